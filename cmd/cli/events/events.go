@@ -2,10 +2,16 @@ package main
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"os/signal"
 	"prevtorrent/internal/platform/container"
+	"prevtorrent/internal/platform/health"
+	"prevtorrent/internal/platform/metrics"
+	"prevtorrent/internal/platform/services"
+	"prevtorrent/internal/platform/tracing"
 	"syscall"
+	"time"
 )
 
 func main() {
@@ -13,17 +19,63 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	if err := container.RequireSharedDriver(c.Config()); err != nil {
+		panic(err)
+	}
+
+	shutdownTracing, err := tracing.Start(context.Background(), c.Config().Tracing(), "events")
+	if err != nil {
+		panic(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	s, err := services.NewServices(c)
+	if err != nil {
+		panic(err)
+	}
 
 	router := c.CQRSRouter()
 
 	ctx, cancelCtx := context.WithCancel(context.Background())
 	go gracefulShutdown(cancelCtx)
+	go s.RetryDownload().Run(ctx, c.Config().RetryPollInterval)
+	go c.OutboxRelay().Run(ctx, c.Config().OutboxPollInterval)
+	go c.Deduplicator().Run(ctx, c.Config().DedupRetention)
+	go c.EventLogPruner().Run(ctx, c.Config().PieceEventRetention)
+	go s.DispatchWebhooks().Run(ctx, c.Config().WebhookPollInterval)
+	go func() {
+		if err := serveOperations(ctx, c.Config().MetricsAddress, c.HealthChecker()); err != nil {
+			c.Logger().WithError(err).Error("unable to serve the metrics and the probes")
+		}
+	}()
 
 	if err := router.Run(ctx); err != nil {
 		panic(err)
 	}
 }
 
+// serveOperations listens on the address with the metrics and the probes until the context is
+// cancelled. The events binary has no API, so it has its own listener for them
+func serveOperations(ctx context.Context, address string, checker *health.Checker) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", health.LiveHandler())
+	mux.Handle("/readyz", health.ReadyHandler(checker))
+	srv := &http.Server{Addr: address, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
 func gracefulShutdown(cancelCtx context.CancelFunc) {
 	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM)
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"prevtorrent/internal/platform/container"
+	"prevtorrent/internal/platform/services"
+	"prevtorrent/internal/platform/tracing"
 	"prevtorrent/internal/preview/platform/cli"
 )
 
@@ -12,9 +15,33 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := container.RequireSharedDriver(c.Config()); err != nil {
+		log.Fatal(err)
+	}
+
+	shutdownTracing, err := tracing.Start(context.Background(), c.Config().Tracing(), "torrentprev")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s, err := services.NewServices(c)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	err = cli.Run(os.Args, c.CommandBus())
+	err = cli.Run(os.Args, lazyCommandBus{c: c}, &s)
+	_ = shutdownTracing(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+// lazyCommandBus builds the command bus on the first command, so the commands that do not use
+// it, like preview-local, do not start the BitTorrent client
+type lazyCommandBus struct {
+	c container.Container
+}
+
+func (b lazyCommandBus) Send(ctx context.Context, cmd interface{}) error {
+	return b.c.CommandBus().Send(ctx, cmd)
+}
@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"prevtorrent/internal/platform/container"
 	"prevtorrent/internal/platform/services"
+	"prevtorrent/internal/platform/tracing"
 	"prevtorrent/internal/preview/platform/http"
 	"syscall"
 	"time"
@@ -26,9 +27,18 @@ func run() error {
 	if err != nil {
 		return err
 	}
+	if err := container.RequireSharedDriver(c.Config()); err != nil {
+		return err
+	}
 
 	c.Config().Print(os.Stdout)
 
+	shutdownTracing, err := tracing.Start(context.Background(), c.Config().Tracing(), "http")
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
 	s, err := services.NewServices(c)
 	if err != nil {
 		return err
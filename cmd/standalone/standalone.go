@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log"
+	http2 "net/http"
+	"os"
+	"os/signal"
+	"prevtorrent/internal/platform/container"
+	"prevtorrent/internal/platform/services"
+	"prevtorrent/internal/platform/tracing"
+	"prevtorrent/internal/preview/platform/http"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// standalone runs the HTTP API, the command and event handlers and the retries in a single process.
+// Meant to be used with PubSubDriver memory or sqlite, so no message broker is needed
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	c, err := container.NewDefaultContainer()
+	if err != nil {
+		return err
+	}
+
+	c.Config().Print(os.Stdout)
+	if driver := c.Config().PubSubDriver; driver != "memory" && driver != "sqlite" {
+		c.Logger().WithField("PubSubDriver", driver).
+			Warn("running standalone with an external message broker. Set PubSubDriver to memory or sqlite to run without it")
+	}
+
+	shutdownTracing, err := tracing.Start(context.Background(), c.Config().Tracing(), "standalone")
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	s, err := services.NewServices(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+
+	router := c.CQRSRouter()
+	routerErr := make(chan error, 1)
+	go func() {
+		routerErr <- router.Run(ctx)
+	}()
+
+	// The in-memory driver drops the messages published before the handlers subscribe
+	select {
+	case <-router.Running():
+	case err := <-routerErr:
+		return err
+	}
+
+	go s.RetryDownload().Run(ctx, c.Config().RetryPollInterval)
+	go c.OutboxRelay().Run(ctx, c.Config().OutboxPollInterval)
+	go c.Deduplicator().Run(ctx, c.Config().DedupRetention)
+	go c.EventLogPruner().Run(ctx, c.Config().PieceEventRetention)
+	go s.DispatchWebhooks().Run(ctx, c.Config().WebhookPollInterval)
+
+	srv := http.Run(s)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http2.ErrServerClosed {
+			c.Logger().Errorf("listen: %s\n", err)
+		}
+	}()
+
+	waitForGracefulShutdown(c.Logger(), srv)
+	cancelCtx()
+
+	return <-routerErr
+}
+
+func waitForGracefulShutdown(logger *logrus.Logger, srv *http2.Server) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	logger.Info("Shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Errorf("Server forced to shutdown: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ module prevtorrent
 go 1.15
 
 require (
+	cloud.google.com/go/pubsub v1.6.1
 	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/ThreeDotsLabs/watermill v1.2.0-rc.3
 	github.com/ThreeDotsLabs/watermill-amqp v1.1.0
@@ -15,17 +16,23 @@ require (
 	github.com/go-playground/validator/v10 v10.4.1 // indirect
 	github.com/google/uuid v1.2.0
 	github.com/huandu/go-sqlbuilder v1.11.0
-	github.com/json-iterator/go v1.1.10 // indirect
 	github.com/leodido/go-urn v1.2.1 // indirect
 	github.com/lithammer/shortuuid/v3 v3.0.5 // indirect
 	github.com/mattn/go-sqlite3 v2.0.2+incompatible
 	github.com/pkg/errors v0.9.1
-	github.com/sirupsen/logrus v1.4.2
+	github.com/prometheus/client_golang v1.11.0
+	github.com/sirupsen/logrus v1.6.0
 	github.com/spf13/viper v1.7.1
-	github.com/stretchr/testify v1.6.1
+	github.com/streadway/amqp v0.0.0-20190404075320-75d898a42a94
+	github.com/stretchr/testify v1.7.0
 	github.com/ugorji/go v1.2.4 // indirect
 	github.com/urfave/cli/v2 v2.3.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 	golang.org/x/crypto v0.0.0-20210218145215-b8e89b74b9df // indirect
-	golang.org/x/sys v0.0.0-20210218155724-8ebf48af031b // indirect
+	google.golang.org/api v0.30.0
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
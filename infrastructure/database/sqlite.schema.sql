@@ -5,6 +5,8 @@ CREATE TABLE IF NOT EXISTS torrents
     length      INT         NOT NULL,
     pieceLength INT         NOT NULL,
     raw         BLOB        NOT NULL,
+    status      VARCHAR(20) NOT NULL DEFAULT 'resolving',
+    last_error  TEXT        NOT NULL DEFAULT '',
     created_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
 
     PRIMARY KEY (id)
@@ -35,3 +37,171 @@ CREATE TABLE IF NOT EXISTS media
     UNIQUE (torrent_id, file_id, name)
 );
 CREATE INDEX IF NOT EXISTS media_torrent_id_file_id ON media (torrent_id, file_id);
+
+CREATE TABLE IF NOT EXISTS progress
+(
+    torrent_id   varchar(40) NOT NULL,
+    piece_length INT         NOT NULL,
+    ranges       TEXT        NOT NULL,
+    pieces       TEXT        NOT NULL,
+    plans        TEXT        NOT NULL,
+    active_peers INT         NOT NULL,
+    seeders      INT         NOT NULL,
+    started_at   DATETIME    NOT NULL,
+    updated_at   DATETIME    NOT NULL,
+    version      INT         NOT NULL,
+    PRIMARY KEY (torrent_id),
+    FOREIGN KEY (torrent_id) REFERENCES torrents (id)
+);
+
+CREATE TABLE IF NOT EXISTS retries
+(
+    torrent_id      varchar(40) NOT NULL,
+    attempts        INT         NOT NULL,
+    next_attempt_at DATETIME    NOT NULL,
+    pending         TEXT        NOT NULL,
+    last_error      TEXT        NOT NULL,
+    version         INT         NOT NULL,
+    PRIMARY KEY (torrent_id),
+    FOREIGN KEY (torrent_id) REFERENCES torrents (id)
+);
+CREATE INDEX IF NOT EXISTS retries_next_attempt_at ON retries (next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS clips
+(
+    torrent_id varchar(40) NOT NULL,
+    file_id    int         NOT NULL,
+    name       TEXT        NOT NULL,
+    duration   INT         NOT NULL,
+    length     INT         NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (torrent_id, file_id, name),
+    FOREIGN KEY (torrent_id, file_id) REFERENCES files (torrent_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS queue_messages
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    uuid       VARCHAR(36) NOT NULL,
+    topic      TEXT        NOT NULL,
+    payload    BLOB        NOT NULL,
+    metadata   TEXT        NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS queue_consumer_groups
+(
+    topic          TEXT NOT NULL,
+    consumer_group TEXT NOT NULL,
+    created_at     DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (topic, consumer_group)
+);
+
+CREATE TABLE IF NOT EXISTS queue_deliveries
+(
+    message_id     INTEGER NOT NULL,
+    consumer_group TEXT    NOT NULL,
+    visible_at     INTEGER NOT NULL, -- unix milliseconds
+    attempts       INT     NOT NULL DEFAULT 0,
+    PRIMARY KEY (message_id, consumer_group),
+    FOREIGN KEY (message_id) REFERENCES queue_messages (id)
+);
+CREATE INDEX IF NOT EXISTS queue_deliveries_consumer_group_visible_at ON queue_deliveries (consumer_group, visible_at);
+
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    uuid       VARCHAR(36) NOT NULL,
+    name       TEXT        NOT NULL,
+    payload    BLOB        NOT NULL,
+    metadata   TEXT        NOT NULL DEFAULT '{}', -- JSON object, see tracing.Inject
+    attempts   INT         NOT NULL DEFAULT 0,
+    last_error TEXT        NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Messages of the outbox that failed to be published too many times, kept to be inspected
+CREATE TABLE IF NOT EXISTS outbox_dead_letters
+(
+    id         INTEGER PRIMARY KEY,
+    uuid       VARCHAR(36) NOT NULL,
+    name       TEXT        NOT NULL,
+    payload    BLOB        NOT NULL,
+    metadata   TEXT        NOT NULL DEFAULT '{}',
+    attempts   INT         NOT NULL DEFAULT 0,
+    last_error TEXT        NOT NULL DEFAULT '',
+    dead_at    DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS processed_messages
+(
+    handler       TEXT     NOT NULL,
+    message_key   TEXT     NOT NULL,
+    processed_at  DATETIME NULL,
+    claimed_until DATETIME NOT NULL,
+    PRIMARY KEY (handler, message_key)
+);
+CREATE INDEX IF NOT EXISTS processed_messages_processed_at ON processed_messages (processed_at);
+
+CREATE TABLE IF NOT EXISTS sagas
+(
+    torrent_id  varchar(40) NOT NULL,
+    parts       INT         NOT NULL,
+    succeeded   INT         NOT NULL,
+    failed      INT         NOT NULL,
+    last_error  TEXT        NOT NULL,
+    started_at  DATETIME    NOT NULL,
+    finished_at DATETIME    NOT NULL,
+    version     INT         NOT NULL,
+    PRIMARY KEY (torrent_id),
+    FOREIGN KEY (torrent_id) REFERENCES torrents (id)
+);
+
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id         VARCHAR(36) NOT NULL,
+    url        TEXT        NOT NULL,
+    secret     TEXT        NOT NULL,
+    torrent_id varchar(40) NOT NULL, -- empty for every torrent
+    events     TEXT        NOT NULL, -- JSON array, empty for every event
+    created_at DATETIME    NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS webhooks_torrent_id ON webhooks (torrent_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              VARCHAR(36) NOT NULL,
+    webhook_id      VARCHAR(36) NOT NULL,
+    event           TEXT        NOT NULL,
+    torrent_id      varchar(40) NOT NULL,
+    payload         BLOB        NOT NULL,
+    status          TEXT        NOT NULL,
+    attempts        INT         NOT NULL,
+    next_attempt_at DATETIME    NOT NULL,
+    response_status INT         NOT NULL,
+    last_error      TEXT        NOT NULL,
+    created_at      DATETIME    NOT NULL,
+    delivered_at    DATETIME    NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (webhook_id) REFERENCES webhooks (id)
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_status_next_attempt_at ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, created_at);
+
+CREATE TABLE IF NOT EXISTS event_log
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    uuid        VARCHAR(36) NOT NULL UNIQUE,
+    name        TEXT        NOT NULL,
+    payload     BLOB        NOT NULL,
+    recorded_at DATETIME    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS event_log_name_recorded_at ON event_log (name, recorded_at);
+
+CREATE TABLE IF NOT EXISTS stats
+(
+    counter TEXT NOT NULL,
+    value   INT  NOT NULL,
+    PRIMARY KEY (counter)
+);
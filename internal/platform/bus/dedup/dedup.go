@@ -0,0 +1,224 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/sirupsen/logrus"
+)
+
+// KeyMetadata is the metadata of the message holding the idempotency key of the command
+const KeyMetadata = "idempotency_key"
+
+const purgeInterval = time.Hour
+
+// DefaultClaimLease is how long a message stays claimed if the process handling it stops. The claim is
+// renewed while the handler runs, so it does not bound how long the handler may take
+const DefaultClaimLease = time.Minute
+
+// ErrClaimed is returned when another delivery of the message is still being handled after waiting
+// for it. The broker delivers it again later, and it is skipped if the other delivery succeeded
+var ErrClaimed = errors.New("the message is being handled by another delivery")
+
+// Keyed is implemented by the commands that may be sent more than once on purpose, like retries.
+// Messages with the same key are handled only once, whatever their UUID
+type Keyed interface {
+	DeduplicationKey() string
+}
+
+// Marshaler adds the key of the Keyed commands to the messages
+type Marshaler struct {
+	cqrs.CommandEventMarshaler
+}
+
+func (m Marshaler) Marshal(v interface{}) (*message.Message, error) {
+	msg, err := m.CommandEventMarshaler.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if keyed, ok := v.(Keyed); ok && keyed.DeduplicationKey() != "" {
+		msg.Metadata.Set(KeyMetadata, keyed.DeduplicationKey())
+	}
+	return msg, nil
+}
+
+// Key returns the idempotency key of the message, or its UUID if it has none
+func Key(msg *message.Message) string {
+	if key := msg.Metadata.Get(KeyMetadata); key != "" {
+		return key
+	}
+	return msg.UUID
+}
+
+//go:generate mockery --case=snake --outpkg=dedupmocks --output=dedupmocks --name=Store
+type Store interface {
+	Processed(ctx context.Context, handler, key string) (bool, error)
+	// Claim reserves the message for the handler until the given time. It returns false if the
+	// message is already claimed or processed
+	Claim(ctx context.Context, handler, key string, until time.Time) (bool, error)
+	// Renew extends the claim of a message not processed until the given time
+	Renew(ctx context.Context, handler, key string, until time.Time) error
+	// Release removes the claim of a message not processed
+	Release(ctx context.Context, handler, key string) error
+	MarkProcessed(ctx context.Context, handler, key string) error
+	// Purge forgets the messages processed before the given time
+	Purge(ctx context.Context, before time.Time) error
+}
+
+// Deduplicator skips the messages already processed by a handler. The brokers deliver the messages
+// at least once, so the same message may reach a handler again after being acked
+type Deduplicator struct {
+	logger *logrus.Logger
+	store  Store
+	lease  time.Duration
+}
+
+func NewDeduplicator(logger *logrus.Logger, store Store, lease time.Duration) *Deduplicator {
+	return &Deduplicator{logger: logger, store: store, lease: lease}
+}
+
+// Middleware is the router middleware. The message is claimed before calling the handler, so
+// concurrent deliveries of it are not handled twice, and marked as processed once the handler
+// succeeds. The claim is renewed while the handler runs, and released if the handler fails or panics
+func (d *Deduplicator) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) (produced []*message.Message, err error) {
+		ctx := msg.Context()
+		handler := message.HandlerNameFromCtx(ctx)
+		key := Key(msg)
+
+		processed, err := d.store.Processed(ctx, handler, key)
+		if err != nil {
+			return nil, err
+		}
+		if processed {
+			d.logger.WithContext(ctx).WithFields(logrus.Fields{
+				"handler": handler,
+				"key":     key,
+			}).Info("message already processed, skipping it")
+			return nil, nil
+		}
+
+		claimed, err := d.store.Claim(ctx, handler, key, time.Now().Add(d.lease))
+		if err != nil {
+			return nil, err
+		}
+		if !claimed {
+			return nil, d.waitForTheOtherDelivery(ctx, handler, key)
+		}
+
+		stopRenewing := d.renew(ctx, handler, key)
+		// The Recoverer is outside this middleware, so the claim would be kept until the lease expires
+		defer func() {
+			if p := recover(); p != nil {
+				stopRenewing()
+				d.release(ctx, handler, key)
+				panic(p)
+			}
+		}()
+
+		produced, err = h(msg)
+		stopRenewing()
+		if err != nil {
+			d.release(ctx, handler, key)
+			return produced, err
+		}
+
+		// Failing here would make the broker deliver the message again, the very thing we avoid
+		if err := d.store.MarkProcessed(ctx, handler, key); err != nil {
+			d.logger.WithContext(ctx).WithFields(logrus.Fields{
+				"handler": handler,
+				"key":     key,
+				"error":   err,
+			}).Error("unable to mark the message as processed")
+		}
+		return produced, nil
+	}
+}
+
+// waitForTheOtherDelivery waits for a while, instead of nacking the message at once, so the broker does
+// not deliver it again and again while the other delivery is handled. The message is acked if the other
+// delivery succeeded by then
+func (d *Deduplicator) waitForTheOtherDelivery(ctx context.Context, handler, key string) error {
+	select {
+	case <-time.After(d.lease / 2):
+	case <-ctx.Done():
+		return ErrClaimed
+	}
+
+	processed, err := d.store.Processed(ctx, handler, key)
+	if err != nil {
+		return err
+	}
+	if processed {
+		return nil
+	}
+	return ErrClaimed
+}
+
+// renew extends the claim periodically until the returned func is called
+func (d *Deduplicator) renew(ctx context.Context, handler, key string) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(d.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := d.store.Renew(ctx, handler, key, time.Now().Add(d.lease)); err != nil {
+					d.logger.WithContext(ctx).WithFields(logrus.Fields{
+						"handler": handler,
+						"key":     key,
+						"error":   err,
+					}).Error("unable to renew the claim of the message")
+				}
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+		<-done
+	}
+}
+
+func (d *Deduplicator) release(ctx context.Context, handler, key string) {
+	if err := d.store.Release(ctx, handler, key); err != nil {
+		d.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"handler": handler,
+			"key":     key,
+			"error":   err,
+		}).Error("unable to release the claim of the message")
+	}
+}
+
+// Run forgets the messages processed longer than the retention ago, until the context is cancelled.
+// A message redelivered after that is handled again
+func (d *Deduplicator) Run(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.store.Purge(ctx, time.Now().Add(-retention)); err != nil {
+				d.logger.WithFields(logrus.Fields{
+					"error": err,
+				}).Error("unable to purge the processed messages")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
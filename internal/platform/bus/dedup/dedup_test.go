@@ -0,0 +1,155 @@
+package dedup_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/platform/bus/dedup"
+	"prevtorrent/internal/platform/bus/dedup/dedupmocks"
+	"prevtorrent/internal/preview/downloadPartials"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicator_HandlesNewMessages(t *testing.T) {
+	store := new(dedupmocks.Store)
+	store.On("Processed", mock.Anything, mock.Anything, "uuid-1").Return(false, nil)
+	store.On("Claim", mock.Anything, mock.Anything, "uuid-1", mock.Anything).Return(true, nil)
+	store.On("MarkProcessed", mock.Anything, mock.Anything, "uuid-1").Return(nil)
+
+	handled := 0
+	h := dedup.NewDeduplicator(fakeLogger(), store, lease).Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		handled++
+		return nil, nil
+	})
+
+	_, err := h(message.NewMessage("uuid-1", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 1, handled)
+	store.AssertExpectations(t)
+}
+
+func TestDeduplicator_SkipsProcessedMessages(t *testing.T) {
+	store := new(dedupmocks.Store)
+	store.On("Processed", mock.Anything, mock.Anything, "uuid-1").Return(true, nil)
+
+	h := dedup.NewDeduplicator(fakeLogger(), store, lease).Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		t.Fatal("the message has already been processed")
+		return nil, nil
+	})
+
+	_, err := h(message.NewMessage("uuid-1", nil))
+	require.NoError(t, err)
+	store.AssertNotCalled(t, "MarkProcessed", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeduplicator_MessagesClaimedByAnotherDeliveryAreRedelivered(t *testing.T) {
+	store := new(dedupmocks.Store)
+	store.On("Processed", mock.Anything, mock.Anything, "uuid-1").Return(false, nil)
+	store.On("Claim", mock.Anything, mock.Anything, "uuid-1", mock.Anything).Return(false, nil)
+
+	h := dedup.NewDeduplicator(fakeLogger(), store, lease).Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		t.Fatal("the message is being handled by another delivery")
+		return nil, nil
+	})
+
+	_, err := h(message.NewMessage("uuid-1", nil))
+	require.True(t, errors.Is(err, dedup.ErrClaimed))
+	store.AssertNotCalled(t, "MarkProcessed", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeduplicator_MessagesProcessedByAnotherDeliveryWhileWaitingAreAcked(t *testing.T) {
+	store := new(dedupmocks.Store)
+	store.On("Processed", mock.Anything, mock.Anything, "uuid-1").Return(false, nil).Once()
+	store.On("Claim", mock.Anything, mock.Anything, "uuid-1", mock.Anything).Return(false, nil)
+	store.On("Processed", mock.Anything, mock.Anything, "uuid-1").Return(true, nil).Once()
+
+	h := dedup.NewDeduplicator(fakeLogger(), store, lease).Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		t.Fatal("the message is being handled by another delivery")
+		return nil, nil
+	})
+
+	_, err := h(message.NewMessage("uuid-1", nil))
+	require.NoError(t, err)
+	store.AssertExpectations(t)
+}
+
+func TestDeduplicator_ClaimIsRenewedWhileHandling(t *testing.T) {
+	store := new(dedupmocks.Store)
+	store.On("Processed", mock.Anything, mock.Anything, "uuid-1").Return(false, nil)
+	store.On("Claim", mock.Anything, mock.Anything, "uuid-1", mock.Anything).Return(true, nil)
+	store.On("Renew", mock.Anything, mock.Anything, "uuid-1", mock.Anything).Return(nil)
+	store.On("MarkProcessed", mock.Anything, mock.Anything, "uuid-1").Return(nil)
+
+	h := dedup.NewDeduplicator(fakeLogger(), store, lease).Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		// Longer than the lease
+		time.Sleep(2 * lease)
+		return nil, nil
+	})
+
+	_, err := h(message.NewMessage("uuid-1", nil))
+	require.NoError(t, err)
+	store.AssertExpectations(t)
+}
+
+func TestDeduplicator_PanickedMessagesAreReleased(t *testing.T) {
+	store := new(dedupmocks.Store)
+	store.On("Processed", mock.Anything, mock.Anything, "uuid-1").Return(false, nil)
+	store.On("Claim", mock.Anything, mock.Anything, "uuid-1", mock.Anything).Return(true, nil)
+	store.On("Release", mock.Anything, mock.Anything, "uuid-1").Return(nil)
+
+	h := dedup.NewDeduplicator(fakeLogger(), store, lease).Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		panic("fake panic")
+	})
+
+	assert.Panics(t, func() {
+		_, _ = h(message.NewMessage("uuid-1", nil))
+	})
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "MarkProcessed", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeduplicator_FailedMessagesAreReleased(t *testing.T) {
+	store := new(dedupmocks.Store)
+	store.On("Processed", mock.Anything, mock.Anything, "uuid-1").Return(false, nil)
+	store.On("Claim", mock.Anything, mock.Anything, "uuid-1", mock.Anything).Return(true, nil)
+	store.On("Release", mock.Anything, mock.Anything, "uuid-1").Return(nil)
+
+	h := dedup.NewDeduplicator(fakeLogger(), store, lease).Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, errors.New("fake error")
+	})
+
+	_, err := h(message.NewMessage("uuid-1", nil))
+	require.Error(t, err)
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "MarkProcessed", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMarshaler_AddsTheKeyOfTheCommand(t *testing.T) {
+	marshaler := dedup.Marshaler{CommandEventMarshaler: cqrs.JSONMarshaler{}}
+
+	cmd := downloadPartials.CMD{ID: "cb84", IdempotencyKey: "retry/cb84/1/0"}
+	msg, err := marshaler.Marshal(cmd)
+	require.NoError(t, err)
+	assert.Equal(t, "retry/cb84/1/0", dedup.Key(msg))
+	assert.Equal(t, "downloadPartials.CMD", msg.Metadata.Get("name"))
+
+	// Without a key, every message is different
+	msg, err = marshaler.Marshal(downloadPartials.CMD{ID: "cb84"})
+	require.NoError(t, err)
+	assert.Equal(t, msg.UUID, dedup.Key(msg))
+}
+
+const lease = 30 * time.Millisecond
+
+func fakeLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
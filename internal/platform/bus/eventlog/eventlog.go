@@ -0,0 +1,58 @@
+package eventlog
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Record is an event appended to the log
+type Record struct {
+	ID         int64
+	UUID       string
+	Name       string // name of the event, as given by the cqrs marshaler
+	Payload    []byte // event encoded in JSON
+	RecordedAt time.Time
+}
+
+//go:generate mockery --case=snake --outpkg=eventlogmocks --output=eventlogmocks --name=Store
+type Store interface {
+	// Append adds the records at the end of the log. A record whose UUID is already in the log is ignored
+	Append(ctx context.Context, records ...Record) error
+	// Read returns, in order, up to limit records appended after the given ID
+	Read(ctx context.Context, afterID int64, limit int) ([]Record, error)
+	// Purge removes the records with the given name recorded before the given time
+	Purge(ctx context.Context, name string, before time.Time) error
+}
+
+// Publisher appends the events to the log before publishing them. If they cannot be appended they
+// are not published either, so the publisher of the event sends them again
+type Publisher struct {
+	message.Publisher
+	store     Store
+	marshaler cqrs.CommandEventMarshaler
+}
+
+func NewPublisher(publisher message.Publisher, store Store, marshaler cqrs.CommandEventMarshaler) *Publisher {
+	return &Publisher{Publisher: publisher, store: store, marshaler: marshaler}
+}
+
+func (p *Publisher) Publish(topic string, messages ...*message.Message) error {
+	now := time.Now()
+	records := make([]Record, 0, len(messages))
+	for _, msg := range messages {
+		records = append(records, Record{
+			UUID:       msg.UUID,
+			Name:       p.marshaler.NameFromMessage(msg),
+			Payload:    msg.Payload,
+			RecordedAt: now,
+		})
+	}
+
+	if err := p.store.Append(context.Background(), records...); err != nil {
+		return err
+	}
+	return p.Publisher.Publish(topic, messages...)
+}
@@ -0,0 +1,70 @@
+package eventlog_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/platform/bus/eventlog"
+	"prevtorrent/internal/platform/bus/eventlog/eventlogmocks"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher_AppendsBeforePublishing(t *testing.T) {
+	msg := message.NewMessage("uuid-1", []byte(`{"TorrentID":"cb84"}`))
+	msg.Metadata.Set("name", "preview.TorrentCreatedEvent")
+
+	store := new(eventlogmocks.Store)
+	store.On("Append", mock.Anything, mock.MatchedBy(func(r eventlog.Record) bool {
+		return r.UUID == "uuid-1" &&
+			r.Name == "preview.TorrentCreatedEvent" &&
+			string(r.Payload) == `{"TorrentID":"cb84"}` &&
+			!r.RecordedAt.IsZero()
+	})).Return(nil)
+
+	next := new(fakePublisher)
+	publisher := eventlog.NewPublisher(next, store, cqrs.JSONMarshaler{})
+
+	require.NoError(t, publisher.Publish("preview.TorrentCreatedEvent", msg))
+	require.Len(t, next.published, 1)
+	assert.Equal(t, "uuid-1", next.published[0].UUID)
+	store.AssertExpectations(t)
+}
+
+func TestPublisher_DoesNotPublishWhatIsNotLogged(t *testing.T) {
+	appendErr := errors.New("database is locked")
+
+	store := new(eventlogmocks.Store)
+	store.On("Append", mock.Anything, mock.Anything).Return(appendErr)
+
+	next := new(fakePublisher)
+	publisher := eventlog.NewPublisher(next, store, cqrs.JSONMarshaler{})
+
+	err := publisher.Publish("preview.TorrentCreatedEvent", message.NewMessage("uuid-1", []byte(`{}`)))
+	require.True(t, errors.Is(err, appendErr))
+	assert.Empty(t, next.published)
+}
+
+type fakePublisher struct {
+	published []*message.Message
+}
+
+func (p *fakePublisher) Publish(topic string, messages ...*message.Message) error {
+	p.published = append(p.published, messages...)
+	return nil
+}
+
+func (p *fakePublisher) Close() error {
+	return nil
+}
+
+func fakeLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
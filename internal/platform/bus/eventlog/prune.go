@@ -0,0 +1,52 @@
+package eventlog
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const pruneInterval = time.Hour
+
+// Pruner removes from the log the events that are only needed for a while, like the ones published
+// for every piece downloaded. The projections must not need them once the retention has passed
+type Pruner struct {
+	logger *logrus.Logger
+	store  Store
+	names  []string
+}
+
+// NewPruner returns a Pruner of the events with the given names, as given by the cqrs marshaler
+func NewPruner(logger *logrus.Logger, store Store, names ...string) *Pruner {
+	return &Pruner{logger: logger, store: store, names: names}
+}
+
+// Prune removes the events recorded before the given time
+func (p *Pruner) Prune(ctx context.Context, before time.Time) error {
+	for _, name := range p.names {
+		if err := p.store.Purge(ctx, name, before); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run removes the events recorded longer than the retention ago, until the context is cancelled
+func (p *Pruner) Run(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Prune(ctx, time.Now().Add(-retention)); err != nil {
+				p.logger.WithFields(logrus.Fields{
+					"error": err,
+				}).Error("unable to prune the event log")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package eventlog_test
+
+import (
+	"context"
+	"errors"
+	"prevtorrent/internal/platform/bus/eventlog"
+	"prevtorrent/internal/platform/bus/eventlog/eventlogmocks"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruner_Prune(t *testing.T) {
+	before := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	store := new(eventlogmocks.Store)
+	store.On("Purge", context.Background(), "preview.PieceCompletedEvent", before).Return(nil)
+
+	pruner := eventlog.NewPruner(fakeLogger(), store, "preview.PieceCompletedEvent")
+	require.NoError(t, pruner.Prune(context.Background(), before))
+	store.AssertExpectations(t)
+}
+
+func TestPruner_Prune_Error(t *testing.T) {
+	store := new(eventlogmocks.Store)
+	store.On("Purge", context.Background(), "preview.PieceCompletedEvent", time.Time{}).Return(errors.New("database is locked"))
+
+	pruner := eventlog.NewPruner(fakeLogger(), store, "preview.PieceCompletedEvent")
+	require.Error(t, pruner.Prune(context.Background(), time.Time{}))
+}
@@ -0,0 +1,140 @@
+package eventlog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/sirupsen/logrus"
+)
+
+const batchSize = 500
+
+// Projection is a read model built only from events, thus it can be rebuilt from the log. The state
+// changed by the commands, like the status of the torrents, is not one
+type Projection struct {
+	name     string
+	reset    func(ctx context.Context) error
+	handlers []cqrs.EventHandler
+}
+
+// NewProjection returns a projection kept up to date by the handlers given. reset must remove
+// everything the handlers have stored
+func NewProjection(name string, reset func(ctx context.Context) error, handlers ...cqrs.EventHandler) Projection {
+	return Projection{name: name, reset: reset, handlers: handlers}
+}
+
+func (p Projection) Name() string {
+	return p.name
+}
+
+// Replayer rebuilds the projections reading the whole log. The handlers of the projections must
+// be stopped meanwhile, otherwise the events they handle might be applied twice
+type Replayer struct {
+	logger      *logrus.Logger
+	store       Store
+	marshaler   cqrs.CommandEventMarshaler
+	projections []Projection
+}
+
+func NewReplayer(logger *logrus.Logger, store Store, marshaler cqrs.CommandEventMarshaler, projections ...Projection) *Replayer {
+	return &Replayer{logger: logger, store: store, marshaler: marshaler, projections: projections}
+}
+
+// Projections returns the names of the projections that can be rebuilt
+func (r *Replayer) Projections() []string {
+	names := make([]string, 0, len(r.projections))
+	for _, p := range r.projections {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+// Replay resets the projections with the given names, all of them if none, and applies every event
+// of the log to them. It stops on the first event a handler fails to apply. It returns the number
+// of events read
+func (r *Replayer) Replay(ctx context.Context, names ...string) (int, error) {
+	projections, err := r.selectProjections(names)
+	if err != nil {
+		return 0, err
+	}
+
+	handlers := make(map[string][]cqrs.EventHandler)
+	for _, p := range projections {
+		if err := p.reset(ctx); err != nil {
+			return 0, fmt.Errorf("unable to reset the projection %v: %w", p.name, err)
+		}
+		for _, h := range p.handlers {
+			name := r.marshaler.Name(h.NewEvent())
+			handlers[name] = append(handlers[name], h)
+		}
+	}
+
+	var read int
+	var lastID int64
+	for {
+		records, err := r.store.Read(ctx, lastID, batchSize)
+		if err != nil {
+			return read, err
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		for _, record := range records {
+			if err := r.apply(ctx, record, handlers[record.Name]); err != nil {
+				return read, fmt.Errorf("unable to replay the event %v (%v): %w", record.ID, record.Name, err)
+			}
+			lastID = record.ID
+			read++
+		}
+
+		r.logger.WithFields(logrus.Fields{
+			"events": read,
+			"lastID": lastID,
+		}).Debug("events replayed")
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"events":      read,
+		"projections": names,
+	}).Info("projections rebuilt")
+	return read, nil
+}
+
+func (r *Replayer) apply(ctx context.Context, record Record, handlers []cqrs.EventHandler) error {
+	for _, h := range handlers {
+		msg := message.NewMessage(record.UUID, record.Payload)
+		event := h.NewEvent()
+		if err := r.marshaler.Unmarshal(msg, event); err != nil {
+			return err
+		}
+		if err := h.Handle(ctx, event); err != nil {
+			return fmt.Errorf("%v: %w", h.HandlerName(), err)
+		}
+	}
+	return nil
+}
+
+func (r *Replayer) selectProjections(names []string) ([]Projection, error) {
+	if len(names) == 0 {
+		return r.projections, nil
+	}
+
+	byName := make(map[string]Projection)
+	for _, p := range r.projections {
+		byName[p.name] = p
+	}
+
+	selected := make([]Projection, 0, len(names))
+	for _, name := range names {
+		p, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown projection %q. Available: %v", name, strings.Join(r.Projections(), ", "))
+		}
+		selected = append(selected, p)
+	}
+	return selected, nil
+}
@@ -0,0 +1,100 @@
+package eventlog_test
+
+import (
+	"context"
+	"errors"
+	"prevtorrent/internal/platform/bus/eventlog"
+	"prevtorrent/internal/platform/bus/eventlog/eventlogmocks"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type createdEvent struct {
+	TorrentID string
+}
+
+func TestReplayer_Replay(t *testing.T) {
+	store := new(eventlogmocks.Store)
+	store.On("Read", mock.Anything, int64(0), mock.Anything).Return([]eventlog.Record{
+		{ID: 1, UUID: "uuid-1", Name: "eventlog_test.createdEvent", Payload: []byte(`{"TorrentID":"cb84"}`)},
+		// Nobody handles it, thus it is skipped
+		{ID: 2, UUID: "uuid-2", Name: "eventlog_test.deletedEvent", Payload: []byte(`{"TorrentID":"cb84"}`)},
+	}, nil)
+	store.On("Read", mock.Anything, int64(2), mock.Anything).Return([]eventlog.Record{
+		{ID: 3, UUID: "uuid-3", Name: "eventlog_test.createdEvent", Payload: []byte(`{"TorrentID":"zocm"}`)},
+	}, nil)
+	store.On("Read", mock.Anything, int64(3), mock.Anything).Return(nil, nil)
+
+	var resets int
+	handler := &fakeHandler{}
+	projection := eventlog.NewProjection("torrents", func(ctx context.Context) error {
+		resets++
+		return nil
+	}, handler)
+
+	replayer := eventlog.NewReplayer(fakeLogger(), store, cqrs.JSONMarshaler{}, projection)
+	read, err := replayer.Replay(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, read)
+	assert.Equal(t, 1, resets)
+	assert.Equal(t, []string{"cb84", "zocm"}, handler.handled)
+	store.AssertExpectations(t)
+}
+
+func TestReplayer_Replay_StopsOnFailure(t *testing.T) {
+	store := new(eventlogmocks.Store)
+	store.On("Read", mock.Anything, int64(0), mock.Anything).Return([]eventlog.Record{
+		{ID: 1, UUID: "uuid-1", Name: "eventlog_test.createdEvent", Payload: []byte(`{"TorrentID":"cb84"}`)},
+		{ID: 2, UUID: "uuid-2", Name: "eventlog_test.createdEvent", Payload: []byte(`{"TorrentID":"zocm"}`)},
+	}, nil)
+
+	handlerErr := errors.New("database is locked")
+	projection := eventlog.NewProjection("torrents", noReset, &fakeHandler{err: handlerErr})
+
+	replayer := eventlog.NewReplayer(fakeLogger(), store, cqrs.JSONMarshaler{}, projection)
+	read, err := replayer.Replay(context.Background())
+
+	require.True(t, errors.Is(err, handlerErr))
+	assert.Equal(t, 0, read)
+}
+
+func TestReplayer_Replay_UnknownProjection(t *testing.T) {
+	store := new(eventlogmocks.Store)
+	replayer := eventlog.NewReplayer(fakeLogger(), store, cqrs.JSONMarshaler{},
+		eventlog.NewProjection("torrents", noReset, &fakeHandler{}))
+
+	_, err := replayer.Replay(context.Background(), "stats")
+	require.Error(t, err)
+	store.AssertNotCalled(t, "Read", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func noReset(context.Context) error {
+	return nil
+}
+
+// fakeHandler handles the createdEvent, as the handlers of the cqrs facade do
+type fakeHandler struct {
+	err     error
+	handled []string
+}
+
+func (h *fakeHandler) HandlerName() string {
+	return "event.test.created"
+}
+
+func (h *fakeHandler) NewEvent() interface{} {
+	return new(createdEvent)
+}
+
+func (h *fakeHandler) Handle(ctx context.Context, e interface{}) error {
+	if h.err != nil {
+		return h.err
+	}
+	h.handled = append(h.handled, e.(*createdEvent).TorrentID)
+	return nil
+}
@@ -0,0 +1,135 @@
+package outbox
+
+import (
+	"context"
+	"prevtorrent/internal/platform/metrics"
+	"prevtorrent/internal/platform/tracing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/sirupsen/logrus"
+)
+
+const batchSize = 100
+
+// Message is an event stored in the outbox, waiting to be published
+type Message struct {
+	ID       int64
+	UUID     string
+	Name     string            // name of the event, as given by the cqrs marshaler
+	Payload  []byte            // event encoded in JSON
+	Metadata map[string]string // correlation ID and span of the context the event was stored with
+	Attempts int
+}
+
+//go:generate mockery --case=snake --outpkg=outboxmocks --output=outboxmocks --name=Store
+type Store interface {
+	// Pending returns the oldest messages first
+	Pending(ctx context.Context, limit int) ([]Message, error)
+	Delete(ctx context.Context, id int64) error
+	Failed(ctx context.Context, id int64, reason error) error
+	// DeadLetter moves the message out of the outbox, where it is kept to be inspected but not published
+	DeadLetter(ctx context.Context, m Message, reason error) error
+}
+
+// Relay publishes the messages of the outbox. A message is deleted once published, thus it might
+// be published more than once if the deletion fails: the handlers must be idempotent
+type Relay struct {
+	logger        *logrus.Logger
+	store         Store
+	publisher     message.Publisher
+	generateTopic func(eventName string) string
+	maxAttempts   int // a message that fails this many times is moved to the dead letters
+}
+
+func NewRelay(logger *logrus.Logger, store Store, publisher message.Publisher, generateTopic func(eventName string) string, maxAttempts int) *Relay {
+	return &Relay{
+		logger:        logger,
+		store:         store,
+		publisher:     publisher,
+		generateTopic: generateTopic,
+		maxAttempts:   maxAttempts,
+	}
+}
+
+// Run publishes the pending messages periodically until the context is cancelled
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := r.RelayPending(ctx); err != nil {
+				r.logger.WithFields(logrus.Fields{
+					"error": err,
+				}).Error("unable to publish the messages of the outbox")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RelayPending publishes the pending messages in the order they were stored, and returns how many
+// have been published. It stops at the first failure, so the messages are never published out of order.
+// Unless the message has failed maxAttempts times: it is moved to the dead letters and the next one is published
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		messages, err := r.store.Pending(ctx, batchSize)
+		if err != nil {
+			return published, err
+		}
+
+		for _, m := range messages {
+			if err := r.publish(ctx, m); err != nil {
+				if m.Attempts+1 >= r.maxAttempts {
+					if err := r.deadLetter(ctx, m, err); err != nil {
+						return published, err
+					}
+					continue
+				}
+				if failedErr := r.store.Failed(ctx, m.ID, err); failedErr != nil {
+					r.logger.WithFields(logrus.Fields{
+						"uuid":  m.UUID,
+						"error": failedErr,
+					}).Error("unable to record the failure publishing the message")
+				}
+				return published, err
+			}
+			if err := r.store.Delete(ctx, m.ID); err != nil {
+				return published, err
+			}
+			published++
+		}
+
+		if len(messages) < batchSize {
+			return published, nil
+		}
+	}
+}
+
+func (r *Relay) deadLetter(ctx context.Context, m Message, reason error) error {
+	if err := r.store.DeadLetter(ctx, m, reason); err != nil {
+		return err
+	}
+	metrics.OutboxDeadLetters.WithLabelValues(m.Name).Inc()
+	r.logger.WithContext(tracing.Extract(ctx, m.Metadata)).WithFields(logrus.Fields{
+		"uuid":     m.UUID,
+		"name":     m.Name,
+		"attempts": m.Attempts + 1,
+		"error":    reason,
+	}).Error("message moved to the dead letters of the outbox")
+	return nil
+}
+
+func (r *Relay) publish(ctx context.Context, m Message) error {
+	// The same message the cqrs EventBus would publish, so the handlers read it as any other event
+	msg := message.NewMessage(m.UUID, m.Payload)
+	msg.Metadata.Set("name", m.Name)
+	// The trace goes on from where the event was stored, not from the relay
+	msg.SetContext(tracing.Extract(ctx, m.Metadata))
+
+	return r.publisher.Publish(r.generateTopic(m.Name), msg)
+}
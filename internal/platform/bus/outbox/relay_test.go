@@ -0,0 +1,126 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/platform/bus/outbox"
+	"prevtorrent/internal/platform/bus/outbox/outboxmocks"
+	"prevtorrent/internal/platform/tracing"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelay_RelayPending(t *testing.T) {
+	messages := []outbox.Message{
+		{ID: 1, UUID: "uuid-1", Name: "preview.TorrentCreatedEvent", Payload: []byte(`{"TorrentID":"cb84"}`)},
+		{
+			ID:       2,
+			UUID:     "uuid-2",
+			Name:     "preview.TorrentCreatedEvent",
+			Payload:  []byte(`{"TorrentID":"zocm"}`),
+			Metadata: map[string]string{"correlation_id": "c0ffee"},
+		},
+	}
+
+	store := new(outboxmocks.Store)
+	store.On("Pending", mock.Anything, mock.Anything).Return(messages, nil)
+	store.On("Delete", mock.Anything, int64(1)).Return(nil)
+	store.On("Delete", mock.Anything, int64(2)).Return(nil)
+
+	publisher := new(fakePublisher)
+	relay := outbox.NewRelay(fakeLogger(), store, publisher, func(name string) string { return "topic." + name }, 5)
+
+	published, err := relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, published)
+
+	require.Len(t, publisher.published, 2)
+	assert.Equal(t, "topic.preview.TorrentCreatedEvent", publisher.topics[0])
+	assert.Equal(t, "uuid-1", publisher.published[0].UUID)
+	assert.Equal(t, "preview.TorrentCreatedEvent", publisher.published[0].Metadata.Get("name"))
+	assert.Equal(t, message.Payload(`{"TorrentID":"cb84"}`), publisher.published[0].Payload)
+	assert.Equal(t, "uuid-2", publisher.published[1].UUID)
+	assert.Equal(t, "c0ffee", tracing.CorrelationID(publisher.published[1].Context()))
+	store.AssertExpectations(t)
+}
+
+func TestRelay_RelayPending_StopsOnFailure(t *testing.T) {
+	messages := []outbox.Message{
+		{ID: 1, UUID: "uuid-1", Name: "preview.TorrentCreatedEvent", Payload: []byte(`{}`)},
+		{ID: 2, UUID: "uuid-2", Name: "preview.TorrentCreatedEvent", Payload: []byte(`{}`)},
+	}
+	publishErr := errors.New("broker down")
+
+	store := new(outboxmocks.Store)
+	store.On("Pending", mock.Anything, mock.Anything).Return(messages, nil)
+	store.On("Failed", mock.Anything, int64(1), publishErr).Return(nil)
+
+	publisher := &fakePublisher{err: publishErr}
+	relay := outbox.NewRelay(fakeLogger(), store, publisher, func(name string) string { return name }, 5)
+
+	published, err := relay.RelayPending(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, 0, published)
+
+	// The second message must not be published before the first one
+	assert.Len(t, publisher.topics, 1)
+	store.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	store.AssertExpectations(t)
+}
+
+func TestRelay_RelayPending_DeadLettersAfterMaxAttempts(t *testing.T) {
+	messages := []outbox.Message{
+		{ID: 1, UUID: "uuid-1", Name: "preview.TorrentCreatedEvent", Payload: []byte(`{}`), Attempts: 4},
+		{ID: 2, UUID: "uuid-2", Name: "preview.TorrentCreatedEvent", Payload: []byte(`{}`)},
+	}
+	publishErr := errors.New("message too large")
+
+	store := new(outboxmocks.Store)
+	store.On("Pending", mock.Anything, mock.Anything).Return(messages, nil)
+	store.On("DeadLetter", mock.Anything, messages[0], publishErr).Return(nil)
+	store.On("Delete", mock.Anything, int64(2)).Return(nil)
+
+	publisher := &fakePublisher{err: publishErr, failing: "uuid-1"}
+	relay := outbox.NewRelay(fakeLogger(), store, publisher, func(name string) string { return name }, 5)
+
+	published, err := relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+
+	require.Len(t, publisher.published, 1)
+	assert.Equal(t, "uuid-2", publisher.published[0].UUID)
+	store.AssertNotCalled(t, "Failed", mock.Anything, mock.Anything, mock.Anything)
+	store.AssertExpectations(t)
+}
+
+type fakePublisher struct {
+	err       error
+	failing   string // UUID of the only message that fails, all of them if empty
+	topics    []string
+	published []*message.Message
+}
+
+func (p *fakePublisher) Publish(topic string, messages ...*message.Message) error {
+	p.topics = append(p.topics, topic)
+	if p.err != nil && (p.failing == "" || p.failing == messages[0].UUID) {
+		return p.err
+	}
+	p.published = append(p.published, messages...)
+	return nil
+}
+
+func (p *fakePublisher) Close() error {
+	return nil
+}
+
+func fakeLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
@@ -0,0 +1,120 @@
+package sqlqueue
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	sqlMessagesTable       = "queue_messages"
+	sqlConsumerGroupsTable = "queue_consumer_groups"
+	sqlDeliveriesTable     = "queue_deliveries"
+)
+
+var ErrClosed = errors.New("the queue has been closed")
+
+type PublisherConfig struct {
+	// Optional. Consumer group subscribed to every topic the publisher publishes to, so the messages
+	// are kept even if no subscriber has ever been started. Like the durable queues of AMQP
+	ConsumerGroup string
+}
+
+// Publisher stores the messages in SQLite. Each message is delivered once to every consumer group
+// subscribed to its topic at the time of publishing
+type Publisher struct {
+	db     *sql.DB
+	config PublisherConfig
+
+	mux    sync.RWMutex
+	closed bool
+}
+
+func NewPublisher(db *sql.DB, config PublisherConfig) *Publisher {
+	return &Publisher{db: db, config: config}
+}
+
+func (p *Publisher) Publish(topic string, messages ...*message.Message) error {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		if err := p.insert(tx, topic, msg); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *Publisher) insert(tx *sql.Tx, topic string, msg *message.Message) error {
+	metadata, err := json.Marshal(msg.Metadata)
+	if err != nil {
+		return err
+	}
+
+	if p.config.ConsumerGroup != "" {
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO "+sqlConsumerGroupsTable+" (topic, consumer_group) VALUES (?, ?)",
+			topic, p.config.ConsumerGroup,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	payload := []byte(msg.Payload)
+	if payload == nil {
+		payload = []byte{}
+	}
+
+	res, err := tx.Exec(
+		"INSERT INTO "+sqlMessagesTable+" (uuid, topic, payload, metadata) VALUES (?, ?, ?, ?)",
+		msg.UUID, topic, payload, string(metadata),
+	)
+	if err != nil {
+		return err
+	}
+	messageID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	res, err = tx.Exec(
+		"INSERT INTO "+sqlDeliveriesTable+" (message_id, consumer_group, visible_at, attempts) "+
+			"SELECT ?, consumer_group, ?, 0 FROM "+sqlConsumerGroupsTable+" WHERE topic = ?",
+		messageID, toMillis(time.Now()), topic,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Nobody is going to read it
+	if deliveries, err := res.RowsAffected(); err != nil || deliveries > 0 {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM "+sqlMessagesTable+" WHERE id = ?", messageID)
+	return err
+}
+
+func (p *Publisher) Close() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.closed = true
+	return nil
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,223 @@
+package sqlqueue_test
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"prevtorrent/internal/platform/bus/sqlqueue"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const topic = "preview.TorrentCreatedEvent"
+
+func TestQueue_DeliversToEveryConsumerGroup(t *testing.T) {
+	db := newDatabase(t)
+	publisher := sqlqueue.NewPublisher(db, sqlqueue.PublisherConfig{})
+
+	// Nobody is listening yet, thus nobody is going to get it
+	require.NoError(t, publisher.Publish(topic, message.NewMessage("lost", []byte("lost"))))
+
+	first := subscribe(t, db, "first", time.Minute)
+	second := subscribe(t, db, "second", time.Minute)
+
+	msg := message.NewMessage(watermill.NewUUID(), []byte(`{"id":"cb84"}`))
+	msg.Metadata.Set("name", "preview.TorrentCreatedEvent")
+	require.NoError(t, publisher.Publish(topic, msg))
+
+	for _, messages := range []<-chan *message.Message{first, second} {
+		got := receive(t, messages)
+		assert.Equal(t, msg.UUID, got.UUID)
+		assert.Equal(t, msg.Payload, got.Payload)
+		assert.Equal(t, "preview.TorrentCreatedEvent", got.Metadata.Get("name"))
+		got.Ack()
+	}
+
+	assert.Eventually(t, func() bool {
+		return count(t, db, "queue_messages") == 0 && count(t, db, "queue_deliveries") == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestQueue_ConsumersOfTheSameGroupCompete(t *testing.T) {
+	db := newDatabase(t)
+	publisher := sqlqueue.NewPublisher(db, sqlqueue.PublisherConfig{})
+
+	first := subscribe(t, db, "commands", time.Minute)
+	second := subscribe(t, db, "commands", time.Minute)
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage("1", nil), message.NewMessage("2", nil)))
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case msg := <-first:
+			got = append(got, msg.UUID) // not acked: keeps the first subscriber busy
+		case msg := <-second:
+			got = append(got, msg.UUID)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for the messages")
+		}
+	}
+	assert.ElementsMatch(t, []string{"1", "2"}, got)
+
+	select {
+	case msg := <-first:
+		t.Fatalf("message %v delivered twice", msg.UUID)
+	case msg := <-second:
+		t.Fatalf("message %v delivered twice", msg.UUID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestQueue_NackedMessagesAreDeliveredAgain(t *testing.T) {
+	db := newDatabase(t)
+	publisher := sqlqueue.NewPublisher(db, sqlqueue.PublisherConfig{})
+	messages := subscribe(t, db, "handler", time.Minute)
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage("1", nil)))
+
+	receive(t, messages).Nack()
+	got := receive(t, messages)
+	assert.Equal(t, "1", got.UUID)
+	got.Ack()
+}
+
+func TestQueue_MessagesAreDroppedAfterTooManyAttempts(t *testing.T) {
+	db := newDatabase(t)
+	publisher := sqlqueue.NewPublisher(db, sqlqueue.PublisherConfig{})
+	messages := subscribe(t, db, "handler", time.Minute)
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage("poison", nil), message.NewMessage("2", nil)))
+
+	// The poison message does not hold up the rest while it is waiting to be delivered again
+	attempts, acked := 0, false
+	for attempts < 3 || !acked {
+		msg := receive(t, messages)
+		if msg.UUID == "poison" {
+			attempts++
+			msg.Nack()
+		} else {
+			acked = true
+			msg.Ack()
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		return count(t, db, "queue_messages") == 0
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case msg := <-messages:
+		t.Fatalf("message %v delivered after too many attempts", msg.UUID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestQueue_MessagesSurviveTheSubscriber(t *testing.T) {
+	db := newDatabase(t)
+	publisher := sqlqueue.NewPublisher(db, sqlqueue.PublisherConfig{})
+
+	subscriber, err := sqlqueue.NewSubscriber(db, config("handler", 200*time.Millisecond), watermill.NopLogger{})
+	require.NoError(t, err)
+	messages, err := subscriber.Subscribe(context.Background(), topic)
+	require.NoError(t, err)
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage("1", nil)))
+	receive(t, messages) // Never acked: the process dies
+	require.NoError(t, subscriber.Close())
+
+	got := receive(t, subscribe(t, db, "handler", time.Minute))
+	assert.Equal(t, "1", got.UUID)
+	got.Ack()
+}
+
+func TestQueue_VisibilityIsExtendedWhileHandling(t *testing.T) {
+	db := newDatabase(t)
+	publisher := sqlqueue.NewPublisher(db, sqlqueue.PublisherConfig{})
+	first := subscribe(t, db, "handler", 100*time.Millisecond)
+	second := subscribe(t, db, "handler", 100*time.Millisecond)
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage("1", nil)))
+
+	var msg *message.Message
+	select {
+	case msg = <-first:
+	case msg = <-second:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the message")
+	}
+
+	select {
+	case <-first:
+		t.Fatal("message delivered while being handled")
+	case <-second:
+		t.Fatal("message delivered while being handled")
+	case <-time.After(500 * time.Millisecond):
+	}
+	msg.Ack()
+}
+
+func TestQueue_PublisherKeepsTheMessagesForItsConsumerGroup(t *testing.T) {
+	db := newDatabase(t)
+	publisher := sqlqueue.NewPublisher(db, sqlqueue.PublisherConfig{ConsumerGroup: "commands"})
+
+	require.NoError(t, publisher.Publish(topic, message.NewMessage("1", nil)))
+
+	got := receive(t, subscribe(t, db, "commands", time.Minute))
+	assert.Equal(t, "1", got.UUID)
+	got.Ack()
+}
+
+func newDatabase(t *testing.T) *sql.DB {
+	schema, err := ioutil.ReadFile("../../../../infrastructure/database/sqlite.schema.sql")
+	require.NoError(t, err)
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "queue.sqlite"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+	return db
+}
+
+func config(group string, visibilityTimeout time.Duration) sqlqueue.SubscriberConfig {
+	return sqlqueue.SubscriberConfig{
+		ConsumerGroup:     group,
+		PollInterval:      10 * time.Millisecond,
+		VisibilityTimeout: visibilityTimeout,
+		MaxAttempts:       3,
+	}
+}
+
+func subscribe(t *testing.T, db *sql.DB, group string, visibilityTimeout time.Duration) <-chan *message.Message {
+	subscriber, err := sqlqueue.NewSubscriber(db, config(group, visibilityTimeout), watermill.NopLogger{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = subscriber.Close() })
+
+	messages, err := subscriber.Subscribe(context.Background(), topic)
+	require.NoError(t, err)
+	return messages
+}
+
+func receive(t *testing.T, messages <-chan *message.Message) *message.Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for a message")
+		return nil
+	}
+}
+
+func count(t *testing.T, db *sql.DB, table string) int {
+	var n int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM "+table).Scan(&n))
+	return n
+}
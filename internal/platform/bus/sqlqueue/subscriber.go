@@ -0,0 +1,263 @@
+package sqlqueue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type SubscriberConfig struct {
+	// The subscribers of the same consumer group share the messages of a topic, while every group
+	// gets all of them. Messages published before the group subscribes for the first time are not
+	// delivered to it
+	ConsumerGroup string
+	// How often to look for new messages when the topic is empty
+	PollInterval time.Duration
+	// A message not acked nor nacked within this time is delivered again. It is extended while the
+	// message is being handled, so it only expires if the subscriber dies
+	VisibilityTimeout time.Duration
+	// A message delivered this many times without being acked is dropped, so a message that always
+	// fails does not hold up the rest of the group
+	MaxAttempts int
+}
+
+func (c SubscriberConfig) validate() error {
+	switch {
+	case c.ConsumerGroup == "":
+		return errors.New("the consumer group is required")
+	case c.PollInterval <= 0:
+		return errors.New("the poll interval must be positive")
+	case c.VisibilityTimeout <= 0:
+		return errors.New("the visibility timeout must be positive")
+	case c.MaxAttempts <= 0:
+		return errors.New("the max attempts must be positive")
+	}
+	return nil
+}
+
+// Subscriber delivers the messages stored by the Publisher, one at a time per subscription
+type Subscriber struct {
+	db     *sql.DB
+	config SubscriberConfig
+	logger watermill.LoggerAdapter
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func NewSubscriber(db *sql.DB, config SubscriberConfig, logger watermill.LoggerAdapter) (*Subscriber, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &Subscriber{
+		db:      db,
+		config:  config,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}, nil
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	select {
+	case <-s.closing:
+		return nil, ErrClosed
+	default:
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO "+sqlConsumerGroupsTable+" (topic, consumer_group) VALUES (?, ?)",
+		topic, s.config.ConsumerGroup,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *message.Message)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(out)
+		s.consume(ctx, topic, out)
+	}()
+	return out, nil
+}
+
+func (s *Subscriber) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+	})
+	s.wg.Wait()
+	return nil
+}
+
+// delivery is a message claimed by the consumer group
+type delivery struct {
+	messageID int64
+	uuid      string
+	payload   []byte
+	metadata  string
+	visibleAt int64
+	attempts  int
+}
+
+func (s *Subscriber) consume(ctx context.Context, topic string, out chan<- *message.Message) {
+	logFields := watermill.LogFields{"topic": topic, "consumer_group": s.config.ConsumerGroup}
+	for {
+		d, err := s.claim(ctx, topic)
+		if err != nil {
+			s.logger.Error("unable to read the next message", err, logFields)
+		}
+
+		if d == nil {
+			select {
+			case <-time.After(s.config.PollInterval):
+				continue
+			case <-ctx.Done():
+				return
+			case <-s.closing:
+				return
+			}
+		}
+
+		if d.attempts > s.config.MaxAttempts {
+			s.logger.Error("message dropped after too many attempts", errors.New("too many attempts"), watermill.LogFields{
+				"uuid":           d.uuid,
+				"topic":          topic,
+				"consumer_group": s.config.ConsumerGroup,
+				"attempts":       d.attempts - 1,
+			})
+			s.logIfError(s.ack(d), "unable to drop the message", d)
+			continue
+		}
+
+		if !s.deliver(ctx, d, out) {
+			return
+		}
+	}
+}
+
+// claim returns the next visible message of the topic and hides it from the rest of the consumers
+// of the group. It returns nil if there is none
+func (s *Subscriber) claim(ctx context.Context, topic string) (*delivery, error) {
+	now := time.Now()
+	d := new(delivery)
+	err := s.db.QueryRowContext(ctx,
+		"SELECT d.message_id, m.uuid, m.payload, m.metadata, d.visible_at, d.attempts "+
+			"FROM "+sqlDeliveriesTable+" d JOIN "+sqlMessagesTable+" m ON m.id = d.message_id "+
+			"WHERE d.consumer_group = ? AND m.topic = ? AND d.visible_at <= ? "+
+			"ORDER BY d.message_id ASC LIMIT 1",
+		s.config.ConsumerGroup, topic, toMillis(now),
+	).Scan(&d.messageID, &d.uuid, &d.payload, &d.metadata, &d.visibleAt, &d.attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Only one consumer succeeds updating the visibility, the one that read it first
+	visibleAt := toMillis(now.Add(s.config.VisibilityTimeout))
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE "+sqlDeliveriesTable+" SET visible_at = ?, attempts = attempts + 1 "+
+			"WHERE message_id = ? AND consumer_group = ? AND visible_at = ?",
+		visibleAt, d.messageID, s.config.ConsumerGroup, d.visibleAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, err
+	}
+
+	d.visibleAt = visibleAt
+	d.attempts++
+	return d, nil
+}
+
+// deliver sends the message and waits for it to be acked or nacked. It returns false if the
+// subscriber must stop
+func (s *Subscriber) deliver(ctx context.Context, d *delivery, out chan<- *message.Message) bool {
+	msg := message.NewMessage(d.uuid, d.payload)
+	if err := json.Unmarshal([]byte(d.metadata), &msg.Metadata); err != nil {
+		s.logger.Error("unable to decode the metadata of the message", err, watermill.LogFields{"uuid": d.uuid})
+	}
+
+	msgCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	msg.SetContext(msgCtx)
+
+	// If we stop before the message is acked, it is delivered again once it becomes visible
+	select {
+	case out <- msg:
+	case <-ctx.Done():
+		return false
+	case <-s.closing:
+		return false
+	}
+
+	heartbeat := time.NewTicker(s.config.VisibilityTimeout / 2)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-msg.Acked():
+			s.logIfError(s.ack(d), "unable to ack the message", d)
+			return true
+		case <-msg.Nacked():
+			s.logIfError(s.hide(d, s.config.PollInterval), "unable to nack the message", d)
+			return true
+		case <-heartbeat.C:
+			s.logIfError(s.hide(d, s.config.VisibilityTimeout), "unable to extend the visibility of the message", d)
+		case <-ctx.Done():
+			return false
+		case <-s.closing:
+			return false
+		}
+	}
+}
+
+// ack removes the delivery, and the message once it has been delivered to every consumer group
+func (s *Subscriber) ack(d *delivery) error {
+	_, err := s.db.Exec(
+		"DELETE FROM "+sqlDeliveriesTable+" WHERE message_id = ? AND consumer_group = ?",
+		d.messageID, s.config.ConsumerGroup,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		"DELETE FROM "+sqlMessagesTable+" WHERE id = ? AND NOT EXISTS "+
+			"(SELECT 1 FROM "+sqlDeliveriesTable+" WHERE message_id = ?)",
+		d.messageID, d.messageID,
+	)
+	return err
+}
+
+// hide makes the message visible again after the given time
+func (s *Subscriber) hide(d *delivery, duration time.Duration) error {
+	visibleAt := toMillis(time.Now().Add(duration))
+	_, err := s.db.Exec(
+		"UPDATE "+sqlDeliveriesTable+" SET visible_at = ? WHERE message_id = ? AND consumer_group = ?",
+		visibleAt, d.messageID, s.config.ConsumerGroup,
+	)
+	if err == nil {
+		d.visibleAt = visibleAt
+	}
+	return err
+}
+
+func (s *Subscriber) logIfError(err error, msg string, d *delivery) {
+	if err != nil {
+		s.logger.Error(msg, err, watermill.LogFields{
+			"uuid":           d.uuid,
+			"consumer_group": s.config.ConsumerGroup,
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package container
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/components/cqrs"
 	"github.com/ThreeDotsLabs/watermill/message"
@@ -9,34 +11,81 @@ import (
 	"github.com/anacrolix/torrent"
 	"github.com/sirupsen/logrus"
 	"prevtorrent/internal/platform/bus"
+	"prevtorrent/internal/platform/bus/dedup"
+	"prevtorrent/internal/platform/bus/eventlog"
+	"prevtorrent/internal/platform/bus/outbox"
+	"prevtorrent/internal/platform/health"
+	"prevtorrent/internal/platform/metrics"
+	"prevtorrent/internal/platform/tracing"
 	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/completePreview"
+	"prevtorrent/internal/preview/deleteTorrent"
+	"prevtorrent/internal/preview/dispatchWebhooks"
 	"prevtorrent/internal/preview/downloadPartials"
 	"prevtorrent/internal/preview/makeDownloadPlan"
 	"prevtorrent/internal/preview/platform/client/bittorrentproto"
+	"prevtorrent/internal/preview/platform/client/webhookhttp"
 	"prevtorrent/internal/preview/platform/configuration"
 	"prevtorrent/internal/preview/platform/storage/file"
 	"prevtorrent/internal/preview/platform/storage/inmemory/ffmpeg"
 	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"prevtorrent/internal/preview/retryDownload"
+	"prevtorrent/internal/preview/trackProgress"
+	"prevtorrent/internal/preview/trackStats"
 	"prevtorrent/internal/preview/unmagnetize"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// healthCheckTimeout is how long every dependency has to answer to the health checks
+const healthCheckTimeout = 5 * time.Second
+
 //go:generate mockery --case=snake --outpkg=containermocks --output=containermocks --name=Container
 type Container interface {
 	Config() configuration.Config
 	Logger() *logrus.Logger
 	ImagePersister() preview.ImagePersister
 	ImageExtractor() preview.ImageExtractor
+	ClipExtractor() preview.ClipExtractor
 	MagnetClient() preview.MagnetClient
 	TorrentDownloader() preview.TorrentDownloader
+	TorrentSeeder() preview.TorrentSeeder
+	TorrentDropper() preview.TorrentDropper
 	CommandBus() bus.Command
 	EventBus() bus.Event
+	OutboxEventBus() bus.Event
 	TorrentRepository() preview.TorrentRepository
 	ImageRepository() preview.ImageRepository
+	ProgressRepository() preview.ProgressRepository
+	RetryRepository() preview.RetryRepository
+	OutboxRelay() *outbox.Relay
+	Deduplicator() *dedup.Deduplicator
+	ClipRepository() preview.ClipRepository
+	SagaRepository() preview.SagaRepository
+	WebhookRepository() preview.WebhookRepository
+	WebhookDeliveryRepository() preview.WebhookDeliveryRepository
+	WebhookSender() preview.WebhookSender
+	StatsRepository() preview.StatsRepository
+	EventReplayer() *eventlog.Replayer
+	EventLogPruner() *eventlog.Pruner
+	HealthChecker() *health.Checker
 }
 
 type repositories struct {
-	torrent preview.TorrentRepository
-	image   preview.ImageRepository
+	torrent   preview.TorrentRepository
+	image     preview.ImageRepository
+	progress  preview.ProgressRepository
+	retry     preview.RetryRepository
+	clip      preview.ClipRepository
+	outbox    outbox.Store
+	outboxBus bus.Event
+	processed dedup.Store
+	saga      preview.SagaRepository
+	webhook   preview.WebhookRepository
+	delivery  preview.WebhookDeliveryRepository
+	eventLog  eventlog.Store
+	stats     preview.StatsRepository
 }
 
 type eventSourcing struct {
@@ -46,18 +95,24 @@ type eventSourcing struct {
 	commandSubscriber message.Subscriber
 	eventPublisher    message.Publisher
 	eventSubscriber   message.Subscriber
+	eventBus          bus.Event
 	cqrsRouter        *message.Router
 }
 
 type container struct {
-	config             configuration.Config
-	logger             *logrus.Logger
-	torrentIntegration *bittorrentproto.TorrentClient
-	imageExtractor     preview.ImageExtractor
-	imagePersister     preview.ImagePersister
-	repositories       repositories
-	loggerWatermill    watermill.LoggerAdapter
-	eventSourcing      eventSourcing
+	config configuration.Config
+	logger *logrus.Logger
+	// The BitTorrent client is started the first time it is used, by any of the goroutines
+	torrentClientOnce      sync.Once
+	torrentClient          atomic.Value // startedTorrentClient
+	torrentIntegrationOnce sync.Once
+	torrentIntegration     atomic.Value // *bittorrentproto.TorrentClient
+	ffmpeg                 *ffmpeg.InMemoryFfmpeg
+	imagePersister         preview.ImagePersister
+	webhookSender          preview.WebhookSender
+	repositories           repositories
+	loggerWatermill        watermill.LoggerAdapter
+	eventSourcing          eventSourcing
 
 	db *sql.DB
 }
@@ -85,6 +140,7 @@ func NewDefaultContainer() (*container, error) {
 		return nil, err
 	}
 	logger.Level = logLevel
+	logger.AddHook(tracing.NewLogHook())
 
 	loggerWatermill := watermill.NewStdLogger(false, false)
 
@@ -97,18 +153,42 @@ func NewDefaultContainer() (*container, error) {
 
 	torrentRepo := sqlite.NewTorrentRepository(sqliteDatabase)
 	imageRepository := sqlite.NewImageRepository(sqliteDatabase)
+	progressRepository := sqlite.NewProgressRepository(sqliteDatabase)
+	retryRepository := sqlite.NewRetryRepository(sqliteDatabase)
+	clipRepository := sqlite.NewClipRepository(sqliteDatabase)
+	outboxRepository := sqlite.NewOutboxRepository(sqliteDatabase)
+	processedRepository := sqlite.NewProcessedMessageRepository(sqliteDatabase)
+	sagaRepository := sqlite.NewSagaRepository(sqliteDatabase)
+	webhookRepository := sqlite.NewWebhookRepository(sqliteDatabase)
+	deliveryRepository := sqlite.NewWebhookDeliveryRepository(sqliteDatabase)
+	eventLogRepository := sqlite.NewEventLogRepository(sqliteDatabase)
+	statsRepository := sqlite.NewStatsRepository(sqliteDatabase)
+
+	webhookSender := webhookhttp.NewSender(webhookhttp.NewClient(config.WebhookTimeout))
 
-	eventDriver := makeEventDriver(config, loggerWatermill)
+	eventDriver := makeEventDriver(config, sqliteDatabase, loggerWatermill)
 
 	return &container{
 		config:          config,
 		logger:          logger,
 		loggerWatermill: loggerWatermill,
 		repositories: repositories{
-			torrent: torrentRepo,
-			image:   imageRepository,
+			torrent:   torrentRepo,
+			image:     imageRepository,
+			progress:  progressRepository,
+			retry:     retryRepository,
+			clip:      clipRepository,
+			outbox:    outboxRepository,
+			outboxBus: outboxRepository,
+			processed: processedRepository,
+			saga:      sagaRepository,
+			webhook:   webhookRepository,
+			delivery:  deliveryRepository,
+			eventLog:  eventLogRepository,
+			stats:     statsRepository,
 		},
 		imagePersister: imagePersister,
+		webhookSender:  webhookSender,
 		db:             sqliteDatabase,
 		eventSourcing: eventSourcing{
 			eventDriver: eventDriver,
@@ -140,14 +220,22 @@ func (c *container) ImagePersister() preview.ImagePersister {
 }
 
 func (c *container) ImageExtractor() preview.ImageExtractor {
-	if c.imageExtractor == nil {
-		imageExtractor, err := ffmpeg.NewInMemoryFfmpeg(c.logger)
+	return c.getFfmpeg()
+}
+
+func (c *container) ClipExtractor() preview.ClipExtractor {
+	return c.getFfmpeg()
+}
+
+func (c *container) getFfmpeg() *ffmpeg.InMemoryFfmpeg {
+	if c.ffmpeg == nil {
+		extractor, err := ffmpeg.NewInMemoryFfmpeg(c.logger)
 		if err != nil {
 			logrus.Fatal(err)
 		}
-		c.imageExtractor = imageExtractor
+		c.ffmpeg = extractor
 	}
-	return c.imageExtractor
+	return c.ffmpeg
 }
 
 func (c *container) MagnetClient() preview.MagnetClient {
@@ -158,6 +246,28 @@ func (c *container) TorrentDownloader() preview.TorrentDownloader {
 	return c.getTorrentIntegration()
 }
 
+func (c *container) TorrentSeeder() preview.TorrentSeeder {
+	return c.getTorrentIntegration()
+}
+
+// TorrentDropper drops the torrents from the BitTorrent client of this process. The client is not
+// started just to drop a torrent it cannot have
+func (c *container) TorrentDropper() preview.TorrentDropper {
+	return startedTorrentDropper{c: c}
+}
+
+type startedTorrentDropper struct {
+	c *container
+}
+
+func (d startedTorrentDropper) Drop(ctx context.Context, torrentID string) error {
+	integration, ok := d.c.torrentIntegration.Load().(*bittorrentproto.TorrentClient)
+	if !ok {
+		return nil
+	}
+	return integration.Drop(ctx, torrentID)
+}
+
 func (c *container) CommandBus() bus.Command {
 	return c.cqrs().CommandBus()
 }
@@ -166,6 +276,23 @@ func (c *container) EventBus() bus.Event {
 	return c.cqrs().EventBus()
 }
 
+// OutboxEventBus stores the events in the outbox, thus they are published by the OutboxRelay of
+// whoever runs it. Meant for the binaries that do not connect to the broker, like the API
+func (c *container) OutboxEventBus() bus.Event {
+	return c.repositories.outboxBus
+}
+
+// OutboxRelay publishes the events stored along with the changes that produced them. It uses the
+// event publisher directly, thus it does not build the cqrs facade
+func (c *container) OutboxRelay() *outbox.Relay {
+	return outbox.NewRelay(c.logger, c.repositories.outbox, c.eventPublisher(), generateEventsTopic, c.config.OutboxMaxAttempts)
+}
+
+// Deduplicator skips the messages the handlers have already processed
+func (c *container) Deduplicator() *dedup.Deduplicator {
+	return dedup.NewDeduplicator(c.logger, c.repositories.processed, dedup.DefaultClaimLease)
+}
+
 func (c *container) CQRSRouter() *message.Router {
 	if c.eventSourcing.cqrsRouter != nil {
 		return c.eventSourcing.cqrsRouter
@@ -184,6 +311,91 @@ func (c *container) ImageRepository() preview.ImageRepository {
 	return c.repositories.image
 }
 
+func (c *container) ProgressRepository() preview.ProgressRepository {
+	return c.repositories.progress
+}
+
+func (c *container) RetryRepository() preview.RetryRepository {
+	return c.repositories.retry
+}
+
+func (c *container) ClipRepository() preview.ClipRepository {
+	return c.repositories.clip
+}
+
+func (c *container) SagaRepository() preview.SagaRepository {
+	return c.repositories.saga
+}
+
+func (c *container) WebhookRepository() preview.WebhookRepository {
+	return c.repositories.webhook
+}
+
+func (c *container) WebhookDeliveryRepository() preview.WebhookDeliveryRepository {
+	return c.repositories.delivery
+}
+
+func (c *container) WebhookSender() preview.WebhookSender {
+	return c.webhookSender
+}
+
+func (c *container) StatsRepository() preview.StatsRepository {
+	return c.repositories.stats
+}
+
+// EventReplayer rebuilds the projections from the event log. It uses the handlers of the projections
+// directly, thus it does not build the cqrs facade
+func (c *container) EventReplayer() *eventlog.Replayer {
+	return eventlog.NewReplayer(
+		c.logger,
+		c.repositories.eventLog,
+		cqrs.JSONMarshaler{},
+		eventlog.NewProjection("progress", c.repositories.progress.Reset, c.progressHandlers()...),
+		eventlog.NewProjection("stats", c.repositories.stats.Reset, c.statsHandlers()...),
+	)
+}
+
+// EventLogPruner removes the events of every piece downloaded once PieceEventRetention has passed.
+// They are the most of the log, and the progress gets the pieces of each range from
+// PieceRangeCompletedEvent, so the replays only miss the peers and the pieces of unfinished ranges
+func (c *container) EventLogPruner() *eventlog.Pruner {
+	return eventlog.NewPruner(c.logger, c.repositories.eventLog, cqrs.JSONMarshaler{}.Name(new(preview.PieceCompletedEvent)))
+}
+
+// HealthChecker checks the dependencies of the binaries. The torrent client is checked only once it
+// has been started, so the binaries that do not use it do not start it. It does not depend on the
+// broker to be started
+func (c *container) HealthChecker() *health.Checker {
+	return health.NewChecker(healthCheckTimeout,
+		health.Check{Name: "sqlite", Run: c.checkDatabase},
+		health.Check{Name: "broker (" + c.config.PubSubDriver + ")", Run: c.eventSourcing.eventDriver.check},
+		health.Check{Name: "image dir", Run: file.NewImagePersister(c.logger, c.config.ImageDir).CheckWritable},
+		health.Check{Name: "ffmpeg", Run: func(context.Context) error { return ffmpeg.CheckExecutable() }},
+		health.Check{Name: "torrent client", Run: c.checkTorrentClient},
+	)
+}
+
+func (c *container) checkDatabase(ctx context.Context) error {
+	if err := c.db.PingContext(ctx); err != nil {
+		return err
+	}
+	return sqlite.CheckSchema(ctx, c.db)
+}
+
+func (c *container) checkTorrentClient(_ context.Context) error {
+	started, ok := c.torrentClient.Load().(startedTorrentClient)
+	if !ok {
+		return nil
+	}
+	if started.err != nil {
+		return started.err
+	}
+	if len(started.client.ListenAddrs()) == 0 {
+		return errors.New("the torrent client is not listening on any address")
+	}
+	return nil
+}
+
 func (c *container) cqrs() *cqrs.Facade {
 	if c.eventSourcing.cqrsFacade != nil {
 		return c.eventSourcing.cqrsFacade
@@ -193,17 +405,15 @@ func (c *container) cqrs() *cqrs.Facade {
 	if err != nil {
 		panic(err)
 	}
-	router.AddMiddleware(middleware.Recoverer)
+	router.AddMiddleware(middleware.Recoverer, tracing.Middleware, metrics.Middleware, c.Deduplicator().Middleware)
 	c.eventSourcing.cqrsRouter = router
 
 	cqrsFacade, err := cqrs.NewFacade(cqrs.FacadeConfig{
-		GenerateCommandsTopic: func(commandName string) string {
-			return commandName
-		},
+		GenerateCommandsTopic: generateCommandsTopic,
 		CommandHandlers: func(cb *cqrs.CommandBus, eb *cqrs.EventBus) []cqrs.CommandHandler {
 			return []cqrs.CommandHandler{
-				unmagnetize.NewCommandHandler(c.unmagnetizeService(eb)),
-				downloadPartials.NewCommandHandler(c.downloadPartialsService()),
+				unmagnetize.NewCommandHandler(c.unmagnetizeService()),
+				downloadPartials.NewCommandHandler(c.downloadPartialsService(eb)),
 				makeDownloadPlan.NewCommandHandler(c.makeDownloadPlan(cb)),
 			}
 		},
@@ -211,18 +421,30 @@ func (c *container) cqrs() *cqrs.Facade {
 		CommandsSubscriberConstructor: func(handlerName string) (message.Subscriber, error) {
 			return c.commandSubscriber(), nil
 		},
-		GenerateEventsTopic: func(eventName string) string {
-			return eventName
-		},
+		GenerateEventsTopic: generateEventsTopic,
 		EventHandlers: func(cb *cqrs.CommandBus, eb *cqrs.EventBus) []cqrs.EventHandler {
-			return []cqrs.EventHandler{
+			handlers := []cqrs.EventHandler{
 				makeDownloadPlan.NewTorrentCreatedEventHandler(c.makeDownloadPlan(cb)),
+				makeDownloadPlan.NewTorrentReprocessRequestedEventHandler(c.makeDownloadPlan(cb)),
+				retryDownload.NewNoSeedersFoundEventHandler(c.retryDownloadService(cb, eb)),
+				retryDownload.NewDownloadIncompleteEventHandler(c.retryDownloadService(cb, eb)),
+				retryDownload.NewPartialDownloadFinishedEventHandler(c.retryDownloadService(cb, eb)),
+				retryDownload.NewTorrentReprocessRequestedEventHandler(c.retryDownloadService(cb, eb)),
+				completePreview.NewPartialDownloadFinishedEventHandler(c.completePreviewService()),
+				completePreview.NewDownloadRetriesExhaustedEventHandler(c.completePreviewService()),
+				deleteTorrent.NewTorrentDeletedEventHandler(c.deleteTorrentService()),
+				dispatchWebhooks.NewTorrentCreatedEventHandler(c.dispatchWebhooksService()),
+				dispatchWebhooks.NewImageExtractedEventHandler(c.dispatchWebhooksService()),
+				dispatchWebhooks.NewTorrentPreviewCompletedEventHandler(c.dispatchWebhooksService()),
+				dispatchWebhooks.NewTorrentPreviewFailedEventHandler(c.dispatchWebhooksService()),
 			}
+			handlers = append(handlers, c.progressHandlers()...)
+			return append(handlers, c.statsHandlers()...)
 		},
 		EventsPublisher:             c.eventPublisher(),
 		EventsSubscriberConstructor: c.eventSourcing.eventDriver.eventSubscriber,
 		Router:                      router,
-		CommandEventMarshaler:       cqrs.JSONMarshaler{},
+		CommandEventMarshaler:       dedup.Marshaler{CommandEventMarshaler: cqrs.JSONMarshaler{}},
 		Logger:                      c.loggerWatermill,
 	})
 	if err != nil {
@@ -235,7 +457,7 @@ func (c *container) cqrs() *cqrs.Facade {
 
 func (c *container) commandPublisher() message.Publisher {
 	if c.eventSourcing.commandPublisher == nil {
-		c.eventSourcing.commandPublisher = c.eventSourcing.eventDriver.commandPublisher()
+		c.eventSourcing.commandPublisher = tracing.NewPublisher(c.eventSourcing.eventDriver.commandPublisher())
 	}
 
 	return c.eventSourcing.commandPublisher
@@ -249,23 +471,66 @@ func (c *container) commandSubscriber() message.Subscriber {
 	return c.eventSourcing.commandSubscriber
 }
 
+// progressEventBus is an event bus that does not depend on the cqrs facade. The torrent
+// integration is built while the facade is being built, so it cannot use the facade's one.
+func (c *container) progressEventBus() bus.Event {
+	if c.eventSourcing.eventBus != nil {
+		return c.eventSourcing.eventBus
+	}
+
+	eventBus, err := cqrs.NewEventBus(c.eventPublisher(), generateEventsTopic, cqrs.JSONMarshaler{})
+	if err != nil {
+		panic(err)
+	}
+	c.eventSourcing.eventBus = eventBus
+	return c.eventSourcing.eventBus
+}
+
+// eventPublisher appends every event to the log before publishing it, no matter who publishes it. Both
+// publishers add the correlation ID and the span of the context to the messages
 func (c *container) eventPublisher() message.Publisher {
 	if c.eventSourcing.eventPublisher == nil {
-		c.eventSourcing.eventPublisher = c.eventSourcing.eventDriver.eventPublisher()
+		c.eventSourcing.eventPublisher = eventlog.NewPublisher(
+			tracing.NewPublisher(c.eventSourcing.eventDriver.eventPublisher()),
+			c.repositories.eventLog,
+			cqrs.JSONMarshaler{},
+		)
 	}
 
 	return c.eventSourcing.eventPublisher
 }
 
 func (c *container) getTorrentIntegration() *bittorrentproto.TorrentClient {
-	if c.torrentIntegration == nil {
-		torrentClient, err := torrent.NewClient(configuration.GetTorrentConf(c.config))
+	c.torrentIntegrationOnce.Do(func() {
+		torrentClient, err := c.loadTorrentClient()
 		if err != nil {
 			panic(err)
 		}
-		c.torrentIntegration = bittorrentproto.NewTorrentClient(torrentClient, c.logger)
-	}
-	return c.torrentIntegration
+		c.torrentIntegration.Store(bittorrentproto.NewTorrentClient(
+			torrentClient,
+			c.logger,
+			c.progressEventBus(),
+			c.config.DownloadLimits(),
+			c.config.TorrentPeers,
+		))
+	})
+	return c.torrentIntegration.Load().(*bittorrentproto.TorrentClient)
+}
+
+// startedTorrentClient is the outcome of starting the BitTorrent client
+type startedTorrentClient struct {
+	client *torrent.Client
+	err    error
+}
+
+// loadTorrentClient starts the BitTorrent client the first time, the one used by the torrent integration
+func (c *container) loadTorrentClient() (*torrent.Client, error) {
+	c.torrentClientOnce.Do(func() {
+		client, err := torrent.NewClient(configuration.GetTorrentConf(c.config))
+		c.torrentClient.Store(startedTorrentClient{client: client, err: err})
+	})
+	started := c.torrentClient.Load().(startedTorrentClient)
+	return started.client, started.err
 }
 
 func (c *container) makeDownloadPlan(cb bus.Command) makeDownloadPlan.Service {
@@ -274,20 +539,89 @@ func (c *container) makeDownloadPlan(cb bus.Command) makeDownloadPlan.Service {
 		cb,
 		c.repositories.torrent,
 		c.repositories.image,
+		c.repositories.saga,
 	)
 }
 
-func (c *container) downloadPartialsService() downloadPartials.Service {
+func (c *container) downloadPartialsService(eb bus.Event) downloadPartials.Service {
 	return downloadPartials.NewService(
 		c.logger,
+		eb,
 		c.repositories.torrent,
 		c.TorrentDownloader(),
 		c.ImageExtractor(),
 		c.imagePersister,
 		c.repositories.image,
+		c.ClipExtractor(),
+		c.repositories.clip,
+		c.config.ClipLimits(),
+	)
+}
+
+func (c *container) trackProgressService() trackProgress.Service {
+	return trackProgress.NewService(c.logger, c.repositories.progress)
+}
+
+// progressHandlers keep the Progress projection up to date. See EventReplayer
+func (c *container) progressHandlers() []cqrs.EventHandler {
+	return []cqrs.EventHandler{
+		trackProgress.NewDownloadPlanStartedEventHandler(c.trackProgressService()),
+		trackProgress.NewPieceCompletedEventHandler(c.trackProgressService()),
+		trackProgress.NewPieceRangeCompletedEventHandler(c.trackProgressService()),
+		trackProgress.NewDownloadPlanFinishedEventHandler(c.trackProgressService()),
+	}
+}
+
+// statsHandlers keep the Stats projection up to date. See EventReplayer
+func (c *container) statsHandlers() []cqrs.EventHandler {
+	service := trackStats.NewService(c.logger, c.repositories.stats)
+	return []cqrs.EventHandler{
+		trackStats.NewTorrentCreatedEventHandler(service),
+		trackStats.NewImageExtractedEventHandler(service),
+		trackStats.NewImageExtractionFailedEventHandler(service),
+		trackStats.NewTorrentPreviewCompletedEventHandler(service),
+		trackStats.NewTorrentPreviewFailedEventHandler(service),
+	}
+}
+
+func (c *container) retryDownloadService(cb bus.Command, eb bus.Event) retryDownload.Service {
+	return retryDownload.NewService(
+		c.logger,
+		cb,
+		eb,
+		c.repositories.torrent,
+		c.repositories.retry,
+		c.config.RetryPolicy(),
+	)
+}
+
+func (c *container) completePreviewService() completePreview.Service {
+	return completePreview.NewService(c.logger, c.repositories.saga, c.repositories.image)
+}
+
+func (c *container) deleteTorrentService() deleteTorrent.Service {
+	return deleteTorrent.NewService(
+		c.logger,
+		c.repositories.torrent,
+		c.repositories.image,
+		c.repositories.clip,
+		c.imagePersister,
+		c.TorrentDropper(),
+	)
+}
+
+func (c *container) dispatchWebhooksService() dispatchWebhooks.Service {
+	return dispatchWebhooks.NewService(
+		c.logger,
+		c.repositories.webhook,
+		c.repositories.delivery,
+		c.webhookSender,
+		c.config.WebhookPolicy(),
+		c.config.WebhookTimeout,
+		preview.SystemClock{},
 	)
 }
 
-func (c *container) unmagnetizeService(eb bus.Event) unmagnetize.Service {
-	return unmagnetize.NewService(c.logger, eb, c.MagnetClient(), c.repositories.torrent)
+func (c *container) unmagnetizeService() unmagnetize.Service {
+	return unmagnetize.NewService(c.logger, c.MagnetClient(), c.repositories.torrent)
 }
@@ -1,40 +1,80 @@
 package container
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"prevtorrent/internal/platform/bus/sqlqueue"
+	"prevtorrent/internal/platform/health"
 	"prevtorrent/internal/preview/platform/configuration"
+	"time"
 
+	googlepubsub "cloud.google.com/go/pubsub"
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-amqp/pkg/amqp"
 	"github.com/ThreeDotsLabs/watermill-googlecloud/pkg/googlecloud"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	streadway "github.com/streadway/amqp"
+	"google.golang.org/api/iterator"
 )
 
+// brokerCheckTTL is how long the result of connecting to a remote broker is reused by the checks
+const brokerCheckTTL = 30 * time.Second
+
+func generateCommandsTopic(commandName string) string {
+	return commandName
+}
+
+func generateEventsTopic(eventName string) string {
+	return eventName
+}
+
 type events interface {
 	commandPublisher() message.Publisher
 	commandSubscriber() message.Subscriber
 	eventPublisher() message.Publisher
 	eventSubscriber(handlerName string) (message.Subscriber, error)
+	// check returns an error if the broker cannot be reached
+	check(ctx context.Context) error
 }
 
-func makeEventDriver(config configuration.Config, log watermill.LoggerAdapter) events {
+func makeEventDriver(config configuration.Config, db *sql.DB, log watermill.LoggerAdapter) events {
 	switch config.PubSubDriver {
 	case "rabbit":
 		return newRabbit(config, log)
 	case "google":
 		return newPubsub(config, log)
+	case "memory":
+		return newMemory(log)
+	case "sqlite":
+		return newSqliteQueue(config, db, log)
 	default:
 		panic(fmt.Sprintf("unknown PubSubDriver: %v", config.PubSubDriver))
 	}
 }
 
+// RequireSharedDriver returns an error if the PubSubDriver only delivers the messages within the
+// process. Every binary but standalone sends messages that are handled by other processes, thus they
+// would be dropped without any error
+func RequireSharedDriver(config configuration.Config) error {
+	if config.PubSubDriver == "memory" {
+		return errors.New("PubSubDriver memory can only be used by the standalone binary. Use rabbit, google or sqlite to share the messages with other processes")
+	}
+	return nil
+}
+
 type pubsub struct {
 	config          configuration.Config
 	loggerWatermill watermill.LoggerAdapter
+	cachedCheck     func(ctx context.Context) error
 }
 
 func newPubsub(config configuration.Config, loggerWatermill watermill.LoggerAdapter) *pubsub {
-	return &pubsub{config: config, loggerWatermill: loggerWatermill}
+	p := &pubsub{config: config, loggerWatermill: loggerWatermill}
+	p.cachedCheck = health.Cached(p.connect, brokerCheckTTL)
+	return p
 }
 
 func (p pubsub) commandSubscriber() message.Subscriber {
@@ -81,13 +121,35 @@ func (p pubsub) eventSubscriber(handlerName string) (message.Subscriber, error)
 	)
 }
 
+// check connects to the broker at most once every brokerCheckTTL, so the probes do not open a
+// connection each
+func (p pubsub) check(ctx context.Context) error {
+	return p.cachedCheck(ctx)
+}
+
+func (p pubsub) connect(ctx context.Context) error {
+	client, err := googlepubsub.NewClient(ctx, p.config.GooglePubSubProjectID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if _, err := client.Topics(ctx).Next(); err != nil && err != iterator.Done {
+		return err
+	}
+	return nil
+}
+
 type rabbit struct {
 	config          configuration.Config
 	loggerWatermill watermill.LoggerAdapter
+	cachedCheck     func(ctx context.Context) error
 }
 
 func newRabbit(config configuration.Config, loggerWatermill watermill.LoggerAdapter) *rabbit {
-	return &rabbit{config: config, loggerWatermill: loggerWatermill}
+	r := &rabbit{config: config, loggerWatermill: loggerWatermill}
+	r.cachedCheck = health.Cached(r.connect, brokerCheckTTL)
+	return r
 }
 
 func (r rabbit) commandSubscriber() message.Subscriber {
@@ -133,3 +195,103 @@ func (r rabbit) eventSubscriber(handlerName string) (message.Subscriber, error)
 
 	return amqp.NewSubscriber(config, r.loggerWatermill)
 }
+
+// check connects to the broker at most once every brokerCheckTTL, so the probes do not open a
+// connection each
+func (r rabbit) check(ctx context.Context) error {
+	return r.cachedCheck(ctx)
+}
+
+func (r rabbit) connect(_ context.Context) error {
+	conn, err := streadway.Dial(r.config.AMQPURI)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// memory sends the messages through go channels, thus the commands and events are handled by the
+// same process that sends them. Messages are lost if the process stops before handling them.
+type memory struct {
+	commands *gochannel.GoChannel
+	events   *gochannel.GoChannel
+}
+
+func newMemory(loggerWatermill watermill.LoggerAdapter) *memory {
+	return &memory{
+		commands: gochannel.NewGoChannel(gochannel.Config{}, loggerWatermill),
+		events:   gochannel.NewGoChannel(gochannel.Config{}, loggerWatermill),
+	}
+}
+
+func (m memory) commandSubscriber() message.Subscriber {
+	return m.commands
+}
+
+func (m memory) commandPublisher() message.Publisher {
+	return m.commands
+}
+
+func (m memory) eventPublisher() message.Publisher {
+	return m.events
+}
+
+// eventSubscriber returns the same GoChannel for every handler. Every subscription gets its own copy
+// of the events, which is what we get from rabbit and google with a queue per handler
+func (m memory) eventSubscriber(_ string) (message.Subscriber, error) {
+	return m.events, nil
+}
+
+// check has nothing to check, the messages never leave the process
+func (m memory) check(_ context.Context) error {
+	return nil
+}
+
+// commandsConsumerGroup is shared by all the processes handling commands, thus every command is
+// handled once. The events are delivered to every handler, using its name as consumer group
+const commandsConsumerGroup = "commands"
+
+// sqliteQueue stores the commands and events in the same database as the repositories
+type sqliteQueue struct {
+	config          configuration.Config
+	db              *sql.DB
+	loggerWatermill watermill.LoggerAdapter
+}
+
+func newSqliteQueue(config configuration.Config, db *sql.DB, loggerWatermill watermill.LoggerAdapter) *sqliteQueue {
+	return &sqliteQueue{config: config, db: db, loggerWatermill: loggerWatermill}
+}
+
+func (q sqliteQueue) commandSubscriber() message.Subscriber {
+	subscriber, err := q.subscriber(commandsConsumerGroup)
+	if err != nil {
+		panic(err)
+	}
+	return subscriber
+}
+
+func (q sqliteQueue) commandPublisher() message.Publisher {
+	return sqlqueue.NewPublisher(q.db, sqlqueue.PublisherConfig{ConsumerGroup: commandsConsumerGroup})
+}
+
+func (q sqliteQueue) eventPublisher() message.Publisher {
+	return sqlqueue.NewPublisher(q.db, sqlqueue.PublisherConfig{})
+}
+
+func (q sqliteQueue) eventSubscriber(handlerName string) (message.Subscriber, error) {
+	return q.subscriber(handlerName)
+}
+
+func (q sqliteQueue) subscriber(consumerGroup string) (*sqlqueue.Subscriber, error) {
+	return sqlqueue.NewSubscriber(q.db, sqlqueue.SubscriberConfig{
+		ConsumerGroup:     consumerGroup,
+		PollInterval:      q.config.QueuePollInterval,
+		VisibilityTimeout: q.config.QueueVisibility,
+		MaxAttempts:       q.config.QueueMaxAttempts,
+	}, q.loggerWatermill)
+}
+
+// check only pings the database, its tables are checked along with the rest of the schema
+func (q sqliteQueue) check(ctx context.Context) error {
+	return q.db.PingContext(ctx)
+}
@@ -0,0 +1,15 @@
+package container_test
+
+import (
+	"prevtorrent/internal/platform/container"
+	"prevtorrent/internal/preview/platform/configuration"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireSharedDriver(t *testing.T) {
+	assert.Error(t, container.RequireSharedDriver(configuration.Config{PubSubDriver: "memory"}))
+	assert.NoError(t, container.RequireSharedDriver(configuration.Config{PubSubDriver: "sqlite"}))
+	assert.NoError(t, container.RequireSharedDriver(configuration.Config{PubSubDriver: "rabbit"}))
+}
@@ -0,0 +1,114 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Check tells whether a dependency can be used. Run returns why not
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Result is the outcome of a Check
+type Result struct {
+	Name     string        `json:"name"`
+	Healthy  bool          `json:"healthy"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"-"`
+}
+
+// Report has the results of every Check, in the order the checks were given
+type Report struct {
+	Healthy bool     `json:"healthy"`
+	Checks  []Result `json:"checks"`
+}
+
+// Print writes one line per check, meant for humans
+func (r Report) Print(w io.Writer) {
+	for _, result := range r.Checks {
+		if result.Healthy {
+			_, _ = fmt.Fprintf(w, "[ OK ] %v (%v)\n", result.Name, result.Duration.Round(time.Millisecond))
+		} else {
+			_, _ = fmt.Fprintf(w, "[FAIL] %v: %v\n", result.Name, result.Error)
+		}
+	}
+}
+
+// Cached returns a check that runs the one given at most once every ttl, answering with its last
+// result meanwhile. Meant for the checks that open a connection, so the probes do not open one each
+func Cached(run func(ctx context.Context) error, ttl time.Duration) func(ctx context.Context) error {
+	var mux sync.Mutex
+	var checkedAt time.Time
+	var last error
+	return func(ctx context.Context) error {
+		mux.Lock()
+		defer mux.Unlock()
+
+		if !checkedAt.IsZero() && time.Since(checkedAt) < ttl {
+			return last
+		}
+		last = run(ctx)
+		checkedAt = time.Now()
+		return last
+	}
+}
+
+// Checker runs the checks of the dependencies of a binary
+type Checker struct {
+	timeout time.Duration
+	checks  []Check
+}
+
+// NewChecker returns a Checker that gives up on each check after the timeout
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{timeout: timeout, checks: checks}
+}
+
+// Run runs every check at the same time. The report is healthy only if all of them are
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Healthy: true, Checks: make([]Result, len(c.checks))}
+
+	wg := new(sync.WaitGroup)
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		report.Healthy = report.Healthy && result.Healthy
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = fmt.Errorf("no answer after %v", c.timeout)
+	}
+
+	result := Result{Name: check.Name, Healthy: err == nil, Duration: time.Since(start)}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package health_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"prevtorrent/internal/platform/health"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ok(context.Context) error {
+	return nil
+}
+
+func failing(context.Context) error {
+	return errors.New("connection refused")
+}
+
+func hanging(ctx context.Context) error {
+	<-ctx.Done()
+	<-time.After(time.Second) // ignores the context on purpose
+	return nil
+}
+
+func TestChecker_Run(t *testing.T) {
+	checker := health.NewChecker(50*time.Millisecond,
+		health.Check{Name: "sqlite", Run: ok},
+		health.Check{Name: "broker", Run: failing},
+		health.Check{Name: "ffmpeg", Run: hanging},
+	)
+
+	report := checker.Run(context.Background())
+
+	assert.False(t, report.Healthy)
+	require.Len(t, report.Checks, 3)
+	assert.Equal(t, health.Result{Name: "sqlite", Healthy: true}, withoutDuration(report.Checks[0]))
+	assert.Equal(t, health.Result{Name: "broker", Error: "connection refused"}, withoutDuration(report.Checks[1]))
+	assert.Equal(t, health.Result{Name: "ffmpeg", Error: "no answer after 50ms"}, withoutDuration(report.Checks[2]))
+}
+
+func TestChecker_Run_Healthy(t *testing.T) {
+	checker := health.NewChecker(time.Second, health.Check{Name: "sqlite", Run: ok})
+
+	report := checker.Run(context.Background())
+
+	assert.True(t, report.Healthy)
+	out := new(bytes.Buffer)
+	report.Print(out)
+	assert.Contains(t, out.String(), "[ OK ] sqlite")
+}
+
+func TestReadyHandler(t *testing.T) {
+	checker := health.NewChecker(time.Second,
+		health.Check{Name: "sqlite", Run: ok},
+		health.Check{Name: "broker", Run: failing},
+	)
+
+	res := httptest.NewRecorder()
+	health.ReadyHandler(checker).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	require.Equal(t, http.StatusServiceUnavailable, res.Code)
+	var report health.Report
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &report))
+	assert.False(t, report.Healthy)
+	assert.Equal(t, "connection refused", report.Checks[1].Error)
+}
+
+func TestLiveHandler(t *testing.T) {
+	res := httptest.NewRecorder()
+	health.LiveHandler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, res.Body.String())
+}
+
+func withoutDuration(result health.Result) health.Result {
+	result.Duration = 0
+	return result
+}
+
+func TestCached(t *testing.T) {
+	runs := 0
+	check := health.Cached(func(context.Context) error {
+		runs++
+		return errors.New("connection refused")
+	}, time.Hour)
+
+	require.Error(t, check(context.Background()))
+	require.Error(t, check(context.Background()))
+	assert.Equal(t, 1, runs)
+
+	runs = 0
+	check = health.Cached(func(context.Context) error {
+		runs++
+		return nil
+	}, 0)
+	require.NoError(t, check(context.Background()))
+	require.NoError(t, check(context.Background()))
+	assert.Equal(t, 2, runs)
+}
@@ -0,0 +1,32 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// LiveHandler answers while the process is able to serve requests. It does not check the dependencies,
+// so the process is not restarted when one of them is down
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+// ReadyHandler answers with the report of the checker. 503 if any dependency is failing
+func ReadyHandler(checker *Checker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Run(r.Context())
+		status := http.StatusOK
+		if !report.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Middleware measures how long the handlers take to process the messages and how many fail
+func Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		handler := message.HandlerNameFromCtx(msg.Context())
+		start := time.Now()
+
+		messages, err := h(msg)
+		HandlerDuration.WithLabelValues(handler).Observe(Since(start))
+		if err != nil {
+			HandlerFailures.WithLabelValues(handler).Inc()
+		}
+		return messages, err
+	}
+}
@@ -0,0 +1,34 @@
+package metrics_test
+
+import (
+	"errors"
+	"prevtorrent/internal/platform/metrics"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	// Outside of a router the messages have no handler name
+	failures := metrics.HandlerFailures.WithLabelValues("")
+	before := testutil.ToFloat64(failures)
+
+	_, err := metrics.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, nil
+	})(message.NewMessage("uuid-1", []byte(`{}`)))
+	require.NoError(t, err)
+	assert.Equal(t, before, testutil.ToFloat64(failures))
+
+	_, err = metrics.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		return nil, errors.New("unable to handle")
+	})(message.NewMessage("uuid-2", []byte(`{}`)))
+	require.Error(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(failures))
+
+	count, err := testutil.GatherAndCount(metrics.Registry, "prevtorrent_handler_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "prevtorrent"
+
+// Registry has every metric of the binary, the ones of the Go runtime and of the process included
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to answer the requests, by route",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	MagnetResolutionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "magnet_resolution_duration_seconds",
+		Help:      "Time taken to get the info of a magnet from the peers",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"result"})
+
+	PiecesDownloaded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pieces_downloaded_total",
+		Help:      "Pieces downloaded from the peers",
+	})
+
+	ChunksWasted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chunks_wasted_total",
+		Help:      "Chunks read from the peers that were not needed, ChunksReadWasted of the torrent client",
+	})
+
+	DownloadPlanBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_plan_bytes",
+		Help:      "Bytes of the pieces asked by every download plan",
+		Buckets:   prometheus.ExponentialBuckets(1<<20, 2, 10), // 1MB to 512MB
+	})
+
+	FfmpegDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ffmpeg_duration_seconds",
+		Help:      "Time taken by ffmpeg, by operation: image or clip",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"operation"})
+
+	FfmpegFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ffmpeg_failures_total",
+		Help:      "Executions of ffmpeg that failed, by operation and reason",
+	}, []string{"operation", "reason"})
+
+	HandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Time taken to process a message, by handler",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 30, 60, 300, 900},
+	}, []string{"handler"})
+
+	HandlerFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handler_failures_total",
+		Help:      "Messages whose processing returned an error, by handler",
+	}, []string{"handler"})
+
+	OutboxDeadLetters = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_dead_letters_total",
+		Help:      "Messages of the outbox given up after failing to be published too many times, by event",
+	}, []string{"event"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		HTTPRequestDuration,
+		MagnetResolutionDuration,
+		PiecesDownloaded,
+		ChunksWasted,
+		DownloadPlanBytes,
+		FfmpegDuration,
+		FfmpegFailures,
+		HandlerDuration,
+		HandlerFailures,
+		OutboxDeadLetters,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Since returns the seconds elapsed since start, the unit of every duration
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
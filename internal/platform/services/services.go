@@ -2,19 +2,49 @@ package services
 
 import "C"
 import (
+	"prevtorrent/internal/platform/bus/eventlog"
 	"prevtorrent/internal/platform/container"
+	"prevtorrent/internal/platform/health"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/completePreview"
+	"prevtorrent/internal/preview/deleteTorrent"
+	"prevtorrent/internal/preview/dispatchWebhooks"
 	"prevtorrent/internal/preview/downloadPartials"
+	"prevtorrent/internal/preview/getProgress"
+	"prevtorrent/internal/preview/getRetry"
+	"prevtorrent/internal/preview/getStats"
 	"prevtorrent/internal/preview/getTorrent"
+	"prevtorrent/internal/preview/getWebhook"
 	"prevtorrent/internal/preview/importTorrent"
+	"prevtorrent/internal/preview/platform/client/bittorrentproto"
+	"prevtorrent/internal/preview/platform/configuration"
+	"prevtorrent/internal/preview/previewLocal"
+	"prevtorrent/internal/preview/registerWebhook"
+	"prevtorrent/internal/preview/reprocessTorrent"
+	"prevtorrent/internal/preview/retryDownload"
+	"prevtorrent/internal/preview/seedTorrent"
+	"prevtorrent/internal/preview/streamFile"
 	"prevtorrent/internal/preview/unmagnetize"
 )
 
 type Services struct {
 	c                container.Container
 	getTorrent       *getTorrent.Service
+	getProgress      *getProgress.Service
+	getRetry         *getRetry.Service
 	unmagnetize      *unmagnetize.Service
 	importTorrent    *importTorrent.Service
 	downloadPartials *downloadPartials.Service
+	retryDownload    *retryDownload.Service
+	streamFile       *streamFile.Service
+	seedTorrent      *seedTorrent.Service
+	previewLocal     *previewLocal.Service
+	registerWebhook  *registerWebhook.Service
+	getWebhook       *getWebhook.Service
+	dispatchWebhooks *dispatchWebhooks.Service
+	getStats         *getStats.Service
+	reprocessTorrent *reprocessTorrent.Service
+	deleteTorrent    *deleteTorrent.Service
 }
 
 func NewServices(c container.Container) (Services, error) {
@@ -23,15 +53,31 @@ func NewServices(c container.Container) (Services, error) {
 
 func (s *Services) GetTorrent() getTorrent.Service {
 	if s.getTorrent == nil {
-		service := getTorrent.NewService(s.c.Logger(), s.c.TorrentRepository(), s.c.ImageRepository())
+		service := getTorrent.NewService(s.c.Logger(), s.c.TorrentRepository(), s.c.ImageRepository(), s.c.ClipRepository())
 		s.getTorrent = &service
 	}
 	return *s.getTorrent
 }
 
+func (s *Services) GetProgress() getProgress.Service {
+	if s.getProgress == nil {
+		service := getProgress.NewService(s.c.Logger(), s.c.ProgressRepository())
+		s.getProgress = &service
+	}
+	return *s.getProgress
+}
+
+func (s *Services) GetRetry() getRetry.Service {
+	if s.getRetry == nil {
+		service := getRetry.NewService(s.c.Logger(), s.c.RetryRepository())
+		s.getRetry = &service
+	}
+	return *s.getRetry
+}
+
 func (s *Services) Unmagnetize() unmagnetize.Service {
 	if s.unmagnetize == nil {
-		service := unmagnetize.NewService(s.c.Logger(), s.c.EventBus(), s.c.MagnetClient(), s.c.TorrentRepository())
+		service := unmagnetize.NewService(s.c.Logger(), s.c.MagnetClient(), s.c.TorrentRepository())
 		s.unmagnetize = &service
 	}
 
@@ -40,7 +86,7 @@ func (s *Services) Unmagnetize() unmagnetize.Service {
 
 func (s *Services) ImportTorrent() importTorrent.Service {
 	if s.importTorrent == nil {
-		service := importTorrent.NewService(s.c.Logger(), s.c.CommandBus(), s.c.TorrentDownloader(), s.c.TorrentRepository())
+		service := importTorrent.NewService(s.c.Logger(), s.c.TorrentDownloader(), s.c.TorrentRepository())
 		s.importTorrent = &service
 	}
 	return *s.importTorrent
@@ -51,14 +97,167 @@ func (s *Services) DownloadPartials() downloadPartials.Service {
 	if s.downloadPartials == nil {
 		service := downloadPartials.NewService(
 			s.c.Logger(),
+			s.c.EventBus(),
 			s.c.TorrentRepository(),
 			s.c.TorrentDownloader(),
 			s.c.ImageExtractor(),
 			s.c.ImagePersister(),
 			s.c.ImageRepository(),
+			s.c.ClipExtractor(),
+			s.c.ClipRepository(),
+			s.c.Config().ClipLimits(),
 		)
 		s.downloadPartials = &service
 	}
 
 	return *s.downloadPartials
 }
+
+func (s *Services) RetryDownload() retryDownload.Service {
+	if s.retryDownload == nil {
+		service := retryDownload.NewService(
+			s.c.Logger(),
+			s.c.CommandBus(),
+			s.c.EventBus(),
+			s.c.TorrentRepository(),
+			s.c.RetryRepository(),
+			s.c.Config().RetryPolicy(),
+		)
+		s.retryDownload = &service
+	}
+
+	return *s.retryDownload
+}
+
+func (s *Services) StreamFile() streamFile.Service {
+	if s.streamFile == nil {
+		service := streamFile.NewService(s.c.Logger(), s.c.TorrentRepository(), s.c.TorrentDownloader())
+		s.streamFile = &service
+	}
+	return *s.streamFile
+}
+
+func (s *Services) SeedTorrent() seedTorrent.Service {
+	if s.seedTorrent == nil {
+		service := seedTorrent.NewService(s.c.Logger(), s.c.TorrentSeeder(), s.c.TorrentRepository(), s.ImportTorrent())
+		s.seedTorrent = &service
+	}
+	return *s.seedTorrent
+}
+
+// PreviewLocal reads the pieces from local files, thus it does not start the BitTorrent client nor
+// the cqrs facade. Nor connects to the broker: its events are stored in the outbox
+func (s *Services) PreviewLocal() previewLocal.Service {
+	if s.previewLocal == nil {
+		localDownloader := bittorrentproto.NewLocalDownloader(s.c.Logger())
+		completePreview := completePreview.NewService(s.c.Logger(), s.c.SagaRepository(), s.c.ImageRepository())
+		downloadPartials := downloadPartials.NewService(
+			s.c.Logger(),
+			previewLocal.NewEventBus(s.c.OutboxEventBus(), completePreview),
+			s.c.TorrentRepository(),
+			localDownloader,
+			s.c.ImageExtractor(),
+			s.c.ImagePersister(),
+			s.c.ImageRepository(),
+			s.c.ClipExtractor(),
+			s.c.ClipRepository(),
+			s.c.Config().ClipLimits(),
+		)
+		service := previewLocal.NewService(
+			s.c.Logger(),
+			localDownloader,
+			s.c.TorrentRepository(),
+			s.c.ImageRepository(),
+			s.c.SagaRepository(),
+			downloadPartials,
+		)
+		s.previewLocal = &service
+	}
+	return *s.previewLocal
+}
+
+func (s *Services) RegisterWebhook() registerWebhook.Service {
+	if s.registerWebhook == nil {
+		service := registerWebhook.NewService(s.c.Logger(), s.c.WebhookRepository())
+		s.registerWebhook = &service
+	}
+	return *s.registerWebhook
+}
+
+func (s *Services) GetWebhook() getWebhook.Service {
+	if s.getWebhook == nil {
+		service := getWebhook.NewService(s.c.Logger(), s.c.WebhookRepository(), s.c.WebhookDeliveryRepository())
+		s.getWebhook = &service
+	}
+	return *s.getWebhook
+}
+
+// DispatchWebhooks sends the deliveries of the webhooks. The deliveries are created by the event
+// handlers of the cqrs facade
+func (s *Services) DispatchWebhooks() dispatchWebhooks.Service {
+	if s.dispatchWebhooks == nil {
+		service := dispatchWebhooks.NewService(
+			s.c.Logger(),
+			s.c.WebhookRepository(),
+			s.c.WebhookDeliveryRepository(),
+			s.c.WebhookSender(),
+			s.c.Config().WebhookPolicy(),
+			s.c.Config().WebhookTimeout,
+			preview.SystemClock{},
+		)
+		s.dispatchWebhooks = &service
+	}
+	return *s.dispatchWebhooks
+}
+
+func (s *Services) GetStats() getStats.Service {
+	if s.getStats == nil {
+		service := getStats.NewService(s.c.Logger(), s.c.StatsRepository())
+		s.getStats = &service
+	}
+	return *s.getStats
+}
+
+// ReprocessTorrent stores its event in the outbox along with the status, thus the API does not need
+// the broker to accept the requests
+func (s *Services) ReprocessTorrent() reprocessTorrent.Service {
+	if s.reprocessTorrent == nil {
+		service := reprocessTorrent.NewService(
+			s.c.Logger(),
+			s.c.TorrentRepository(),
+			s.c.ImageRepository(),
+			s.c.ImagePersister(),
+		)
+		s.reprocessTorrent = &service
+	}
+	return *s.reprocessTorrent
+}
+
+// DeleteTorrent drops the torrent from the client of this process, if it has been started. The events
+// binary drops it from its own when the event arrives
+func (s *Services) DeleteTorrent() deleteTorrent.Service {
+	if s.deleteTorrent == nil {
+		service := deleteTorrent.NewService(
+			s.c.Logger(),
+			s.c.TorrentRepository(),
+			s.c.ImageRepository(),
+			s.c.ClipRepository(),
+			s.c.ImagePersister(),
+			s.c.TorrentDropper(),
+		)
+		s.deleteTorrent = &service
+	}
+	return *s.deleteTorrent
+}
+
+func (s *Services) EventReplayer() *eventlog.Replayer {
+	return s.c.EventReplayer()
+}
+
+func (s *Services) HealthChecker() *health.Checker {
+	return s.c.HealthChecker()
+}
+
+func (s *Services) Config() configuration.Config {
+	return s.c.Config()
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Publisher adds to the metadata of the messages the correlation ID and the span of their context,
+// which is the one given to the command and event buses
+type Publisher struct {
+	message.Publisher
+}
+
+func NewPublisher(publisher message.Publisher) *Publisher {
+	return &Publisher{Publisher: publisher}
+}
+
+func (p *Publisher) Publish(topic string, messages ...*message.Message) error {
+	spans := make([]trace.Span, 0, len(messages))
+	for _, msg := range messages {
+		ctx, span := Tracer().Start(msg.Context(), "publish "+topic, trace.WithSpanKind(trace.SpanKindProducer))
+		span.SetAttributes(
+			attribute.String("messaging.message_id", msg.UUID),
+			attribute.String(metadataKey, CorrelationID(ctx)),
+		)
+		Inject(ctx, msg.Metadata)
+		spans = append(spans, span)
+	}
+
+	err := p.Publisher.Publish(topic, messages...)
+	for _, span := range spans {
+		endSpan(span, err)
+	}
+	return err
+}
+
+// Middleware continues the trace of the messages handled by the router. The messages without
+// correlation ID, like the ones published before it existed, are given a new one
+func Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		ctx := Extract(msg.Context(), msg.Metadata)
+		if CorrelationID(ctx) == "" {
+			ctx = WithCorrelationID(ctx, NewCorrelationID())
+		}
+
+		ctx, span := Tracer().Start(ctx, message.HandlerNameFromCtx(ctx), trace.WithSpanKind(trace.SpanKindConsumer))
+		span.SetAttributes(
+			attribute.String("messaging.message_id", msg.UUID),
+			attribute.String(metadataKey, CorrelationID(ctx)),
+		)
+		msg.SetContext(ctx)
+
+		messages, err := h(msg)
+		endSpan(span, err)
+		return messages, err
+	}
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,82 @@
+package tracing_test
+
+import (
+	"context"
+	"os"
+	"prevtorrent/internal/platform/tracing"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMain(m *testing.M) {
+	// The spans are not exported, but they are recorded so they have valid IDs
+	if _, err := tracing.Start(context.Background(), tracing.Config{Exporter: tracing.ExporterNone}, "test"); err != nil {
+		panic(err)
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	os.Exit(m.Run())
+}
+
+type fakePublisher struct {
+	message.Publisher
+	published []*message.Message
+}
+
+func (p *fakePublisher) Publish(topic string, messages ...*message.Message) error {
+	p.published = append(p.published, messages...)
+	return nil
+}
+
+func TestPublisher_Publish(t *testing.T) {
+	ctx, span := tracing.Tracer().Start(tracing.WithCorrelationID(context.Background(), "c0ffee"), "test")
+	defer span.End()
+
+	msg := message.NewMessage("uuid-1", []byte(`{}`))
+	msg.SetContext(ctx)
+
+	next := new(fakePublisher)
+	err := tracing.NewPublisher(next).Publish("preview.TorrentCreatedEvent", msg)
+	require.NoError(t, err)
+
+	require.Len(t, next.published, 1)
+	assert.Equal(t, "c0ffee", next.published[0].Metadata.Get("correlation_id"))
+	assert.Contains(t, next.published[0].Metadata.Get("traceparent"), span.SpanContext().TraceID().String())
+}
+
+func TestMiddleware_ContinuesTheTrace(t *testing.T) {
+	ctx, span := tracing.Tracer().Start(tracing.WithCorrelationID(context.Background(), "c0ffee"), "test")
+	defer span.End()
+
+	msg := message.NewMessage("uuid-1", []byte(`{}`))
+	tracing.Inject(ctx, msg.Metadata)
+
+	var handled context.Context
+	_, err := tracing.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		handled = msg.Context()
+		return nil, nil
+	})(msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "c0ffee", tracing.CorrelationID(handled))
+	assert.Equal(t, span.SpanContext().TraceID(), trace.SpanContextFromContext(handled).TraceID())
+}
+
+func TestMiddleware_GeneratesCorrelationID(t *testing.T) {
+	msg := message.NewMessage("uuid-1", []byte(`{}`))
+
+	var handled context.Context
+	_, err := tracing.Middleware(func(msg *message.Message) ([]*message.Message, error) {
+		handled = msg.Context()
+		return nil, nil
+	})(msg)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, tracing.CorrelationID(handled))
+	assert.True(t, trace.SpanContextFromContext(handled).IsValid())
+}
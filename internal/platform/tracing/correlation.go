@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+)
+
+// Header is the HTTP header with the correlation ID of a request. It is generated if the client does not send it
+const Header = "X-Correlation-ID"
+
+// metadataKey is the key of the correlation ID in the metadata of the messages, the same one used by watermill
+const metadataKey = middleware.CorrelationIDMetadataKey
+
+type correlationIDKey struct{}
+
+// NewCorrelationID returns a new random correlation ID
+func NewCorrelationID() string {
+	return uuid.New().String()
+}
+
+// WithCorrelationID returns a copy of the context with the correlation ID given
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation ID of the context, or an empty string if there is none
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// Inject adds the correlation ID and the current span of the context to the metadata, so whoever
+// reads the metadata continues the same trace. See Extract
+func Inject(ctx context.Context, metadata map[string]string) {
+	if id := CorrelationID(ctx); id != "" {
+		metadata[metadataKey] = id
+	}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(metadata))
+}
+
+// Extract returns a copy of the context with the correlation ID and the remote span of the metadata
+func Extract(ctx context.Context, metadata map[string]string) context.Context {
+	if id := metadata[metadataKey]; id != "" {
+		ctx = WithCorrelationID(ctx, id)
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(metadata))
+}
+
+// metadataCarrier lets the propagators read and write the metadata of the messages
+type metadataCarrier map[string]string
+
+func (c metadataCarrier) Get(key string) string {
+	return c[key]
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LogHook adds the correlation ID and the span of the context of the entries to their fields. Only
+// the entries created with WithContext have a context
+type LogHook struct{}
+
+func NewLogHook() LogHook {
+	return LogHook{}
+}
+
+func (LogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (LogHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	if id := CorrelationID(entry.Context); id != "" {
+		entry.Data[metadataKey] = id
+	}
+	if span := trace.SpanContextFromContext(entry.Context); span.IsValid() {
+		entry.Data["trace_id"] = span.TraceID().String()
+		entry.Data["span_id"] = span.SpanID().String()
+	}
+	return nil
+}
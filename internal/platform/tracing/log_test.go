@@ -0,0 +1,32 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"prevtorrent/internal/platform/tracing"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogHook(t *testing.T) {
+	ctx, span := tracing.Tracer().Start(tracing.WithCorrelationID(context.Background(), "c0ffee"), "test")
+	defer span.End()
+
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(tracing.NewLogHook())
+
+	logger.WithContext(ctx).WithField("torrentID", "cb84").Info("torrent created")
+
+	var fields map[string]string
+	require.NoError(t, json.Unmarshal(out.Bytes(), &fields))
+	assert.Equal(t, "c0ffee", fields["correlation_id"])
+	assert.Equal(t, span.SpanContext().TraceID().String(), fields["trace_id"])
+	assert.Equal(t, "cb84", fields["torrentID"])
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "prevtorrent"
+
+const (
+	ExporterNone   = "none"   // The spans are not exported, but the correlation IDs are still propagated
+	ExporterStdout = "stdout" // The spans are written to stdout. Meant to be used locally
+	ExporterOTLP   = "otlp"   // The spans are sent to an OTLP collector over HTTP
+)
+
+// Config tells where the spans are exported
+type Config struct {
+	Exporter string
+	Endpoint string // host:port of the OTLP collector. Only used by ExporterOTLP
+}
+
+// Start sets up the propagation of the traces and the exporter of the spans of the given service.
+// The shutdown function returned flushes the spans not exported yet
+func Start(ctx context.Context, config Config, service string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	switch config.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx,
+			otlptracehttp.WithEndpoint(config.Endpoint),
+			otlptracehttp.WithInsecure(),
+		)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %v", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the %v tracing exporter: %w", config.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(service),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the project. The spans are dropped until Start is called
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
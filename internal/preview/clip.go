@@ -0,0 +1,69 @@
+package preview
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+//go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=ClipExtractor
+type ClipExtractor interface {
+	// ExtractClip transcodes the beginning of the video into a short MP4 and returns it with its duration
+	ExtractClip(ctx context.Context, data io.Reader, limits ClipLimits) ([]byte, time.Duration, error)
+}
+
+//go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=ClipRepository
+type ClipRepository interface {
+	ByTorrent(ctx context.Context, id string) ([]Clip, error)
+	Persist(ctx context.Context, clip Clip) error
+}
+
+// ClipLimits bounds the CPU and storage spent generating the clips
+type ClipLimits struct {
+	Enabled    bool          // clips are optional, and disabled by default
+	Duration   time.Duration // how long the clip is
+	MaxBitrate int           // of the video, in kbit/s
+	MaxHeight  int           // of the video, in pixels. Smaller videos are not scaled up
+	Threads    int           // used to transcode a single clip
+	Timeout    time.Duration // the transcoding is cancelled after it
+	MaxSize    int           // in bytes. Bigger clips are discarded
+}
+
+// Clip describes a short video, transcoded from a file of the torrent, that plays in any browser
+type Clip struct {
+	torrentID string
+	fileID    int
+	name      string
+	duration  time.Duration
+	length    int
+}
+
+// NewClip returns a Clip
+func NewClip(torrentID string, fileID int, name string, duration time.Duration, length int) Clip {
+	return Clip{torrentID: torrentID, fileID: fileID, name: name, duration: duration, length: length}
+}
+
+// TorrentID returns the obvious
+func (c Clip) TorrentID() string {
+	return c.torrentID
+}
+
+// FileID returns the obvious
+func (c Clip) FileID() int {
+	return c.fileID
+}
+
+// Name returns the name of the file
+func (c Clip) Name() string {
+	return c.name
+}
+
+// Duration returns how long the clip plays
+func (c Clip) Duration() time.Duration {
+	return c.duration
+}
+
+// Length returns the length of the file in bytes
+func (c Clip) Length() int {
+	return c.length
+}
@@ -0,0 +1,22 @@
+package preview
+
+import "time"
+
+// Clock abstracts the time, so the components depending on it can be tested deterministically
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the machine
+type SystemClock struct{}
+
+// Now returns the current time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After waits for the duration to elapse and then sends the current time on the returned channel
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
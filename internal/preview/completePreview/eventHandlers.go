@@ -0,0 +1,46 @@
+package completePreview
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+)
+
+type PartialDownloadFinishedEventHandler struct {
+	service Service
+}
+
+func NewPartialDownloadFinishedEventHandler(service Service) *PartialDownloadFinishedEventHandler {
+	return &PartialDownloadFinishedEventHandler{service: service}
+}
+
+func (h PartialDownloadFinishedEventHandler) HandlerName() string {
+	return "event.preview.partialDownloadFinished"
+}
+
+func (PartialDownloadFinishedEventHandler) NewEvent() interface{} {
+	return new(preview.PartialDownloadFinishedEvent)
+}
+
+func (h *PartialDownloadFinishedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.PartFinished(ctx, *e.(*preview.PartialDownloadFinishedEvent))
+}
+
+type DownloadRetriesExhaustedEventHandler struct {
+	service Service
+}
+
+func NewDownloadRetriesExhaustedEventHandler(service Service) *DownloadRetriesExhaustedEventHandler {
+	return &DownloadRetriesExhaustedEventHandler{service: service}
+}
+
+func (h DownloadRetriesExhaustedEventHandler) HandlerName() string {
+	return "event.preview.retriesExhausted"
+}
+
+func (DownloadRetriesExhaustedEventHandler) NewEvent() interface{} {
+	return new(preview.DownloadRetriesExhaustedEvent)
+}
+
+func (h *DownloadRetriesExhaustedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.RetriesExhausted(ctx, *e.(*preview.DownloadRetriesExhaustedEvent))
+}
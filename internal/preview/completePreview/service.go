@@ -0,0 +1,84 @@
+package completePreview
+
+import (
+	"context"
+	"errors"
+	"prevtorrent/internal/preview"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Service follows the downloads of the DownloadPlans, and tells how the preview of the torrent
+// ended once all of them have finished
+type Service struct {
+	logger          *logrus.Logger
+	sagaRepository  preview.SagaRepository
+	imageRepository preview.ImageRepository
+}
+
+func NewService(logger *logrus.Logger, sagaRepository preview.SagaRepository, imageRepository preview.ImageRepository) Service {
+	return Service{
+		logger:          logger,
+		sagaRepository:  sagaRepository,
+		imageRepository: imageRepository,
+	}
+}
+
+// PartFinished registers the download of the event as succeeded or failed
+func (s Service) PartFinished(ctx context.Context, event preview.PartialDownloadFinishedEvent) error {
+	return s.update(ctx, event.TorrentID, func(saga *preview.PreviewSaga) error {
+		if event.Succeeded() {
+			return saga.PartSucceeded(event.FinishedAt)
+		}
+		return saga.PartFailed(event.Reason, event.FinishedAt)
+	})
+}
+
+// RetriesExhausted registers as failed the download that is not going to be retried anymore
+func (s Service) RetriesExhausted(ctx context.Context, event preview.DownloadRetriesExhaustedEvent) error {
+	return s.update(ctx, event.TorrentID, func(saga *preview.PreviewSaga) error {
+		return saga.PartFailed(event.Reason, event.GaveUpAt)
+	})
+}
+
+// update applies the change to the saga of the torrent, and stores it along with its outcome once
+// finished. If the saga is updated concurrently, preview.ErrConcurrentUpdate is returned so the
+// event is handled again
+func (s Service) update(ctx context.Context, torrentID string, change func(saga *preview.PreviewSaga) error) error {
+	logger := s.logger.WithContext(ctx).WithFields(logrus.Fields{"torrentID": torrentID})
+
+	saga, err := s.sagaRepository.Get(ctx, torrentID)
+	if errors.Is(err, preview.ErrNotFound) {
+		logger.Debug("no preview being followed for the torrent")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = change(saga)
+	if errors.Is(err, preview.ErrSagaFinished) {
+		logger.Warn("download finished after the preview had already finished")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var events []interface{}
+	if saga.IsFinished() {
+		images, err := s.imageRepository.ByTorrent(ctx, torrentID)
+		if err != nil {
+			return err
+		}
+		events = append(events, saga.Outcome(len(images.Images())))
+
+		logger.WithFields(logrus.Fields{
+			"parts":  saga.Parts(),
+			"failed": saga.Failed(),
+			"images": len(images.Images()),
+		}).Info("preview finished")
+	}
+
+	return s.sagaRepository.Persist(ctx, saga, events...)
+}
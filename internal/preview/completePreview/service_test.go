@@ -0,0 +1,121 @@
+package completePreview_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/completePreview"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const torrentID = "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+var startedAt = time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func TestService_PartFinished_WaitsForTheRest(t *testing.T) {
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.RestorePreviewSaga(torrentID, 2, 0, 0, "", startedAt, time.Time{}, 1), nil)
+	sagaRepository.On("Persist", mock.Anything, mock.MatchedBy(func(s *preview.PreviewSaga) bool {
+		return s.Succeeded() == 1 && !s.IsFinished()
+	})).Return(nil)
+
+	service := completePreview.NewService(fakeLogger(), sagaRepository, new(storagemocks.ImageRepository))
+	err := service.PartFinished(context.Background(), preview.PartialDownloadFinishedEvent{
+		TorrentID:  torrentID,
+		FinishedAt: startedAt.Add(time.Minute),
+	})
+	require.NoError(t, err)
+	sagaRepository.AssertExpectations(t)
+}
+
+func TestService_PartFinished_Completes(t *testing.T) {
+	finishedAt := startedAt.Add(time.Minute)
+
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.RestorePreviewSaga(torrentID, 2, 0, 1, "no seeders", startedAt, time.Time{}, 1), nil)
+	sagaRepository.On("Persist", mock.Anything, mock.Anything, &preview.TorrentPreviewCompletedEvent{
+		TorrentID:   torrentID,
+		Parts:       2,
+		FailedParts: 1,
+		Images:      1,
+		StartedAt:   startedAt,
+		FinishedAt:  finishedAt,
+	}).Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages([]preview.Image{
+		preview.NewImage(torrentID, 0, "video.mp4.jpg", 10),
+	}), nil)
+
+	service := completePreview.NewService(fakeLogger(), sagaRepository, imageRepository)
+	err := service.PartFinished(context.Background(), preview.PartialDownloadFinishedEvent{
+		TorrentID:  torrentID,
+		FinishedAt: finishedAt,
+	})
+	require.NoError(t, err)
+	sagaRepository.AssertExpectations(t)
+}
+
+func TestService_RetriesExhausted_Fails(t *testing.T) {
+	gaveUpAt := startedAt.Add(time.Hour)
+
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.RestorePreviewSaga(torrentID, 1, 0, 0, "", startedAt, time.Time{}, 1), nil)
+	sagaRepository.On("Persist", mock.Anything, mock.Anything, &preview.TorrentPreviewFailedEvent{
+		TorrentID:  torrentID,
+		Parts:      1,
+		Reason:     "no seeders",
+		StartedAt:  startedAt,
+		FinishedAt: gaveUpAt,
+	}).Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages(nil), nil)
+
+	service := completePreview.NewService(fakeLogger(), sagaRepository, imageRepository)
+	err := service.RetriesExhausted(context.Background(), preview.DownloadRetriesExhaustedEvent{
+		TorrentID: torrentID,
+		Attempts:  5,
+		Reason:    "no seeders",
+		GaveUpAt:  gaveUpAt,
+	})
+	require.NoError(t, err)
+	sagaRepository.AssertExpectations(t)
+}
+
+func TestService_PartFinished_IgnoresUnknownTorrents(t *testing.T) {
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).Return(nil, preview.ErrNotFound)
+
+	service := completePreview.NewService(fakeLogger(), sagaRepository, new(storagemocks.ImageRepository))
+	err := service.PartFinished(context.Background(), preview.PartialDownloadFinishedEvent{TorrentID: torrentID})
+	require.NoError(t, err)
+	sagaRepository.AssertNotCalled(t, "Persist", mock.Anything, mock.Anything)
+}
+
+func TestService_PartFinished_ConcurrentUpdate(t *testing.T) {
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.RestorePreviewSaga(torrentID, 2, 0, 0, "", startedAt, time.Time{}, 1), nil)
+	sagaRepository.On("Persist", mock.Anything, mock.Anything).Return(preview.ErrConcurrentUpdate)
+
+	service := completePreview.NewService(fakeLogger(), sagaRepository, new(storagemocks.ImageRepository))
+	err := service.PartFinished(context.Background(), preview.PartialDownloadFinishedEvent{TorrentID: torrentID})
+	require.True(t, errors.Is(err, preview.ErrConcurrentUpdate))
+}
+
+func fakeLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
@@ -0,0 +1,7 @@
+package deleteTorrent
+
+type CMD struct {
+	TorrentID string
+	// Optional. Deletes the torrent even if its preview is being processed, stopping the downloads of this process
+	Force bool
+}
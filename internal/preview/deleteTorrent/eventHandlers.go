@@ -0,0 +1,28 @@
+package deleteTorrent
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+)
+
+type TorrentDeletedEventHandler struct {
+	service Service
+}
+
+func NewTorrentDeletedEventHandler(service Service) *TorrentDeletedEventHandler {
+	return &TorrentDeletedEventHandler{service: service}
+}
+
+func (h TorrentDeletedEventHandler) HandlerName() string {
+	return "event.torrentDeleted.dropTorrent"
+}
+
+func (TorrentDeletedEventHandler) NewEvent() interface{} {
+	return new(preview.TorrentDeletedEvent)
+}
+
+func (h *TorrentDeletedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	event := e.(*preview.TorrentDeletedEvent)
+
+	return h.service.Drop(ctx, event.TorrentID)
+}
@@ -0,0 +1,121 @@
+package deleteTorrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"prevtorrent/internal/preview"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Service struct {
+	logger            *logrus.Logger
+	torrentRepository preview.TorrentRepository
+	imageRepository   preview.ImageRepository
+	clipRepository    preview.ClipRepository
+	imagePersister    preview.ImagePersister
+	torrentDropper    preview.TorrentDropper
+}
+
+func NewService(
+	logger *logrus.Logger,
+	torrentRepository preview.TorrentRepository,
+	imageRepository preview.ImageRepository,
+	clipRepository preview.ClipRepository,
+	imagePersister preview.ImagePersister,
+	torrentDropper preview.TorrentDropper,
+) Service {
+	return Service{
+		logger:            logger,
+		torrentRepository: torrentRepository,
+		imageRepository:   imageRepository,
+		clipRepository:    clipRepository,
+		imagePersister:    imagePersister,
+		torrentDropper:    torrentDropper,
+	}
+}
+
+// Delete removes the torrent, its images and its clips, and stops sharing it. The torrent is marked
+// as deleting first, so nothing else is done with it meanwhile; it is refused while its preview is
+// being processed, unless forced. A forced deletion drops the torrent before deleting the files, so
+// the downloads of this process stop, and the downloads of other processes stop once they see the
+// torrent is deleting. The files are deleted before the rows that point to them, so a failed deletion
+// can be tried again. Returns preview.ErrNotFound if there is no such torrent
+func (s Service) Delete(ctx context.Context, cmd CMD) error {
+	torrent, err := s.torrentRepository.Get(ctx, cmd.TorrentID)
+	if err != nil {
+		return err
+	}
+
+	previous := torrent.Status()
+	if err := torrent.MarkAsDeleting(cmd.Force); err != nil {
+		return err
+	}
+	if previous != preview.StatusDeleting {
+		err := s.torrentRepository.UpdateStatusFrom(ctx, torrent, previous)
+		if errors.Is(err, preview.ErrConcurrentUpdate) {
+			return fmt.Errorf("%w: the torrent has changed meanwhile", preview.ErrPreviewInProgress)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if cmd.Force {
+		if err := s.Drop(ctx, torrent.ID()); err != nil {
+			return err
+		}
+	}
+
+	names, err := s.mediaNames(ctx, torrent.ID())
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := s.imagePersister.DeleteFile(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	if err := s.torrentRepository.Delete(ctx, torrent.ID(), preview.NewTorrentDeletedEvent(torrent, time.Now())); err != nil {
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"torrentID": torrent.ID(),
+		"name":      torrent.Name(),
+		"files":     len(names),
+		"force":     cmd.Force,
+		"previous":  previous,
+	}).Info("torrent deleted")
+
+	return s.Drop(ctx, torrent.ID())
+}
+
+// Drop stops downloading and seeding the torrent. The processes that did not delete the torrent drop it
+// when they receive the preview.TorrentDeletedEvent
+func (s Service) Drop(ctx context.Context, torrentID string) error {
+	return s.torrentDropper.Drop(ctx, torrentID)
+}
+
+func (s Service) mediaNames(ctx context.Context, torrentID string) ([]string, error) {
+	images, err := s.imageRepository.ByTorrent(ctx, torrentID)
+	if err != nil {
+		return nil, err
+	}
+	clips, err := s.clipRepository.ByTorrent(ctx, torrentID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(images.Images())+len(clips))
+	for _, img := range images.Images() {
+		names = append(names, img.Name())
+	}
+	for _, clip := range clips {
+		names = append(names, clip.Name())
+	}
+	return names, nil
+}
@@ -0,0 +1,187 @@
+package deleteTorrent_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/deleteTorrent"
+	"prevtorrent/internal/preview/platform/client/clientmocks"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const torrentID = "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+func TestService_Delete(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusCompleted), nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusDeleting
+	}), preview.StatusCompleted).Return(nil)
+	torrentRepository.On("Delete", mock.Anything, torrentID, mock.MatchedBy(func(e *preview.TorrentDeletedEvent) bool {
+		return e.TorrentID == torrentID && e.Name == "test torrent" && !e.DeletedAt.IsZero()
+	})).Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages([]preview.Image{
+		preview.NewImage(torrentID, 0, "image.jpg", 100),
+	}), nil)
+
+	clipRepository := new(storagemocks.ClipRepository)
+	clipRepository.On("ByTorrent", mock.Anything, torrentID).Return([]preview.Clip{
+		preview.NewClip(torrentID, 0, "clip.mp4", time.Second, 100),
+	}, nil)
+
+	imagePersister := new(storagemocks.ImagePersister)
+	imagePersister.On("DeleteFile", mock.Anything, "image.jpg").Return(nil)
+	imagePersister.On("DeleteFile", mock.Anything, "clip.mp4").Return(nil)
+
+	torrentDropper := new(clientmocks.TorrentDropper)
+	torrentDropper.On("Drop", mock.Anything, torrentID).Return(nil)
+
+	service := deleteTorrent.NewService(fakeLogger(), torrentRepository, imageRepository, clipRepository, imagePersister, torrentDropper)
+
+	err := service.Delete(context.Background(), deleteTorrent.CMD{TorrentID: torrentID})
+	require.NoError(t, err)
+	torrentRepository.AssertExpectations(t)
+	imagePersister.AssertExpectations(t)
+	torrentDropper.AssertExpectations(t)
+}
+
+func TestService_Delete_NotFound(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(preview.Torrent{}, preview.ErrNotFound)
+
+	torrentDropper := new(clientmocks.TorrentDropper)
+
+	service := deleteTorrent.NewService(fakeLogger(), torrentRepository, nil, nil, nil, torrentDropper)
+
+	err := service.Delete(context.Background(), deleteTorrent.CMD{TorrentID: torrentID})
+	assert.True(t, errors.Is(err, preview.ErrNotFound))
+	torrentDropper.AssertNotCalled(t, "Drop", mock.Anything, mock.Anything)
+}
+
+func TestService_Delete_InProgress(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusDownloading), nil)
+
+	service := deleteTorrent.NewService(fakeLogger(), torrentRepository, nil, nil, nil, new(clientmocks.TorrentDropper))
+
+	err := service.Delete(context.Background(), deleteTorrent.CMD{TorrentID: torrentID})
+	assert.True(t, errors.Is(err, preview.ErrPreviewInProgress))
+	torrentRepository.AssertNotCalled(t, "UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything)
+	torrentRepository.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestService_Delete_ForceStopsThePreviewInProgress(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusDownloading), nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusDeleting
+	}), preview.StatusDownloading).Return(nil)
+	torrentRepository.On("Delete", mock.Anything, torrentID, mock.Anything).Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages([]preview.Image{
+		preview.NewImage(torrentID, 0, "image.jpg", 100),
+	}), nil)
+
+	clipRepository := new(storagemocks.ClipRepository)
+	clipRepository.On("ByTorrent", mock.Anything, torrentID).Return(nil, nil)
+
+	// The downloads must be stopped before the images are deleted, or they could write new ones
+	dropped := false
+	torrentDropper := new(clientmocks.TorrentDropper)
+	torrentDropper.On("Drop", mock.Anything, torrentID).Run(func(mock.Arguments) { dropped = true }).Return(nil)
+	imagePersister := new(storagemocks.ImagePersister)
+	imagePersister.On("DeleteFile", mock.Anything, "image.jpg").Run(func(mock.Arguments) {
+		assert.True(t, dropped)
+	}).Return(nil)
+
+	service := deleteTorrent.NewService(fakeLogger(), torrentRepository, imageRepository, clipRepository, imagePersister, torrentDropper)
+
+	err := service.Delete(context.Background(), deleteTorrent.CMD{TorrentID: torrentID, Force: true})
+	require.NoError(t, err)
+	torrentRepository.AssertExpectations(t)
+	imagePersister.AssertExpectations(t)
+}
+
+func TestService_Delete_ChangedConcurrently(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusFailed), nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, preview.StatusFailed).
+		Return(preview.ErrConcurrentUpdate)
+
+	service := deleteTorrent.NewService(fakeLogger(), torrentRepository, nil, nil, nil, new(clientmocks.TorrentDropper))
+
+	err := service.Delete(context.Background(), deleteTorrent.CMD{TorrentID: torrentID})
+	assert.True(t, errors.Is(err, preview.ErrPreviewInProgress))
+	torrentRepository.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestService_Delete_TriesAgainAFailedDeletion(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusDeleting), nil)
+	torrentRepository.On("Delete", mock.Anything, torrentID, mock.Anything).Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages(nil), nil)
+
+	clipRepository := new(storagemocks.ClipRepository)
+	clipRepository.On("ByTorrent", mock.Anything, torrentID).Return(nil, nil)
+
+	torrentDropper := new(clientmocks.TorrentDropper)
+	torrentDropper.On("Drop", mock.Anything, torrentID).Return(nil)
+
+	service := deleteTorrent.NewService(fakeLogger(), torrentRepository, imageRepository, clipRepository, new(storagemocks.ImagePersister), torrentDropper)
+
+	err := service.Delete(context.Background(), deleteTorrent.CMD{TorrentID: torrentID})
+	require.NoError(t, err)
+	torrentRepository.AssertNotCalled(t, "UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything)
+	torrentRepository.AssertExpectations(t)
+}
+
+func TestService_Delete_KeepsTheRowsIfAFileCannotBeDeleted(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusNoSeeders), nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, preview.StatusNoSeeders).Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages([]preview.Image{
+		preview.NewImage(torrentID, 0, "image.jpg", 100),
+	}), nil)
+
+	clipRepository := new(storagemocks.ClipRepository)
+	clipRepository.On("ByTorrent", mock.Anything, torrentID).Return(nil, nil)
+
+	imagePersister := new(storagemocks.ImagePersister)
+	imagePersister.On("DeleteFile", mock.Anything, "image.jpg").Return(errors.New("permission denied"))
+
+	service := deleteTorrent.NewService(fakeLogger(), torrentRepository, imageRepository, clipRepository, imagePersister, new(clientmocks.TorrentDropper))
+
+	err := service.Delete(context.Background(), deleteTorrent.CMD{TorrentID: torrentID})
+	require.Error(t, err)
+	torrentRepository.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func fakeTorrent(t *testing.T, status preview.Status) preview.Torrent {
+	f, err := preview.NewFileInfo(0, 1000, "movie.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 100, []preview.File{f}, []byte(""))
+	require.NoError(t, err)
+	torrent.RestoreStatus(status, "")
+	return torrent
+}
+
+func fakeLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	return l
+}
@@ -0,0 +1,244 @@
+package dispatchWebhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"prevtorrent/internal/preview"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// batchSize is how many deliveries are sent on each round, at most
+	batchSize = 100
+	// maxConcurrentWebhooks is how many webhooks are posted to at the same time
+	maxConcurrentWebhooks = 10
+	// claimLease is how long a delivery is reserved once claimed. Once it expires, the delivery is
+	// sent again, so it must be longer than the timeout of the sender
+	claimLease = 5 * time.Minute
+)
+
+var errWebhookRemoved = errors.New("the webhook has been removed")
+
+// payload is the body posted to the webhooks. Data is the domain event that caused it
+type payload struct {
+	ID         string      `json:"id"`
+	Event      string      `json:"event"`
+	TorrentID  string      `json:"torrent_id"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// Service creates a delivery for every webhook subscribed to the events of the previews, and
+// posts them until the receivers accept them or we give up
+type Service struct {
+	logger             *logrus.Logger
+	webhookRepository  preview.WebhookRepository
+	deliveryRepository preview.WebhookDeliveryRepository
+	sender             preview.WebhookSender
+	policy             preview.RetryPolicy
+	timeout            time.Duration // of the sender, for each delivery
+	clock              preview.Clock
+}
+
+func NewService(
+	logger *logrus.Logger,
+	webhookRepository preview.WebhookRepository,
+	deliveryRepository preview.WebhookDeliveryRepository,
+	sender preview.WebhookSender,
+	policy preview.RetryPolicy,
+	timeout time.Duration,
+	clock preview.Clock,
+) Service {
+	return Service{
+		logger:             logger,
+		webhookRepository:  webhookRepository,
+		deliveryRepository: deliveryRepository,
+		sender:             sender,
+		policy:             policy,
+		timeout:            timeout,
+		clock:              clock,
+	}
+}
+
+func (s Service) TorrentCreated(ctx context.Context, event preview.TorrentCreatedEvent) error {
+	return s.enqueue(ctx, preview.WebhookTorrentCreated, event.TorrentID, event, time.Now())
+}
+
+func (s Service) ImageExtracted(ctx context.Context, event preview.ImageExtractedEvent) error {
+	return s.enqueue(ctx, preview.WebhookImageExtracted, event.TorrentID, event, event.ExtractedAt)
+}
+
+func (s Service) PreviewCompleted(ctx context.Context, event preview.TorrentPreviewCompletedEvent) error {
+	return s.enqueue(ctx, preview.WebhookPreviewCompleted, event.TorrentID, event, event.FinishedAt)
+}
+
+func (s Service) PreviewFailed(ctx context.Context, event preview.TorrentPreviewFailedEvent) error {
+	return s.enqueue(ctx, preview.WebhookPreviewFailed, event.TorrentID, event, event.FinishedAt)
+}
+
+// enqueue stores a delivery of the event for each webhook subscribed to it. They are sent by SendDue
+func (s Service) enqueue(ctx context.Context, event string, torrentID string, data interface{}, occurredAt time.Time) error {
+	webhooks, err := s.webhookRepository.Subscribed(ctx, event, torrentID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := make([]*preview.WebhookDelivery, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return err
+		}
+
+		body, err := json.Marshal(payload{
+			ID:         id.String(),
+			Event:      event,
+			TorrentID:  torrentID,
+			OccurredAt: occurredAt,
+			Data:       data,
+		})
+		if err != nil {
+			return err
+		}
+
+		deliveries = append(deliveries, preview.NewWebhookDelivery(id.String(), webhook.ID(), event, torrentID, body, now))
+	}
+
+	return s.deliveryRepository.Persist(ctx, deliveries...)
+}
+
+// SendDue posts the deliveries that are due, and records how it went. The deliveries of each
+// webhook are sent in order, and the webhooks concurrently, so a slow receiver does not hold the rest
+func (s Service) SendDue(ctx context.Context, now time.Time) error {
+	deliveries, err := s.deliveryRepository.Due(ctx, now, batchSize)
+	if err != nil {
+		return err
+	}
+
+	// A round sends no more deliveries to a webhook than fit in a lease, however slow the receiver is.
+	// The rest are due the next round
+	perWebhook := s.deliveriesPerWebhook()
+	byWebhook := make(map[string][]*preview.WebhookDelivery)
+	for _, delivery := range deliveries {
+		if len(byWebhook[delivery.WebhookID()]) < perWebhook {
+			byWebhook[delivery.WebhookID()] = append(byWebhook[delivery.WebhookID()], delivery)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(byWebhook))
+	slots := make(chan struct{}, maxConcurrentWebhooks)
+	for webhookID, deliveries := range byWebhook {
+		wg.Add(1)
+		go func(webhookID string, deliveries []*preview.WebhookDelivery) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			errs <- s.sendToWebhook(ctx, webhookID, deliveries)
+		}(webhookID, deliveries)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliveriesPerWebhook is how many deliveries are sent to a webhook in the time of a lease
+func (s Service) deliveriesPerWebhook() int {
+	if s.timeout <= 0 {
+		return batchSize
+	}
+	n := int(claimLease / s.timeout)
+	if n < 1 {
+		return 1
+	}
+	if n > batchSize {
+		return batchSize
+	}
+	return n
+}
+
+// sendToWebhook posts the deliveries of a webhook that nobody else has claimed. Each one is claimed
+// right before it is posted, so the lease does not run out while the previous ones are sent
+func (s Service) sendToWebhook(ctx context.Context, webhookID string, deliveries []*preview.WebhookDelivery) error {
+	webhook, err := s.webhookRepository.Get(ctx, webhookID)
+	if err != nil && !errors.Is(err, preview.ErrNotFound) {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		now := s.clock.Now()
+		claimed, err := s.deliveryRepository.Claim(ctx, delivery.ID(), now, now.Add(claimLease))
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		if webhook == nil {
+			delivery.Abandon(errWebhookRemoved)
+		} else {
+			s.send(ctx, webhook, delivery)
+		}
+
+		if err := s.deliveryRepository.Persist(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s Service) send(ctx context.Context, webhook *preview.Webhook, delivery *preview.WebhookDelivery) {
+	logger := s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"webhookID":  webhook.ID(),
+		"deliveryID": delivery.ID(),
+		"event":      delivery.Event(),
+		"torrentID":  delivery.TorrentID(),
+	})
+
+	status, err := s.sender.Send(ctx, webhook.URL(), delivery, webhook.Sign(delivery.Payload()))
+	now := s.clock.Now()
+	if err != nil {
+		delivery.Failed(status, err, s.policy, now)
+		logger.WithFields(logrus.Fields{
+			"error":    err,
+			"attempts": delivery.Attempts(),
+			"status":   delivery.Status(),
+		}).Warn("unable to deliver the webhook")
+		return
+	}
+
+	delivery.Delivered(status, now)
+	logger.Debug("webhook delivered")
+}
+
+// Run sends the due deliveries every interval until the context is cancelled
+func (s Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.SendDue(ctx, s.clock.Now()); err != nil {
+				s.logger.WithContext(ctx).WithFields(logrus.Fields{
+					"error": err,
+				}).Error("unable to send the webhook deliveries")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
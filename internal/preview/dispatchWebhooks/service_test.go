@@ -0,0 +1,304 @@
+package dispatchWebhooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/dispatchWebhooks"
+	"prevtorrent/internal/preview/platform/client/clientmocks"
+	"prevtorrent/internal/preview/platform/client/webhookhttp"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const torrentID = "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+var (
+	now    = time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	policy = preview.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+)
+
+const timeout = 10 * time.Second
+
+func TestService_PreviewCompleted_EnqueuesADeliveryPerWebhook(t *testing.T) {
+	event := preview.TorrentPreviewCompletedEvent{TorrentID: torrentID, Parts: 2, Images: 2, StartedAt: now, FinishedAt: now}
+
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Subscribed", mock.Anything, preview.WebhookPreviewCompleted, torrentID).
+		Return([]*preview.Webhook{
+			preview.RestoreWebhook("e9c6", "https://example.com/all", "s3cr3t", "", nil, now),
+			preview.RestoreWebhook("f00d", "https://example.com/cb84", "s3cr3t", torrentID, nil, now),
+		}, nil)
+
+	isDeliveryTo := func(webhookID string) interface{} {
+		return mock.MatchedBy(func(d *preview.WebhookDelivery) bool {
+			var body map[string]interface{}
+			return d.WebhookID() == webhookID &&
+				d.Status() == preview.DeliveryPending &&
+				json.Unmarshal(d.Payload(), &body) == nil &&
+				body["id"] == d.ID() &&
+				body["event"] == preview.WebhookPreviewCompleted &&
+				body["torrent_id"] == torrentID &&
+				body["occurred_at"] == "2021-03-01T10:00:00Z" &&
+				body["data"].(map[string]interface{})["Images"] == float64(2)
+		})
+	}
+	deliveryRepository := new(storagemocks.WebhookDeliveryRepository)
+	deliveryRepository.On("Persist", mock.Anything, isDeliveryTo("e9c6"), isDeliveryTo("f00d")).Return(nil)
+
+	service := dispatchWebhooks.NewService(fakeLogger(), webhookRepository, deliveryRepository, new(clientmocks.WebhookSender), policy, timeout, fixedClock{now})
+	require.NoError(t, service.PreviewCompleted(context.Background(), event))
+	deliveryRepository.AssertExpectations(t)
+}
+
+func TestService_SendDue_SignsThePayload(t *testing.T) {
+	webhook := preview.RestoreWebhook("e9c6", "https://example.com/hooks", "s3cr3t", "", nil, now)
+	delivery := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte(`{}`), now)
+
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Get", mock.Anything, "e9c6").Return(webhook, nil).Once()
+
+	deliveryRepository := new(storagemocks.WebhookDeliveryRepository)
+	deliveryRepository.On("Due", mock.Anything, now, 100).Return([]*preview.WebhookDelivery{delivery}, nil)
+	deliveryRepository.On("Claim", mock.Anything, "d1", now, now.Add(5*time.Minute)).Return(true, nil)
+	deliveryRepository.On("Persist", mock.Anything, mock.MatchedBy(func(d *preview.WebhookDelivery) bool {
+		return d.Status() == preview.DeliveryDelivered && d.ResponseStatus() == 200
+	})).Return(nil)
+
+	sender := new(clientmocks.WebhookSender)
+	sender.On("Send", mock.Anything, "https://example.com/hooks", delivery, webhook.Sign([]byte(`{}`))).
+		Return(200, nil)
+
+	service := dispatchWebhooks.NewService(fakeLogger(), webhookRepository, deliveryRepository, sender, policy, timeout, fixedClock{now})
+	require.NoError(t, service.SendDue(context.Background(), now))
+	sender.AssertExpectations(t)
+	deliveryRepository.AssertExpectations(t)
+}
+
+func TestService_SendDue_RetriesLater(t *testing.T) {
+	webhook := preview.RestoreWebhook("e9c6", "https://example.com/hooks", "s3cr3t", "", nil, now)
+	delivery := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte(`{}`), now)
+
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Get", mock.Anything, "e9c6").Return(webhook, nil)
+
+	deliveryRepository := new(storagemocks.WebhookDeliveryRepository)
+	deliveryRepository.On("Due", mock.Anything, now, 100).Return([]*preview.WebhookDelivery{delivery}, nil)
+	deliveryRepository.On("Claim", mock.Anything, "d1", now, now.Add(5*time.Minute)).Return(true, nil)
+	deliveryRepository.On("Persist", mock.Anything, mock.MatchedBy(func(d *preview.WebhookDelivery) bool {
+		return d.Status() == preview.DeliveryPending &&
+			d.Attempts() == 1 &&
+			d.ResponseStatus() == 503 &&
+			d.NextAttemptAt().Equal(now.Add(time.Minute))
+	})).Return(nil)
+
+	sender := new(clientmocks.WebhookSender)
+	sender.On("Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(503, errors.New("unexpected status 503"))
+
+	service := dispatchWebhooks.NewService(fakeLogger(), webhookRepository, deliveryRepository, sender, policy, timeout, fixedClock{now})
+	require.NoError(t, service.SendDue(context.Background(), now))
+	deliveryRepository.AssertExpectations(t)
+}
+
+func TestService_SendDue_WebhookRemoved(t *testing.T) {
+	delivery := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte(`{}`), now)
+
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Get", mock.Anything, "e9c6").Return(nil, preview.ErrNotFound)
+
+	deliveryRepository := new(storagemocks.WebhookDeliveryRepository)
+	deliveryRepository.On("Due", mock.Anything, now, 100).Return([]*preview.WebhookDelivery{delivery}, nil)
+	deliveryRepository.On("Claim", mock.Anything, "d1", now, now.Add(5*time.Minute)).Return(true, nil)
+	deliveryRepository.On("Persist", mock.Anything, mock.MatchedBy(func(d *preview.WebhookDelivery) bool {
+		return d.Status() == preview.DeliveryFailed && d.Attempts() == 0
+	})).Return(nil)
+
+	sender := new(clientmocks.WebhookSender)
+
+	service := dispatchWebhooks.NewService(fakeLogger(), webhookRepository, deliveryRepository, sender, policy, timeout, fixedClock{now})
+	require.NoError(t, service.SendDue(context.Background(), now))
+	sender.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	deliveryRepository.AssertExpectations(t)
+}
+
+func TestService_SendDue_SkipsTheDeliveriesClaimedByOthers(t *testing.T) {
+	webhook := preview.RestoreWebhook("e9c6", "https://example.com/hooks", "s3cr3t", "", nil, now)
+	delivery := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte(`{}`), now)
+
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Get", mock.Anything, "e9c6").Return(webhook, nil)
+
+	deliveryRepository := new(storagemocks.WebhookDeliveryRepository)
+	deliveryRepository.On("Due", mock.Anything, now, 100).Return([]*preview.WebhookDelivery{delivery}, nil)
+	deliveryRepository.On("Claim", mock.Anything, "d1", now, mock.Anything).Return(false, nil)
+
+	sender := new(clientmocks.WebhookSender)
+
+	service := dispatchWebhooks.NewService(fakeLogger(), webhookRepository, deliveryRepository, sender, policy, timeout, fixedClock{now})
+	require.NoError(t, service.SendDue(context.Background(), now))
+	sender.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	deliveryRepository.AssertNotCalled(t, "Persist", mock.Anything, mock.Anything)
+}
+
+func TestService_SendDue_WebhooksAreSentConcurrently(t *testing.T) {
+	slow := preview.RestoreWebhook("e9c6", "https://slow.example.com/hooks", "s3cr3t", "", nil, now)
+	fast := preview.RestoreWebhook("f00d", "https://fast.example.com/hooks", "s3cr3t", "", nil, now)
+	toSlow := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte(`{}`), now)
+	toFast := preview.NewWebhookDelivery("d2", "f00d", preview.WebhookTorrentCreated, torrentID, []byte(`{}`), now)
+
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Get", mock.Anything, "e9c6").Return(slow, nil)
+	webhookRepository.On("Get", mock.Anything, "f00d").Return(fast, nil)
+
+	deliveryRepository := new(storagemocks.WebhookDeliveryRepository)
+	deliveryRepository.On("Due", mock.Anything, now, 100).Return([]*preview.WebhookDelivery{toSlow, toFast}, nil)
+	deliveryRepository.On("Claim", mock.Anything, mock.Anything, now, mock.Anything).Return(true, nil)
+	deliveryRepository.On("Persist", mock.Anything, mock.Anything).Return(nil)
+
+	// The slow receiver answers once the fast one has
+	fastDone := make(chan struct{})
+	sender := new(clientmocks.WebhookSender)
+	sender.On("Send", mock.Anything, "https://fast.example.com/hooks", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { close(fastDone) }).Return(200, nil)
+	sender.On("Send", mock.Anything, "https://slow.example.com/hooks", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { <-fastDone }).Return(200, nil)
+
+	service := dispatchWebhooks.NewService(fakeLogger(), webhookRepository, deliveryRepository, sender, policy, timeout, fixedClock{now})
+	require.NoError(t, service.SendDue(context.Background(), now))
+	assert.Equal(t, preview.DeliveryDelivered, toSlow.Status())
+	assert.Equal(t, preview.DeliveryDelivered, toFast.Status())
+}
+
+func TestService_SendDue_ClaimsEachDeliveryWhenItIsSent(t *testing.T) {
+	webhook := preview.RestoreWebhook("e9c6", "https://example.com/hooks", "s3cr3t", "", nil, now)
+	first := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte(`{}`), now)
+	second := preview.NewWebhookDelivery("d2", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte(`{}`), now)
+
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Get", mock.Anything, "e9c6").Return(webhook, nil)
+
+	// Each call to the clock is a minute later, as if each post took that long
+	clock := &steppingClock{now: now, step: time.Minute}
+	deliveryRepository := new(storagemocks.WebhookDeliveryRepository)
+	deliveryRepository.On("Due", mock.Anything, now, 100).Return([]*preview.WebhookDelivery{first, second}, nil)
+	deliveryRepository.On("Claim", mock.Anything, "d1", now, now.Add(5*time.Minute)).Return(true, nil)
+	deliveryRepository.On("Claim", mock.Anything, "d2", now.Add(2*time.Minute), now.Add(7*time.Minute)).Return(true, nil)
+	deliveryRepository.On("Persist", mock.Anything, mock.Anything).Return(nil)
+
+	sender := new(clientmocks.WebhookSender)
+	sender.On("Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(200, nil)
+
+	service := dispatchWebhooks.NewService(fakeLogger(), webhookRepository, deliveryRepository, sender, policy, timeout, clock)
+	require.NoError(t, service.SendDue(context.Background(), now))
+	deliveryRepository.AssertExpectations(t)
+	assert.Equal(t, now.Add(time.Minute), first.DeliveredAt())
+}
+
+func TestService_SendDue_SendsToAWebhookWhatFitsInALease(t *testing.T) {
+	webhook := preview.RestoreWebhook("e9c6", "https://example.com/hooks", "s3cr3t", "", nil, now)
+	deliveries := []*preview.WebhookDelivery{
+		preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte(`{}`), now),
+		preview.NewWebhookDelivery("d2", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte(`{}`), now),
+		preview.NewWebhookDelivery("d3", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte(`{}`), now),
+	}
+
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Get", mock.Anything, "e9c6").Return(webhook, nil)
+
+	deliveryRepository := new(storagemocks.WebhookDeliveryRepository)
+	deliveryRepository.On("Due", mock.Anything, now, 100).Return(deliveries, nil)
+	deliveryRepository.On("Claim", mock.Anything, mock.Anything, now, mock.Anything).Return(true, nil)
+	deliveryRepository.On("Persist", mock.Anything, mock.Anything).Return(nil)
+
+	sender := new(clientmocks.WebhookSender)
+	sender.On("Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(200, nil)
+
+	// Only two posts timing out fit in the lease of five minutes
+	service := dispatchWebhooks.NewService(fakeLogger(), webhookRepository, deliveryRepository, sender, policy, 2*time.Minute, fixedClock{now})
+	require.NoError(t, service.SendDue(context.Background(), now))
+	deliveryRepository.AssertNotCalled(t, "Claim", mock.Anything, "d3", mock.Anything, mock.Anything)
+	assert.Equal(t, preview.DeliveryPending, deliveries[2].Status())
+}
+
+// The receiver checks the signature the way the API clients are told to
+func TestService_SendDue_ToAReceiver(t *testing.T) {
+	received := make(chan bool, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		expected := preview.RestoreWebhook("", "", "s3cr3t", "", nil, now).Sign(body)
+		if r.Header.Get(webhookhttp.HeaderSignature) != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received <- true
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer receiver.Close()
+
+	webhook := preview.RestoreWebhook("e9c6", receiver.URL, "s3cr3t", "", nil, now)
+	delivery := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte(`{"torrent_id":"cb84"}`), now)
+
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Get", mock.Anything, "e9c6").Return(webhook, nil)
+
+	deliveryRepository := new(storagemocks.WebhookDeliveryRepository)
+	deliveryRepository.On("Due", mock.Anything, now, 100).Return([]*preview.WebhookDelivery{delivery}, nil)
+	deliveryRepository.On("Claim", mock.Anything, "d1", now, now.Add(5*time.Minute)).Return(true, nil)
+	deliveryRepository.On("Persist", mock.Anything, mock.Anything).Return(nil)
+
+	service := dispatchWebhooks.NewService(fakeLogger(), webhookRepository, deliveryRepository, webhookhttp.NewSender(receiver.Client()), policy, timeout, fixedClock{now})
+	require.NoError(t, service.SendDue(context.Background(), now))
+
+	assert.Len(t, received, 1)
+	assert.Equal(t, preview.DeliveryDelivered, delivery.Status())
+	assert.Equal(t, http.StatusAccepted, delivery.ResponseStatus())
+}
+
+func fakeLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func (c fixedClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// steppingClock moves forward each time it is read
+type steppingClock struct {
+	now  time.Time
+	step time.Duration
+	mux  sync.Mutex
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+func (c *steppingClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -4,12 +4,49 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
+var ErrDeadlineExceeded = errors.New("the deadline to download the torrent has been exceeded")
+
+// DownloadLimits bounds how long we wait for the pieces of a DownloadPlan. Zero values
+// mean that the defaults of the downloader are used
+type DownloadLimits struct {
+	MaxDownloadTime time.Duration // how long we wait for the pieces once the download has started
+	SeederWaitTime  time.Duration // how long we wait for a seeder before giving up
+	Deadline        time.Time     // when we give up, no matter what. Meant for interactive requests
+}
+
+// Or returns the limits, using the defaults for the ones not set
+func (l DownloadLimits) Or(defaults DownloadLimits) DownloadLimits {
+	if l.MaxDownloadTime == 0 {
+		l.MaxDownloadTime = defaults.MaxDownloadTime
+	}
+	if l.SeederWaitTime == 0 {
+		l.SeederWaitTime = defaults.SeederWaitTime
+	}
+	if l.Deadline.IsZero() {
+		l.Deadline = defaults.Deadline
+	}
+	return l
+}
+
+// HasDeadline returns true if there is a deadline set
+func (l DownloadLimits) HasDeadline() bool {
+	return !l.Deadline.IsZero()
+}
+
+// IsExpired returns true if the deadline has passed
+func (l DownloadLimits) IsExpired(now time.Time) bool {
+	return l.HasDeadline() && !now.Before(l.Deadline)
+}
+
 // DownloadPlan helps to describe what we want to download from the torrent.
 type DownloadPlan struct {
 	torrent     Torrent
 	pieceRanges []PieceRange
+	limits      DownloadLimits
+	urgent      bool // somebody is waiting for the pieces, in order
 }
 
 // NewDownloadPlan returns a DownloadPlan
@@ -20,11 +57,55 @@ func NewDownloadPlan(torrent Torrent) *DownloadPlan {
 	}
 }
 
+// NewStreamPlan returns a DownloadPlan to stream a portion of a file. Each PieceRange holds a single
+// piece, so each one can be sent as soon as it has been downloaded. The plan is urgent: the pieces
+// are expected to be downloaded before any other, in order.
+func NewStreamPlan(torrent Torrent, file File, offset int, length int) (*DownloadPlan, error) {
+	if offset < 0 || length <= 0 || offset+length > file.Length() {
+		return nil, fmt.Errorf("invalid window to stream. offset=%v, length=%v, file length=%v", offset, length, file.Length())
+	}
+
+	dp := NewDownloadPlan(torrent)
+	dp.urgent = true
+
+	fileStart := findStartingByteOfFile(torrent, file)
+	for pos := offset; pos < offset+length; {
+		nextPiece := ((fileStart+pos)/torrent.pieceLength + 1) * torrent.pieceLength
+		n := nextPiece - (fileStart + pos)
+		if pos+n > offset+length {
+			n = offset + length - pos
+		}
+
+		pr, err := NewPieceRange(torrent, file, fileStart, pos, n)
+		if err != nil {
+			return nil, err
+		}
+		dp.addToDownloadPlan(pr)
+		pos += n
+	}
+	return dp, nil
+}
+
 // GetTorrent returns the Torrent to download
 func (dp *DownloadPlan) GetTorrent() Torrent {
 	return dp.torrent
 }
 
+// Limits returns how long we are willing to wait for the pieces of the plan
+func (dp *DownloadPlan) Limits() DownloadLimits {
+	return dp.limits
+}
+
+// SetLimits sets how long we are willing to wait for the pieces of the plan
+func (dp *DownloadPlan) SetLimits(limits DownloadLimits) {
+	dp.limits = limits
+}
+
+// IsUrgent returns true if the pieces are needed right now, in order
+func (dp *DownloadPlan) IsUrgent() bool {
+	return dp.urgent
+}
+
 // GetPlan returns the plan to download. Each PieceRange usually is a part of a file,
 // but could describe various data ranges from the same file.
 func (dp *DownloadPlan) GetPlan() []PieceRange {
@@ -80,6 +161,30 @@ func (dp *DownloadPlan) AddAll(torrentImages *TorrentImages) error {
 	return nil
 }
 
+// AddFiles works like AddAll, but only with the given files. All the supported files are added if
+// none is given
+func (dp *DownloadPlan) AddFiles(torrentImages *TorrentImages, fileIDs []int) error {
+	if len(fileIDs) == 0 {
+		return dp.AddAll(torrentImages)
+	}
+
+	added := make(map[int]bool, len(fileIDs))
+	for _, id := range fileIDs {
+		if added[id] {
+			continue
+		}
+		file, err := dp.torrent.SupportedFile(id)
+		if err != nil {
+			return err
+		}
+		if err := dp.addDownloadToPlan(file, torrentImages, 0, file.DownloadSize()); err != nil {
+			return err
+		}
+		added[id] = true
+	}
+	return nil
+}
+
 // CountPieces returns the number of unique pieces to be downloaded. Remember the multiple PieceRange,
 // could share some pieces.
 func (dp *DownloadPlan) CountPieces() int {
@@ -202,6 +307,11 @@ func (p PieceRange) Name() string {
 	)
 }
 
+// ClipName returns the name of the clip of the file. It's supposed to be HTTP friendly
+func (p PieceRange) ClipName() string {
+	return strings.TrimSuffix(p.Name(), ".jpg") + ".mp4"
+}
+
 // FileID returns the obvious
 func (p PieceRange) FileID() int {
 	return p.file.ID()
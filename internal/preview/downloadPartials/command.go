@@ -1,5 +1,10 @@
 package downloadPartials
 
+import (
+	"prevtorrent/internal/preview"
+	"time"
+)
+
 type File struct {
 	FileID int
 	Start  int
@@ -9,4 +14,42 @@ type File struct {
 type CMD struct {
 	ID    string
 	Files []File
+	// Optional. The defaults of the configuration are used when not set
+	MaxDownloadTime time.Duration
+	SeederWaitTime  time.Duration
+	Deadline        time.Time
+	// Optional. Downloads the segments even if we already have their images, replacing them
+	Force bool
+	// Optional. Commands with the same key are handled only once
+	IdempotencyKey string
+}
+
+// DeduplicationKey implements dedup.Keyed
+func (c CMD) DeduplicationKey() string {
+	return c.IdempotencyKey
+}
+
+func (c CMD) limits() preview.DownloadLimits {
+	return preview.DownloadLimits{
+		MaxDownloadTime: c.MaxDownloadTime,
+		SeederWaitTime:  c.SeederWaitTime,
+		Deadline:        c.Deadline,
+	}
+}
+
+func (c CMD) segments() []preview.FileSegment {
+	segments := make([]preview.FileSegment, 0, len(c.Files))
+	for _, f := range c.Files {
+		segments = append(segments, preview.FileSegment{FileID: f.FileID, Start: f.Start, Length: f.Length})
+	}
+	return segments
+}
+
+// NewCMD returns a CMD to download the given segments of a torrent
+func NewCMD(torrentID string, segments []preview.FileSegment) CMD {
+	files := make([]File, 0, len(segments))
+	for _, s := range segments {
+		files = append(files, File{FileID: s.FileID, Start: s.Start, Length: s.Length})
+	}
+	return CMD{ID: torrentID, Files: files}
 }
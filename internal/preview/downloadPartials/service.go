@@ -3,81 +3,185 @@ package downloadPartials
 import (
 	"context"
 	"errors"
+	"fmt"
+	"prevtorrent/internal/platform/bus"
 	"prevtorrent/internal/preview"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 const (
 	frameTimeToExtract = 5 // in seconds
+	maxUpdateAttempts  = 5
 )
 
+// errTorrentDeleted stops the download of a torrent deleted while it was being downloaded
+var errTorrentDeleted = errors.New("the torrent has been deleted")
+
 type Service struct {
 	logger            *logrus.Logger
+	eventBus          bus.Event
 	torrentRepository preview.TorrentRepository
 	torrentDownloader preview.TorrentDownloader
 	imageExtractor    preview.ImageExtractor
 	imagePersister    preview.ImagePersister
 	imageRepository   preview.ImageRepository
+	clipExtractor     preview.ClipExtractor
+	clipRepository    preview.ClipRepository
+	clipLimits        preview.ClipLimits
 }
 
 func NewService(
 	logger *logrus.Logger,
+	eventBus bus.Event,
 	torrentRepository preview.TorrentRepository,
 	torrentDownloader preview.TorrentDownloader,
 	imageExtractor preview.ImageExtractor,
 	imagePersister preview.ImagePersister,
 	imageRepository preview.ImageRepository,
+	clipExtractor preview.ClipExtractor,
+	clipRepository preview.ClipRepository,
+	clipLimits preview.ClipLimits,
 ) Service {
 	return Service{
 		logger:            logger,
+		eventBus:          eventBus,
 		torrentRepository: torrentRepository,
 		torrentDownloader: torrentDownloader,
 		imageExtractor:    imageExtractor,
 		imagePersister:    imagePersister,
 		imageRepository:   imageRepository,
+		clipExtractor:     clipExtractor,
+		clipRepository:    clipRepository,
+		clipLimits:        clipLimits,
 	}
 }
 
 func (s Service) DownloadPartials(ctx context.Context, cmd CMD) error {
 	torrent, err := s.torrentRepository.Get(ctx, cmd.ID)
+	if isDeleted(torrent, err) {
+		// The torrent has been deleted since the command was sent, e.g. by a retry
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"torrentID": cmd.ID,
+		}).Info("the torrent has been deleted, nothing to download")
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
 	if len(cmd.Files) == 0 {
-		s.logger.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"torrentID": torrent.ID(),
 			"name":      torrent.Name(),
 		}).Debug("the download plan have 0 files thus nothing to do")
-		return nil
+		return s.finished(ctx, torrent.ID(), nil)
 	}
 
-	s.logger.WithFields(logrus.Fields{
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"torrentID": torrent.ID(),
 		"name":      torrent.Name(),
 	}).Debug("torrent to be processed")
 
+	if err := s.changeStatus(ctx, &torrent, preview.StatusDownloading, nil); err != nil {
+		return err
+	}
+
+	result, err := s.downloadPartials(ctx, &torrent, cmd)
+	switch {
+	case errors.Is(err, errTorrentDeleted):
+		// Its saga and its retries have been deleted along with it, nobody waits for this download
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"torrentID": torrent.ID(),
+			"images":    result.generated,
+		}).Info("the torrent has been deleted, download stopped")
+		return nil
+	case errors.Is(err, preview.ErrNoSeeders):
+		if err := s.changeStatus(ctx, &torrent, preview.StatusNoSeeders, err); err != nil {
+			return err
+		}
+		// The retries are scheduled by whoever listens to this event
+		event := preview.NewNoSeedersFoundEvent(torrent.ID(), cmd.segments(), err, time.Now())
+		event.Limits, event.Force = cmd.limits(), cmd.Force
+		return s.eventBus.Publish(ctx, event)
+	case errors.Is(err, preview.ErrDeadlineExceeded):
+		// Retrying the command would be useless, the deadline is not going to move
+		if err := s.changeStatus(ctx, &torrent, preview.StatusFailed, err); err != nil {
+			return err
+		}
+		return s.finished(ctx, torrent.ID(), err)
+	case err != nil:
+		if statusErr := s.changeStatus(ctx, &torrent, preview.StatusFailed, err); statusErr != nil {
+			s.logger.WithContext(ctx).WithFields(logrus.Fields{
+				"torrentID": torrent.ID(),
+				"error":     statusErr,
+			}).Error("unable to mark the torrent as failed")
+		}
+		return err
+	case result.isComplete():
+		if err := s.changeStatus(ctx, &torrent, preview.StatusCompleted, nil); err != nil {
+			return err
+		}
+		return s.finished(ctx, torrent.ID(), nil)
+	}
+
+	if err := s.changeStatus(ctx, &torrent, preview.StatusPartiallyCompleted, nil); err != nil {
+		return err
+	}
+	if len(result.missing) == 0 {
+		return s.finished(ctx, torrent.ID(), nil)
+	}
+
+	event := preview.NewDownloadIncompleteEvent(torrent.ID(), result.missing, time.Now())
+	event.Limits, event.Force = cmd.limits(), cmd.Force
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"torrentID":     torrent.ID(),
+		"rangesMissing": len(event.Ranges),
+		"piecesMissing": event.PiecesMissing(),
+	}).Info("download finished with missing pieces")
+
+	// The missing ranges are downloaded again by whoever listens to this event
+	return s.eventBus.Publish(ctx, event)
+}
+
+// result counts the images we expected from a DownloadPlan and the ones we have been able to generate,
+// and keeps the ranges that have not been downloaded
+type result struct {
+	expected  int
+	generated int
+	missing   []preview.MissingRange
+}
+
+func (r result) isComplete() bool {
+	return r.generated == r.expected
+}
+
+func (s Service) downloadPartials(ctx context.Context, torrent *preview.Torrent, cmd CMD) (result, error) {
 	torrentImages, err := s.imageRepository.ByTorrent(ctx, cmd.ID)
 	if err != nil {
-		return err
+		return result{}, err
 	}
 
-	s.logger.WithFields(logrus.Fields{
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"torrentID":          torrent.ID(),
 		"name":               torrent.Name(),
 		"imagesTorrentCount": len(torrentImages.Images()),
 	}).Debug("images that we already have for the torrent")
 
-	plan := preview.NewDownloadPlan(torrent)
+	if cmd.Force {
+		torrentImages = preview.NewTorrentImages(nil)
+	}
+
+	plan := preview.NewDownloadPlan(*torrent)
 	for _, file := range cmd.Files {
 		f := torrent.File(file.FileID)
 		if err := plan.Add(torrentImages, f, file.Start, file.Length); err != nil {
-			return err
+			return result{}, err
 		}
 	}
 
-	s.logger.WithFields(logrus.Fields{
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"torrentID":        torrent.ID(),
 		"name":             torrent.Name(),
 		"pieceLength":      torrent.PieceLength(),
@@ -85,13 +189,33 @@ func (s Service) DownloadPartials(ctx context.Context, cmd CMD) error {
 		"downloadPlanSize": plan.DownloadSize(),
 	}).Debug("pieces to download")
 
+	plan.SetLimits(cmd.limits())
+	if plan.Limits().IsExpired(time.Now()) {
+		return result{}, preview.ErrDeadlineExceeded
+	}
+
+	res := result{expected: len(plan.GetPlan())}
 	registry, err := s.torrentDownloader.DownloadParts(ctx, *plan)
+	if errors.Is(err, preview.ErrPriceRegistryWithNothingToWaitFor) {
+		return res, nil // We already have all the images of the plan
+	}
 	if err != nil {
-		return err
+		return res, err
 	}
 
 	err = registry.RunOnPieceReady(ctx, func(part preview.PieceRange) error {
-		downloaded, err := s.getBundle(registry, part)
+		s.publish(ctx, preview.NewPieceRangeCompletedEvent(part, time.Now()))
+
+		if torrent.Status() != preview.StatusExtracting {
+			if err := s.changeStatus(ctx, torrent, preview.StatusExtracting, nil); err != nil {
+				return err
+			}
+		}
+
+		downloaded, err := s.getBundle(ctx, registry, part)
+		if errors.Is(err, preview.ErrCorruptPiece) {
+			return nil // The range is reported as missing, thus is going to be downloaded again
+		}
 		if err != nil {
 			return err
 		}
@@ -100,6 +224,13 @@ func (s Service) DownloadPartials(ctx context.Context, cmd CMD) error {
 			return err
 		}
 
+		// A forced deletion does not wait for the downloads in progress, which must not store anything afterwards
+		if stored, err := s.torrentRepository.Get(ctx, torrent.ID()); isDeleted(stored, err) {
+			return errTorrentDeleted
+		} else if err != nil {
+			return err
+		}
+
 		if err := s.storeBinaryImage(ctx, imgBytes, part.Name(), part); err != nil {
 			return err
 		}
@@ -114,13 +245,75 @@ func (s Service) DownloadPartials(ctx context.Context, cmd CMD) error {
 			return err
 		}
 
+		if img.Length() != 0 {
+			res.generated++
+			s.publish(ctx, preview.NewImageExtractedEvent(img, time.Now()))
+			s.generateClip(ctx, part, downloaded)
+		}
 		return nil
 	})
-	return err
+	if err != nil {
+		return res, err
+	}
+
+	res.missing = registry.MissingRanges()
+	return res, nil
 }
 
-func (s Service) getBundle(registry *preview.PieceRegistry, part preview.PieceRange) (preview.MediaPart, error) {
-	s.logger.WithFields(logrus.Fields{
+// isDeleted tells whether the torrent read is deleted, or being deleted
+func isDeleted(torrent preview.Torrent, err error) bool {
+	return errors.Is(err, preview.ErrNotFound) || (err == nil && torrent.Status() == preview.StatusDeleting)
+}
+
+// publish sends an event nobody in the process of the download depends on, thus failures are only logged
+func (s Service) publish(ctx context.Context, event interface{}) {
+	if err := s.eventBus.Publish(ctx, event); err != nil {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"event": fmt.Sprintf("%T", event),
+			"error": err,
+		}).Warn("unable to publish the event")
+	}
+}
+
+// finished tells the download is not going to be tried again, so whoever follows the plan can tell
+// when all its downloads are done
+func (s Service) finished(ctx context.Context, torrentID string, reason error) error {
+	return s.eventBus.Publish(ctx, preview.NewPartialDownloadFinishedEvent(torrentID, reason, time.Now()))
+}
+
+// changeStatus stores the new status only if nobody changed the stored one in the meantime.
+// The downloads of a plan run concurrently, so on a conflict the torrent is read again and the
+// status is only changed if the transition is still valid, otherwise the one set by the other download is kept
+func (s Service) changeStatus(ctx context.Context, torrent *preview.Torrent, status preview.Status, reason error) error {
+	for attempt := 1; ; attempt++ {
+		previous := torrent.Status()
+		if err := torrent.ChangeStatus(status, reason); err != nil {
+			if attempt > 1 && errors.Is(err, preview.ErrInvalidStatusTransition) {
+				s.logger.WithContext(ctx).WithFields(logrus.Fields{
+					"torrentID": torrent.ID(),
+					"status":    previous,
+					"wanted":    status,
+				}).Debug("status changed by another download, kept")
+				return nil
+			}
+			return err
+		}
+
+		err := s.torrentRepository.UpdateStatusFrom(ctx, *torrent, previous)
+		if !errors.Is(err, preview.ErrConcurrentUpdate) || attempt == maxUpdateAttempts {
+			return err
+		}
+
+		stored, err := s.torrentRepository.Get(ctx, torrent.ID())
+		if err != nil {
+			return err
+		}
+		*torrent = stored
+	}
+}
+
+func (s Service) getBundle(ctx context.Context, registry *preview.PieceRegistry, part preview.PieceRange) (preview.MediaPart, error) {
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"torrentID":  part.Torrent().ID(),
 		"name":       part.Name(),
 		"pieceCount": part.PieceCount(),
@@ -128,7 +321,7 @@ func (s Service) getBundle(registry *preview.PieceRegistry, part preview.PieceRa
 	bundle := preview.NewBundlePlan()
 	downloadedPart, err := bundle.Bundle(registry, part)
 	if err != nil {
-		s.logger.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"torrentID":  part.Torrent().ID(),
 			"name":       part.Name(),
 			"pieceCount": part.PieceCount(),
@@ -141,20 +334,21 @@ func (s Service) getBundle(registry *preview.PieceRegistry, part preview.PieceRa
 }
 
 func (s Service) extractImage(ctx context.Context, part preview.PieceRange, downloadedPart preview.MediaPart) ([]byte, error) {
-	img, err := s.imageExtractor.ExtractImage(ctx, downloadedPart.Data(), frameTimeToExtract)
+	img, err := s.imageExtractor.ExtractImage(ctx, downloadedPart.Reader(), frameTimeToExtract)
 	if errors.Is(err, preview.ErrAtomNotFound) || errors.Is(err, preview.ErrNotAbleToGenerateImage) {
-		s.logger.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"torrentID":  part.Torrent().ID(),
 			"name":       part.Name(),
 			"pieceCount": part.PieceCount(),
 			"error":      err,
 			"imgBytes":   len(img),
 		}).Warn("atom not found error, ignoring video")
+		s.publish(ctx, preview.NewImageExtractionFailedEvent(part, err, time.Now()))
 		return nil, nil
 	}
 
 	if err != nil {
-		s.logger.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"torrentID":  part.Torrent().ID(),
 			"name":       part.Name(),
 			"pieceCount": part.PieceCount(),
@@ -163,7 +357,7 @@ func (s Service) extractImage(ctx context.Context, part preview.PieceRange, down
 		}).Error("error when extracting image from video")
 		return nil, err
 	}
-	s.logger.WithFields(logrus.Fields{
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"torrentID": part.Torrent().ID(),
 		"name":      part.Name(),
 	}).Debug("image extracted successfully")
@@ -171,12 +365,50 @@ func (s Service) extractImage(ctx context.Context, part preview.PieceRange, down
 	return img, nil
 }
 
+// generateClip transcodes a short clip of the video, if enabled. Clips are optional, thus
+// failures are logged and ignored
+func (s Service) generateClip(ctx context.Context, part preview.PieceRange, downloadedPart preview.MediaPart) {
+	if !s.clipLimits.Enabled {
+		return
+	}
+
+	logger := s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"torrentID": part.Torrent().ID(),
+		"name":      part.ClipName(),
+	})
+
+	clip, duration, err := s.clipExtractor.ExtractClip(ctx, downloadedPart.Reader(), s.clipLimits)
+	if err != nil {
+		logger.WithField("error", err).Warn("unable to generate the clip")
+		return
+	}
+	if s.clipLimits.MaxSize > 0 && len(clip) > s.clipLimits.MaxSize {
+		logger.WithField("clipBytes", len(clip)).Warn("clip bigger than allowed, discarding it")
+		return
+	}
+
+	if err := s.imagePersister.PersistFile(ctx, part.ClipName(), clip); err != nil {
+		logger.WithField("error", err).Warn("unable to persist the clip")
+		return
+	}
+	c := preview.NewClip(part.Torrent().ID(), part.FileID(), part.ClipName(), duration, len(clip))
+	if err := s.clipRepository.Persist(ctx, c); err != nil {
+		logger.WithField("error", err).Warn("unable to persist the clip")
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"duration":  duration,
+		"clipBytes": len(clip),
+	}).Debug("clip generated successfully")
+}
+
 func (s Service) storeBinaryImage(ctx context.Context, img []byte, name string, part preview.PieceRange) error {
 	err := s.imagePersister.PersistFile(ctx, name, img)
 	if err != nil {
 		return err
 	}
-	s.logger.WithFields(logrus.Fields{
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"torrentID": part.Torrent().ID(),
 		"name":      name,
 	}).Debug("image persisted successfully")
@@ -2,12 +2,17 @@ package downloadPartials_test
 
 import (
 	"context"
+	"crypto/sha1"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"prevtorrent/internal/platform/bus/busmocks"
 	"prevtorrent/internal/preview"
 	"prevtorrent/internal/preview/downloadPartials"
 	"prevtorrent/internal/preview/platform/client/clientmocks"
 	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"strings"
 	"testing"
 	"time"
 
@@ -32,13 +37,19 @@ func TestService_DownloadPartials_GetTorrentError(t *testing.T) {
 
 	imageRepository := new(storagemocks.ImageRepository)
 
+	eventBus := new(busmocks.Event)
+
 	service := downloadPartials.NewService(
 		fakeLogger(),
+		eventBus,
 		torrentRepository,
 		torrentDownloader,
 		imageExtractor,
 		imagePersister,
 		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
 	)
 
 	cmd := downloadPartials.CMD{ID: torrentID}
@@ -46,6 +57,44 @@ func TestService_DownloadPartials_GetTorrentError(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestService_DownloadPartials_TorrentDeleted(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 100, "video.mp4")
+	assert.NoError(t, err)
+	deleting, err := preview.NewInfo(torrentID, "test torrent", 100, []preview.File{f}, []byte("torrent-data"))
+	assert.NoError(t, err)
+	deleting.RestoreStatus(preview.StatusDeleting, "")
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(preview.Torrent{}, preview.ErrNotFound).Once()
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(deleting, nil).Once()
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+
+	service := downloadPartials.NewService(
+		fakeLogger(),
+		new(busmocks.Event),
+		torrentRepository,
+		torrentDownloader,
+		new(storagemocks.ImageExtractor),
+		new(storagemocks.ImagePersister),
+		new(storagemocks.ImageRepository),
+		nil,
+		nil,
+		preview.ClipLimits{},
+	)
+
+	cmd := downloadPartials.CMD{
+		ID:    torrentID,
+		Files: []downloadPartials.File{{FileID: 0, Start: 0, Length: 100}},
+	}
+	require.NoError(t, service.DownloadPartials(context.Background(), cmd))
+	require.NoError(t, service.DownloadPartials(context.Background(), cmd))
+	torrentDownloader.AssertNotCalled(t, "DownloadParts", mock.Anything, mock.Anything)
+	torrentRepository.AssertNotCalled(t, "UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestService_DownloadPartials_DownloadPartsFails(t *testing.T) {
 	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
 
@@ -60,6 +109,7 @@ func TestService_DownloadPartials_DownloadPartsFails(t *testing.T) {
 
 	torrentRepository := new(storagemocks.TorrentRepository)
 	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	torrentDownloader := new(clientmocks.TorrentDownloader)
 	torrentDownloader.On("DownloadParts", mock.Anything, mock.Anything).
@@ -73,13 +123,71 @@ func TestService_DownloadPartials_DownloadPartsFails(t *testing.T) {
 	imageRepository.On("ByTorrent", mock.Anything, torrentID).
 		Return(preview.NewTorrentImages(nil), nil)
 
+	eventBus := new(busmocks.Event)
+
 	service := downloadPartials.NewService(
 		fakeLogger(),
+		eventBus,
 		torrentRepository,
 		torrentDownloader,
 		imageExtractor,
 		imagePersister,
 		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
+	)
+
+	cmd := downloadPartials.CMD{
+		ID: torrentID,
+		Files: []downloadPartials.File{
+			{FileID: 0, Start: 0, Length: 100},
+		},
+	}
+	err = service.DownloadPartials(context.Background(), cmd)
+	require.Error(t, err)
+	torrentRepository.AssertCalled(t, "UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusFailed && t.LastError() == "error when downloading"
+	}), mock.Anything)
+}
+
+func TestService_DownloadPartials_ForceDownloadsTheImagesWeAlreadyHave(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 100, "video.mp4")
+	assert.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 100, []preview.File{f}, []byte("torrent-data"))
+	assert.NoError(t, err)
+
+	plan := preview.NewDownloadPlan(torrent)
+	assert.NoError(t, plan.AddAll(preview.NewTorrentImages(nil)))
+	existing := preview.NewImage(torrentID, 0, plan.GetPlan()[0].Name(), 100)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("DownloadParts", mock.Anything, mock.MatchedBy(func(p preview.DownloadPlan) bool {
+		return len(p.GetPlan()) == 1
+	})).Return(nil, errors.New("error when downloading"))
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(preview.NewTorrentImages([]preview.Image{existing}), nil)
+
+	service := downloadPartials.NewService(
+		fakeLogger(),
+		new(busmocks.Event),
+		torrentRepository,
+		torrentDownloader,
+		new(storagemocks.ImageExtractor),
+		new(storagemocks.ImagePersister),
+		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
 	)
 
 	cmd := downloadPartials.CMD{
@@ -87,9 +195,11 @@ func TestService_DownloadPartials_DownloadPartsFails(t *testing.T) {
 		Files: []downloadPartials.File{
 			{FileID: 0, Start: 0, Length: 100},
 		},
+		Force: true,
 	}
 	err = service.DownloadPartials(context.Background(), cmd)
 	require.Error(t, err)
+	torrentDownloader.AssertExpectations(t)
 }
 
 func TestService_DownloadPartials_RegistryClosesWithNoParts(t *testing.T) {
@@ -129,18 +239,28 @@ func TestService_DownloadPartials_RegistryClosesWithNoParts(t *testing.T) {
 
 	imagePersister := new(storagemocks.ImagePersister)
 
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.MatchedBy(func(e *preview.PartialDownloadFinishedEvent) bool {
+		return e.TorrentID == torrentID && e.Succeeded()
+	})).Return(nil)
+
 	service := downloadPartials.NewService(
 		fakeLogger(),
+		eventBus,
 		torrentRepository,
 		torrentDownloader,
 		imageExtractor,
 		imagePersister,
 		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
 	)
 
 	cmd := downloadPartials.CMD{ID: torrentID}
 	err = service.DownloadPartials(context.Background(), cmd)
 	require.NoError(t, err)
+	eventBus.AssertExpectations(t)
 }
 
 func TestService_DownloadPartials_ExtractImageFails(t *testing.T) {
@@ -157,6 +277,7 @@ func TestService_DownloadPartials_ExtractImageFails(t *testing.T) {
 
 	torrentRepository := new(storagemocks.TorrentRepository)
 	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	torrentImages := preview.NewTorrentImages(nil)
 
@@ -175,7 +296,7 @@ func TestService_DownloadPartials_ExtractImageFails(t *testing.T) {
 		Return(registry, nil)
 
 	imageExtractor := new(storagemocks.ImageExtractor)
-	imageExtractor.On("ExtractImage", mock.Anything, []byte("1234567890"), 5).Return(nil, errors.New("fake image error"))
+	imageExtractor.On("ExtractImage", mock.Anything, readerWith("1234567890"), 5).Return(nil, errors.New("fake image error"))
 
 	imageRepository := new(storagemocks.ImageRepository)
 	imageRepository.On("ByTorrent", mock.Anything, torrentID).
@@ -183,13 +304,20 @@ func TestService_DownloadPartials_ExtractImageFails(t *testing.T) {
 
 	imagePersister := new(storagemocks.ImagePersister)
 
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
 	service := downloadPartials.NewService(
 		fakeLogger(),
+		eventBus,
 		torrentRepository,
 		torrentDownloader,
 		imageExtractor,
 		imagePersister,
 		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
 	)
 
 	cmd := downloadPartials.CMD{
@@ -202,6 +330,73 @@ func TestService_DownloadPartials_ExtractImageFails(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestService_DownloadPartials_ImageExtractionFailed(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	plan := preview.NewDownloadPlan(torrent)
+	assert.NoError(t, plan.AddAll(preview.NewTorrentImages(nil)))
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	assert.NoError(t, err)
+	registry.RegisterPiece(preview.NewPiece(torrentID, 0, []byte("12345")))
+	registry.RegisterPiece(preview.NewPiece(torrentID, 1, []byte("67890")))
+	registry.NoMorePieces()
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("DownloadParts", mock.Anything, mock.Anything).
+		Return(registry, nil)
+
+	imageExtractor := new(storagemocks.ImageExtractor)
+	imageExtractor.On("ExtractImage", mock.Anything, readerWith("1234567890"), 5).
+		Return(nil, fmt.Errorf("%w. moov atom not found", preview.ErrAtomNotFound))
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(preview.NewTorrentImages(nil), nil)
+	imageRepository.On("Persist", mock.Anything, mock.Anything).Return(nil)
+
+	imagePersister := new(storagemocks.ImagePersister)
+	imagePersister.On("PersistFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
+	service := downloadPartials.NewService(
+		fakeLogger(),
+		eventBus,
+		torrentRepository,
+		torrentDownloader,
+		imageExtractor,
+		imagePersister,
+		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
+	)
+
+	cmd := downloadPartials.CMD{
+		ID: torrentID,
+		Files: []downloadPartials.File{
+			{FileID: 0, Start: 0, Length: 10},
+		},
+	}
+	err = service.DownloadPartials(context.Background(), cmd)
+	require.NoError(t, err)
+	eventBus.AssertCalled(t, "Publish", mock.Anything, mock.MatchedBy(func(e *preview.ImageExtractionFailedEvent) bool {
+		return e.TorrentID == torrentID && e.FileID == 0 && strings.HasPrefix(e.Reason, preview.ErrAtomNotFound.Error())
+	}))
+	eventBus.AssertNotCalled(t, "Publish", mock.Anything, mock.AnythingOfType("*preview.ImageExtractedEvent"))
+}
+
 func TestService_DownloadPartials_PersistingImageFails(t *testing.T) {
 	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
 
@@ -216,6 +411,7 @@ func TestService_DownloadPartials_PersistingImageFails(t *testing.T) {
 
 	torrentRepository := new(storagemocks.TorrentRepository)
 	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	torrentImages := preview.NewTorrentImages(nil)
 	plan := preview.NewDownloadPlan(torrent)
@@ -234,7 +430,7 @@ func TestService_DownloadPartials_PersistingImageFails(t *testing.T) {
 
 	imgBytes := []byte("JPG binary data here")
 	imageExtractor := new(storagemocks.ImageExtractor)
-	imageExtractor.On("ExtractImage", mock.Anything, []byte("1234567890"), 5).Return(imgBytes, nil)
+	imageExtractor.On("ExtractImage", mock.Anything, readerWith("1234567890"), 5).Return(imgBytes, nil)
 
 	imageRepository := new(storagemocks.ImageRepository)
 	imageRepository.On("ByTorrent", mock.Anything, torrentID).
@@ -244,13 +440,20 @@ func TestService_DownloadPartials_PersistingImageFails(t *testing.T) {
 	imagePersister.On("PersistFile", mock.Anything, "cb84ccc10f296df72d6c40ba7a07c178a4323a14.0.0-1.video.mp4.jpg", imgBytes).
 		Return(errors.New("fake storing error"))
 
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
 	service := downloadPartials.NewService(
 		fakeLogger(),
+		eventBus,
 		torrentRepository,
 		torrentDownloader,
 		imageExtractor,
 		imagePersister,
 		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
 	)
 
 	cmd := downloadPartials.CMD{
@@ -263,6 +466,71 @@ func TestService_DownloadPartials_PersistingImageFails(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestService_DownloadPartials_TorrentDeletedWhileDownloading(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+	deleting, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+	deleting.RestoreStatus(preview.StatusDeleting, "")
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil).Once()
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(deleting, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	plan := preview.NewDownloadPlan(torrent)
+	assert.NoError(t, plan.AddAll(preview.NewTorrentImages(nil)))
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	require.NoError(t, err)
+	registry.RegisterPiece(preview.NewPiece(torrentID, 0, []byte("12345")))
+	registry.RegisterPiece(preview.NewPiece(torrentID, 1, []byte("67890")))
+	registry.NoMorePieces()
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("DownloadParts", mock.Anything, mock.Anything).Return(registry, nil)
+
+	imageExtractor := new(storagemocks.ImageExtractor)
+	imageExtractor.On("ExtractImage", mock.Anything, readerWith("1234567890"), 5).Return([]byte("JPG binary data here"), nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages(nil), nil)
+	imagePersister := new(storagemocks.ImagePersister)
+
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
+	service := downloadPartials.NewService(
+		fakeLogger(),
+		eventBus,
+		torrentRepository,
+		torrentDownloader,
+		imageExtractor,
+		imagePersister,
+		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
+	)
+
+	cmd := downloadPartials.CMD{
+		ID:    torrentID,
+		Files: []downloadPartials.File{{FileID: 0, Start: 0, Length: 10}},
+	}
+	err = service.DownloadPartials(context.Background(), cmd)
+	require.NoError(t, err)
+	// Nothing is stored for the torrent deleted, nor is it marked as failed
+	imagePersister.AssertNotCalled(t, "PersistFile", mock.Anything, mock.Anything, mock.Anything)
+	imageRepository.AssertNotCalled(t, "Persist", mock.Anything, mock.Anything)
+	torrentRepository.AssertNotCalled(t, "UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusFailed
+	}), mock.Anything)
+}
+
 func TestService_DownloadPartials_BaseCase(t *testing.T) {
 	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
 
@@ -295,7 +563,7 @@ func TestService_DownloadPartials_BaseCase(t *testing.T) {
 
 	imgBytes := []byte("JPG binary data here")
 	imageExtractor := new(storagemocks.ImageExtractor)
-	imageExtractor.On("ExtractImage", mock.Anything, []byte("1234567890"), 5).Return(imgBytes, nil)
+	imageExtractor.On("ExtractImage", mock.Anything, readerWith("1234567890"), 5).Return(imgBytes, nil)
 
 	img := preview.NewImage(
 		torrentID,
@@ -314,13 +582,20 @@ func TestService_DownloadPartials_BaseCase(t *testing.T) {
 	imagePersister.On("PersistFile", mock.Anything, "cb84ccc10f296df72d6c40ba7a07c178a4323a14.0.0-1.video.mp4.jpg", imgBytes).
 		Return(nil)
 
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
 	service := downloadPartials.NewService(
 		fakeLogger(),
+		eventBus,
 		torrentRepository,
 		torrentDownloader,
 		imageExtractor,
 		imagePersister,
 		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
 	)
 
 	cmd := downloadPartials.CMD{ID: torrentID}
@@ -328,6 +603,493 @@ func TestService_DownloadPartials_BaseCase(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestService_DownloadPartials_NoSeeders(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	plan := preview.NewDownloadPlan(torrent)
+	assert.NoError(t, plan.AddAll(preview.NewTorrentImages(nil)))
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	require.NoError(t, err)
+	registry.Fail(preview.ErrNoSeeders)
+	registry.NoMorePieces()
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("DownloadParts", mock.Anything, mock.Anything).
+		Return(registry, nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(preview.NewTorrentImages(nil), nil)
+
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.MatchedBy(func(e *preview.NoSeedersFoundEvent) bool {
+		return e.TorrentID == torrentID && len(e.Segments) == 1 &&
+			e.Limits.SeederWaitTime == time.Second && e.Force
+	})).Return(nil)
+
+	service := downloadPartials.NewService(
+		fakeLogger(),
+		eventBus,
+		torrentRepository,
+		torrentDownloader,
+		new(storagemocks.ImageExtractor),
+		new(storagemocks.ImagePersister),
+		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
+	)
+
+	cmd := downloadPartials.CMD{
+		ID: torrentID,
+		Files: []downloadPartials.File{
+			{FileID: 0, Start: 0, Length: 10},
+		},
+		SeederWaitTime: time.Second,
+		Force:          true,
+	}
+	err = service.DownloadPartials(context.Background(), cmd)
+	require.NoError(t, err)
+	torrentRepository.AssertCalled(t, "UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusNoSeeders
+	}), mock.Anything)
+	eventBus.AssertExpectations(t)
+}
+
+func TestService_DownloadPartials_KeepsTheStatusChangedByAnotherDownload(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+	completed, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+	completed.RestoreStatus(preview.StatusCompleted, "")
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil).Once()
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(completed, nil).Once()
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, preview.StatusResolving).Return(nil).Once()
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, preview.StatusDownloading).
+		Return(preview.ErrConcurrentUpdate).Once()
+
+	plan := preview.NewDownloadPlan(torrent)
+	assert.NoError(t, plan.AddAll(preview.NewTorrentImages(nil)))
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	require.NoError(t, err)
+	registry.Fail(preview.ErrNoSeeders)
+	registry.NoMorePieces()
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("DownloadParts", mock.Anything, mock.Anything).Return(registry, nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages(nil), nil)
+
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.AnythingOfType("*preview.NoSeedersFoundEvent")).Return(nil)
+
+	service := downloadPartials.NewService(
+		fakeLogger(),
+		eventBus,
+		torrentRepository,
+		torrentDownloader,
+		new(storagemocks.ImageExtractor),
+		new(storagemocks.ImagePersister),
+		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
+	)
+
+	cmd := downloadPartials.CMD{
+		ID:    torrentID,
+		Files: []downloadPartials.File{{FileID: 0, Start: 0, Length: 10}},
+	}
+	err = service.DownloadPartials(context.Background(), cmd)
+	require.NoError(t, err)
+	torrentRepository.AssertExpectations(t)
+	torrentRepository.AssertNumberOfCalls(t, "UpdateStatusFrom", 2)
+}
+
+func TestService_DownloadPartials_ChangesTheStatusAgainAfterAConflict(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 100, "video.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 100, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+	extracting, err := preview.NewInfo(torrentID, "test torrent", 100, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+	extracting.RestoreStatus(preview.StatusExtracting, "")
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil).Once()
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(extracting, nil).Once()
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, preview.StatusResolving).Return(nil).Once()
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, preview.StatusDownloading).
+		Return(preview.ErrConcurrentUpdate).Once()
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusFailed && t.LastError() == "error when downloading"
+	}), preview.StatusExtracting).Return(nil).Once()
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("DownloadParts", mock.Anything, mock.Anything).
+		Return(nil, errors.New("error when downloading"))
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages(nil), nil)
+
+	service := downloadPartials.NewService(
+		fakeLogger(),
+		new(busmocks.Event),
+		torrentRepository,
+		torrentDownloader,
+		new(storagemocks.ImageExtractor),
+		new(storagemocks.ImagePersister),
+		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
+	)
+
+	cmd := downloadPartials.CMD{
+		ID:    torrentID,
+		Files: []downloadPartials.File{{FileID: 0, Start: 0, Length: 100}},
+	}
+	err = service.DownloadPartials(context.Background(), cmd)
+	require.Error(t, err)
+	torrentRepository.AssertExpectations(t)
+}
+
+func TestService_DownloadPartials_DeadlineExceeded(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(preview.NewTorrentImages(nil), nil)
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.MatchedBy(func(e *preview.PartialDownloadFinishedEvent) bool {
+		return e.TorrentID == torrentID && e.Reason == preview.ErrDeadlineExceeded.Error()
+	})).Return(nil)
+
+	service := downloadPartials.NewService(
+		fakeLogger(),
+		eventBus,
+		torrentRepository,
+		torrentDownloader,
+		new(storagemocks.ImageExtractor),
+		new(storagemocks.ImagePersister),
+		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
+	)
+
+	cmd := downloadPartials.CMD{
+		ID: torrentID,
+		Files: []downloadPartials.File{
+			{FileID: 0, Start: 0, Length: 10},
+		},
+		Deadline: time.Now().Add(-time.Minute),
+	}
+	err = service.DownloadPartials(context.Background(), cmd)
+	require.NoError(t, err)
+	torrentDownloader.AssertNotCalled(t, "DownloadParts", mock.Anything, mock.Anything)
+	torrentRepository.AssertCalled(t, "UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusFailed && t.LastError() == preview.ErrDeadlineExceeded.Error()
+	}), mock.Anything)
+	eventBus.AssertExpectations(t)
+}
+
+func TestService_DownloadPartials_MissingPieces(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f0, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+	f1, err := preview.NewFileInfo(1, 10, "video2.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f0, f1}, []byte("torrent-data"))
+	require.NoError(t, err)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	plan := preview.NewDownloadPlan(torrent)
+	assert.NoError(t, plan.AddAll(preview.NewTorrentImages(nil)))
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	require.NoError(t, err)
+	registry.RegisterPiece(preview.NewPiece(torrentID, 0, []byte("12345")))
+	registry.RegisterPiece(preview.NewPiece(torrentID, 1, []byte("67890")))
+	registry.RegisterPiece(preview.NewPiece(torrentID, 2, []byte("12345")))
+	registry.NoMorePieces()
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("DownloadParts", mock.Anything, mock.Anything).
+		Return(registry, nil)
+
+	imgBytes := []byte("JPG binary data here")
+	imageExtractor := new(storagemocks.ImageExtractor)
+	imageExtractor.On("ExtractImage", mock.Anything, readerWith("1234567890"), 5).Return(imgBytes, nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(preview.NewTorrentImages(nil), nil)
+	imageRepository.On("Persist", mock.Anything, mock.Anything).
+		Return(nil)
+
+	imagePersister := new(storagemocks.ImagePersister)
+	imagePersister.On("PersistFile", mock.Anything, mock.Anything, imgBytes).
+		Return(nil)
+
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.AnythingOfType("*preview.PieceRangeCompletedEvent")).Return(nil)
+	eventBus.On("Publish", mock.Anything, mock.AnythingOfType("*preview.ImageExtractedEvent")).Return(nil)
+	eventBus.On("Publish", mock.Anything, mock.MatchedBy(func(e *preview.DownloadIncompleteEvent) bool {
+		return assert.ObjectsAreEqual([]preview.IncompleteRange{
+			{FileID: 1, PieceStart: 2, PieceEnd: 3, PiecesMissing: 1},
+		}, e.Ranges) && assert.ObjectsAreEqual([]preview.FileSegment{
+			{FileID: 1, Start: 0, Length: 10},
+		}, e.Segments)
+	})).Return(nil)
+
+	service := downloadPartials.NewService(
+		fakeLogger(),
+		eventBus,
+		torrentRepository,
+		torrentDownloader,
+		imageExtractor,
+		imagePersister,
+		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
+	)
+
+	cmd := downloadPartials.CMD{
+		ID: torrentID,
+		Files: []downloadPartials.File{
+			{FileID: 0, Start: 0, Length: 10},
+			{FileID: 1, Start: 0, Length: 10},
+		},
+	}
+	err = service.DownloadPartials(context.Background(), cmd)
+	require.NoError(t, err)
+
+	eventBus.AssertExpectations(t)
+	torrentRepository.AssertCalled(t, "UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusPartiallyCompleted
+	}), mock.Anything)
+}
+
+func TestService_DownloadPartials_CorruptPiece(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f0, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+	f1, err := preview.NewFileInfo(1, 10, "video2.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f0, f1}, []byte("torrent-data"))
+	require.NoError(t, err)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	pieces := [][]byte{[]byte("12345"), []byte("67890"), []byte("12345"), []byte("67890")}
+	hashes := make([][]byte, len(pieces))
+	for i, p := range pieces {
+		sum := sha1.Sum(p)
+		hashes[i] = sum[:]
+	}
+
+	plan := preview.NewDownloadPlan(torrent)
+	assert.NoError(t, plan.AddAll(preview.NewTorrentImages(nil)))
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan),
+		preview.WithPieceHashes(hashes))
+	require.NoError(t, err)
+	registry.RegisterPiece(preview.NewPiece(torrentID, 0, pieces[0]))
+	registry.RegisterPiece(preview.NewPiece(torrentID, 1, pieces[1]))
+	registry.RegisterPiece(preview.NewPiece(torrentID, 2, pieces[2]))
+	registry.RegisterPiece(preview.NewPiece(torrentID, 3, make([]byte, 5))) // what the storage returns when it has nothing
+	registry.NoMorePieces()
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("DownloadParts", mock.Anything, mock.Anything).
+		Return(registry, nil)
+
+	imgBytes := []byte("JPG binary data here")
+	imageExtractor := new(storagemocks.ImageExtractor)
+	imageExtractor.On("ExtractImage", mock.Anything, readerWith("1234567890"), 5).Return(imgBytes, nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(preview.NewTorrentImages(nil), nil)
+	imageRepository.On("Persist", mock.Anything, mock.Anything).
+		Return(nil)
+
+	imagePersister := new(storagemocks.ImagePersister)
+	imagePersister.On("PersistFile", mock.Anything, mock.Anything, imgBytes).
+		Return(nil)
+
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.AnythingOfType("*preview.PieceRangeCompletedEvent")).Return(nil)
+	eventBus.On("Publish", mock.Anything, mock.AnythingOfType("*preview.ImageExtractedEvent")).Return(nil)
+	eventBus.On("Publish", mock.Anything, mock.MatchedBy(func(e *preview.DownloadIncompleteEvent) bool {
+		return assert.ObjectsAreEqual([]preview.IncompleteRange{
+			{FileID: 1, PieceStart: 2, PieceEnd: 3, PiecesMissing: 2},
+		}, e.Ranges)
+	})).Return(nil)
+
+	service := downloadPartials.NewService(
+		fakeLogger(),
+		eventBus,
+		torrentRepository,
+		torrentDownloader,
+		imageExtractor,
+		imagePersister,
+		imageRepository,
+		nil,
+		nil,
+		preview.ClipLimits{},
+	)
+
+	cmd := downloadPartials.CMD{
+		ID: torrentID,
+		Files: []downloadPartials.File{
+			{FileID: 0, Start: 0, Length: 10},
+			{FileID: 1, Start: 0, Length: 10},
+		},
+	}
+	err = service.DownloadPartials(context.Background(), cmd)
+	require.NoError(t, err)
+
+	eventBus.AssertExpectations(t)
+	imageExtractor.AssertNumberOfCalls(t, "ExtractImage", 1)
+	torrentRepository.AssertCalled(t, "UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusPartiallyCompleted
+	}), mock.Anything)
+}
+
+func TestService_DownloadPartials_GeneratesClip(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	limits := preview.ClipLimits{Enabled: true, Duration: 10 * time.Second, MaxBitrate: 400, MaxHeight: 360, Threads: 1, MaxSize: 100}
+
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	plan := preview.NewDownloadPlan(torrent)
+	assert.NoError(t, plan.AddAll(preview.NewTorrentImages(nil)))
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	require.NoError(t, err)
+	registry.RegisterPiece(preview.NewPiece(torrentID, 0, []byte("12345")))
+	registry.RegisterPiece(preview.NewPiece(torrentID, 1, []byte("67890")))
+	registry.NoMorePieces()
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("DownloadParts", mock.Anything, mock.Anything).
+		Return(registry, nil)
+
+	imgBytes := []byte("JPG binary data here")
+	imageExtractor := new(storagemocks.ImageExtractor)
+	imageExtractor.On("ExtractImage", mock.Anything, readerWith("1234567890"), 5).Return(imgBytes, nil)
+
+	clipBytes := []byte("MP4 binary data here")
+	clipExtractor := new(storagemocks.ClipExtractor)
+	clipExtractor.On("ExtractClip", mock.Anything, readerWith("1234567890"), limits).
+		Return(clipBytes, 9500*time.Millisecond, nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(preview.NewTorrentImages(nil), nil)
+	imageRepository.On("Persist", mock.Anything, mock.Anything).
+		Return(nil)
+
+	clipName := "cb84ccc10f296df72d6c40ba7a07c178a4323a14.0.0-1.video.mp4.mp4"
+	imagePersister := new(storagemocks.ImagePersister)
+	imagePersister.On("PersistFile", mock.Anything, mock.Anything, imgBytes).Return(nil)
+	imagePersister.On("PersistFile", mock.Anything, clipName, clipBytes).Return(nil)
+
+	clipRepository := new(storagemocks.ClipRepository)
+	clipRepository.On("Persist", mock.Anything, preview.NewClip(torrentID, 0, clipName, 9500*time.Millisecond, len(clipBytes))).
+		Return(nil)
+
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
+	service := downloadPartials.NewService(
+		fakeLogger(),
+		eventBus,
+		torrentRepository,
+		torrentDownloader,
+		imageExtractor,
+		imagePersister,
+		imageRepository,
+		clipExtractor,
+		clipRepository,
+		limits,
+	)
+
+	cmd := downloadPartials.CMD{
+		ID: torrentID,
+		Files: []downloadPartials.File{
+			{FileID: 0, Start: 0, Length: 10},
+		},
+	}
+	err = service.DownloadPartials(context.Background(), cmd)
+	require.NoError(t, err)
+
+	imagePersister.AssertExpectations(t)
+	clipRepository.AssertExpectations(t)
+}
+
+// readerWith matches a reader with the given content. The reader is rewound after being read
+func readerWith(content string) interface{} {
+	return mock.MatchedBy(func(r io.ReadSeeker) bool {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return false
+		}
+		_, err = r.Seek(0, io.SeekStart)
+		return err == nil && string(data) == content
+	})
+}
+
 func fakeLogger() *logrus.Logger {
 	l := logrus.New()
 	l.Out = ioutil.Discard
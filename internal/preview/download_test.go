@@ -1,8 +1,10 @@
 package preview_test
 
 import (
+	"errors"
 	"prevtorrent/internal/preview"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -284,6 +286,50 @@ func TestDownloadPlan_AddAll(t *testing.T) {
 	assert.Len(t, pieceRanges, 2)
 }
 
+func TestDownloadPlan_AddFiles(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	fi, err := preview.NewFileInfo(0, 1000, "movie.mp4")
+	assert.NoError(t, err)
+	f2, err := preview.NewFileInfo(1, 500, "movie2.mp4")
+	assert.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "generic movie", 100, []preview.File{fi, f2}, []byte(""))
+	assert.NoError(t, err)
+
+	torrentImages := preview.NewTorrentImages(nil)
+
+	plan := preview.NewDownloadPlan(torrent)
+	err = plan.AddFiles(torrentImages, []int{1, 1})
+	assert.NoError(t, err)
+
+	pieceRanges := plan.GetPlan()
+	require.Len(t, pieceRanges, 1)
+	assert.Equal(t, 1, pieceRanges[0].FileID())
+
+	plan = preview.NewDownloadPlan(torrent)
+	err = plan.AddFiles(torrentImages, nil)
+	assert.NoError(t, err)
+	assert.Len(t, plan.GetPlan(), 2)
+}
+
+func TestDownloadPlan_AddFilesWithInvalidFile(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	fi, err := preview.NewFileInfo(0, 1000, "movie.mp4")
+	assert.NoError(t, err)
+	f2, err := preview.NewFileInfo(1, 10, "subtitles.srt")
+	assert.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "generic movie", 100, []preview.File{fi, f2}, []byte(""))
+	assert.NoError(t, err)
+
+	plan := preview.NewDownloadPlan(torrent)
+	err = plan.AddFiles(preview.NewTorrentImages(nil), []int{1})
+	assert.True(t, errors.Is(err, preview.ErrInvalidFile))
+
+	err = plan.AddFiles(preview.NewTorrentImages(nil), []int{7})
+	assert.True(t, errors.Is(err, preview.ErrInvalidFile))
+}
+
 func Test_DownloadPlan_GetCappedPlans(t *testing.T) {
 	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
 
@@ -361,3 +407,44 @@ func TestDownloadPlan_DownloadSize(t *testing.T) {
 	assert.Equal(t, plan.CountPieces(), 10)
 	assert.Equal(t, plan.DownloadSize(), 10*100)
 }
+
+func TestDownloadLimits_Or(t *testing.T) {
+	deadline := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	defaults := preview.DownloadLimits{MaxDownloadTime: time.Hour, SeederWaitTime: time.Minute}
+
+	limits := preview.DownloadLimits{SeederWaitTime: time.Second, Deadline: deadline}.Or(defaults)
+	assert.Equal(t, time.Hour, limits.MaxDownloadTime)
+	assert.Equal(t, time.Second, limits.SeederWaitTime)
+	assert.Equal(t, deadline, limits.Deadline)
+
+	assert.False(t, limits.IsExpired(deadline.Add(-time.Second)))
+	assert.True(t, limits.IsExpired(deadline))
+	assert.False(t, defaults.IsExpired(deadline))
+}
+
+func TestNewStreamPlan(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f0, err := preview.NewFileInfo(0, 150, "subtitles.srt")
+	require.NoError(t, err)
+	f1, err := preview.NewFileInfo(1, 1000, "movie.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "generic movie", 100, []preview.File{f0, f1}, []byte(""))
+	require.NoError(t, err)
+
+	plan, err := preview.NewStreamPlan(torrent, f1, 20, 200)
+	require.NoError(t, err)
+	assert.True(t, plan.IsUrgent())
+
+	// The file starts at the byte 150 of the torrent, thus the window is [170, 370)
+	type window struct{ piece, fileStart, fileLength int }
+	got := make([]window, 0)
+	for _, pr := range plan.GetPlan() {
+		require.Equal(t, pr.Start(), pr.End())
+		got = append(got, window{pr.Start(), pr.FileStart(), pr.FileLength()})
+	}
+	assert.Equal(t, []window{{1, 20, 30}, {2, 50, 100}, {3, 150, 70}}, got)
+
+	_, err = preview.NewStreamPlan(torrent, f1, 900, 101)
+	assert.Error(t, err)
+}
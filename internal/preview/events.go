@@ -1,5 +1,7 @@
 package preview
 
+import "time"
+
 type TorrentCreatedEvent struct {
 	TorrentID string
 }
@@ -7,3 +9,396 @@ type TorrentCreatedEvent struct {
 func NewTorrentCreatedEvent(torrentID string) *TorrentCreatedEvent {
 	return &TorrentCreatedEvent{TorrentID: torrentID}
 }
+
+// TorrentReprocessRequestedEvent is published when the preview of a torrent has to be made again,
+// e.g. after improving the extraction. FileIDs is empty to reprocess all the supported files, and
+// Force makes the images we already have to be generated again instead of skipped, and the plan in
+// progress, if any, to be replaced. PreviousStatus is the status the torrent had before
+type TorrentReprocessRequestedEvent struct {
+	TorrentID       string
+	FileIDs         []int
+	Force           bool
+	PreviousStatus  Status
+	MaxDownloadTime time.Duration
+	SeederWaitTime  time.Duration
+	Deadline        time.Time
+	RequestedAt     time.Time
+}
+
+func NewTorrentReprocessRequestedEvent(
+	torrentID string,
+	fileIDs []int,
+	force bool,
+	previousStatus Status,
+	limits DownloadLimits,
+	requestedAt time.Time,
+) *TorrentReprocessRequestedEvent {
+	return &TorrentReprocessRequestedEvent{
+		TorrentID:       torrentID,
+		FileIDs:         fileIDs,
+		Force:           force,
+		PreviousStatus:  previousStatus,
+		MaxDownloadTime: limits.MaxDownloadTime,
+		SeederWaitTime:  limits.SeederWaitTime,
+		Deadline:        limits.Deadline,
+		RequestedAt:     requestedAt,
+	}
+}
+
+// TorrentDeletedEvent is published when a torrent and its previews have been removed, e.g. because
+// of a takedown request
+type TorrentDeletedEvent struct {
+	TorrentID string
+	Name      string
+	DeletedAt time.Time
+}
+
+func NewTorrentDeletedEvent(torrent Torrent, deletedAt time.Time) *TorrentDeletedEvent {
+	return &TorrentDeletedEvent{
+		TorrentID: torrent.ID(),
+		Name:      torrent.Name(),
+		DeletedAt: deletedAt,
+	}
+}
+
+// MagnetResolvedEvent is published when the metadata of a magnet has been fetched from the network
+type MagnetResolvedEvent struct {
+	TorrentID  string
+	Magnet     string
+	Name       string
+	ResolvedAt time.Time
+}
+
+func NewMagnetResolvedEvent(magnet Magnet, torrent Torrent, resolvedAt time.Time) *MagnetResolvedEvent {
+	return &MagnetResolvedEvent{
+		TorrentID:  torrent.ID(),
+		Magnet:     magnet.Value(),
+		Name:       torrent.Name(),
+		ResolvedAt: resolvedAt,
+	}
+}
+
+// TorrentImportedEvent is published when a torrent file has been imported
+type TorrentImportedEvent struct {
+	TorrentID  string
+	Name       string
+	Length     int
+	Files      int
+	ImportedAt time.Time
+}
+
+func NewTorrentImportedEvent(torrent Torrent, importedAt time.Time) *TorrentImportedEvent {
+	return &TorrentImportedEvent{
+		TorrentID:  torrent.ID(),
+		Name:       torrent.Name(),
+		Length:     torrent.TotalLength(),
+		Files:      len(torrent.Files()),
+		ImportedAt: importedAt,
+	}
+}
+
+// PlannedRange describes, with primitives, a PieceRange that is going to be downloaded
+type PlannedRange struct {
+	FileID     int
+	PieceStart int
+	PieceEnd   int
+}
+
+// DownloadPlanCreatedEvent is published when the pieces to download for the preview of a torrent
+// have been planned. Downloads is the number of downloads the plan has been split into
+type DownloadPlanCreatedEvent struct {
+	TorrentID string
+	Downloads int
+	Ranges    []PlannedRange
+	CreatedAt time.Time
+}
+
+func NewDownloadPlanCreatedEvent(plan DownloadPlan, downloads int, createdAt time.Time) *DownloadPlanCreatedEvent {
+	return &DownloadPlanCreatedEvent{
+		TorrentID: plan.GetTorrent().ID(),
+		Downloads: downloads,
+		Ranges:    plannedRanges(plan),
+		CreatedAt: createdAt,
+	}
+}
+
+func plannedRanges(plan DownloadPlan) []PlannedRange {
+	ranges := make([]PlannedRange, 0, len(plan.GetPlan()))
+	for _, pr := range plan.GetPlan() {
+		ranges = append(ranges, PlannedRange{
+			FileID:     pr.FileID(),
+			PieceStart: pr.Start(),
+			PieceEnd:   pr.End(),
+		})
+	}
+	return ranges
+}
+
+// DownloadPlanStartedEvent is published when we start downloading the pieces of a DownloadPlan
+type DownloadPlanStartedEvent struct {
+	TorrentID   string
+	PlanID      string
+	PieceLength int
+	Ranges      []PlannedRange
+	StartedAt   time.Time
+}
+
+func NewDownloadPlanStartedEvent(plan DownloadPlan, planID string, startedAt time.Time) *DownloadPlanStartedEvent {
+	return &DownloadPlanStartedEvent{
+		TorrentID:   plan.GetTorrent().ID(),
+		PlanID:      planID,
+		PieceLength: plan.GetTorrent().PieceLength(),
+		Ranges:      plannedRanges(plan),
+		StartedAt:   startedAt,
+	}
+}
+
+// PieceCompletedEvent is published each time a piece of a DownloadPlan has been downloaded
+type PieceCompletedEvent struct {
+	TorrentID        string
+	PieceID          int
+	ActivePeers      int
+	ConnectedSeeders int
+	CompletedAt      time.Time
+}
+
+func NewPieceCompletedEvent(torrentID string, pieceID int, activePeers int, connectedSeeders int, completedAt time.Time) *PieceCompletedEvent {
+	return &PieceCompletedEvent{
+		TorrentID:        torrentID,
+		PieceID:          pieceID,
+		ActivePeers:      activePeers,
+		ConnectedSeeders: connectedSeeders,
+		CompletedAt:      completedAt,
+	}
+}
+
+// PieceRangeCompletedEvent is published when all the pieces of a PieceRange are ready, that is, when
+// the range has been downloaded
+type PieceRangeCompletedEvent struct {
+	TorrentID   string
+	FileID      int
+	PieceStart  int
+	PieceEnd    int
+	CompletedAt time.Time
+}
+
+func NewPieceRangeCompletedEvent(pieceRange PieceRange, completedAt time.Time) *PieceRangeCompletedEvent {
+	return &PieceRangeCompletedEvent{
+		TorrentID:   pieceRange.Torrent().ID(),
+		FileID:      pieceRange.FileID(),
+		PieceStart:  pieceRange.Start(),
+		PieceEnd:    pieceRange.End(),
+		CompletedAt: completedAt,
+	}
+}
+
+// ImageExtractedEvent is published when the image of a range has been generated and stored
+type ImageExtractedEvent struct {
+	TorrentID   string
+	FileID      int
+	Name        string
+	Length      int
+	ExtractedAt time.Time
+}
+
+func NewImageExtractedEvent(img Image, extractedAt time.Time) *ImageExtractedEvent {
+	return &ImageExtractedEvent{
+		TorrentID:   img.TorrentID(),
+		FileID:      img.FileID(),
+		Name:        img.Name(),
+		Length:      img.Length(),
+		ExtractedAt: extractedAt,
+	}
+}
+
+// ImageExtractionFailedEvent is published when no image can be generated from a downloaded range,
+// because of ErrAtomNotFound or ErrNotAbleToGenerateImage. The range is not going to be downloaded again
+type ImageExtractionFailedEvent struct {
+	TorrentID string
+	FileID    int
+	Name      string
+	Reason    string
+	FailedAt  time.Time
+}
+
+func NewImageExtractionFailedEvent(pieceRange PieceRange, reason error, failedAt time.Time) *ImageExtractionFailedEvent {
+	return &ImageExtractionFailedEvent{
+		TorrentID: pieceRange.Torrent().ID(),
+		FileID:    pieceRange.FileID(),
+		Name:      pieceRange.Name(),
+		Reason:    reason.Error(),
+		FailedAt:  failedAt,
+	}
+}
+
+// DownloadPlanFinishedEvent is published when we stop waiting for pieces of a DownloadPlan. Either
+// because we have all of them or because we gave up (PiecesLeft > 0)
+type DownloadPlanFinishedEvent struct {
+	TorrentID  string
+	PlanID     string
+	PiecesLeft int
+	FinishedAt time.Time
+}
+
+func NewDownloadPlanFinishedEvent(torrentID string, planID string, piecesLeft int, finishedAt time.Time) *DownloadPlanFinishedEvent {
+	return &DownloadPlanFinishedEvent{
+		TorrentID:  torrentID,
+		PlanID:     planID,
+		PiecesLeft: piecesLeft,
+		FinishedAt: finishedAt,
+	}
+}
+
+// NoSeedersFoundEvent is published when a download cannot start because nobody is sharing the torrent.
+// Limits and Force are the ones the download was requested with
+type NoSeedersFoundEvent struct {
+	TorrentID string
+	Segments  []FileSegment
+	Limits    DownloadLimits
+	Force     bool
+	Reason    string
+	FoundAt   time.Time
+}
+
+func NewNoSeedersFoundEvent(torrentID string, segments []FileSegment, reason error, foundAt time.Time) *NoSeedersFoundEvent {
+	return &NoSeedersFoundEvent{
+		TorrentID: torrentID,
+		Segments:  segments,
+		Reason:    reason.Error(),
+		FoundAt:   foundAt,
+	}
+}
+
+// IncompleteRange describes, with primitives, a PieceRange that has not received all its pieces
+type IncompleteRange struct {
+	FileID        int
+	PieceStart    int
+	PieceEnd      int
+	PiecesMissing int
+}
+
+// DownloadIncompleteEvent is published when a DownloadPlan has finished without all its pieces.
+// Segments are the parts of the files that still have to be downloaded, with the Limits and Force the
+// download was requested with
+type DownloadIncompleteEvent struct {
+	TorrentID  string
+	Ranges     []IncompleteRange
+	Segments   []FileSegment
+	Limits     DownloadLimits
+	Force      bool
+	FinishedAt time.Time
+}
+
+func NewDownloadIncompleteEvent(torrentID string, missing []MissingRange, finishedAt time.Time) *DownloadIncompleteEvent {
+	ranges := make([]IncompleteRange, 0, len(missing))
+	segments := make([]FileSegment, 0, len(missing))
+	for _, m := range missing {
+		ranges = append(ranges, IncompleteRange{
+			FileID:        m.PieceRange.FileID(),
+			PieceStart:    m.PieceRange.Start(),
+			PieceEnd:      m.PieceRange.End(),
+			PiecesMissing: m.PiecesMissing,
+		})
+		segments = append(segments, FileSegment{
+			FileID: m.PieceRange.FileID(),
+			Start:  m.PieceRange.FileStart(),
+			Length: m.PieceRange.FileLength(),
+		})
+	}
+
+	return &DownloadIncompleteEvent{
+		TorrentID:  torrentID,
+		Ranges:     ranges,
+		Segments:   segments,
+		FinishedAt: finishedAt,
+	}
+}
+
+// PiecesMissing returns the number of pieces missing of all the ranges
+func (e DownloadIncompleteEvent) PiecesMissing() int {
+	count := 0
+	for _, r := range e.Ranges {
+		count += r.PiecesMissing
+	}
+	return count
+}
+
+// PartialDownloadFinishedEvent is published when a download of a DownloadPlan is not going to be
+// tried again. Reason is empty if it succeeded, even if some images could not be generated
+type PartialDownloadFinishedEvent struct {
+	TorrentID  string
+	Reason     string
+	FinishedAt time.Time
+}
+
+func NewPartialDownloadFinishedEvent(torrentID string, reason error, finishedAt time.Time) *PartialDownloadFinishedEvent {
+	e := &PartialDownloadFinishedEvent{TorrentID: torrentID, FinishedAt: finishedAt}
+	if reason != nil {
+		e.Reason = reason.Error()
+	}
+	return e
+}
+
+// Succeeded returns true if the download did not fail
+func (e PartialDownloadFinishedEvent) Succeeded() bool {
+	return e.Reason == ""
+}
+
+// DownloadRetriesExhaustedEvent is published when a download is not going to be tried again
+// because it has already been retried too many times
+type DownloadRetriesExhaustedEvent struct {
+	TorrentID string
+	Attempts  int
+	Reason    string
+	GaveUpAt  time.Time
+}
+
+func NewDownloadRetriesExhaustedEvent(retry *DownloadRetry, gaveUpAt time.Time) *DownloadRetriesExhaustedEvent {
+	return &DownloadRetriesExhaustedEvent{
+		TorrentID: retry.TorrentID(),
+		Attempts:  retry.Attempts(),
+		Reason:    retry.LastError(),
+		GaveUpAt:  gaveUpAt,
+	}
+}
+
+// TorrentPreviewCompletedEvent is published when all the downloads of a DownloadPlan have finished
+// and at least one of them succeeded
+type TorrentPreviewCompletedEvent struct {
+	TorrentID   string
+	Parts       int
+	FailedParts int
+	Images      int
+	StartedAt   time.Time
+	FinishedAt  time.Time
+}
+
+func NewTorrentPreviewCompletedEvent(saga *PreviewSaga, images int) *TorrentPreviewCompletedEvent {
+	return &TorrentPreviewCompletedEvent{
+		TorrentID:   saga.TorrentID(),
+		Parts:       saga.Parts(),
+		FailedParts: saga.Failed(),
+		Images:      images,
+		StartedAt:   saga.StartedAt(),
+		FinishedAt:  saga.FinishedAt(),
+	}
+}
+
+// TorrentPreviewFailedEvent is published when all the downloads of a DownloadPlan have failed
+type TorrentPreviewFailedEvent struct {
+	TorrentID  string
+	Parts      int
+	Reason     string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+func NewTorrentPreviewFailedEvent(saga *PreviewSaga, reason string) *TorrentPreviewFailedEvent {
+	return &TorrentPreviewFailedEvent{
+		TorrentID:  saga.TorrentID(),
+		Parts:      saga.Parts(),
+		Reason:     reason,
+		StartedAt:  saga.StartedAt(),
+		FinishedAt: saga.FinishedAt(),
+	}
+}
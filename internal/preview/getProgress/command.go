@@ -0,0 +1,5 @@
+package getProgress
+
+type CMD struct {
+	TorrentID string
+}
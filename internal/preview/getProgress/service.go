@@ -0,0 +1,21 @@
+package getProgress
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Service struct {
+	logger             *logrus.Logger
+	progressRepository preview.ProgressRepository
+}
+
+func NewService(logger *logrus.Logger, progressRepository preview.ProgressRepository) Service {
+	return Service{logger: logger, progressRepository: progressRepository}
+}
+
+func (s Service) Get(ctx context.Context, cmd CMD) (*preview.Progress, error) {
+	return s.progressRepository.Get(ctx, cmd.TorrentID)
+}
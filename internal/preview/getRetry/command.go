@@ -0,0 +1,5 @@
+package getRetry
+
+type CMD struct {
+	TorrentID string
+}
@@ -0,0 +1,21 @@
+package getRetry
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Service struct {
+	logger          *logrus.Logger
+	retryRepository preview.RetryRepository
+}
+
+func NewService(logger *logrus.Logger, retryRepository preview.RetryRepository) Service {
+	return Service{logger: logger, retryRepository: retryRepository}
+}
+
+func (s Service) Get(ctx context.Context, cmd CMD) (*preview.DownloadRetry, error) {
+	return s.retryRepository.Get(ctx, cmd.TorrentID)
+}
@@ -0,0 +1,21 @@
+package getStats
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Service struct {
+	logger          *logrus.Logger
+	statsRepository preview.StatsRepository
+}
+
+func NewService(logger *logrus.Logger, statsRepository preview.StatsRepository) Service {
+	return Service{logger: logger, statsRepository: statsRepository}
+}
+
+func (s Service) Get(ctx context.Context) (*preview.Stats, error) {
+	return s.statsRepository.Get(ctx)
+}
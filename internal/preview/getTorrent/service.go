@@ -11,17 +11,20 @@ type Service struct {
 	logger          *logrus.Logger
 	torrentRepo     preview.TorrentRepository
 	imageRepository preview.ImageRepository
+	clipRepository  preview.ClipRepository
 }
 
 func NewService(
 	logger *logrus.Logger,
 	torrentRepo preview.TorrentRepository,
 	imageRepository preview.ImageRepository,
+	clipRepository preview.ClipRepository,
 ) Service {
 	return Service{
 		logger:          logger,
 		torrentRepo:     torrentRepo,
 		imageRepository: imageRepository,
+		clipRepository:  clipRepository,
 	}
 }
 
@@ -43,5 +46,17 @@ func (s Service) Get(ctx context.Context, cmd CMD) (preview.Torrent, error) {
 		}
 	}
 
+	clips, err := s.clipRepository.ByTorrent(ctx, torrent.ID())
+	if err != nil {
+		return preview.Torrent{}, err
+	}
+
+	for _, clip := range clips {
+		file := torrent.File(clip.FileID())
+		if err := file.AddClip(clip); err != nil {
+			return preview.Torrent{}, err
+		}
+	}
+
 	return torrent, nil
 }
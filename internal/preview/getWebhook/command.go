@@ -0,0 +1,5 @@
+package getWebhook
+
+type CMD struct {
+	WebhookID string
+}
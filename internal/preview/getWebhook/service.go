@@ -0,0 +1,30 @@
+package getWebhook
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Service struct {
+	logger             *logrus.Logger
+	webhookRepository  preview.WebhookRepository
+	deliveryRepository preview.WebhookDeliveryRepository
+}
+
+func NewService(logger *logrus.Logger, webhookRepository preview.WebhookRepository, deliveryRepository preview.WebhookDeliveryRepository) Service {
+	return Service{logger: logger, webhookRepository: webhookRepository, deliveryRepository: deliveryRepository}
+}
+
+func (s Service) Get(ctx context.Context, cmd CMD) (*preview.Webhook, error) {
+	return s.webhookRepository.Get(ctx, cmd.WebhookID)
+}
+
+// Deliveries returns the log of the deliveries of the webhook, newest first
+func (s Service) Deliveries(ctx context.Context, cmd CMD) ([]*preview.WebhookDelivery, error) {
+	if _, err := s.webhookRepository.Get(ctx, cmd.WebhookID); err != nil {
+		return nil, err
+	}
+	return s.deliveryRepository.ByWebhook(ctx, cmd.WebhookID)
+}
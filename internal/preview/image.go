@@ -3,6 +3,7 @@ package preview
 import (
 	"context"
 	"errors"
+	"io"
 )
 
 var ErrAtomNotFound = errors.New("moov atom not found")
@@ -10,18 +11,22 @@ var ErrNotAbleToGenerateImage = errors.New("unknown error. unable to generate im
 
 //go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=ImageExtractor
 type ImageExtractor interface {
-	ExtractImage(ctx context.Context, data []byte, time int) ([]byte, error)
+	ExtractImage(ctx context.Context, data io.Reader, time int) ([]byte, error)
 }
 
 //go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=ImagePersister
 type ImagePersister interface {
 	PersistFile(ctx context.Context, id string, data []byte) error
+	// DeleteFile removes a file stored with PersistFile. It does nothing if there is no such file
+	DeleteFile(ctx context.Context, id string) error
 }
 
 //go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=ImageRepository
 type ImageRepository interface {
 	ByTorrent(ctx context.Context, id string) (*TorrentImages, error)
 	Persist(ctx context.Context, img Image) error
+	// DeleteByFiles removes the images of the files given, or of every file of the torrent if none
+	DeleteByFiles(ctx context.Context, torrentID string, fileIDs []int) error
 }
 
 // Image describes a single image, probably extracted from a video
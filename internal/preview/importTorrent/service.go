@@ -3,28 +3,25 @@ package importTorrent
 import (
 	"context"
 	"errors"
-	"prevtorrent/internal/platform/bus"
 	"prevtorrent/internal/preview"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 type Service struct {
 	logger            *logrus.Logger
-	commandBus        bus.Command
 	torrentDownloader preview.TorrentDownloader
 	torrentRepository preview.TorrentRepository
 }
 
 func NewService(
 	logger *logrus.Logger,
-	commandBus bus.Command,
 	torrentDownloader preview.TorrentDownloader,
 	torrentRepository preview.TorrentRepository,
 ) Service {
 	return Service{
 		logger:            logger,
-		commandBus:        commandBus,
 		torrentDownloader: torrentDownloader,
 		torrentRepository: torrentRepository,
 	}
@@ -42,10 +39,12 @@ func (s Service) Import(ctx context.Context, cmd CMD) (preview.Torrent, error) {
 
 	if errors.Is(err, preview.ErrNotFound) {
 		err = nil
-		if err := s.torrentRepository.Persist(ctx, torrent); err != nil {
-			return preview.Torrent{}, err
-		}
-		if err := s.commandBus.Send(ctx, preview.NewTorrentCreatedEvent(torrent.ID())); err != nil {
+		// The events are published once the torrent is stored, even if the publisher is down at the moment
+		err := s.torrentRepository.Persist(ctx, torrent,
+			preview.NewTorrentImportedEvent(torrent, time.Now()),
+			preview.NewTorrentCreatedEvent(torrent.ID()),
+		)
+		if err != nil {
 			return preview.Torrent{}, err
 		}
 	}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"io/ioutil"
-	"prevtorrent/internal/platform/bus/busmocks"
 	"prevtorrent/internal/preview"
 	"prevtorrent/internal/preview/importTorrent"
 	"prevtorrent/internal/preview/platform/client/clientmocks"
@@ -20,14 +19,13 @@ import (
 func TestService_Import_TorrentImportError(t *testing.T) {
 	raw := []byte("")
 
-	commandBus := new(busmocks.Command)
 	torrentDownloader := new(clientmocks.TorrentDownloader)
 	torrentDownloader.On("Import", mock.Anything, raw).
 		Return(preview.Torrent{}, errors.New("fake error"))
 
 	torrentRepository := new(storagemocks.TorrentRepository)
 
-	service := importTorrent.NewService(fakeLogger(), commandBus, torrentDownloader, torrentRepository)
+	service := importTorrent.NewService(fakeLogger(), torrentDownloader, torrentRepository)
 
 	_, err := service.Import(context.Background(), importTorrent.CMD{
 		TorrentRaw: raw,
@@ -41,8 +39,6 @@ func TestService_Import_TorrentAlreadyExists(t *testing.T) {
 	fakeTorrent, err := preview.NewInfo("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "test torrent", 100, nil, raw)
 	require.NoError(t, err)
 
-	commandBus := new(busmocks.Command)
-
 	torrentDownloader := new(clientmocks.TorrentDownloader)
 	torrentDownloader.On("Import", mock.Anything, raw).
 		Return(fakeTorrent, nil)
@@ -51,7 +47,7 @@ func TestService_Import_TorrentAlreadyExists(t *testing.T) {
 	torrentRepository.On("Get", mock.Anything, "cb84ccc10f296df72d6c40ba7a07c178a4323a14").
 		Return(preview.Torrent{}, nil)
 
-	service := importTorrent.NewService(fakeLogger(), commandBus, torrentDownloader, torrentRepository)
+	service := importTorrent.NewService(fakeLogger(), torrentDownloader, torrentRepository)
 
 	torrent, err := service.Import(context.Background(), importTorrent.CMD{
 		TorrentRaw: raw,
@@ -66,8 +62,6 @@ func TestService_Import_ErrorOnPersist(t *testing.T) {
 	fakeTorrent, err := preview.NewInfo("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "test torrent", 100, nil, raw)
 	require.NoError(t, err)
 
-	commandBus := new(busmocks.Command)
-
 	torrentDownloader := new(clientmocks.TorrentDownloader)
 	torrentDownloader.On("Import", mock.Anything, raw).
 		Return(fakeTorrent, nil)
@@ -75,38 +69,10 @@ func TestService_Import_ErrorOnPersist(t *testing.T) {
 	torrentRepository := new(storagemocks.TorrentRepository)
 	torrentRepository.On("Get", mock.Anything, "cb84ccc10f296df72d6c40ba7a07c178a4323a14").
 		Return(preview.Torrent{}, preview.ErrNotFound)
-	torrentRepository.On("Persist", mock.Anything, fakeTorrent).
+	torrentRepository.On("Persist", mock.Anything, fakeTorrent, mock.Anything, mock.Anything).
 		Return(errors.New("fake error on persist"))
 
-	service := importTorrent.NewService(fakeLogger(), commandBus, torrentDownloader, torrentRepository)
-
-	_, err = service.Import(context.Background(), importTorrent.CMD{
-		TorrentRaw: raw,
-	})
-	assert.Error(t, err)
-}
-
-func TestService_Import_ErrorOnEvent(t *testing.T) {
-	raw := []byte("")
-
-	fakeTorrent, err := preview.NewInfo("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "test torrent", 100, nil, raw)
-	require.NoError(t, err)
-
-	commandBus := new(busmocks.Command)
-	commandBus.On("Send", context.Background(), preview.NewTorrentCreatedEvent(fakeTorrent.ID())).
-		Return(errors.New("fake error on send event"))
-
-	torrentDownloader := new(clientmocks.TorrentDownloader)
-	torrentDownloader.On("Import", mock.Anything, raw).
-		Return(fakeTorrent, nil)
-
-	torrentRepository := new(storagemocks.TorrentRepository)
-	torrentRepository.On("Get", mock.Anything, "cb84ccc10f296df72d6c40ba7a07c178a4323a14").
-		Return(preview.Torrent{}, preview.ErrNotFound)
-	torrentRepository.On("Persist", mock.Anything, fakeTorrent).
-		Return(nil)
-
-	service := importTorrent.NewService(fakeLogger(), commandBus, torrentDownloader, torrentRepository)
+	service := importTorrent.NewService(fakeLogger(), torrentDownloader, torrentRepository)
 
 	_, err = service.Import(context.Background(), importTorrent.CMD{
 		TorrentRaw: raw,
@@ -120,10 +86,6 @@ func TestService_Import_BaseCase(t *testing.T) {
 	fakeTorrent, err := preview.NewInfo("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "test torrent", 100, nil, raw)
 	require.NoError(t, err)
 
-	commandBus := new(busmocks.Command)
-	commandBus.On("Send", context.Background(), preview.NewTorrentCreatedEvent(fakeTorrent.ID())).
-		Return(nil)
-
 	torrentDownloader := new(clientmocks.TorrentDownloader)
 	torrentDownloader.On("Import", mock.Anything, raw).
 		Return(fakeTorrent, nil)
@@ -131,10 +93,14 @@ func TestService_Import_BaseCase(t *testing.T) {
 	torrentRepository := new(storagemocks.TorrentRepository)
 	torrentRepository.On("Get", mock.Anything, "cb84ccc10f296df72d6c40ba7a07c178a4323a14").
 		Return(preview.Torrent{}, preview.ErrNotFound)
-	torrentRepository.On("Persist", mock.Anything, fakeTorrent).
-		Return(nil)
-
-	service := importTorrent.NewService(fakeLogger(), commandBus, torrentDownloader, torrentRepository)
+	torrentRepository.On("Persist", mock.Anything, fakeTorrent,
+		mock.MatchedBy(func(e *preview.TorrentImportedEvent) bool {
+			return e.TorrentID == fakeTorrent.ID() && e.Name == "test torrent"
+		}),
+		preview.NewTorrentCreatedEvent(fakeTorrent.ID()),
+	).Return(nil)
+
+	service := importTorrent.NewService(fakeLogger(), torrentDownloader, torrentRepository)
 
 	torrent, err := service.Import(context.Background(), importTorrent.CMD{
 		TorrentRaw: raw,
@@ -1,5 +1,22 @@
 package makeDownloadPlan
 
+import (
+	"prevtorrent/internal/preview"
+	"time"
+)
+
 type CMD struct {
 	TorrentID string
+	// Optional. All the supported files are planned when empty
+	FileIDs []int
+	// Optional. Plans again the ranges we already have an image of, replacing them once extracted.
+	// The plan in progress, if any, is replaced as well
+	Force bool
+	// Optional. The status of a reprocessed torrent before it was planned again, kept if there is
+	// nothing to download
+	PreviousStatus preview.Status
+	// Optional. Forwarded to each downloadPartials.CMD. See preview.DownloadLimits
+	MaxDownloadTime time.Duration
+	SeederWaitTime  time.Duration
+	Deadline        time.Time
 }
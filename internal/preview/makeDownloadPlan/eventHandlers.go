@@ -24,7 +24,37 @@ func (TorrentCreatedEventHandler) NewEvent() interface{} {
 func (b *TorrentCreatedEventHandler) Handle(ctx context.Context, e interface{}) error {
 	event := e.(*preview.TorrentCreatedEvent)
 
-	return b.service.Download(ctx, CMD{
+	return ignoreRunning(b.service.Download(ctx, CMD{
 		TorrentID: event.TorrentID,
-	})
+	}))
+}
+
+type TorrentReprocessRequestedEventHandler struct {
+	service Service
+}
+
+func NewTorrentReprocessRequestedEventHandler(service Service) *TorrentReprocessRequestedEventHandler {
+	return &TorrentReprocessRequestedEventHandler{service: service}
+}
+
+func (b TorrentReprocessRequestedEventHandler) HandlerName() string {
+	return "event.torrentReprocess.makeDownloadPlan"
+}
+
+func (TorrentReprocessRequestedEventHandler) NewEvent() interface{} {
+	return new(preview.TorrentReprocessRequestedEvent)
+}
+
+func (b *TorrentReprocessRequestedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	event := e.(*preview.TorrentReprocessRequestedEvent)
+
+	return ignoreRunning(b.service.Download(ctx, CMD{
+		TorrentID:       event.TorrentID,
+		FileIDs:         event.FileIDs,
+		Force:           event.Force,
+		PreviousStatus:  event.PreviousStatus,
+		MaxDownloadTime: event.MaxDownloadTime,
+		SeederWaitTime:  event.SeederWaitTime,
+		Deadline:        event.Deadline,
+	}))
 }
@@ -2,6 +2,8 @@ package makeDownloadPlan
 
 import (
 	"context"
+	"errors"
+	"prevtorrent/internal/preview"
 )
 
 type CommandHandler struct {
@@ -21,5 +23,14 @@ func (h CommandHandler) NewCommand() interface{} {
 }
 
 func (h CommandHandler) Handle(ctx context.Context, c interface{}) error {
-	return h.service.Download(ctx, *c.(*CMD))
+	return ignoreRunning(h.service.Download(ctx, *c.(*CMD)))
+}
+
+// ignoreRunning acks the messages asking for a plan while another one is running. Delivering
+// them again would not help, the plan running makes the preview
+func ignoreRunning(err error) error {
+	if errors.Is(err, preview.ErrSagaRunning) {
+		return nil
+	}
+	return err
 }
@@ -2,15 +2,20 @@ package makeDownloadPlan
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"prevtorrent/internal/platform/bus"
 	"prevtorrent/internal/preview"
 	"prevtorrent/internal/preview/downloadPartials"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 const (
 	mb = 1 << (10 * 2) // MiB, really
+
+	maxUpdateAttempts = 5
 )
 
 type Service struct {
@@ -18,6 +23,7 @@ type Service struct {
 	commandBus        bus.Command
 	torrentRepository preview.TorrentRepository
 	imageRepository   preview.ImageRepository
+	sagaRepository    preview.SagaRepository
 }
 
 func NewService(
@@ -25,12 +31,14 @@ func NewService(
 	commandBus bus.Command,
 	torrentRepository preview.TorrentRepository,
 	imageRepository preview.ImageRepository,
+	sagaRepository preview.SagaRepository,
 ) Service {
 	return Service{
 		logger:            logger,
 		commandBus:        commandBus,
 		torrentRepository: torrentRepository,
 		imageRepository:   imageRepository,
+		sagaRepository:    sagaRepository,
 	}
 }
 
@@ -40,44 +48,174 @@ func (s Service) Download(ctx context.Context, cmd CMD) error {
 		return err
 	}
 
-	plan, err := s.makePlan(ctx, torrent)
+	err = s.download(ctx, &torrent, cmd)
+	if errors.Is(err, preview.ErrSagaRunning) {
+		// The status belongs to the plan running
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"torrentID": torrent.ID(),
+		}).Warn("the preview of the torrent is still running, no plan made")
+		return err
+	}
+	if err != nil {
+		s.markAsFailed(ctx, &torrent, err)
+		return err
+	}
+
+	return nil
+}
+
+func (s Service) download(ctx context.Context, torrent *preview.Torrent, cmd CMD) error {
+	torrentImages, err := s.imageRepository.ByTorrent(ctx, torrent.ID())
+	if err != nil {
+		return err
+	}
+
+	skip := torrentImages
+	if cmd.Force {
+		skip = preview.NewTorrentImages(nil)
+	}
+	plan, err := s.makePlan(*torrent, skip, cmd.FileIDs)
 	if err != nil {
 		return err
 	}
 
-	downloadCMD, err := s.makeDownloadPartialCommands(plan)
+	now := time.Now()
+	downloadCMD, err := s.makeDownloadPartialCommands(plan, cmd, now)
+	if err != nil {
+		return err
+	}
+
+	// The saga must be waiting before any of the downloads finishes. Storing it fails if the
+	// downloads of another plan are running, thus it goes before changing the status
+	saga, err := s.startSaga(ctx, torrent.ID(), len(downloadCMD), now, cmd.Force)
+	if err != nil {
+		return err
+	}
+	events := []interface{}{preview.NewDownloadPlanCreatedEvent(*plan, len(downloadCMD), now)}
+	if outcome := saga.Outcome(len(torrentImages.Images())); outcome != nil {
+		events = append(events, outcome)
+	}
+	err = s.sagaRepository.Persist(ctx, saga, events...)
+	if errors.Is(err, preview.ErrConcurrentUpdate) {
+		return preview.ErrSagaRunning
+	}
 	if err != nil {
 		return err
 	}
 
-	if err := s.executeCMDs(ctx, downloadCMD); err != nil {
+	// The status must be stored before sending the commands, otherwise we might overwrite
+	// the status set by the downloadPartials service
+	status := preview.StatusPlanned
+	if len(downloadCMD) == 0 {
+		status = preview.StatusCompleted
+		// Reprocessing something we already have does not change the outcome of the preview
+		if torrent.Status().IsFinal() {
+			status = torrent.Status()
+		} else if cmd.PreviousStatus.IsFinal() {
+			status = cmd.PreviousStatus
+		}
+	}
+	if err := torrent.ChangeStatus(status, nil); err != nil {
+		return err
+	}
+	if err := s.torrentRepository.UpdateStatus(ctx, *torrent); err != nil {
+		s.abandon(ctx, torrent.ID(), len(downloadCMD), len(torrentImages.Images()), err)
 		return err
 	}
 
+	if sent, err := s.executeCMDs(ctx, downloadCMD); err != nil {
+		s.abandon(ctx, torrent.ID(), len(downloadCMD)-sent, len(torrentImages.Images()), err)
+		return err
+	}
 	return nil
 }
 
-func (s Service) makePlan(ctx context.Context, t preview.Torrent) (*preview.DownloadPlan, error) {
-	torrentImages, err := s.imageRepository.ByTorrent(ctx, t.ID())
+// abandon gives up the downloads of the plan that were not sent, so its saga finishes and the
+// torrent can be planned again
+func (s Service) abandon(ctx context.Context, torrentID string, unsent, images int, reason error) {
+	if unsent == 0 {
+		return
+	}
+
+	var err error
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var saga *preview.PreviewSaga
+		if saga, err = s.sagaRepository.Get(ctx, torrentID); err != nil {
+			break
+		}
+		// In process, the downloads sent may have already been counted
+		for i := 0; i < unsent && !saga.IsFinished() && err == nil; i++ {
+			err = saga.PartFailed(reason.Error(), time.Now())
+		}
+		if err != nil {
+			break
+		}
+
+		var events []interface{}
+		if outcome := saga.Outcome(images); outcome != nil {
+			events = append(events, outcome)
+		}
+		if err = s.sagaRepository.Persist(ctx, saga, events...); !errors.Is(err, preview.ErrConcurrentUpdate) {
+			break
+		}
+	}
+	if err != nil {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"torrentID": torrentID,
+			"error":     err,
+		}).Error("unable to give up the downloads of the plan")
+	}
+}
+
+// startSaga returns the saga of a new plan, replacing the one of the previous plan if it finished,
+// or anyway if forced
+func (s Service) startSaga(ctx context.Context, torrentID string, parts int, now time.Time, force bool) (*preview.PreviewSaga, error) {
+	saga, err := s.sagaRepository.Get(ctx, torrentID)
+	if errors.Is(err, preview.ErrNotFound) {
+		return preview.StartPreviewSaga(torrentID, parts, now), nil
+	}
 	if err != nil {
 		return nil, err
 	}
+	if force {
+		saga.Replace(parts, now)
+		return saga, nil
+	}
+	if err := saga.Restart(parts, now); err != nil {
+		return nil, err
+	}
+	return saga, nil
+}
+
+func (s Service) markAsFailed(ctx context.Context, torrent *preview.Torrent, reason error) {
+	err := torrent.ChangeStatus(preview.StatusFailed, reason)
+	if err == nil {
+		err = s.torrentRepository.UpdateStatus(ctx, *torrent)
+	}
+	if err != nil {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"torrentID": torrent.ID(),
+			"error":     err,
+		}).Error("unable to mark the torrent as failed")
+	}
+}
 
+func (s Service) makePlan(t preview.Torrent, torrentImages *preview.TorrentImages, fileIDs []int) (*preview.DownloadPlan, error) {
 	plan := preview.NewDownloadPlan(t)
-	if err := plan.AddAll(torrentImages); err != nil {
+	if err := plan.AddFiles(torrentImages, fileIDs); err != nil {
 		return nil, err
 	}
 	return plan, nil
 }
 
-func (s Service) makeDownloadPartialCommands(plan *preview.DownloadPlan) ([]downloadPartials.CMD, error) {
+func (s Service) makeDownloadPartialCommands(plan *preview.DownloadPlan, cmd CMD, startedAt time.Time) ([]downloadPartials.CMD, error) {
 	plans, err := plan.GetCappedPlans(downloadSize(plan.GetTorrent()))
 	if err != nil {
 		return nil, err
 	}
 
 	commands := make([]downloadPartials.CMD, 0)
-	for _, partialPlan := range plans {
+	for i, partialPlan := range plans {
 		files := make([]downloadPartials.File, 0, len(partialPlan))
 		for _, fileRange := range partialPlan {
 			files = append(files, downloadPartials.File{
@@ -87,19 +225,33 @@ func (s Service) makeDownloadPartialCommands(plan *preview.DownloadPlan) ([]down
 			})
 		}
 
-		commands = append(commands, downloadPartials.CMD{ID: plan.GetTorrent().ID(), Files: files})
+		commands = append(commands, downloadPartials.CMD{
+			ID:              plan.GetTorrent().ID(),
+			Files:           files,
+			MaxDownloadTime: cmd.MaxDownloadTime,
+			SeederWaitTime:  cmd.SeederWaitTime,
+			Deadline:        cmd.Deadline,
+			Force:           cmd.Force,
+			IdempotencyKey:  planKey(plan.GetTorrent().ID(), startedAt, i),
+		})
 	}
 	return commands, nil
 }
 
-func (s Service) executeCMDs(ctx context.Context, commands []downloadPartials.CMD) error {
-	for _, downloadCMD := range commands {
+// executeCMDs sends the commands, returning how many were sent
+func (s Service) executeCMDs(ctx context.Context, commands []downloadPartials.CMD) (int, error) {
+	for i, downloadCMD := range commands {
 		if err := s.commandBus.Send(ctx, downloadCMD); err != nil {
-			return err
+			return i, err
 		}
 	}
 
-	return nil
+	return len(commands), nil
+}
+
+// planKey identifies each download of a plan, so the ones delivered twice are made only once
+func planKey(torrentID string, startedAt time.Time, part int) string {
+	return fmt.Sprintf("plan/%v/%v/%v", torrentID, startedAt.UnixNano(), part)
 }
 
 func downloadSize(t preview.Torrent) int {
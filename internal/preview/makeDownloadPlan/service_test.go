@@ -6,9 +6,12 @@ import (
 	"io/ioutil"
 	"prevtorrent/internal/platform/bus/busmocks"
 	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/downloadPartials"
 	"prevtorrent/internal/preview/makeDownloadPlan"
 	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
@@ -26,7 +29,7 @@ func TestService_Download_ErrorOnGettingTorrent(t *testing.T) {
 
 	commandBus := new(busmocks.Command)
 
-	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository)
+	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository, new(storagemocks.SagaRepository))
 
 	err := service.Download(context.Background(), makeDownloadPlan.CMD{
 		TorrentID: torrentID,
@@ -49,6 +52,8 @@ func TestService_Download_ErrorOnGettingTorrentImages(t *testing.T) {
 	torrentRepository := new(storagemocks.TorrentRepository)
 	torrentRepository.On("Get", mock.Anything, torrentID).
 		Return(torrent, nil)
+	torrentRepository.On("UpdateStatus", mock.Anything, mock.Anything).
+		Return(nil)
 
 	imageRepository := new(storagemocks.ImageRepository)
 	imageRepository.On("ByTorrent", mock.Anything, torrentID).
@@ -56,7 +61,7 @@ func TestService_Download_ErrorOnGettingTorrentImages(t *testing.T) {
 
 	commandBus := new(busmocks.Command)
 
-	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository)
+	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository, new(storagemocks.SagaRepository))
 
 	err = service.Download(context.Background(), makeDownloadPlan.CMD{
 		TorrentID: torrentID,
@@ -79,6 +84,8 @@ func TestService_Download_ErrorOnExecutingCommands(t *testing.T) {
 	torrentRepository := new(storagemocks.TorrentRepository)
 	torrentRepository.On("Get", mock.Anything, torrentID).
 		Return(torrent, nil)
+	torrentRepository.On("UpdateStatus", mock.Anything, mock.Anything).
+		Return(nil)
 
 	imageRepository := new(storagemocks.ImageRepository)
 	imageRepository.On("ByTorrent", mock.Anything, torrentID).
@@ -88,13 +95,30 @@ func TestService_Download_ErrorOnExecutingCommands(t *testing.T) {
 	commandBus.On("Send", mock.Anything, mock.Anything).
 		Return(errors.New("fake publish error"))
 
-	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository)
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).Return(nil, preview.ErrNotFound).Once()
+	sagaRepository.On("Persist", mock.Anything, mock.MatchedBy(func(s *preview.PreviewSaga) bool {
+		return s.TorrentID() == torrentID && s.Parts() == 1 && !s.IsFinished()
+	}), mock.MatchedBy(func(e *preview.DownloadPlanCreatedEvent) bool {
+		return e.TorrentID == torrentID && e.Downloads == 1 && len(e.Ranges) == 1
+	})).Return(nil).Once()
+	// The download not sent is given up, so the torrent can be planned again
+	sagaRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.RestorePreviewSaga(torrentID, 1, 0, 0, "", time.Now(), time.Time{}, 1), nil).Once()
+	sagaRepository.On("Persist", mock.Anything, mock.MatchedBy(func(s *preview.PreviewSaga) bool {
+		return s.IsFinished() && s.Failed() == 1
+	}), mock.MatchedBy(func(e *preview.TorrentPreviewFailedEvent) bool {
+		return e.Reason == "fake publish error"
+	})).Return(nil).Once()
+
+	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository, sagaRepository)
 
 	err = service.Download(context.Background(), makeDownloadPlan.CMD{
 		TorrentID: torrentID,
 	})
 
 	require.Error(t, err)
+	sagaRepository.AssertExpectations(t)
 }
 
 func TestService_Download_BaseCase(t *testing.T) {
@@ -111,22 +135,300 @@ func TestService_Download_BaseCase(t *testing.T) {
 	torrentRepository := new(storagemocks.TorrentRepository)
 	torrentRepository.On("Get", mock.Anything, torrentID).
 		Return(torrent, nil)
+	torrentRepository.On("UpdateStatus", mock.Anything, mock.Anything).
+		Return(nil)
 
 	imageRepository := new(storagemocks.ImageRepository)
 	imageRepository.On("ByTorrent", mock.Anything, torrentID).
 		Return(new(preview.TorrentImages), nil)
 
 	commandBus := new(busmocks.Command)
-	commandBus.On("Send", mock.Anything, mock.Anything).
+	commandBus.On("Send", mock.Anything, mock.MatchedBy(func(cmd downloadPartials.CMD) bool {
+		return strings.HasPrefix(cmd.IdempotencyKey, "plan/"+torrentID+"/") && strings.HasSuffix(cmd.IdempotencyKey, "/0")
+	})).Return(nil)
+
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).Return(nil, preview.ErrNotFound).Once()
+	sagaRepository.On("Persist", mock.Anything, mock.MatchedBy(func(s *preview.PreviewSaga) bool {
+		return s.TorrentID() == torrentID && s.Parts() == 1 && !s.IsFinished()
+	}), mock.MatchedBy(func(e *preview.DownloadPlanCreatedEvent) bool {
+		return e.TorrentID == torrentID && e.Downloads == 1 && len(e.Ranges) == 1
+	})).Return(nil)
+
+	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository, sagaRepository)
+
+	err = service.Download(context.Background(), makeDownloadPlan.CMD{
+		TorrentID: torrentID,
+	})
+
+	require.NoError(t, err)
+	torrentRepository.AssertCalled(t, "UpdateStatus", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusPlanned
+	}))
+	sagaRepository.AssertExpectations(t)
+}
+
+func TestService_Download_PreviewRunning(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).
+		Return(torrent, nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(new(preview.TorrentImages), nil)
+
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.RestorePreviewSaga(torrentID, 2, 1, 0, "", time.Now(), time.Time{}, 2), nil)
+
+	commandBus := new(busmocks.Command)
+
+	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository, sagaRepository)
+
+	err = service.Download(context.Background(), makeDownloadPlan.CMD{
+		TorrentID: torrentID,
+	})
+
+	require.True(t, errors.Is(err, preview.ErrSagaRunning))
+	torrentRepository.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything)
+	sagaRepository.AssertNotCalled(t, "Persist", mock.Anything, mock.Anything, mock.Anything)
+	commandBus.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+}
+
+func TestService_Download_ForceReplacesThePreviewRunning(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+	torrent.RestoreStatus(preview.StatusPlanned, "")
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).
+		Return(torrent, nil)
+	torrentRepository.On("UpdateStatus", mock.Anything, mock.Anything).
 		Return(nil)
 
-	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository)
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(new(preview.TorrentImages), nil)
+
+	// The downloads of the previous plan are stuck
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.RestorePreviewSaga(torrentID, 2, 1, 0, "", time.Now().Add(-24*time.Hour), time.Time{}, 2), nil)
+	sagaRepository.On("Persist", mock.Anything, mock.MatchedBy(func(s *preview.PreviewSaga) bool {
+		return s.Version() == 2 && s.Parts() == 1 && s.Succeeded() == 0 && !s.IsFinished()
+	}), mock.AnythingOfType("*preview.DownloadPlanCreatedEvent")).Return(nil)
+
+	commandBus := new(busmocks.Command)
+	commandBus.On("Send", mock.Anything, mock.Anything).Return(nil)
+
+	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository, sagaRepository)
+
+	err = service.Download(context.Background(), makeDownloadPlan.CMD{
+		TorrentID:      torrentID,
+		Force:          true,
+		PreviousStatus: preview.StatusDownloading,
+	})
+
+	require.NoError(t, err)
+	sagaRepository.AssertExpectations(t)
+	commandBus.AssertNumberOfCalls(t, "Send", 1)
+}
+
+func TestService_Download_PreviewStartedConcurrently(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).
+		Return(torrent, nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(new(preview.TorrentImages), nil)
+
+	// The previous preview has finished, but someone else restarts it first
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.RestorePreviewSaga(torrentID, 1, 1, 0, "", time.Now(), time.Now(), 2), nil)
+	sagaRepository.On("Persist", mock.Anything, mock.MatchedBy(func(s *preview.PreviewSaga) bool {
+		return s.Version() == 2 && s.Parts() == 1 && s.Succeeded() == 0
+	}), mock.Anything).Return(preview.ErrConcurrentUpdate)
+
+	commandBus := new(busmocks.Command)
+
+	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository, sagaRepository)
+
+	err = service.Download(context.Background(), makeDownloadPlan.CMD{
+		TorrentID: torrentID,
+	})
+
+	require.True(t, errors.Is(err, preview.ErrSagaRunning))
+	torrentRepository.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything)
+	commandBus.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+}
+
+func TestService_Download_NothingToDownload(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 10, "readme.txt")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).
+		Return(torrent, nil)
+	torrentRepository.On("UpdateStatus", mock.Anything, mock.Anything).
+		Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(new(preview.TorrentImages), nil)
+
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).Return(nil, preview.ErrNotFound).Once()
+	sagaRepository.On("Persist", mock.Anything, mock.MatchedBy(func(s *preview.PreviewSaga) bool {
+		return s.IsFinished()
+	}), mock.AnythingOfType("*preview.DownloadPlanCreatedEvent"), mock.MatchedBy(func(e *preview.TorrentPreviewCompletedEvent) bool {
+		return e.TorrentID == torrentID && e.Parts == 0
+	})).Return(nil)
+
+	commandBus := new(busmocks.Command)
+
+	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository, sagaRepository)
 
 	err = service.Download(context.Background(), makeDownloadPlan.CMD{
 		TorrentID: torrentID,
 	})
 
 	require.NoError(t, err)
+	torrentRepository.AssertCalled(t, "UpdateStatus", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusCompleted
+	}))
+	commandBus.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+	sagaRepository.AssertExpectations(t)
+}
+
+func TestService_Download_ForceReprocessOfSomeFiles(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f1, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+	f2, err := preview.NewFileInfo(1, 10, "video2.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f1, f2}, []byte("torrent-data"))
+	require.NoError(t, err)
+	torrent.RestoreStatus(preview.StatusPlanned, "")
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).
+		Return(torrent, nil)
+	torrentRepository.On("UpdateStatus", mock.Anything, mock.Anything).
+		Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(existingImages(t, torrent), nil)
+
+	commandBus := new(busmocks.Command)
+	commandBus.On("Send", mock.Anything, mock.MatchedBy(func(cmd downloadPartials.CMD) bool {
+		return cmd.Force && len(cmd.Files) == 1 && cmd.Files[0].FileID == 1
+	})).Return(nil)
+
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).Return(nil, preview.ErrNotFound).Once()
+	sagaRepository.On("Persist", mock.Anything, mock.MatchedBy(func(s *preview.PreviewSaga) bool {
+		return s.Parts() == 1 && !s.IsFinished()
+	}), mock.AnythingOfType("*preview.DownloadPlanCreatedEvent")).Return(nil)
+
+	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository, sagaRepository)
+
+	err = service.Download(context.Background(), makeDownloadPlan.CMD{
+		TorrentID:      torrentID,
+		FileIDs:        []int{1},
+		Force:          true,
+		PreviousStatus: preview.StatusCompleted,
+	})
+
+	require.NoError(t, err)
+	torrentRepository.AssertCalled(t, "UpdateStatus", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusPlanned
+	}))
+	commandBus.AssertNumberOfCalls(t, "Send", 1)
+	sagaRepository.AssertExpectations(t)
+}
+
+func TestService_Download_ReprocessWithoutForceKeepsTheStatus(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+	torrent.RestoreStatus(preview.StatusPlanned, "")
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).
+		Return(torrent, nil)
+	torrentRepository.On("UpdateStatus", mock.Anything, mock.Anything).
+		Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).
+		Return(existingImages(t, torrent), nil)
+
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).Return(nil, preview.ErrNotFound).Once()
+	sagaRepository.On("Persist", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	commandBus := new(busmocks.Command)
+
+	service := makeDownloadPlan.NewService(fakeLogger(), commandBus, torrentRepository, imageRepository, sagaRepository)
+
+	err = service.Download(context.Background(), makeDownloadPlan.CMD{
+		TorrentID:      torrentID,
+		FileIDs:        []int{0},
+		PreviousStatus: preview.StatusPartiallyCompleted,
+	})
+
+	require.NoError(t, err)
+	torrentRepository.AssertCalled(t, "UpdateStatus", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusPartiallyCompleted
+	}))
+	commandBus.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+}
+
+// existingImages returns an image for every range the torrent would download
+func existingImages(t *testing.T, torrent preview.Torrent) *preview.TorrentImages {
+	plan := preview.NewDownloadPlan(torrent)
+	require.NoError(t, plan.AddAll(preview.NewTorrentImages(nil)))
+
+	images := make([]preview.Image, 0, len(plan.GetPlan()))
+	for _, pr := range plan.GetPlan() {
+		images = append(images, preview.NewImage(torrent.ID(), pr.FileID(), pr.Name(), 100))
+	}
+	return preview.NewTorrentImages(images)
 }
 
 func fakeLogger() *logrus.Logger {
@@ -1,22 +1,48 @@
 package preview
 
 import (
-	"bytes"
-	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 )
 
+// PieceSource reads the pieces of a torrent by index. The reader of a MediaPart releases each piece
+// once it moves to another one, so only one piece of the file is held in memory at a time
+type PieceSource interface {
+	ReadPiece(idx int) ([]byte, error)
+	ReleasePiece(idx int)
+}
+
 // MediaPart has the binary data expected after downloading a PieceRange from the
 // DownloadPlan. So, usually it's going to be a partial video from a Torrent.
+// The data is not kept in memory: the MediaPart knows the portions of the pieces that belong
+// to the file and reads them from the PieceSource, in order, when the file is read.
 type MediaPart struct {
 	torrentID  string
 	pieceRange PieceRange
-	data       []byte
+	source     PieceSource
+	spans      []pieceSpan // portions of the pieces, in order
+	length     int64
+}
+
+// pieceSpan is the portion [start, end) of a piece that belongs to the file
+type pieceSpan struct {
+	idx   int
+	start int
+	end   int
 }
 
-// NewMediaPart creates a MediaPart
+// NewMediaPart creates a MediaPart with the data already in memory
 func NewMediaPart(torrentID string, pieceRange PieceRange, data []byte) MediaPart {
-	return MediaPart{torrentID: torrentID, pieceRange: pieceRange, data: data}
+	return newMediaPart(torrentID, pieceRange, bytesSource(data), []pieceSpan{{idx: 0, start: 0, end: len(data)}})
+}
+
+func newMediaPart(torrentID string, pieceRange PieceRange, source PieceSource, spans []pieceSpan) MediaPart {
+	length := int64(0)
+	for _, span := range spans {
+		length += int64(span.end - span.start)
+	}
+	return MediaPart{torrentID: torrentID, pieceRange: pieceRange, source: source, spans: spans, length: length}
 }
 
 // PieceRange returns the obvious
@@ -24,30 +50,162 @@ func (p MediaPart) PieceRange() PieceRange {
 	return p.pieceRange
 }
 
-// Data raw data of the file
-func (p MediaPart) Data() []byte {
-	return p.data
+// Length returns the size of the file in bytes
+func (p MediaPart) Length() int64 {
+	return p.length
+}
+
+// Reader returns a new reader of the file. Each reader has its own offset and its own piece in memory
+func (p MediaPart) Reader() io.ReadSeeker {
+	return &mediaReader{source: p.source, spans: p.spans, length: p.length, current: -1}
+}
+
+// Data raw data of the file. Copies the whole file in memory, use Reader whenever possible
+func (p MediaPart) Data() ([]byte, error) {
+	return ioutil.ReadAll(p.Reader())
+}
+
+// bytesSource is a PieceSource with a single piece already in memory
+type bytesSource []byte
+
+func (b bytesSource) ReadPiece(int) ([]byte, error) {
+	return b, nil
+}
+
+func (b bytesSource) ReleasePiece(int) {}
+
+// mediaReader reads the spans of a MediaPart as if they were a single slice. It only holds the
+// piece being read, which is released as soon as the reader moves to another one
+type mediaReader struct {
+	source  PieceSource
+	spans   []pieceSpan
+	length  int64
+	offset  int64
+	current int // span whose piece is in data. -1 if none
+	data    []byte
+}
+
+func (r *mediaReader) Read(b []byte) (int, error) {
+	if r.offset >= r.length {
+		r.release()
+		return 0, io.EOF
+	}
+
+	n := 0
+	start := int64(0) // offset of the current span in the file
+	for i, span := range r.spans {
+		end := start + int64(span.end-span.start)
+		if r.offset < end && n < len(b) {
+			if err := r.load(i); err != nil {
+				return n, err
+			}
+			from := span.start + int(r.offset-start)
+			copied := copy(b[n:], r.data[from:span.end])
+			n += copied
+			r.offset += int64(copied)
+		}
+		start = end
+	}
+	if r.offset >= r.length {
+		r.release()
+	}
+	return n, nil
+}
+
+// load reads the piece of the span, releasing the one read before
+func (r *mediaReader) load(span int) error {
+	if r.current == span {
+		return nil
+	}
+	r.release()
+
+	idx := r.spans[span].idx
+	data, err := r.source.ReadPiece(idx)
+	if err != nil {
+		return err
+	}
+	if len(data) < r.spans[span].end {
+		r.source.ReleasePiece(idx)
+		return fmt.Errorf("piece %v has %v bytes, expected at least %v", idx, len(data), r.spans[span].end)
+	}
+	r.current, r.data = span, data
+	return nil
+}
+
+func (r *mediaReader) release() {
+	if r.current < 0 {
+		return
+	}
+	r.source.ReleasePiece(r.spans[r.current].idx)
+	r.current, r.data = -1, nil
+}
+
+func (r *mediaReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.length + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %v", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("negative position %v", abs)
+	}
+	r.offset = abs
+	return abs, nil
 }
 
 type pieceRangeCounter struct {
 	pieceRange       PieceRange
+	received         []bool // pieces received, from the start of the range
 	piecesDownloaded int
 }
 
 func newPieceRangeCounter(
 	pieceRange PieceRange,
 ) *pieceRangeCounter {
-	return &pieceRangeCounter{pieceRange: pieceRange}
+	return &pieceRangeCounter{pieceRange: pieceRange, received: make([]bool, pieceRange.PieceCount())}
 }
 
-func (c *pieceRangeCounter) addOne() {
+// addOne counts the piece as downloaded. Returns false if it does not belong to the range or
+// it has already been counted
+func (c *pieceRangeCounter) addOne(pieceIdx int) bool {
+	i := pieceIdx - c.pieceRange.Start()
+	if i < 0 || i >= len(c.received) || c.received[i] {
+		return false
+	}
+	c.received[i] = true
 	c.piecesDownloaded++
+	return true
+}
+
+// reset forgets the pieces received, so they are counted again when downloaded again
+func (c *pieceRangeCounter) reset() {
+	c.received = make([]bool, len(c.received))
+	c.piecesDownloaded = 0
 }
 
 func (c *pieceRangeCounter) areAllPiecesDownloaded() bool {
 	return c.piecesDownloaded >= c.pieceRange.PieceCount()
 }
 
+func (c *pieceRangeCounter) piecesMissing() int {
+	if c.areAllPiecesDownloaded() {
+		return 0
+	}
+	return c.pieceRange.PieceCount() - c.piecesDownloaded
+}
+
+// MissingRange is a PieceRange that has not received all its pieces
+type MissingRange struct {
+	PieceRange    PieceRange
+	PiecesMissing int
+}
+
 // BundlePlan gets a PieceRange which is the definition of a file we want to download,
 // and a PieceRegistry which is were we have stored individual pieces,
 // and reads the whole file from the pieces.
@@ -55,6 +213,9 @@ func (c *pieceRangeCounter) areAllPiecesDownloaded() bool {
 // and each files does not start at the start of a piece. That would be coincidence.
 // BundlePlan takes care of this logic and returns a MediaPart, which is the closes thing
 // of a file we're going to have.
+// When the registry knows the hashes of the torrent, each piece is verified before being
+// used. If a piece is missing or corrupt, a CorruptPieceError is returned and the
+// PieceRange is marked as missing in the registry, so it can be downloaded again.
 type BundlePlan struct{}
 
 // NewBundlePlan creates a BundlePlan
@@ -62,14 +223,24 @@ func NewBundlePlan() BundlePlan {
 	return BundlePlan{}
 }
 
-// Bundle transform a PieceRange (the file we want) to a MediaPart (the actual file)
+// Bundle transform a PieceRange (the file we want) to a MediaPart (the actual file). Each piece
+// is read once to be verified, and read again from the registry when the MediaPart is read
 func (b BundlePlan) Bundle(registry *PieceRegistry, pieceRange PieceRange) (MediaPart, error) {
-	piece := new(bytes.Buffer)
+	spans := make([]pieceSpan, 0, pieceRange.PieceCount())
 
 	for pieceIdx := pieceRange.Start(); pieceIdx <= pieceRange.End(); pieceIdx++ {
 		p, found := registry.GetPiece(pieceIdx)
 		if !found {
-			return MediaPart{}, errors.New("piece not found in the registry. could be ignored but kept to further investigate")
+			registry.reject(pieceRange)
+			return MediaPart{}, &CorruptPieceError{
+				TorrentID: pieceRange.Torrent().ID(),
+				PieceIdx:  pieceIdx,
+				Reason:    "piece not found in the registry",
+			}
+		}
+		if err := registry.verify(p); err != nil {
+			registry.reject(pieceRange)
+			return MediaPart{}, err
 		}
 		start := pieceRange.StartOffset(pieceIdx)
 		end := pieceRange.EndOffset(pieceIdx)
@@ -83,14 +254,10 @@ func (b BundlePlan) Bundle(registry *PieceRegistry, pieceRange PieceRange) (Medi
 			return MediaPart{}, fmt.Errorf("end offset %v is bigger than length of slice %v", start, len(p.data))
 		}
 
-		rawData := p.data[start:end]
-		_, err := piece.Write(rawData)
-		if err != nil {
-			return MediaPart{}, err
-		}
+		spans = append(spans, pieceSpan{idx: pieceIdx, start: start, end: end})
 	}
 
-	return NewMediaPart(pieceRange.Torrent().ID(), pieceRange, piece.Bytes()), nil
+	return newMediaPart(pieceRange.Torrent().ID(), pieceRange, registry, spans), nil
 }
 
 // TorrentImages represents all the images of a torrent
@@ -1,6 +1,8 @@
 package preview
 
 import (
+	"io"
+	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -22,10 +24,63 @@ func TestPieceRangeCounter_TwoPieces(t *testing.T) {
 
 	counter := newPieceRangeCounter(pr)
 	assert.False(t, counter.areAllPiecesDownloaded())
-	counter.addOne() // +1 . Total=1
+	assert.True(t, counter.addOne(0)) // +1 . Total=1
+	assert.False(t, counter.addOne(0), "a piece is counted once")
 	assert.False(t, counter.areAllPiecesDownloaded())
-	counter.addOne() // +1 . Total=2
+	assert.False(t, counter.addOne(2), "the piece is not in the range")
+	assert.True(t, counter.addOne(1)) // +1 . Total=2
 	assert.True(t, counter.areAllPiecesDownloaded())
 
 	assert.Equal(t, pr.PieceCount(), counter.piecesDownloaded)
 }
+
+// countingSource counts the pieces read and not released yet
+type countingSource struct {
+	pieces      map[int][]byte
+	resident    int
+	maxResident int
+}
+
+func (s *countingSource) ReadPiece(idx int) ([]byte, error) {
+	s.resident++
+	if s.resident > s.maxResident {
+		s.maxResident = s.resident
+	}
+	return s.pieces[idx], nil
+}
+
+func (s *countingSource) ReleasePiece(int) {
+	s.resident--
+}
+
+func TestMediaPart_Reader_OnePieceInMemory(t *testing.T) {
+	source := &countingSource{pieces: map[int][]byte{
+		0: []byte("0000000000"),
+		1: []byte("1111111111"),
+		2: []byte("2222222222"),
+	}}
+	spans := []pieceSpan{{idx: 0, start: 5, end: 10}, {idx: 1, start: 0, end: 10}, {idx: 2, start: 0, end: 4}}
+	media := newMediaPart("cb84ccc10f296df72d6c40ba7a07c178a4323a14", PieceRange{}, source, spans)
+
+	reader := media.Reader()
+	buf := make([]byte, 3)
+	read := make([]byte, 0)
+	for {
+		n, err := reader.Read(buf)
+		read = append(read, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "000001111111111"+"2222", string(read))
+
+	_, err := reader.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	all, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "0001111111111"+"2222", string(all))
+
+	assert.Equal(t, 1, source.maxResident)
+	assert.Equal(t, 0, source.resident, "the last piece is released once the whole file has been read")
+}
@@ -2,8 +2,12 @@ package preview_test
 
 import (
 	"context"
+	"crypto/sha1"
+	"errors"
+	"io"
 	"io/ioutil"
 	"prevtorrent/internal/preview"
+	"strings"
 	"testing"
 	"time"
 
@@ -30,10 +34,55 @@ func TestMediaPart(t *testing.T) {
 
 	media := preview.NewMediaPart(torrentID, pr, data)
 
-	assert.Equal(t, data, media.Data())
+	got, err := media.Data()
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
 	assert.Equal(t, pr, media.PieceRange())
 }
 
+func TestMediaPart_Reader(t *testing.T) {
+	torrentID := "ZOCmzqipffw7ollmic5hub6bpcsdeoqu"
+
+	fi, err := preview.NewFileInfo(0, 60, "movie.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "test movie", 25, []preview.File{fi}, []byte(""))
+	require.NoError(t, err)
+
+	plan := preview.NewDownloadPlan(torrent)
+	require.NoError(t, plan.AddAll(preview.NewTorrentImages(nil)))
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	require.NoError(t, err)
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 0, []byte("0000000000000000000000000"))))
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 1, []byte("1111111111111111111111111"))))
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 2, []byte("2222222222"))))
+
+	pieceRange, err := preview.NewPieceRange(torrent, fi, 0, 20, 35)
+	require.NoError(t, err)
+	media, err := preview.NewBundlePlan().Bundle(registry, pieceRange)
+	require.NoError(t, err)
+	assert.Equal(t, int64(35), media.Length())
+
+	reader := media.Reader()
+	buf := make([]byte, 10)
+	n, err := io.ReadFull(reader, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "0000011111", string(buf[:n]))
+
+	pos, err := reader.Seek(-5, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), pos)
+	rest, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "22222", string(rest))
+
+	_, err = reader.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+
+	all, err := ioutil.ReadAll(media.Reader())
+	require.NoError(t, err)
+	assert.Equal(t, "00000"+strings.Repeat("1", 25)+"22222", string(all))
+}
+
 func TestBundlePlan_Bundle(t *testing.T) {
 	type args struct {
 		start  int
@@ -143,11 +192,65 @@ func TestBundlePlan_Bundle(t *testing.T) {
 				t.Errorf("Bundle() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			assert.Equal(t, string(tt.want), string(got.Data()))
+			data, err := got.Data()
+			require.NoError(t, err)
+			assert.Equal(t, string(tt.want), string(data))
 		})
 	}
 }
 
+func TestBundlePlan_Bundle_VerifiesPieces(t *testing.T) {
+	torrentID := "ZOCmzqipffw7ollmic5hub6bpcsdeoqu"
+
+	fi, err := preview.NewFileInfo(0, 40, "movie.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "test movie", 25, []preview.File{fi}, []byte(""))
+	require.NoError(t, err)
+
+	part0 := []byte("0123456789012345678912345")
+	part1 := []byte("111111111111111") // the last piece is shorter
+	hash0, hash1 := sha1.Sum(part0), sha1.Sum(part1)
+	hashes := [][]byte{hash0[:], hash1[:]}
+
+	plan := preview.NewDownloadPlan(torrent)
+	require.NoError(t, plan.AddAll(preview.NewTorrentImages(nil)))
+	pieceRange, err := preview.NewPieceRange(torrent, fi, 0, 0, 40)
+	require.NoError(t, err)
+
+	t.Run("valid pieces, the last one padded", func(t *testing.T) {
+		registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan),
+			preview.WithPieceHashes(hashes))
+		require.NoError(t, err)
+		require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 0, part0)))
+		require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 1, append(part1, make([]byte, 10)...))))
+
+		got, err := preview.NewBundlePlan().Bundle(registry, pieceRange)
+		require.NoError(t, err)
+		data, err := got.Data()
+		require.NoError(t, err)
+		assert.Equal(t, append(part0, part1...), data)
+		assert.Empty(t, registry.MissingRanges())
+	})
+
+	t.Run("corrupt piece", func(t *testing.T) {
+		registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan),
+			preview.WithPieceHashes(hashes))
+		require.NoError(t, err)
+		require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 0, part0)))
+		require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 1, make([]byte, 25))))
+
+		_, err = preview.NewBundlePlan().Bundle(registry, pieceRange)
+		require.True(t, errors.Is(err, preview.ErrCorruptPiece))
+		var corrupt *preview.CorruptPieceError
+		require.True(t, errors.As(err, &corrupt))
+		assert.Equal(t, 1, corrupt.PieceIdx)
+
+		missing := registry.MissingRanges()
+		require.Len(t, missing, 1)
+		assert.Equal(t, 2, missing[0].PiecesMissing)
+	})
+}
+
 func Test_TorrentImages(t *testing.T) {
 	imgs := []preview.Image{
 		preview.NewImage("torrentID", 0, "img1", 10),
@@ -3,23 +3,48 @@ package cli
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
 	"prevtorrent/internal/platform/bus"
+	"prevtorrent/internal/platform/bus/eventlog"
+	"prevtorrent/internal/platform/health"
+	"prevtorrent/internal/preview/deleteTorrent"
 	"prevtorrent/internal/preview/downloadPartials"
+	"prevtorrent/internal/preview/previewLocal"
+	"prevtorrent/internal/preview/reprocessTorrent"
+	"prevtorrent/internal/preview/seedTorrent"
 	"prevtorrent/internal/preview/unmagnetize"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
 
+// Services are the services used by the commands that do not go through the command bus. They are
+// only built when the command needs them
+type Services interface {
+	SeedTorrent() seedTorrent.Service
+	PreviewLocal() previewLocal.Service
+	EventReplayer() *eventlog.Replayer
+	HealthChecker() *health.Checker
+	ReprocessTorrent() reprocessTorrent.Service
+	DeleteTorrent() deleteTorrent.Service
+}
+
 type handlers struct {
 	commandBus bus.Command
+	services   Services
 }
 
-func newHandlers(bus bus.Command) *handlers {
-	return &handlers{commandBus: bus}
+func newHandlers(bus bus.Command, services Services) *handlers {
+	return &handlers{commandBus: bus, services: services}
 }
 
-func Run(args []string, bus bus.Command) error {
-	handlers := newHandlers(bus)
+func Run(args []string, bus bus.Command, services Services) error {
+	handlers := newHandlers(bus, services)
 
 	app := &cli.App{
 		Name:  "torrentprev",
@@ -28,6 +53,20 @@ func Run(args []string, bus bus.Command) error {
 			{
 				Name:  "download",
 				Usage: "download the given torrent ID - must have been imported first",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "max-download-time",
+						Usage: "how long to wait for the pieces once the download has started",
+					},
+					&cli.DurationFlag{
+						Name:  "seeder-wait",
+						Usage: "how long to wait for a seeder before giving up",
+					},
+					&cli.DurationFlag{
+						Name:  "deadline",
+						Usage: "give up after this time, no matter what",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					return handlers.download(c)
 				},
@@ -39,6 +78,99 @@ func Run(args []string, bus bus.Command) error {
 					return handlers.magnet(c)
 				},
 			},
+			{
+				Name:      "seed",
+				Usage:     "creates a torrent with the files in the given path, imports it and seeds it until stopped",
+				ArgsUsage: "<path>",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "piece-length",
+						Usage: "piece length in bytes. Chosen depending on the size of the files if not set",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return handlers.seed(c)
+				},
+			},
+			{
+				Name:      "preview-local",
+				Usage:     "generates the previews reading the files in the given path, without downloading anything",
+				ArgsUsage: "<path>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "torrent",
+						Usage: "path to the .torrent of the files. A torrent is created if not set",
+					},
+					&cli.IntFlag{
+						Name:  "piece-length",
+						Usage: "piece length in bytes of the torrent created. Ignored when --torrent is set",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return handlers.previewLocal(c)
+				},
+			},
+			{
+				Name: "replay",
+				Usage: "rebuilds the given projections, all of them if none, from the event log. " +
+					"Stop the event handlers meanwhile. The status of the torrents is not a projection, it is not rebuilt",
+				ArgsUsage: "[projection...]",
+				Action: func(c *cli.Context) error {
+					return handlers.replay(c)
+				},
+			},
+			{
+				Name: "reprocess",
+				Usage: "generates again the previews of the given torrent ID, of all its files if no --file is set. " +
+					"The images we already have are skipped unless --force is set",
+				ArgsUsage: "<torrentID>",
+				Flags: []cli.Flag{
+					&cli.IntSliceFlag{
+						Name:  "file",
+						Usage: "ID of a file to reprocess. Can be repeated",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "replace the images we already have, and the plan in progress if the preview is stuck",
+					},
+					&cli.DurationFlag{
+						Name:  "max-download-time",
+						Usage: "how long to wait for the pieces once the download has started",
+					},
+					&cli.DurationFlag{
+						Name:  "seeder-wait",
+						Usage: "how long to wait for a seeder before giving up",
+					},
+					&cli.DurationFlag{
+						Name:  "deadline",
+						Usage: "give up after this time, no matter what",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return handlers.reprocess(c)
+				},
+			},
+			{
+				Name:      "delete",
+				Usage:     "deletes the given torrent ID, its images and its clips, and stops sharing it",
+				ArgsUsage: "<torrentID>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "delete it even if its preview is being processed, e.g. stuck downloading",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return handlers.delete(c)
+				},
+			},
+			{
+				Name:  "doctor",
+				Usage: "checks the database, the broker, the image directory, ffmpeg and the torrent client",
+				Action: func(c *cli.Context) error {
+					return handlers.doctor(c)
+				},
+			},
 		},
 	}
 
@@ -62,7 +194,141 @@ func (h *handlers) download(c *cli.Context) error {
 	}
 	torrent := c.Args().Get(0)
 
-	return h.commandBus.Send(context.Background(), &downloadPartials.CMD{
-		ID: torrent,
+	cmd := &downloadPartials.CMD{
+		ID:              torrent,
+		MaxDownloadTime: c.Duration("max-download-time"),
+		SeederWaitTime:  c.Duration("seeder-wait"),
+	}
+	if deadline := c.Duration("deadline"); deadline > 0 {
+		cmd.Deadline = time.Now().Add(deadline)
+	}
+
+	return h.commandBus.Send(context.Background(), cmd)
+}
+
+func (h *handlers) seed(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("second parameter must be the path to a file or a directory")
+	}
+	pieceLength := c.Int("piece-length")
+	if pieceLength < 0 {
+		return errors.New("piece-length must be positive")
+	}
+
+	torrent, err := h.services.SeedTorrent().Seed(context.Background(), seedTorrent.CMD{
+		Root:        c.Args().Get(0),
+		PieceLength: pieceLength,
 	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "seeding torrent %v (%v). Press Ctrl+C to stop\n", torrent.ID(), torrent.Name())
+
+	ctx, stop := context.WithCancel(context.Background())
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+	go func() {
+		<-quit
+		stop()
+	}()
+
+	// Seeding stops as well if the torrent is deleted
+	err = h.services.SeedTorrent().KeepSeeding(ctx, torrent.ID())
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func (h *handlers) previewLocal(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("second parameter must be the path to the files of the torrent")
+	}
+	pieceLength := c.Int("piece-length")
+	if pieceLength < 0 {
+		return errors.New("piece-length must be positive")
+	}
+
+	cmd := previewLocal.CMD{
+		Root:        c.Args().Get(0),
+		PieceLength: pieceLength,
+	}
+	if path := c.String("torrent"); path != "" {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		cmd.TorrentRaw = raw
+	}
+
+	torrent, err := h.services.PreviewLocal().Preview(context.Background(), cmd)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "torrent %v (%v): %v\n", torrent.ID(), torrent.Name(), torrent.Status())
+	return nil
+}
+
+func (h *handlers) replay(c *cli.Context) error {
+	projections := c.Args().Slice()
+	replayer := h.services.EventReplayer()
+	if len(projections) == 0 {
+		projections = replayer.Projections()
+	}
+
+	events, err := replayer.Replay(context.Background(), projections...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "%v events replayed into %v\n", events, strings.Join(projections, ", "))
+	return nil
+}
+
+func (h *handlers) reprocess(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("second parameter must be the ID of the torrent")
+	}
+
+	cmd := reprocessTorrent.CMD{
+		TorrentID:       c.Args().Get(0),
+		FileIDs:         c.IntSlice("file"),
+		Force:           c.Bool("force"),
+		MaxDownloadTime: c.Duration("max-download-time"),
+		SeederWaitTime:  c.Duration("seeder-wait"),
+	}
+	if deadline := c.Duration("deadline"); deadline > 0 {
+		cmd.Deadline = time.Now().Add(deadline)
+	}
+
+	if err := h.services.ReprocessTorrent().Reprocess(context.Background(), cmd); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "reprocess of torrent %v requested\n", cmd.TorrentID)
+	return nil
+}
+
+func (h *handlers) delete(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("second parameter must be the ID of the torrent")
+	}
+	cmd := deleteTorrent.CMD{
+		TorrentID: c.Args().Get(0),
+		Force:     c.Bool("force"),
+	}
+
+	if err := h.services.DeleteTorrent().Delete(context.Background(), cmd); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "torrent %v deleted\n", cmd.TorrentID)
+	return nil
+}
+
+func (h *handlers) doctor(c *cli.Context) error {
+	report := h.services.HealthChecker().Run(context.Background())
+	report.Print(c.App.Writer)
+	if !report.Healthy {
+		return errors.New("some dependencies are failing")
+	}
+	return nil
 }
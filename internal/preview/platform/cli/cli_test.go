@@ -1,12 +1,25 @@
 package cli_test
 
 import (
+	"context"
+	"errors"
 	"prevtorrent/internal/platform/bus/busmocks"
+	"prevtorrent/internal/platform/bus/eventlog"
+	"prevtorrent/internal/platform/bus/eventlog/eventlogmocks"
+	"prevtorrent/internal/platform/health"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/deleteTorrent"
 	"prevtorrent/internal/preview/downloadPartials"
 	"prevtorrent/internal/preview/platform/cli"
+	"prevtorrent/internal/preview/platform/client/clientmocks"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"prevtorrent/internal/preview/reprocessTorrent"
 	"prevtorrent/internal/preview/unmagnetize"
 	"testing"
+	"time"
 
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -23,7 +36,7 @@ func TestTorrentPrev_MagnetEventIsTriggered(t *testing.T) {
 		"magnet:?xt=urn:btih:c92f656155d0d8e87d21471d7ea43e3ad0d42723",
 	}
 
-	err := cli.Run(args, commandBus)
+	err := cli.Run(args, commandBus, nil)
 	require.NoError(t, err)
 }
 
@@ -38,7 +51,7 @@ func TestTorrentPrev_MagnetFailsOnInvalidArguments(t *testing.T) {
 		"magnet",
 	}
 
-	err := cli.Run(args, commandBus)
+	err := cli.Run(args, commandBus, nil)
 	require.Error(t, err)
 }
 
@@ -54,7 +67,7 @@ func TestTorrentPrev_DownloadEventIsTriggered(t *testing.T) {
 		"c92f656155d0d8e87d21471d7ea43e3ad0d42723",
 	}
 
-	err := cli.Run(args, commandBus)
+	err := cli.Run(args, commandBus, nil)
 	require.NoError(t, err)
 }
 
@@ -69,6 +82,206 @@ func TestTorrentPrev_DownloadFailsOnInvalidArguments(t *testing.T) {
 		"download",
 	}
 
-	err := cli.Run(args, commandBus)
+	err := cli.Run(args, commandBus, nil)
 	require.Error(t, err)
 }
+
+func TestTorrentPrev_DownloadWithLimits(t *testing.T) {
+	commandBus := new(busmocks.Command)
+	commandBus.On("Send", mock.Anything, mock.MatchedBy(func(cmd *downloadPartials.CMD) bool {
+		return cmd.ID == "c92f656155d0d8e87d21471d7ea43e3ad0d42723" &&
+			cmd.MaxDownloadTime == time.Hour &&
+			cmd.SeederWaitTime == time.Minute &&
+			cmd.Deadline.After(time.Now())
+	})).Return(nil)
+
+	args := []string{
+		"test",
+		"download",
+		"--max-download-time", "1h",
+		"--seeder-wait", "1m",
+		"--deadline", "2m",
+		"c92f656155d0d8e87d21471d7ea43e3ad0d42723",
+	}
+
+	err := cli.Run(args, commandBus, nil)
+	require.NoError(t, err)
+	commandBus.AssertExpectations(t)
+}
+
+func TestTorrentPrev_SeedFailsOnInvalidArguments(t *testing.T) {
+	args := []string{
+		"test",
+		"seed",
+	}
+
+	err := cli.Run(args, new(busmocks.Command), nil)
+	require.Error(t, err)
+}
+
+type fakeServices struct {
+	cli.Services
+	replayer  *eventlog.Replayer
+	checker   *health.Checker
+	reprocess reprocessTorrent.Service
+	delete    deleteTorrent.Service
+}
+
+func (s fakeServices) EventReplayer() *eventlog.Replayer {
+	return s.replayer
+}
+
+func (s fakeServices) HealthChecker() *health.Checker {
+	return s.checker
+}
+
+func (s fakeServices) ReprocessTorrent() reprocessTorrent.Service {
+	return s.reprocess
+}
+
+func (s fakeServices) DeleteTorrent() deleteTorrent.Service {
+	return s.delete
+}
+
+func TestTorrentPrev_ReplayFailsOnUnknownProjection(t *testing.T) {
+	store := new(eventlogmocks.Store)
+	replayer := eventlog.NewReplayer(logrus.New(), store, cqrs.JSONMarshaler{},
+		eventlog.NewProjection("stats", func(ctx context.Context) error { return nil }),
+	)
+
+	args := []string{
+		"test",
+		"replay",
+		"status",
+	}
+
+	err := cli.Run(args, new(busmocks.Command), fakeServices{replayer: replayer})
+	require.Error(t, err)
+	store.AssertNotCalled(t, "Read", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestTorrentPrev_ReplayAllProjections(t *testing.T) {
+	store := new(eventlogmocks.Store)
+	store.On("Read", mock.Anything, int64(0), mock.Anything).Return(nil, nil)
+
+	var resets []string
+	reset := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			resets = append(resets, name)
+			return nil
+		}
+	}
+	replayer := eventlog.NewReplayer(logrus.New(), store, cqrs.JSONMarshaler{},
+		eventlog.NewProjection("progress", reset("progress")),
+		eventlog.NewProjection("stats", reset("stats")),
+	)
+
+	args := []string{
+		"test",
+		"replay",
+	}
+
+	err := cli.Run(args, new(busmocks.Command), fakeServices{replayer: replayer})
+	require.NoError(t, err)
+	require.Equal(t, []string{"progress", "stats"}, resets)
+	store.AssertExpectations(t)
+}
+
+func TestTorrentPrev_DoctorFailsIfAnyCheckFails(t *testing.T) {
+	checked := make(chan string, 2)
+	check := func(name string, err error) health.Check {
+		return health.Check{Name: name, Run: func(context.Context) error {
+			checked <- name
+			return err
+		}}
+	}
+	checker := health.NewChecker(time.Second,
+		check("sqlite", nil),
+		check("ffmpeg", errors.New("executable file not found in $PATH")),
+	)
+
+	err := cli.Run([]string{"test", "doctor"}, new(busmocks.Command), fakeServices{checker: checker})
+	require.Error(t, err)
+	require.Len(t, checked, 2)
+}
+
+func TestTorrentPrev_ReprocessSomeFiles(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	f1, err := preview.NewFileInfo(0, 1000, "movie.mp4")
+	require.NoError(t, err)
+	f2, err := preview.NewFileInfo(1, 1000, "movie2.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 100, []preview.File{f1, f2}, []byte(""))
+	require.NoError(t, err)
+	torrent.RestoreStatus(preview.StatusCompleted, "")
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, preview.StatusCompleted,
+		mock.MatchedBy(func(e *preview.TorrentReprocessRequestedEvent) bool {
+			return e.TorrentID == torrentID && len(e.FileIDs) == 2 && e.Force && e.Deadline.After(time.Now())
+		})).Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages(nil), nil)
+	imageRepository.On("DeleteByFiles", mock.Anything, torrentID, []int{0, 1}).Return(nil)
+
+	reprocess := reprocessTorrent.NewService(logrus.New(), torrentRepository, imageRepository, new(storagemocks.ImagePersister))
+	services := fakeServices{reprocess: reprocess}
+
+	args := []string{
+		"test",
+		"reprocess",
+		"--file", "0",
+		"--file", "1",
+		"--force",
+		"--deadline", "1h",
+		torrentID,
+	}
+
+	err = cli.Run(args, new(busmocks.Command), services)
+	require.NoError(t, err)
+	torrentRepository.AssertExpectations(t)
+}
+
+func TestTorrentPrev_DeleteForced(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	f, err := preview.NewFileInfo(0, 1000, "movie.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 100, []preview.File{f}, []byte(""))
+	require.NoError(t, err)
+	torrent.RestoreStatus(preview.StatusDownloading, "")
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, preview.StatusDownloading).Return(nil)
+	torrentRepository.On("Delete", mock.Anything, torrentID, mock.Anything).Return(nil)
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages(nil), nil)
+	clipRepository := new(storagemocks.ClipRepository)
+	clipRepository.On("ByTorrent", mock.Anything, torrentID).Return(nil, nil)
+	torrentDropper := new(clientmocks.TorrentDropper)
+	torrentDropper.On("Drop", mock.Anything, torrentID).Return(nil)
+
+	services := fakeServices{delete: deleteTorrent.NewService(
+		logrus.New(), torrentRepository, imageRepository, clipRepository, new(storagemocks.ImagePersister), torrentDropper,
+	)}
+
+	err = cli.Run([]string{"test", "delete", "--force", torrentID}, new(busmocks.Command), services)
+	require.NoError(t, err)
+	torrentRepository.AssertExpectations(t)
+}
+
+func TestTorrentPrev_DeleteFailsIfTheTorrentDoesNotExist(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(preview.Torrent{}, preview.ErrNotFound)
+
+	torrentDropper := new(clientmocks.TorrentDropper)
+	services := fakeServices{delete: deleteTorrent.NewService(logrus.New(), torrentRepository, nil, nil, nil, torrentDropper)}
+
+	err := cli.Run([]string{"test", "delete", torrentID}, new(busmocks.Command), services)
+	require.True(t, errors.Is(err, preview.ErrNotFound))
+	torrentDropper.AssertNotCalled(t, "Drop", mock.Anything, mock.Anything)
+}
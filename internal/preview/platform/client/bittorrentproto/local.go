@@ -0,0 +1,234 @@
+package bittorrentproto
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"prevtorrent/internal/preview"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/sirupsen/logrus"
+)
+
+// LocalDownloader implements preview.TorrentDownloader reading the pieces from files on disk. No
+// connection is made to any peer, so the torrents must have been opened with the path to their files
+type LocalDownloader struct {
+	logger *logrus.Logger
+
+	mux   sync.RWMutex
+	files map[string]*localFiles // by torrent ID
+}
+
+func NewLocalDownloader(logger *logrus.Logger) *LocalDownloader {
+	return &LocalDownloader{logger: logger, files: make(map[string]*localFiles)}
+}
+
+// Create builds a .torrent with the files at root. See TorrentClient.Create
+func (l *LocalDownloader) Create(root string, pieceLength int) ([]byte, error) {
+	return createTorrent(root, pieceLength)
+}
+
+// Open links the torrent with its files at root. Root is the file itself for torrents with a
+// single file, and the directory with the files for the rest
+func (l *LocalDownloader) Open(raw []byte, root string) (preview.Torrent, error) {
+	metaInfo, err := metainfo.Load(bytes.NewBuffer(raw))
+	if err != nil {
+		return preview.Torrent{}, err
+	}
+	info, err := metaInfo.UnmarshalInfo()
+	if err != nil {
+		return preview.Torrent{}, err
+	}
+
+	files, err := newLocalFiles(&info, root)
+	if err != nil {
+		return preview.Torrent{}, err
+	}
+
+	torrent, err := parseMetaInfo(metaInfo, &info, raw)
+	if err != nil {
+		return preview.Torrent{}, err
+	}
+
+	l.mux.Lock()
+	l.files[torrent.ID()] = files
+	l.mux.Unlock()
+	return torrent, nil
+}
+
+func (l *LocalDownloader) Import(_ context.Context, raw []byte) (preview.Torrent, error) {
+	metaInfo, err := metainfo.Load(bytes.NewBuffer(raw))
+	if err != nil {
+		return preview.Torrent{}, err
+	}
+	info, err := metaInfo.UnmarshalInfo()
+	if err != nil {
+		return preview.Torrent{}, err
+	}
+	return parseMetaInfo(metaInfo, &info, raw)
+}
+
+func (l *LocalDownloader) DownloadParts(ctx context.Context, downloadPlan preview.DownloadPlan) (*preview.PieceRegistry, error) {
+	torrent := downloadPlan.GetTorrent()
+	l.mux.RLock()
+	files, ok := l.files[torrent.ID()]
+	l.mux.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("torrent %v has not been opened: the path to its files is unknown", torrent.ID())
+	}
+
+	hashes, err := pieceHashes(torrent.Raw())
+	if err != nil {
+		return nil, err
+	}
+
+	// The pieces are read again from the local files when the ranges are consumed
+	storage := newDiskStorage(torrent.ID(), func(idx int) []byte {
+		data, err := files.readPiece(idx)
+		if err != nil {
+			l.logger.WithContext(ctx).WithFields(logrus.Fields{
+				"torrentID": torrent.ID(),
+				"pieceIdx":  idx,
+				"error":     err,
+			}).Warn("unable to read the piece from the local files")
+			return nil
+		}
+		return data
+	})
+	registry, err := preview.NewPieceRegistry(ctx, l.logger, &downloadPlan, storage,
+		preview.WithMaxPendingRanges(maxPendingRanges),
+		preview.WithPieceHashes(hashes),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	go l.readPieces(ctx, registry, files, downloadPlan)
+	return registry, nil
+}
+
+func (l *LocalDownloader) readPieces(ctx context.Context, registry *preview.PieceRegistry, files *localFiles, downloadPlan preview.DownloadPlan) {
+	defer registry.NoMorePieces()
+
+	torrentID := downloadPlan.GetTorrent().ID()
+	read := make(map[int]bool)
+	for _, plan := range downloadPlan.GetPlan() {
+		for pIdx := plan.Start(); pIdx <= plan.End(); pIdx++ {
+			if read[pIdx] {
+				continue
+			}
+			read[pIdx] = true
+
+			data, err := files.readPiece(pIdx)
+			if err != nil {
+				// The piece is reported as missing by the registry
+				l.logger.WithContext(ctx).WithFields(logrus.Fields{
+					"torrentID": torrentID,
+					"pieceIdx":  pIdx,
+					"error":     err,
+				}).Warn("unable to read the piece from the local files")
+				continue
+			}
+
+			if err := registry.RegisterPiece(preview.NewPiece(torrentID, pIdx, data)); err != nil {
+				l.logger.WithContext(ctx).WithError(err).WithField("pieceIdx", pIdx).Warn("registry not accepting pieces anymore")
+				return
+			}
+		}
+	}
+}
+
+// localFiles reads the pieces of a torrent from the files on disk, laid out as in the torrent
+type localFiles struct {
+	pieceLength int64
+	totalLength int64
+	files       []localFile
+}
+
+type localFile struct {
+	path   string
+	offset int64 // in the torrent
+	length int64
+}
+
+func newLocalFiles(info *metainfo.Info, root string) (*localFiles, error) {
+	lf := &localFiles{pieceLength: info.PieceLength, totalLength: info.TotalLength()}
+
+	offset := int64(0)
+	for _, f := range info.UpvertedFiles() {
+		path := root
+		if info.IsDir() {
+			path = filepath.Join(append([]string{root}, f.Path...)...)
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if fi.Size() != f.Length {
+			return nil, fmt.Errorf("file %v does not match the torrent. Expected %v bytes, found %v", path, f.Length, fi.Size())
+		}
+
+		lf.files = append(lf.files, localFile{path: path, offset: offset, length: f.Length})
+		offset += f.Length
+	}
+	return lf, nil
+}
+
+func (lf *localFiles) readPiece(idx int) ([]byte, error) {
+	start := int64(idx) * lf.pieceLength
+	end := start + lf.pieceLength
+	if end > lf.totalLength {
+		end = lf.totalLength
+	}
+	if start >= end {
+		return nil, fmt.Errorf("piece %v out of the torrent", idx)
+	}
+
+	data := make([]byte, end-start)
+	for _, f := range lf.files {
+		from, to := max64(start, f.offset), min64(end, f.offset+f.length)
+		if from >= to {
+			continue
+		}
+		if err := readAt(f.path, data[from-start:to-start], from-f.offset); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func readAt(path string, dst []byte, offset int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := f.ReadAt(dst, offset)
+	if n == len(dst) {
+		return nil // io.EOF is allowed when reading up to the end of the file
+	}
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
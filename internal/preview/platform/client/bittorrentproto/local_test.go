@@ -0,0 +1,93 @@
+package bittorrentproto_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/client/bittorrentproto"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalDownloader_DownloadParts(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "videos")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "extra"), 0755))
+	first := bytes.Repeat([]byte("a"), 40000)
+	second := bytes.Repeat([]byte("0123456789"), 5000)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "a.mp4"), first, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "extra", "b.mp4"), second, 0644))
+
+	downloader := bittorrentproto.NewLocalDownloader(fakeLogger())
+	raw, err := downloader.Create(root, 16<<10)
+	require.NoError(t, err)
+	torrent, err := downloader.Open(raw, root)
+	require.NoError(t, err)
+	require.Len(t, torrent.Files(), 2)
+	assert.Equal(t, "videos", torrent.Name())
+
+	// The file in the middle of a piece, up to the end of the torrent
+	file := torrent.Files()[1]
+	plan, err := preview.NewStreamPlan(torrent, file, 0, file.Length())
+	require.NoError(t, err)
+
+	registry, err := downloader.DownloadParts(context.Background(), *plan)
+	require.NoError(t, err)
+
+	got := new(bytes.Buffer)
+	err = registry.RunOnPieceReady(context.Background(), func(part preview.PieceRange) error {
+		media, err := preview.NewBundlePlan().Bundle(registry, part)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(got, media.Reader())
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, second, got.Bytes())
+	assert.Empty(t, registry.MissingRanges())
+}
+
+func TestLocalDownloader_Open_FilesDoNotMatch(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.mp4")
+	require.NoError(t, ioutil.WriteFile(path, []byte("original content"), 0644))
+
+	downloader := bittorrentproto.NewLocalDownloader(fakeLogger())
+	raw, err := downloader.Create(path, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("changed"), 0644))
+	_, err = downloader.Open(raw, path)
+	assert.Error(t, err)
+
+	_, err = downloader.Open(raw, filepath.Join(root, "missing.mp4"))
+	assert.Error(t, err)
+}
+
+func TestLocalDownloader_DownloadParts_NotOpened(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.mp4")
+	require.NoError(t, ioutil.WriteFile(path, []byte("content"), 0644))
+
+	downloader := bittorrentproto.NewLocalDownloader(fakeLogger())
+	raw, err := downloader.Create(path, 0)
+	require.NoError(t, err)
+	torrent, err := downloader.Import(context.Background(), raw)
+	require.NoError(t, err)
+
+	_, err = downloader.DownloadParts(context.Background(), *preview.NewDownloadPlan(torrent))
+	assert.Error(t, err)
+}
+
+func fakeLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
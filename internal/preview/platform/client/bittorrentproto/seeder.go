@@ -0,0 +1,129 @@
+package bittorrentproto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	torrent2 "github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	minPieceLength    = 16 << 10 // 16 KiB
+	maxPieceLength    = 16 << 20 // 16 MiB
+	targetPieceCount  = 1500
+	torrentsCreatedBy = "prevtorrent"
+)
+
+// Create builds a .torrent with the file or the directory given. If the piece length is 0,
+// one is chosen depending on the size of the files
+func (r *TorrentClient) Create(root string, pieceLength int) ([]byte, error) {
+	return createTorrent(root, pieceLength)
+}
+
+// Seed shares the torrent, reading the pieces from the files at root. The torrent is shared
+// while the client is running. Must be called before importing the torrent, otherwise the
+// client would use the default storage for it
+func (r *TorrentClient) Seed(ctx context.Context, raw []byte, root string) error {
+	metaInfo, err := metainfo.Load(bytes.NewBuffer(raw))
+	if err != nil {
+		return err
+	}
+
+	spec := torrent2.TorrentSpecFromMetaInfo(metaInfo)
+	// The files of the torrent are at <baseDir>/<name of the torrent>
+	spec.Storage = storage.NewFileWithCompletion(filepath.Dir(filepath.Clean(root)), storage.NewMapPieceCompletion())
+	t, _, err := r.client.AddTorrentSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	if err := r.waitForInfo(ctx, t); err != nil {
+		return err
+	}
+	t.VerifyData()
+	if missing := t.BytesMissing(); missing != 0 {
+		t.Drop()
+		return fmt.Errorf("the files at %v do not match the torrent. %v bytes missing", root, missing)
+	}
+	// The plans of the torrent must not drop it when they finish
+	r.pin(t)
+
+	r.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"torrentID": t.InfoHash().HexString(),
+		"name":      t.Name(),
+		"port":      r.client.LocalPort(),
+	}).Info("seeding torrent")
+	return nil
+}
+
+func createTorrent(root string, pieceLength int) ([]byte, error) {
+	if pieceLength == 0 {
+		size, err := totalSize(root)
+		if err != nil {
+			return nil, err
+		}
+		pieceLength = choosePieceLength(size)
+	}
+
+	info := metainfo.Info{PieceLength: int64(pieceLength)}
+	if err := info.BuildFromFilePath(root); err != nil {
+		return nil, err
+	}
+	if info.TotalLength() == 0 {
+		return nil, fmt.Errorf("there are no files to share in %v", root)
+	}
+
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	metaInfo := metainfo.MetaInfo{
+		InfoBytes:    infoBytes,
+		CreatedBy:    torrentsCreatedBy,
+		CreationDate: time.Now().Unix(),
+	}
+	buf := new(bytes.Buffer)
+	if err := metaInfo.Write(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func totalSize(root string) (int64, error) {
+	size := int64(0)
+	err := filepath.Walk(root, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if size == 0 {
+		return 0, errors.New("there are no files to share")
+	}
+	return size, nil
+}
+
+// choosePieceLength returns the power of 2 that splits the size in around targetPieceCount pieces
+func choosePieceLength(size int64) int {
+	pieceLength := int64(minPieceLength)
+	for pieceLength < maxPieceLength && size/pieceLength > targetPieceCount {
+		pieceLength *= 2
+	}
+	return int(pieceLength)
+}
@@ -0,0 +1,45 @@
+package bittorrentproto
+
+import (
+	"prevtorrent/internal/preview"
+	"sync"
+)
+
+// diskStorage is a preview.PieceStorage that only remembers which pieces have been received. The
+// data is read again from disk each time a piece is needed, so the pieces are not kept in memory
+type diskStorage struct {
+	torrentID string
+	read      func(idx int) []byte // nil if the piece cannot be read
+	mux       sync.RWMutex
+	received  map[int]bool
+}
+
+func newDiskStorage(torrentID string, read func(idx int) []byte) *diskStorage {
+	return &diskStorage{torrentID: torrentID, read: read, received: make(map[int]bool)}
+}
+
+// Set implements preview.PieceStorage. The data of the piece is dropped, it's already on disk
+func (s *diskStorage) Set(p *preview.Piece) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.received[p.ID()] = true
+}
+
+// Get implements preview.PieceStorage
+func (s *diskStorage) Get(id int) (*preview.Piece, bool) {
+	s.mux.RLock()
+	received := s.received[id]
+	s.mux.RUnlock()
+	if !received {
+		return nil, false
+	}
+
+	data := s.read(id)
+	if data == nil {
+		return nil, false
+	}
+	return preview.NewPiece(s.torrentID, id, data), true
+}
+
+// Release implements preview.PieceStorage. Nothing to free, the data is only on disk
+func (s *diskStorage) Release(int) {}
@@ -4,27 +4,59 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"prevtorrent/internal/platform/bus"
+	"prevtorrent/internal/platform/metrics"
 	"prevtorrent/internal/preview"
 	"sync"
 	"time"
 
 	torrent2 "github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
 const (
-	maxDownloadTime = time.Minute * 15
-	seederWaitTime  = time.Second * 30
+	// maxPendingRanges is how many ranges can be waiting to be processed before we stop reading pieces
+	maxPendingRanges = 4
+	// stallMargin is added to the download limits to decide that nobody is consuming the registry
+	stallMargin = time.Minute
+	// idleDropDelay is how long a torrent stays in the client after its last plan finishes. The
+	// windows of a stream are downloaded one after the other and keep the peers found by the first one
+	idleDropDelay = 30 * time.Second
 )
 
 type TorrentClient struct {
-	client *torrent2.Client
-	logger *logrus.Logger
+	client   *torrent2.Client
+	logger   *logrus.Logger
+	eventBus bus.Event
+	limits   preview.DownloadLimits // limits used when the DownloadPlan does not set them
+	peers    []string               // addresses of peers known beforehand, added to every download. Ex: a local seeder
+
+	mux  sync.Mutex
+	uses map[metainfo.Hash]*torrentUse // torrents added to the client by the plans, by info hash
 }
 
-func NewTorrentClient(client *torrent2.Client, logger *logrus.Logger) *TorrentClient {
-	return &TorrentClient{client: client, logger: logger}
+// torrentUse counts the plans using a torrent. It is dropped from the client, deleting the chunks
+// in the storage, only when nobody has been using it for idleDropDelay
+type torrentUse struct {
+	users      int
+	generation int // invalidates the drops scheduled before the torrent was used again
+	pinned     bool
+	wasted     int64 // chunks read wasted already added to the metrics
+}
+
+func NewTorrentClient(client *torrent2.Client, logger *logrus.Logger, eventBus bus.Event, limits preview.DownloadLimits, peers []string) *TorrentClient {
+	return &TorrentClient{
+		client:   client,
+		logger:   logger,
+		eventBus: eventBus,
+		limits:   limits,
+		peers:    peers,
+		uses:     make(map[metainfo.Hash]*torrentUse),
+	}
 }
 
 func (r *TorrentClient) Resolve(ctx context.Context, m preview.Magnet) (preview.Torrent, error) {
@@ -33,9 +65,12 @@ func (r *TorrentClient) Resolve(ctx context.Context, m preview.Magnet) (preview.
 		return preview.Torrent{}, err
 	}
 
+	start := time.Now()
 	if err := r.waitForInfo(ctx, t); err != nil {
+		metrics.MagnetResolutionDuration.WithLabelValues("failed").Observe(metrics.Since(start))
 		return preview.Torrent{}, err
 	}
+	metrics.MagnetResolutionDuration.WithLabelValues("resolved").Observe(metrics.Since(start))
 	return parseTorrent(t)
 }
 
@@ -46,9 +81,14 @@ func parseTorrent(t *torrent2.Torrent) (preview.Torrent, error) {
 		return preview.Torrent{}, err
 	}
 
+	metaInfo := t.Metainfo()
+	return parseMetaInfo(&metaInfo, t.Info(), buf.Bytes())
+}
+
+func parseMetaInfo(metaInfo *metainfo.MetaInfo, info *metainfo.Info, raw []byte) (preview.Torrent, error) {
 	files := make([]preview.File, 0)
-	for idx, f := range t.Info().UpvertedFiles() {
-		fi, err := preview.NewFileInfo(idx, int(f.Length), f.DisplayPath(t.Info()))
+	for idx, f := range info.UpvertedFiles() {
+		fi, err := preview.NewFileInfo(idx, int(f.Length), f.DisplayPath(info))
 		if err != nil {
 			return preview.Torrent{}, err
 		}
@@ -57,11 +97,11 @@ func parseTorrent(t *torrent2.Torrent) (preview.Torrent, error) {
 	}
 
 	return preview.NewInfo(
-		t.Metainfo().HashInfoBytes().String(),
-		t.Name(),
-		int(t.Info().PieceLength),
+		metaInfo.HashInfoBytes().String(),
+		info.Name,
+		int(info.PieceLength),
 		files,
-		buf.Bytes(),
+		raw,
 	)
 }
 
@@ -75,18 +115,35 @@ func (r *TorrentClient) waitForInfo(ctx context.Context, t *torrent2.Torrent) er
 }
 
 func (r *TorrentClient) DownloadParts(ctx context.Context, downloadPlan preview.DownloadPlan) (*preview.PieceRegistry, error) {
-	storage := preview.NewPieceInMemoryStorage(downloadPlan)
-	registry, err := preview.NewPieceRegistry(ctx, r.logger, &downloadPlan, storage)
+	hashes, err := pieceHashes(downloadPlan.GetTorrent().Raw())
 	if err != nil {
 		return nil, err
 	}
 
-	t, err := r.getTorrent(downloadPlan)
+	t, err := r.acquire(downloadPlan)
 	if err != nil {
 		return nil, err
 	}
 
+	// The pieces are read from the storage of the torrent when the ranges are consumed
+	storage := newDiskStorage(t.InfoHash().HexString(), func(idx int) []byte {
+		return r.readPiece(ctx, t, idx)
+	})
+	limits := downloadPlan.Limits().Or(r.limits)
+	registry, err := preview.NewPieceRegistry(ctx, r.logger, &downloadPlan, storage,
+		preview.WithMaxPendingRanges(maxPendingRanges),
+		preview.WithStallTimeout(limits.SeederWaitTime+limits.MaxDownloadTime+stallMargin),
+		preview.WithPieceHashes(hashes),
+	)
+	if err != nil {
+		r.release(t)
+		return nil, err
+	}
+
 	startTorrentDownload(t, downloadPlan)
+	metrics.DownloadPlanBytes.Observe(float64(downloadPlan.DownloadSize()))
+	planID := uuid.New().String()
+	r.publish(ctx, downloadPlan, preview.NewDownloadPlanStartedEvent(downloadPlan, planID, time.Now()))
 
 	wg := new(sync.WaitGroup)
 	wg.Add(2)
@@ -94,60 +151,205 @@ func (r *TorrentClient) DownloadParts(ctx context.Context, downloadPlan preview.
 		wg.Wait()
 		registry.NoMorePieces()
 	}()
-	go r.publishPartsThatWeAlreadyHave(wg, t, registry, downloadPlan)
-	go r.waitPiecesToDownload(ctx, wg, registry, t, downloadPlan)
+	go r.publishPartsThatWeAlreadyHave(ctx, wg, t, registry, downloadPlan)
+	go r.waitPiecesToDownload(ctx, wg, registry, t, downloadPlan, planID)
+	go func() {
+		wg.Wait()
+		// The torrent must not be dropped while the consumer is still reading its pieces
+		select {
+		case <-registry.Consumed():
+		case <-ctx.Done():
+		}
+		r.release(t)
+	}()
 
 	return registry, nil
 }
 
+// acquire adds the torrent of the plan to the client, or reuses it if other plan or stream has it
+func (r *TorrentClient) acquire(plan preview.DownloadPlan) (*torrent2.Torrent, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	t, err := r.getTorrent(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	use, ok := r.uses[t.InfoHash()]
+	if !ok {
+		use = &torrentUse{}
+		r.uses[t.InfoHash()] = use
+	}
+	use.users++
+	use.generation++
+	return t, nil
+}
+
+// release drops the torrent once it has been idle for idleDropDelay, unless it is being seeded
+func (r *TorrentClient) release(t *torrent2.Torrent) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	use, ok := r.uses[t.InfoHash()]
+	if !ok {
+		return // already dropped
+	}
+	use.users--
+	if use.users > 0 || use.pinned {
+		return
+	}
+
+	generation := use.generation
+	time.AfterFunc(idleDropDelay, func() {
+		r.dropIdle(t, use, generation)
+	})
+}
+
+func (r *TorrentClient) dropIdle(t *torrent2.Torrent, use *torrentUse, generation int) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.uses[t.InfoHash()] != use || use.users > 0 || use.generation != generation {
+		return // used again after being released
+	}
+	delete(r.uses, t.InfoHash())
+	t.Drop() // Delete all the chunks we have in the storage
+}
+
+// reportWasted adds to the metrics the chunks read wasted since the last report. The stats are of
+// the torrent, which is shared by the plans and the streams using it at the same time
+func (r *TorrentClient) reportWasted(t *torrent2.Torrent) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	use, ok := r.uses[t.InfoHash()]
+	if !ok {
+		return // dropped, along with its stats
+	}
+	stats := t.Stats()
+	wasted := stats.ChunksReadWasted.Int64()
+	if wasted > use.wasted {
+		metrics.ChunksWasted.Add(float64(wasted - use.wasted))
+		use.wasted = wasted
+	}
+}
+
+// pin keeps the torrent in the client while the process is running
+func (r *TorrentClient) pin(t *torrent2.Torrent) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	use, ok := r.uses[t.InfoHash()]
+	if !ok {
+		use = &torrentUse{}
+		r.uses[t.InfoHash()] = use
+	}
+	use.pinned = true
+}
+
 func (r *TorrentClient) getTorrent(plan preview.DownloadPlan) (*torrent2.Torrent, error) {
 	buff := bytes.NewBuffer(plan.GetTorrent().Raw())
 	metaInfo, err := metainfo.Load(buff)
 	if err != nil {
 		return nil, err
 	}
-	return r.client.AddTorrent(metaInfo)
+
+	spec := torrent2.TorrentSpecFromMetaInfo(metaInfo)
+	spec.PeerAddrs = r.peers
+	t, _, err := r.client.AddTorrentSpec(spec)
+	return t, err
+}
+
+// pieceHashes reads the SHA-1 of every piece from the info dictionary of the torrent
+func pieceHashes(raw []byte) ([][]byte, error) {
+	metaInfo, err := metainfo.Load(bytes.NewBuffer(raw))
+	if err != nil {
+		return nil, err
+	}
+	info, err := metaInfo.UnmarshalInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([][]byte, info.NumPieces())
+	for i := range hashes {
+		hash := info.Piece(i).Hash()
+		hashes[i] = hash.Bytes()
+	}
+	return hashes, nil
 }
 
-func countNumberPiecesWaitingFor(t *torrent2.Torrent, downloadPlan preview.DownloadPlan) int {
-	uniquePartsWaitingFor := make(map[int]interface{})
+// piecesWaitingFor returns the indexes of the pieces of the plan that have not been downloaded yet
+func piecesWaitingFor(t *torrent2.Torrent, downloadPlan preview.DownloadPlan) map[int]bool {
+	waitingFor := make(map[int]bool)
 	for _, plan := range downloadPlan.GetPlan() {
 		for pIdx := plan.Start(); pIdx <= plan.End(); pIdx++ {
 			if t.Piece(pIdx).State().Complete {
 				continue
 			}
-			uniquePartsWaitingFor[pIdx] = struct{}{}
+			waitingFor[pIdx] = true
 		}
 	}
-	return len(uniquePartsWaitingFor)
+	return waitingFor
 }
 
-func (r *TorrentClient) publishPartsThatWeAlreadyHave(wg *sync.WaitGroup, t *torrent2.Torrent, registry *preview.PieceRegistry, downloadPlan preview.DownloadPlan) {
+func (r *TorrentClient) publishPartsThatWeAlreadyHave(ctx context.Context, wg *sync.WaitGroup, t *torrent2.Torrent, registry *preview.PieceRegistry, downloadPlan preview.DownloadPlan) {
 	defer wg.Done()
 	for _, plan := range downloadPlan.GetPlan() {
 		for pIdx := plan.Start(); pIdx <= plan.End(); pIdx++ {
 			if t.Piece(pIdx).State().Complete {
-				buf := r.readPiece(t, pIdx)
-				registry.RegisterPiece(preview.NewPiece(t.InfoHash().HexString(), pIdx, buf))
+				buf := r.readPiece(ctx, t, pIdx)
+				if err := registry.RegisterPiece(preview.NewPiece(t.InfoHash().HexString(), pIdx, buf)); err != nil {
+					r.logger.WithContext(ctx).WithError(err).WithField("pieceIdx", pIdx).Warn("registry not accepting pieces anymore")
+					return
+				}
+				r.publishPieceCompleted(ctx, t, downloadPlan, pIdx)
 			}
 		}
 	}
 }
 
 func startTorrentDownload(t *torrent2.Torrent, downloadPlan preview.DownloadPlan) {
+	if downloadPlan.IsUrgent() {
+		prioritise(t, downloadPlan)
+		return
+	}
+
 	// Idempotent. All the pieces already downloaded are ignored.
 	for _, plan := range downloadPlan.GetPlan() {
 		t.DownloadPieces(plan.Start(), plan.End()+1) //  (start, end]
 	}
 }
 
-func (r *TorrentClient) waitPiecesToDownload(ctx context.Context, wg *sync.WaitGroup, registry *preview.PieceRegistry, t *torrent2.Torrent, downloadPlan preview.DownloadPlan) {
+// prioritise asks for the first piece of the plan before anything else, and for the rest right after
+func prioritise(t *torrent2.Torrent, downloadPlan preview.DownloadPlan) {
+	for i, plan := range downloadPlan.GetPlan() {
+		priority := torrent2.PiecePriorityReadahead
+		if i == 0 {
+			priority = torrent2.PiecePriorityNow
+		}
+		for pIdx := plan.Start(); pIdx <= plan.End(); pIdx++ {
+			t.Piece(pIdx).SetPriority(priority)
+		}
+	}
+}
+
+func (r *TorrentClient) waitPiecesToDownload(ctx context.Context, wg *sync.WaitGroup, registry *preview.PieceRegistry, t *torrent2.Torrent, downloadPlan preview.DownloadPlan, planID string) {
 	defer wg.Done()
-	defer t.Drop() // Delete all the chunks we have in the storage
+	defer r.reportWasted(t)
+
+	// The torrent is shared with other plans and streams, thus the subscription gets the changes of
+	// all its pieces. Subscribed before looking for the pieces we have, so no piece is missed
+	subscription := t.SubscribePieceStateChanges()
+	defer subscription.Close()
 
-	waitingFor := countNumberPiecesWaitingFor(t, downloadPlan)
-	if waitingFor == 0 {
-		r.logger.WithFields(
+	pending := piecesWaitingFor(t, downloadPlan)
+	defer func() {
+		r.publish(ctx, downloadPlan, preview.NewDownloadPlanFinishedEvent(downloadPlan.GetTorrent().ID(), planID, len(pending), time.Now()))
+	}()
+	if len(pending) == 0 {
+		r.logger.WithContext(ctx).WithFields(
 			logrus.Fields{
 				"waitingFor": 0,
 				"torrent":    t.Name(),
@@ -155,51 +357,68 @@ func (r *TorrentClient) waitPiecesToDownload(ctx context.Context, wg *sync.WaitG
 		).Debug("all pieces already downloaded")
 	}
 
-	if !r.hasSeeders(ctx, t, seederWaitTime) {
+	limits := downloadPlan.Limits().Or(r.limits)
+	ctxDeadline, cancelDeadline := ctx, context.CancelFunc(func() {})
+	if limits.HasDeadline() {
+		ctxDeadline, cancelDeadline = context.WithDeadline(ctx, limits.Deadline)
+	}
+	defer cancelDeadline()
+
+	if len(pending) > 0 && !r.hasSeeders(ctxDeadline, t, limits.SeederWaitTime) {
+		if limits.IsExpired(time.Now()) {
+			registry.Fail(preview.ErrDeadlineExceeded)
+		} else {
+			registry.Fail(preview.ErrNoSeeders)
+		}
 		return
 	}
 
-	ctxTimeout, cancel := context.WithTimeout(ctx, maxDownloadTime)
+	ctxTimeout, cancel := context.WithTimeout(ctxDeadline, limits.MaxDownloadTime)
 	defer cancel()
 
-	subscription := t.SubscribePieceStateChanges()
-	defer subscription.Close()
-	for waitingFor > 0 {
+	for len(pending) > 0 {
 		select {
 		case _v, isOpen := <-subscription.Values:
 			if !isOpen {
-				r.logger.WithFields(
+				r.logger.WithContext(ctx).WithFields(
 					logrus.Fields{
-						"waitingFor": waitingFor,
+						"waitingFor": len(pending),
 						"torrent":    t.Name(),
 					},
 				).Info("transmissions subscriber closed")
+				return
 			}
 			v, ok := _v.(torrent2.PieceStateChange)
-			if !ok || !v.Complete {
-				continue
+			if !ok || !v.Complete || !pending[v.Index] {
+				continue // not a piece of the plan, or already received
 			}
 
-			waitingFor--
-			buf := r.readPiece(t, v.Index)
+			// A piece that cannot be read is not delivered. It's waited for until it's completed again
+			buf := r.readPiece(ctx, t, v.Index)
 			if buf == nil {
 				continue
 			}
-			registry.RegisterPiece(preview.NewPiece(t.InfoHash().HexString(), v.Index, buf))
+			delete(pending, v.Index)
+			metrics.PiecesDownloaded.Inc()
+			if err := registry.RegisterPiece(preview.NewPiece(t.InfoHash().HexString(), v.Index, buf)); err != nil {
+				r.logger.WithContext(ctx).WithError(err).WithField("pieceIdx", v.Index).Warn("registry not accepting pieces anymore")
+				return
+			}
+			r.publishPieceCompleted(ctx, t, downloadPlan, v.Index)
 
-			r.logger.WithFields(
+			r.logger.WithContext(ctx).WithFields(
 				logrus.Fields{"pieceIdx": v.Index,
 					"complete":   v.Complete,
-					"waitingFor": waitingFor,
+					"waitingFor": len(pending),
 					"torrent":    t.Name(),
 				},
 			).Info("piece download completed")
 
 		case <-time.After(time.Second * 3):
-			r.logger.WithFields(
+			r.logger.WithContext(ctx).WithFields(
 				logrus.Fields{
 					"seedersCount":     t.Stats().ConnectedSeeders,
-					"piecesLeft":       waitingFor,
+					"piecesLeft":       len(pending),
 					"activePeers":      t.Stats().ActivePeers,
 					"chunksReadUseful": t.Stats().ChunksReadUseful,
 					"ChunksReadWasted": t.Stats().ChunksReadWasted,
@@ -207,11 +426,11 @@ func (r *TorrentClient) waitPiecesToDownload(ctx context.Context, wg *sync.WaitG
 				},
 			).Debug("number of connected peers")
 		case <-ctxTimeout.Done():
-			r.logger.WithFields(
+			r.logger.WithContext(ctx).WithFields(
 				logrus.Fields{
 					"peersCount": len(t.PeerConns()),
 					"torrent":    t.Name(),
-					"piecesLeft": waitingFor,
+					"piecesLeft": len(pending),
 					"context":    ctxTimeout.Err(),
 				},
 			).Error("goroutine stopped because context closed")
@@ -226,7 +445,7 @@ func (r *TorrentClient) hasSeeders(ctx context.Context, t *torrent2.Torrent, dur
 	for t.Stats().ConnectedSeeders == 0 {
 		select {
 		case <-ctxSeederTimeout.Done():
-			r.logger.WithFields(
+			r.logger.WithContext(ctx).WithFields(
 				logrus.Fields{
 					"torrent":     t.InfoHash().String(),
 					"torrentName": t.Name(),
@@ -240,11 +459,41 @@ func (r *TorrentClient) hasSeeders(ctx context.Context, t *torrent2.Torrent, dur
 	return true
 }
 
-func (r *TorrentClient) readPiece(t *torrent2.Torrent, idx int) []byte {
-	buf := make([]byte, t.Info().PieceLength)
+func (r *TorrentClient) publishPieceCompleted(ctx context.Context, t *torrent2.Torrent, downloadPlan preview.DownloadPlan, idx int) {
+	stats := t.Stats()
+	r.publish(ctx, downloadPlan, preview.NewPieceCompletedEvent(
+		t.InfoHash().HexString(),
+		idx,
+		stats.ActivePeers,
+		stats.ConnectedSeeders,
+		time.Now(),
+	))
+}
+
+// publish sends progress events. Those are informative, so a failure must not stop the download.
+// The windows of a stream are not part of the preview, thus their progress is not published
+func (r *TorrentClient) publish(ctx context.Context, downloadPlan preview.DownloadPlan, event interface{}) {
+	if downloadPlan.IsUrgent() {
+		return
+	}
+	if err := r.eventBus.Publish(ctx, event); err != nil {
+		r.logger.WithContext(ctx).WithFields(
+			logrus.Fields{
+				"error": err,
+			},
+		).Warn("unable to publish progress event")
+	}
+}
+
+func (r *TorrentClient) readPiece(ctx context.Context, t *torrent2.Torrent, idx int) []byte {
+	// The last piece of the torrent is usually shorter than the rest
+	buf := make([]byte, t.Piece(idx).Info().Length())
 	n, err := t.Piece(idx).Storage().ReadAt(buf, 0)
+	if err == io.EOF && n == len(buf) {
+		err = nil
+	}
 	if err != nil {
-		r.logger.WithFields(
+		r.logger.WithContext(ctx).WithFields(
 			logrus.Fields{"pieceIdx": idx,
 				"complete": t.Piece(idx).Storage().Completion().Complete,
 				"torrent":  t.Name(),
@@ -255,7 +504,7 @@ func (r *TorrentClient) readPiece(t *torrent2.Torrent, idx int) []byte {
 	}
 
 	if n != len(buf) {
-		r.logger.WithFields(
+		r.logger.WithContext(ctx).WithFields(
 			logrus.Fields{"pieceIdx": idx,
 				"complete":        t.Piece(idx).Storage().Completion().Complete,
 				"torrent":         t.Name(),
@@ -268,6 +517,21 @@ func (r *TorrentClient) readPiece(t *torrent2.Torrent, idx int) []byte {
 	return buf
 }
 
+// Drop removes the torrent from the client, if it has it. Its downloads stop and it is not seeded anymore
+func (r *TorrentClient) Drop(_ context.Context, torrentID string) error {
+	var hash metainfo.Hash
+	if err := hash.FromHexString(torrentID); err != nil {
+		return fmt.Errorf("%w: %v", preview.ErrInvalidTorrentID, err)
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	delete(r.uses, hash)
+	if t, ok := r.client.Torrent(hash); ok {
+		t.Drop()
+	}
+	return nil
+}
+
 func (r *TorrentClient) Import(_ context.Context, raw []byte) (preview.Torrent, error) {
 	data := bytes.NewBuffer(raw)
 	metaInfo, err := metainfo.Load(data)
@@ -0,0 +1,67 @@
+package bittorrentproto_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"prevtorrent/internal/platform/bus/busmocks"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/client/bittorrentproto"
+	"testing"
+
+	torrent2 "github.com/anacrolix/torrent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTorrentClient_DownloadParts_LastPieceOfTheTorrent(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "video.mp4")
+	content := bytes.Repeat([]byte("0123456789"), 5000) // 3 pieces of 16 KiB and a short one
+	require.NoError(t, ioutil.WriteFile(root, content, 0644))
+
+	config := torrent2.NewDefaultClientConfig()
+	config.DataDir = t.TempDir()
+	config.ListenPort = 0
+	config.NoDHT = true
+	config.DisableTrackers = true
+	client, err := torrent2.NewClient(config)
+	require.NoError(t, err)
+	defer client.Close()
+
+	eventBus := &busmocks.Event{}
+	eventBus.On("Publish", mock.Anything, mock.Anything).Return(nil)
+	torrentClient := bittorrentproto.NewTorrentClient(client, fakeLogger(), eventBus, preview.DownloadLimits{}, nil)
+	raw, err := torrentClient.Create(root, 16<<10)
+	require.NoError(t, err)
+	require.NoError(t, torrentClient.Seed(context.Background(), raw, root))
+	torrent, err := torrentClient.Import(context.Background(), raw)
+	require.NoError(t, err)
+
+	// The end of the file, as asked by a Range request with bytes=-100
+	file := torrent.Files()[0]
+	plan, err := preview.NewStreamPlan(torrent, file, file.Length()-100, 100)
+	require.NoError(t, err)
+
+	registry, err := torrentClient.DownloadParts(context.Background(), *plan)
+	require.NoError(t, err)
+
+	got := new(bytes.Buffer)
+	err = registry.RunOnPieceReady(context.Background(), func(part preview.PieceRange) error {
+		media, err := preview.NewBundlePlan().Bundle(registry, part)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(got, media.Reader())
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, content[len(content)-100:], got.Bytes())
+	eventBus.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+
+	// The seeded torrent is kept when the plan finishes
+	_, stillSeeded := client.Torrent(client.Torrents()[0].InfoHash())
+	assert.True(t, stillSeeded)
+}
@@ -0,0 +1,86 @@
+package webhookhttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"prevtorrent/internal/preview"
+	"syscall"
+	"time"
+)
+
+const (
+	HeaderEvent     = "X-Prevtorrent-Event"
+	HeaderDelivery  = "X-Prevtorrent-Delivery"
+	HeaderSignature = "X-Prevtorrent-Signature"
+
+	userAgent = "prevtorrent-webhooks"
+	// maxResponse is how much of the response we read, so the connection can be reused
+	maxResponse = 64 << 10
+)
+
+var ErrUnexpectedStatus = errors.New("unexpected status")
+
+// Sender posts the deliveries as JSON. Any 2xx response means the receiver accepted it
+type Sender struct {
+	client *http.Client
+}
+
+func NewSender(client *http.Client) *Sender {
+	return &Sender{client: client}
+}
+
+// NewClient returns the client for the Sender. It refuses to connect to the addresses that are not
+// public, which the names of the webhooks, or their redirects, might resolve to
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   publicOnly,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Through a proxy, the address dialed would be the one of the proxy
+	transport.Proxy = nil
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !preview.IsPublicAddress(ip) {
+		return fmt.Errorf("%w: %v", preview.ErrNonPublicAddress, host)
+	}
+	return nil
+}
+
+func (s *Sender) Send(ctx context.Context, url string, delivery *preview.WebhookDelivery, signature string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(delivery.Payload()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderEvent, delivery.Event())
+	req.Header.Set(HeaderDelivery, delivery.ID())
+	req.Header.Set(HeaderSignature, signature)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponse))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%w %v", ErrUnexpectedStatus, resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,70 @@
+package webhookhttp_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/client/webhookhttp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSender_Send(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	delivery := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, "cb84", []byte(`{"event":"torrent.created"}`), time.Now())
+
+	sender := webhookhttp.NewSender(receiver.Client())
+	status, err := sender.Send(context.Background(), receiver.URL+"/hooks", delivery, "sha256=abc")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, http.MethodPost, received.Method)
+	assert.Equal(t, "/hooks", received.URL.Path)
+	assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	assert.Equal(t, "torrent.created", received.Header.Get(webhookhttp.HeaderEvent))
+	assert.Equal(t, "d1", received.Header.Get(webhookhttp.HeaderDelivery))
+	assert.Equal(t, "sha256=abc", received.Header.Get(webhookhttp.HeaderSignature))
+	assert.JSONEq(t, `{"event":"torrent.created"}`, string(body))
+}
+
+func TestSender_Send_Rejected(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	delivery := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, "cb84", []byte(`{}`), time.Now())
+
+	sender := webhookhttp.NewSender(receiver.Client())
+	status, err := sender.Send(context.Background(), receiver.URL, delivery, "sha256=abc")
+
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	require.True(t, errors.Is(err, webhookhttp.ErrUnexpectedStatus))
+}
+
+func TestNewClient_RefusesNonPublicAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("the receiver is on the loopback")
+	}))
+	defer receiver.Close()
+
+	delivery := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, "cb84", []byte(`{}`), time.Now())
+
+	sender := webhookhttp.NewSender(webhookhttp.NewClient(time.Second))
+	_, err := sender.Send(context.Background(), receiver.URL, delivery, "sha256=abc")
+	require.True(t, errors.Is(err, preview.ErrNonPublicAddress))
+}
@@ -5,27 +5,110 @@ import (
 	"fmt"
 	"io"
 	"prevtorrent/internal/platform/storage/inmemory"
+	"prevtorrent/internal/platform/tracing"
+	"prevtorrent/internal/preview"
+	"time"
 
 	"github.com/anacrolix/torrent"
 	"github.com/spf13/viper"
 )
 
-const projectName = "prevtorrent"
+const (
+	projectName = "prevtorrent"
+	mb          = 1 << 20
+)
 
 type Config struct {
-	ImageDir              string `yaml:"ImageDir"`
-	SqlitePath            string `yaml:"SqlitePath"`
-	EnableIPv6            bool   `yaml:"EnableIPv6"`
-	EnableUTP             bool   `yaml:"EnableUTP"`
-	EnableTorrentDebug    bool   `yaml:"EnableTorrentDebug"`
-	LogLevel              string `yaml:"LogLevel"`
-	ConnectionsPerTorrent int    `yaml:"ConnectionsPerTorrent"`
-	TorrentListeningPort  int    `yaml:"TorrentListeningPort"`
-	TorrentStorageDriver  string `yaml:"TorrentStorageDriver"`
-	PubSubDriver          string `yaml:"PubSubDriver"`
-	GooglePubSubProjectID string `yaml:"GooglePubSubProjectID"`
-	AMQPURI               string `yaml:"AMQPURI"`
-	LogFormatter          string `yaml:"LogFormatter"`
+	ImageDir              string        `yaml:"ImageDir"`
+	SqlitePath            string        `yaml:"SqlitePath"`
+	EnableIPv6            bool          `yaml:"EnableIPv6"`
+	EnableUTP             bool          `yaml:"EnableUTP"`
+	EnableTorrentDebug    bool          `yaml:"EnableTorrentDebug"`
+	LogLevel              string        `yaml:"LogLevel"`
+	ConnectionsPerTorrent int           `yaml:"ConnectionsPerTorrent"`
+	TorrentListeningPort  int           `yaml:"TorrentListeningPort"`
+	TorrentStorageDriver  string        `yaml:"TorrentStorageDriver"`
+	PubSubDriver          string        `yaml:"PubSubDriver"`
+	GooglePubSubProjectID string        `yaml:"GooglePubSubProjectID"`
+	AMQPURI               string        `yaml:"AMQPURI"`
+	LogFormatter          string        `yaml:"LogFormatter"`
+	RetryMaxAttempts      int           `yaml:"RetryMaxAttempts"`
+	RetryInitialBackoff   time.Duration `yaml:"RetryInitialBackoff"`
+	RetryMaxBackoff       time.Duration `yaml:"RetryMaxBackoff"`
+	RetryPollInterval     time.Duration `yaml:"RetryPollInterval"`
+	MaxDownloadTime       time.Duration `yaml:"MaxDownloadTime"`
+	SeederWaitTime        time.Duration `yaml:"SeederWaitTime"`
+	ClipsEnabled          bool          `yaml:"ClipsEnabled"`
+	ClipDuration          time.Duration `yaml:"ClipDuration"`
+	ClipMaxBitrate        int           `yaml:"ClipMaxBitrate"`
+	ClipMaxHeight         int           `yaml:"ClipMaxHeight"`
+	ClipThreads           int           `yaml:"ClipThreads"`
+	ClipTimeout           time.Duration `yaml:"ClipTimeout"`
+	ClipMaxSize           int           `yaml:"ClipMaxSize"`
+	TorrentPeers          []string      `yaml:"TorrentPeers"`
+	QueuePollInterval     time.Duration `yaml:"QueuePollInterval"`
+	QueueVisibility       time.Duration `yaml:"QueueVisibility"`
+	QueueMaxAttempts      int           `yaml:"QueueMaxAttempts"`
+	OutboxPollInterval    time.Duration `yaml:"OutboxPollInterval"`
+	OutboxMaxAttempts     int           `yaml:"OutboxMaxAttempts"`
+	DedupRetention        time.Duration `yaml:"DedupRetention"`
+	PieceEventRetention   time.Duration `yaml:"PieceEventRetention"`
+	WebhookMaxAttempts    int           `yaml:"WebhookMaxAttempts"`
+	WebhookInitialBackoff time.Duration `yaml:"WebhookInitialBackoff"`
+	WebhookMaxBackoff     time.Duration `yaml:"WebhookMaxBackoff"`
+	WebhookPollInterval   time.Duration `yaml:"WebhookPollInterval"`
+	WebhookTimeout        time.Duration `yaml:"WebhookTimeout"`
+	TracingExporter       string        `yaml:"TracingExporter"`
+	TracingEndpoint       string        `yaml:"TracingEndpoint"`
+	MetricsAddress        string        `yaml:"MetricsAddress"`
+	AdminToken            string        `yaml:"AdminToken" json:"-"`
+}
+
+// DownloadLimits returns the default limits of the downloads. The commands might override them
+func (c Config) DownloadLimits() preview.DownloadLimits {
+	return preview.DownloadLimits{
+		MaxDownloadTime: c.MaxDownloadTime,
+		SeederWaitTime:  c.SeederWaitTime,
+	}
+}
+
+// RetryPolicy returns how the downloads of torrents without seeders are retried
+func (c Config) RetryPolicy() preview.RetryPolicy {
+	return preview.RetryPolicy{
+		MaxAttempts:    c.RetryMaxAttempts,
+		InitialBackoff: c.RetryInitialBackoff,
+		MaxBackoff:     c.RetryMaxBackoff,
+	}
+}
+
+// WebhookPolicy returns how the deliveries of the webhooks are retried
+func (c Config) WebhookPolicy() preview.RetryPolicy {
+	return preview.RetryPolicy{
+		MaxAttempts:    c.WebhookMaxAttempts,
+		InitialBackoff: c.WebhookInitialBackoff,
+		MaxBackoff:     c.WebhookMaxBackoff,
+	}
+}
+
+// Tracing returns where the spans are exported
+func (c Config) Tracing() tracing.Config {
+	return tracing.Config{
+		Exporter: c.TracingExporter,
+		Endpoint: c.TracingEndpoint,
+	}
+}
+
+// ClipLimits returns how the clips of the videos are generated
+func (c Config) ClipLimits() preview.ClipLimits {
+	return preview.ClipLimits{
+		Enabled:    c.ClipsEnabled,
+		Duration:   c.ClipDuration,
+		MaxBitrate: c.ClipMaxBitrate,
+		MaxHeight:  c.ClipMaxHeight,
+		Threads:    c.ClipThreads,
+		Timeout:    c.ClipTimeout,
+		MaxSize:    c.ClipMaxSize,
+	}
 }
 
 func (c Config) Print(w io.Writer) {
@@ -59,6 +142,36 @@ func NewConfig() (Config, error) {
 	viper.SetDefault("PubSubDriver", "rabbit")
 	viper.SetDefault("AMQPURI", "amqp://localhost:5672")
 	viper.SetDefault("LogFormatter", "text")
+	viper.SetDefault("RetryMaxAttempts", 8)
+	viper.SetDefault("RetryInitialBackoff", "5m")
+	viper.SetDefault("RetryMaxBackoff", "12h")
+	viper.SetDefault("RetryPollInterval", "30s")
+	viper.SetDefault("MaxDownloadTime", "15m")
+	viper.SetDefault("SeederWaitTime", "30s")
+	viper.SetDefault("ClipsEnabled", false)
+	viper.SetDefault("ClipDuration", "10s")
+	viper.SetDefault("ClipMaxBitrate", 400)
+	viper.SetDefault("ClipMaxHeight", 360)
+	viper.SetDefault("ClipThreads", 1)
+	viper.SetDefault("ClipTimeout", "1m")
+	viper.SetDefault("ClipMaxSize", 2*mb)
+	viper.SetDefault("TorrentPeers", []string{})
+	viper.SetDefault("QueuePollInterval", "1s")
+	viper.SetDefault("QueueVisibility", "1m")
+	viper.SetDefault("QueueMaxAttempts", 10)
+	viper.SetDefault("OutboxPollInterval", "1s")
+	viper.SetDefault("OutboxMaxAttempts", 50)
+	viper.SetDefault("DedupRetention", "168h")
+	viper.SetDefault("PieceEventRetention", "168h")
+	viper.SetDefault("WebhookMaxAttempts", 10)
+	viper.SetDefault("WebhookInitialBackoff", "30s")
+	viper.SetDefault("WebhookMaxBackoff", "1h")
+	viper.SetDefault("WebhookPollInterval", "5s")
+	viper.SetDefault("WebhookTimeout", "10s")
+	viper.SetDefault("TracingExporter", "none")
+	viper.SetDefault("TracingEndpoint", "localhost:4318")
+	viper.SetDefault("MetricsAddress", ":9090")
+	viper.SetDefault("AdminToken", "")
 
 	if err := viper.ReadInConfig(); err != nil {
 		return Config{}, err
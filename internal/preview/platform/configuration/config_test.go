@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"prevtorrent/internal/preview/platform/configuration"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -23,6 +24,36 @@ func TestConfiguration(t *testing.T) {
 		GooglePubSubProjectID: "GooglePubSubProjectID",
 		AMQPURI:               "AMQPURI",
 		LogFormatter:          "LogFormatter",
+		RetryMaxAttempts:      3,
+		RetryInitialBackoff:   time.Minute,
+		RetryMaxBackoff:       time.Hour,
+		RetryPollInterval:     10 * time.Second,
+		MaxDownloadTime:       2 * time.Hour,
+		SeederWaitTime:        time.Minute,
+		ClipsEnabled:          true,
+		ClipDuration:          5 * time.Second,
+		ClipMaxBitrate:        200,
+		ClipMaxHeight:         240,
+		ClipThreads:           2,
+		ClipTimeout:           30 * time.Second,
+		ClipMaxSize:           1048576,
+		TorrentPeers:          []string{"127.0.0.1:42069"},
+		QueuePollInterval:     500 * time.Millisecond,
+		QueueVisibility:       2 * time.Minute,
+		QueueMaxAttempts:      5,
+		OutboxPollInterval:    3 * time.Second,
+		OutboxMaxAttempts:     20,
+		DedupRetention:        24 * time.Hour,
+		PieceEventRetention:   72 * time.Hour,
+		WebhookMaxAttempts:    4,
+		WebhookInitialBackoff: 10 * time.Second,
+		WebhookMaxBackoff:     10 * time.Minute,
+		WebhookPollInterval:   2 * time.Second,
+		WebhookTimeout:        5 * time.Second,
+		TracingExporter:       "stdout",
+		TracingEndpoint:       "collector:4318",
+		MetricsAddress:        ":9191",
+		AdminToken:            "AdminToken",
 	}
 
 	config, err := configuration.NewConfig()
@@ -38,6 +69,7 @@ func TestConfiguration_Print(t *testing.T) {
 	buf := new(bytes.Buffer)
 	config.Print(buf)
 	assert.NotEmpty(t, buf)
+	assert.NotContains(t, buf.String(), config.AdminToken, "the admin token is a secret")
 }
 
 func TestConfiguration_GetTorrentConf(t *testing.T) {
@@ -0,0 +1,97 @@
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"prevtorrent/internal/preview/deleteTorrent"
+	"prevtorrent/internal/preview/reprocessTorrent"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminOnly rejects the requests without the admin token as bearer token
+func adminOnly(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearer := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, httpError{
+				Message: "a valid admin token is required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (s *Server) reprocessTorrentController(c *gin.Context) {
+	// Every parameter is optional, so is the body
+	var req reprocessTorrentRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, httpError{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	cmd, err := req.cmd(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpError{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := s.services.ReprocessTorrent().Reprocess(c.Request.Context(), cmd); err != nil {
+		s.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func (s *Server) deleteTorrentController(c *gin.Context) {
+	var req deleteTorrentRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpError{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	err := s.services.DeleteTorrent().Delete(c.Request.Context(), deleteTorrent.CMD{
+		TorrentID: c.Params.ByName("id"),
+		Force:     req.Force,
+	})
+	if err != nil {
+		s.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (r reprocessTorrentRequest) cmd(torrentID string) (reprocessTorrent.CMD, error) {
+	cmd := reprocessTorrent.CMD{
+		TorrentID: torrentID,
+		FileIDs:   r.Files,
+		Force:     r.Force,
+	}
+	if r.Deadline != nil {
+		cmd.Deadline = *r.Deadline
+	}
+
+	var err error
+	if r.MaxDownloadTime != "" {
+		if cmd.MaxDownloadTime, err = time.ParseDuration(r.MaxDownloadTime); err != nil {
+			return reprocessTorrent.CMD{}, err
+		}
+	}
+	if r.SeederWaitTime != "" {
+		if cmd.SeederWaitTime, err = time.ParseDuration(r.SeederWaitTime); err != nil {
+			return reprocessTorrent.CMD{}, err
+		}
+	}
+	return cmd, nil
+}
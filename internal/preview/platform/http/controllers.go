@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"prevtorrent/internal/platform/services"
 	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/getProgress"
+	"prevtorrent/internal/preview/getRetry"
 	"prevtorrent/internal/preview/getTorrent"
 	"prevtorrent/internal/preview/importTorrent"
 	"prevtorrent/internal/preview/unmagnetize"
@@ -25,7 +27,7 @@ func NewServer(services services.Services) *Server {
 }
 
 func (s *Server) getTorrentController(c *gin.Context) {
-	torrent, err := s.services.GetTorrent().Get(c, getTorrent.CMD{
+	torrent, err := s.services.GetTorrent().Get(c.Request.Context(), getTorrent.CMD{
 		TorrentID: c.Params.ByName("id"),
 	})
 
@@ -36,10 +38,12 @@ func (s *Server) getTorrentController(c *gin.Context) {
 
 	c.IndentedJSON(http.StatusOK, getTorrentResponse{
 		Torrent: Torrent{
-			Id:     torrent.ID(),
-			Name:   torrent.Name(),
-			Length: torrent.TotalLength(),
-			Files:  makeFiles(torrent),
+			Id:        torrent.ID(),
+			Name:      torrent.Name(),
+			Length:    torrent.TotalLength(),
+			Status:    torrent.Status().String(),
+			LastError: torrent.LastError(),
+			Files:     makeFiles(torrent),
 		},
 	})
 }
@@ -56,17 +60,104 @@ func makeFiles(torrent preview.Torrent) []File {
 			})
 		}
 
+		clips := make([]Clip, 0)
+		for _, clip := range f.Clips() {
+			clips = append(clips, Clip{
+				Src:             clip.Name(),
+				Length:          clip.Length(),
+				DurationSeconds: clip.Duration().Seconds(),
+			})
+		}
+
 		files = append(files, File{
 			ID:          f.ID(),
 			Length:      f.Length(),
 			Name:        f.Name(),
 			Images:      images,
+			Clips:       clips,
 			IsSupported: f.IsSupportedExtension(),
 		})
 	}
 	return files
 }
 
+func (s *Server) getTorrentProgressController(c *gin.Context) {
+	progress, err := s.services.GetProgress().Get(c.Request.Context(), getProgress.CMD{
+		TorrentID: c.Params.ByName("id"),
+	})
+
+	if err != nil {
+		s.handleError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, getProgressResponse{
+		Progress: makeProgress(progress),
+	})
+}
+
+func makeProgress(progress *preview.Progress) Progress {
+	files := make([]FileProgress, 0)
+	for _, f := range progress.Files() {
+		files = append(files, FileProgress{
+			ID:               f.FileID,
+			Pieces:           f.Pieces,
+			PiecesDownloaded: f.PiecesDownloaded,
+			Percentage:       f.Percentage(),
+		})
+	}
+
+	var eta *int
+	if duration, ok := progress.ETA(); ok {
+		seconds := int(duration.Seconds())
+		eta = &seconds
+	}
+
+	return Progress{
+		TorrentID:     progress.TorrentID(),
+		IsDownloading: progress.IsDownloading(),
+		PiecesLeft:    progress.PiecesLeft(),
+		ActivePeers:   progress.Peers().Active,
+		Seeders:       progress.Peers().Seeders,
+		ETASeconds:    eta,
+		StartedAt:     progress.StartedAt(),
+		UpdatedAt:     progress.UpdatedAt(),
+		Files:         files,
+	}
+}
+
+func (s *Server) getTorrentRetryController(c *gin.Context) {
+	retry, err := s.services.GetRetry().Get(c.Request.Context(), getRetry.CMD{
+		TorrentID: c.Params.ByName("id"),
+	})
+
+	if err != nil {
+		s.handleError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, getRetryResponse{
+		Retry: makeRetry(retry),
+	})
+}
+
+func makeRetry(retry *preview.DownloadRetry) Retry {
+	var nextAttemptAt *time.Time
+	if retry.IsWaiting() {
+		at := retry.NextAttemptAt()
+		nextAttemptAt = &at
+	}
+
+	return Retry{
+		TorrentID:        retry.TorrentID(),
+		Attempts:         retry.Attempts(),
+		IsWaiting:        retry.IsWaiting(),
+		PendingDownloads: len(retry.Pending()),
+		NextAttemptAt:    nextAttemptAt,
+		LastError:        retry.LastError(),
+	}
+}
+
 func (s *Server) handleError(c *gin.Context, err error) {
 	if errors.Is(err, preview.ErrNotFound) {
 		c.JSON(http.StatusNotFound, httpError{
@@ -75,6 +166,20 @@ func (s *Server) handleError(c *gin.Context, err error) {
 		return
 	}
 
+	if errors.Is(err, preview.ErrPreviewInProgress) {
+		c.JSON(http.StatusConflict, httpError{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, preview.ErrInvalidWebhook) || errors.Is(err, preview.ErrInvalidFile) {
+		c.JSON(http.StatusBadRequest, httpError{
+			Message: err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusInternalServerError, httpError{
 		Message: fmt.Sprintf("Unexpected error: %v", err.Error()),
 	})
@@ -88,7 +193,7 @@ func (s *Server) unmagnetizeController(ctx *gin.Context) {
 		})
 		return
 	}
-	ctxWithCancellation, cancel := context.WithTimeout(ctx, time.Second*15)
+	ctxWithCancellation, cancel := context.WithTimeout(ctx.Request.Context(), time.Second*15)
 	defer cancel()
 
 	torrentID, err := s.services.Unmagnetize().Handle(ctxWithCancellation, unmagnetize.CMD{Magnet: magnet})
@@ -122,7 +227,7 @@ func (s *Server) newTorrentController(ctx *gin.Context) {
 		return
 	}
 
-	torrent, err := s.services.ImportTorrent().Import(ctx, importTorrent.CMD{
+	torrent, err := s.services.ImportTorrent().Import(ctx.Request.Context(), importTorrent.CMD{
 		TorrentRaw: file,
 	})
 	if err != nil {
@@ -134,3 +239,21 @@ func (s *Server) newTorrentController(ctx *gin.Context) {
 		"id": torrent.ID(),
 	})
 }
+
+func (s *Server) getStatsController(c *gin.Context) {
+	stats, err := s.services.GetStats().Get(c.Request.Context())
+	if err != nil {
+		s.handleError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, getStatsResponse{
+		Stats: Stats{
+			Torrents:          stats.Count(preview.CounterTorrents),
+			Images:            stats.Count(preview.CounterImages),
+			ImageFailures:     stats.Count(preview.CounterImageFailures),
+			PreviewsCompleted: stats.Count(preview.CounterPreviewsCompleted),
+			PreviewsFailed:    stats.Count(preview.CounterPreviewsFailed),
+		},
+	})
+}
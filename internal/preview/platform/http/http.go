@@ -2,7 +2,10 @@ package http
 
 import (
 	http2 "net/http"
+	"prevtorrent/internal/platform/health"
+	"prevtorrent/internal/platform/metrics"
 	"prevtorrent/internal/platform/services"
+	"prevtorrent/internal/platform/tracing"
 	"time"
 
 	"github.com/cnjack/throttle"
@@ -26,22 +29,46 @@ func Run(s services.Services) *http2.Server {
 func setupServer(server *Server) *gin.Engine {
 	router := gin.Default()
 	router.Use(getCORS())
+	router.Use(correlate())
+	router.Use(measure())
+
+	// Registered before the throttling so the scrapes and the probes are never rejected
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	router.GET("/healthz", gin.WrapH(health.LiveHandler()))
+	router.GET("/readyz", gin.WrapH(health.ReadyHandler(server.services.HealthChecker())))
 
 	router.Use(throttle.Policy(&throttle.Quota{Limit: 4, Within: time.Second}))
 	router.Use(throttle.Policy(&throttle.Quota{Limit: 120, Within: time.Minute}))
 
 	router.GET("/torrent/:id", server.getTorrentController)
+	router.GET("/torrent/:id/progress", server.getTorrentProgressController)
+	router.GET("/torrent/:id/retry", server.getTorrentRetryController)
+	router.GET("/torrent/:id/files/:fileID/stream", server.streamFileController)
+	router.GET("/stats", server.getStatsController)
 	router.POST("/unmagnetize", server.unmagnetizeController)
 	router.POST("/torrent", server.newTorrentController)
+
+	// The admin routes do not exist unless a token has been configured
+	if token := server.services.Config().AdminToken; token != "" {
+		router.DELETE("/torrent/:id", adminOnly(token), server.deleteTorrentController)
+		admin := router.Group("/admin", adminOnly(token))
+		admin.POST("/torrent/:id/reprocess", server.reprocessTorrentController)
+		// The server posts to the webhooks, so not anyone can register them
+		webhooks := router.Group("/webhooks", adminOnly(token))
+		webhooks.POST("", server.registerWebhookController)
+		webhooks.GET("/:id", server.getWebhookController)
+		webhooks.GET("/:id/deliveries", server.getWebhookDeliveriesController)
+		webhooks.DELETE("/:id", server.unregisterWebhookController)
+	}
 	return router
 }
 
 func getCORS() gin.HandlerFunc {
 	return cors.New(cors.Config{
 		AllowOrigins:  []string{"*", "localhost"},
-		AllowMethods:  []string{"GET", "POST"},
-		AllowHeaders:  []string{"Origin", "Cache-Control", "X-Requested-With"},
-		ExposeHeaders: []string{"Content-Length"},
+		AllowMethods:  []string{"GET", "POST", "DELETE"},
+		AllowHeaders:  []string{"Origin", "Cache-Control", "X-Requested-With", "Range", "Content-Type", "Authorization", tracing.Header},
+		ExposeHeaders: []string{"Content-Length", "Content-Range", "Accept-Ranges", tracing.Header},
 		MaxAge:        12 * time.Hour,
 	})
 }
@@ -0,0 +1,123 @@
+//go:build integration
+// +build integration
+
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"prevtorrent/internal/platform/container"
+	"prevtorrent/internal/platform/services"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/deleteTorrent"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Admin_Reprocess(t *testing.T) {
+	c, err := container.NewTestingContainer()
+	require.NoError(t, err)
+
+	createDB(t, c.GetSQLDatabase())
+	populateDB(t, c.GetSQLDatabase())
+	defer removeDB(c.Config().SqlitePath)
+
+	s, err := services.NewServices(c)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(setupServer(NewServer(s)))
+	defer ts.Close()
+
+	reprocess := func(torrentID, token, body string) int {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/admin/torrent/"+torrentID+"/reprocess", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, reprocess("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "wrong", ""))
+	assert.Equal(t, http.StatusNotFound, reprocess("0000000000000000000000000000000000000000", "test-admin-token", ""))
+	assert.Equal(t, http.StatusBadRequest, reprocess("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "test-admin-token", `{"max_download_time": "soon"}`))
+	// The torrent of the testdata has not been planned yet
+	assert.Equal(t, http.StatusConflict, reprocess("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "test-admin-token", `{"files": [0], "force": true}`))
+}
+
+func Test_Admin_DeleteTorrent(t *testing.T) {
+	c, err := container.NewTestingContainer()
+	require.NoError(t, err)
+
+	createDB(t, c.GetSQLDatabase())
+	populateDB(t, c.GetSQLDatabase())
+	defer removeDB(c.Config().SqlitePath)
+
+	// The image of the testdata
+	imagePath := path.Join(c.Config().ImageDir, "fil1.mp4.pjg")
+	require.NoError(t, os.MkdirAll(c.Config().ImageDir, 0755))
+	require.NoError(t, ioutil.WriteFile(imagePath, []byte("image"), 0644))
+	defer os.Remove(imagePath)
+
+	s, err := services.NewServices(c)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(setupServer(NewServer(s)))
+	defer ts.Close()
+
+	remove := func(token string, query string) int {
+		req, err := http.NewRequest(http.MethodDelete, ts.URL+"/torrent/cb84ccc10f296df72d6c40ba7a07c178a4323a14"+query, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, remove("", ""))
+	// The testdata torrent is still being resolved. Checked with the service, the routes are throttled
+	err = s.DeleteTorrent().Delete(context.Background(), deleteTorrent.CMD{TorrentID: "cb84ccc10f296df72d6c40ba7a07c178a4323a14"})
+	assert.True(t, errors.Is(err, preview.ErrPreviewInProgress))
+
+	_, err = c.GetSQLDatabase().Exec("INSERT INTO event_log (uuid, name, payload, recorded_at) VALUES " +
+		"('e1', 'preview.TorrentCreatedEvent', CAST('{\"TorrentID\":\"cb84ccc10f296df72d6c40ba7a07c178a4323a14\"}' AS BLOB), CURRENT_TIMESTAMP), " +
+		"('e2', 'preview.TorrentCreatedEvent', CAST('{\"TorrentID\":\"other\"}' AS BLOB), CURRENT_TIMESTAMP)")
+	require.NoError(t, err)
+
+	// Taken down anyway
+	assert.Equal(t, http.StatusNoContent, remove("test-admin-token", "?force=true"))
+	assert.Equal(t, http.StatusNotFound, remove("test-admin-token", ""))
+
+	res, err := http.Get(ts.URL + "/torrent/cb84ccc10f296df72d6c40ba7a07c178a4323a14")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	_, err = os.Stat(imagePath)
+	assert.True(t, os.IsNotExist(err))
+
+	var uuids []string
+	rows, err := c.GetSQLDatabase().Query("SELECT uuid FROM event_log")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var uuid string
+		require.NoError(t, rows.Scan(&uuid))
+		uuids = append(uuids, uuid)
+	}
+	assert.Equal(t, []string{"e2"}, uuids)
+}
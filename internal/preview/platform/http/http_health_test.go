@@ -0,0 +1,46 @@
+//go:build integration
+// +build integration
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"prevtorrent/internal/platform/container"
+	"prevtorrent/internal/platform/health"
+	"prevtorrent/internal/platform/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Health(t *testing.T) {
+	c, err := container.NewTestingContainer()
+	require.NoError(t, err)
+
+	createDB(t, c.GetSQLDatabase())
+	defer removeDB(c.Config().SqlitePath)
+
+	s, err := services.NewServices(c)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(setupServer(NewServer(s)))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/healthz")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = http.Get(ts.URL + "/readyz")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	// The broker and ffmpeg might not be there, only the database is checked
+	var report health.Report
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	require.NotEmpty(t, report.Checks)
+	assert.Equal(t, health.Result{Name: "sqlite", Healthy: true}, report.Checks[0])
+}
@@ -0,0 +1,46 @@
+//go:build integration
+// +build integration
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"prevtorrent/internal/platform/container"
+	"prevtorrent/internal/platform/services"
+	"prevtorrent/internal/preview"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GetStats(t *testing.T) {
+	c, err := container.NewTestingContainer()
+	require.NoError(t, err)
+
+	createDB(t, c.GetSQLDatabase())
+	defer removeDB(c.Config().SqlitePath)
+
+	ctx := context.Background()
+	require.NoError(t, c.StatsRepository().Increment(ctx, preview.CounterTorrents))
+	require.NoError(t, c.StatsRepository().Increment(ctx, preview.CounterImages))
+	require.NoError(t, c.StatsRepository().Increment(ctx, preview.CounterImages))
+
+	s, err := services.NewServices(c)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(setupServer(NewServer(s)))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/stats")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var body getStatsResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	assert.Equal(t, Stats{Torrents: 1, Images: 2}, body.Stats)
+}
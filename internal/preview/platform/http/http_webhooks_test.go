@@ -0,0 +1,133 @@
+//go:build integration
+// +build integration
+
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"prevtorrent/internal/platform/container"
+	"prevtorrent/internal/platform/services"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Webhooks_Register(t *testing.T) {
+	ts, cleanup := newWebhooksServer(t)
+	defer cleanup()
+
+	registered := postWebhook(t, ts, url.Values{
+		"url":        {"https://example.com/hooks"},
+		"torrent_id": {"cb84ccc10f296df72d6c40ba7a07c178a4323a14"},
+		"events":     {"image.extracted", "preview.completed"},
+	})
+	assert.NotEmpty(t, registered.ID)
+	assert.NotEmpty(t, registered.Secret)
+	assert.Equal(t, []string{"image.extracted", "preview.completed"}, registered.Events)
+
+	resp := adminRequest(t, http.MethodGet, ts.URL+"/webhooks/"+registered.ID, nil)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got webhookResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.Equal(t, "https://example.com/hooks", got.Webhook.URL)
+	assert.Empty(t, got.Webhook.Secret)
+
+	resp = adminRequest(t, http.MethodGet, ts.URL+"/webhooks/"+registered.ID+"/deliveries", nil)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var deliveries deliveriesResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&deliveries))
+	assert.Empty(t, deliveries.Deliveries)
+}
+
+func Test_Webhooks_Unregister(t *testing.T) {
+	ts, cleanup := newWebhooksServer(t)
+	defer cleanup()
+
+	registered := postWebhook(t, ts, url.Values{"url": {"https://example.com/hooks"}})
+
+	resp := adminRequest(t, http.MethodDelete, ts.URL+"/webhooks/"+registered.ID, nil)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = adminRequest(t, http.MethodGet, ts.URL+"/webhooks/"+registered.ID, nil)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func Test_Webhooks_Invalid(t *testing.T) {
+	ts, cleanup := newWebhooksServer(t)
+	defer cleanup()
+
+	for _, form := range []url.Values{
+		{"url": {"https://example.com/hooks"}, "events": {"torrent.deleted"}},
+		{"url": {"http://169.254.169.254/latest/meta-data"}},
+	} {
+		resp := adminRequest(t, http.MethodPost, ts.URL+"/webhooks", form)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func Test_Webhooks_AdminOnly(t *testing.T) {
+	ts, cleanup := newWebhooksServer(t)
+	defer cleanup()
+
+	resp, err := http.PostForm(ts.URL+"/webhooks", url.Values{"url": {"https://example.com/hooks"}})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func newWebhooksServer(t *testing.T) (*httptest.Server, func()) {
+	c, err := container.NewTestingContainer()
+	require.NoError(t, err)
+
+	createDB(t, c.GetSQLDatabase())
+
+	s, err := services.NewServices(c)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(setupServer(NewServer(s)))
+	return ts, func() {
+		ts.Close()
+		removeDB(c.Config().SqlitePath)
+	}
+}
+
+func postWebhook(t *testing.T, ts *httptest.Server, form url.Values) Webhook {
+	resp := adminRequest(t, http.MethodPost, ts.URL+"/webhooks", form)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var registered webhookResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&registered))
+	return registered.Webhook
+}
+
+// adminRequest sends the request with the admin token of the testdata, and the form, if any
+func adminRequest(t *testing.T, method, target string, form url.Values) *http.Response {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, target, body)
+	require.NoError(t, err)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("Authorization", "Bearer test-admin-token")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
@@ -0,0 +1,25 @@
+package http
+
+import (
+	"prevtorrent/internal/platform/metrics"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// measure observes how long every request takes, by route, so the paths with ids are grouped
+func measure() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "not found"
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(metrics.Since(start))
+	}
+}
@@ -0,0 +1,29 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"prevtorrent/internal/platform/metrics"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_measure(t *testing.T) {
+	router := gin.New()
+	router.Use(measure())
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	router.GET("/measured/:id", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/measured/cb84ccc10f296df72d6c40ba7a07c178a4323a14", nil))
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Body.String(),
+		`prevtorrent_http_request_duration_seconds_count{method="GET",route="/measured/:id",status="404"} 1`)
+}
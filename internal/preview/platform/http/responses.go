@@ -7,3 +7,23 @@ type httpError struct {
 type getTorrentResponse struct {
 	Torrent Torrent `json:"torrent"`
 }
+
+type getProgressResponse struct {
+	Progress Progress `json:"progress"`
+}
+
+type getRetryResponse struct {
+	Retry Retry `json:"retry"`
+}
+
+type webhookResponse struct {
+	Webhook Webhook `json:"webhook"`
+}
+
+type deliveriesResponse struct {
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+type getStatsResponse struct {
+	Stats Stats `json:"stats"`
+}
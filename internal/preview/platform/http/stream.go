@@ -0,0 +1,121 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"prevtorrent/internal/preview/streamFile"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidRange = errors.New("invalid range")
+
+func (s *Server) streamFileController(c *gin.Context) {
+	fileID, err := strconv.Atoi(c.Params.ByName("fileID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpError{
+			Message: "the file ID must be a number",
+		})
+		return
+	}
+
+	stream, err := s.services.StreamFile().Open(c.Request.Context(), streamFile.CMD{
+		TorrentID: c.Params.ByName("id"),
+		FileID:    fileID,
+	})
+	if err != nil {
+		s.handleError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	start, length := 0, stream.Length()
+	if header := c.GetHeader("Range"); header != "" {
+		start, length, err = parseRange(header, stream.Length())
+		if err != nil {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%v", stream.Length()))
+			c.JSON(http.StatusRequestedRangeNotSatisfiable, httpError{
+				Message: err.Error(),
+			})
+			return
+		}
+		status = http.StatusPartialContent
+		c.Header("Content-Range", fmt.Sprintf("bytes %v-%v/%v", start, start+length-1, stream.Length()))
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(stream.Name()))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Length", strconv.Itoa(length))
+	c.Status(status)
+
+	// The headers are already sent, the only thing we can do on error is to cut the connection
+	if err := s.services.StreamFile().Copy(c.Request.Context(), flushWriter{c.Writer}, stream, start, length); err != nil {
+		_ = c.Error(err)
+		c.Abort()
+	}
+}
+
+// parseRange parses a single range of the Range header (RFC 7233) and returns
+// the first byte and the number of bytes requested
+func parseRange(header string, size int) (int, int, error) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return 0, 0, fmt.Errorf("%w: unit not supported", errInvalidRange)
+	}
+	spec := strings.TrimPrefix(header, "bytes=")
+	if strings.Contains(spec, ",") {
+		return 0, 0, fmt.Errorf("%w: multiple ranges not supported", errInvalidRange)
+	}
+
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("%w: %q", errInvalidRange, spec)
+	}
+	first, last := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+	if first == "" { // bytes=-500 are the last 500 bytes
+		suffix, err := strconv.Atoi(last)
+		if err != nil || suffix <= 0 {
+			return 0, 0, fmt.Errorf("%w: %q", errInvalidRange, spec)
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, nil
+	}
+
+	start, err := strconv.Atoi(first)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, fmt.Errorf("%w: %q", errInvalidRange, spec)
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.Atoi(last)
+		if err != nil || end < start {
+			return 0, 0, fmt.Errorf("%w: %q", errInvalidRange, spec)
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, nil
+}
+
+// flushWriter sends the bytes to the client as soon as they are written
+type flushWriter struct {
+	w gin.ResponseWriter
+}
+
+func (f flushWriter) Write(b []byte) (int, error) {
+	n, err := f.w.Write(b)
+	f.w.Flush()
+	return n, err
+}
@@ -0,0 +1,40 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		wantStart  int
+		wantLength int
+		wantErr    bool
+	}{
+		{header: "bytes=0-", wantStart: 0, wantLength: 1000},
+		{header: "bytes=100-199", wantStart: 100, wantLength: 100},
+		{header: "bytes=900-5000", wantStart: 900, wantLength: 100},
+		{header: "bytes=-100", wantStart: 900, wantLength: 100},
+		{header: "bytes=-5000", wantStart: 0, wantLength: 1000},
+		{header: "bytes=1000-", wantErr: true},
+		{header: "bytes=200-100", wantErr: true},
+		{header: "bytes=0-10,20-30", wantErr: true},
+		{header: "items=0-10", wantErr: true},
+		{header: "bytes=abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			start, length, err := parseRange(tt.header, 1000)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStart, start)
+			assert.Equal(t, tt.wantLength, length)
+		})
+	}
+}
@@ -1,22 +1,113 @@
 package http
 
+import "time"
+
 type Image struct {
 	Src     string `json:"source"`
 	Length  int    `json:"length"`
 	IsValid bool   `json:"is_valid"`
 }
 
+type Clip struct {
+	Src             string  `json:"source"`
+	Length          int     `json:"length"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
 type File struct {
 	ID          int     `json:"id"`
 	Length      int     `json:"length"`
 	IsSupported bool    `json:"is_supported"`
 	Name        string  `json:"name"`
 	Images      []Image `json:"images"`
+	Clips       []Clip  `json:"clips"`
 }
 
 type Torrent struct {
-	Id     string `json:"id"`
-	Name   string `json:"name"`
-	Length int    `json:"length"`
-	Files  []File `json:"files"`
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Length    int    `json:"length"`
+	Status    string `json:"status"`
+	LastError string `json:"last_error,omitempty"`
+	Files     []File `json:"files"`
+}
+
+type FileProgress struct {
+	ID               int     `json:"id"`
+	Pieces           int     `json:"pieces"`
+	PiecesDownloaded int     `json:"pieces_downloaded"`
+	Percentage       float64 `json:"percentage"`
+}
+
+type Progress struct {
+	TorrentID     string         `json:"torrent_id"`
+	IsDownloading bool           `json:"is_downloading"`
+	PiecesLeft    int            `json:"pieces_left"`
+	ActivePeers   int            `json:"active_peers"`
+	Seeders       int            `json:"seeders"`
+	ETASeconds    *int           `json:"eta_seconds"`
+	StartedAt     time.Time      `json:"started_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	Files         []FileProgress `json:"files"`
+}
+
+type Retry struct {
+	TorrentID        string     `json:"torrent_id"`
+	Attempts         int        `json:"attempts"`
+	IsWaiting        bool       `json:"is_waiting"`
+	PendingDownloads int        `json:"pending_downloads"`
+	NextAttemptAt    *time.Time `json:"next_attempt_at"`
+	LastError        string     `json:"last_error"`
+}
+
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	TorrentID string    `json:"torrent_id"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Delivery struct {
+	ID             string     `json:"id"`
+	Event          string     `json:"event"`
+	TorrentID      string     `json:"torrent_id"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"response_status"`
+	LastError      string     `json:"last_error"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+type registerWebhookRequest struct {
+	URL       string   `form:"url" json:"url"`
+	Secret    string   `form:"secret" json:"secret"`
+	TorrentID string   `form:"torrent_id" json:"torrent_id"`
+	Events    []string `form:"events" json:"events"`
+}
+
+// reprocessTorrentRequest has the optional parameters of a reprocess. The durations use the format
+// of time.ParseDuration, e.g. "10m"
+type reprocessTorrentRequest struct {
+	Files           []int      `json:"files"`
+	Force           bool       `json:"force"`
+	MaxDownloadTime string     `json:"max_download_time"`
+	SeederWaitTime  string     `json:"seeder_wait_time"`
+	Deadline        *time.Time `json:"deadline"`
+}
+
+// deleteTorrentRequest has the optional parameters of a deletion, given in the query
+type deleteTorrentRequest struct {
+	Force bool `form:"force"`
+}
+
+type Stats struct {
+	Torrents          int `json:"torrents"`
+	Images            int `json:"images"`
+	ImageFailures     int `json:"image_failures"`
+	PreviewsCompleted int `json:"previews_completed"`
+	PreviewsFailed    int `json:"previews_failed"`
 }
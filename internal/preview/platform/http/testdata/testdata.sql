@@ -8,3 +8,6 @@ VALUES ('cb84ccc10f296df72d6c40ba7a07c178a4323a14', 1, 'img2.jpg', 400);
 
 INSERT INTO media (torrent_id, file_id, name, length)
 VALUES ('cb84ccc10f296df72d6c40ba7a07c178a4323a14', 0, 'fil1.mp4.pjg', 10);
+
+INSERT INTO clips (torrent_id, file_id, name, duration, length)
+VALUES ('cb84ccc10f296df72d6c40ba7a07c178a4323a14', 0, 'fil1.mp4.mp4', 9500, 2048);
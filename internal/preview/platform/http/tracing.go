@@ -0,0 +1,54 @@
+package http
+
+import (
+	"net/http"
+	"prevtorrent/internal/platform/tracing"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// validCorrelationID limits what the clients can send as correlation ID, since it ends in the logs
+var validCorrelationID = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,128}$`)
+
+// correlate gives a correlation ID to every request, the one sent by the client if valid, and starts
+// its span. The controllers must use the context of the request, the gin one does not keep them
+func correlate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		id := c.GetHeader(tracing.Header)
+		if !validCorrelationID.MatchString(id) {
+			id = tracing.NewCorrelationID()
+		}
+		ctx = tracing.WithCorrelationID(ctx, id)
+		c.Header(tracing.Header, id)
+
+		route := c.FullPath()
+		if route == "" {
+			route = "not found"
+		}
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(
+			semconv.HTTPMethodKey.String(c.Request.Method),
+			semconv.HTTPRouteKey.String(route),
+			semconv.HTTPStatusCodeKey.Int(status),
+			attribute.String("correlation_id", id),
+		)
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
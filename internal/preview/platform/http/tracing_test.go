@@ -0,0 +1,49 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"prevtorrent/internal/platform/tracing"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_correlate(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		keeps  bool
+	}{
+		{name: "given by the client", header: "c0ffee-42", keeps: true},
+		{name: "missing", header: ""},
+		{name: "invalid", header: "c0ffee\n42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled string
+			router := gin.New()
+			router.Use(correlate())
+			router.GET("/stats", func(c *gin.Context) {
+				handled = tracing.CorrelationID(c.Request.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+			if tt.header != "" {
+				req.Header.Set(tracing.Header, tt.header)
+			}
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			assert.NotEmpty(t, handled)
+			assert.Equal(t, handled, res.Header().Get(tracing.Header))
+			if tt.keeps {
+				assert.Equal(t, tt.header, handled)
+			} else {
+				assert.NotEqual(t, tt.header, handled)
+			}
+		})
+	}
+}
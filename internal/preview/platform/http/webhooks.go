@@ -0,0 +1,108 @@
+package http
+
+import (
+	"net/http"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/getWebhook"
+	"prevtorrent/internal/preview/registerWebhook"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) registerWebhookController(c *gin.Context) {
+	var req registerWebhookRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpError{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	webhook, err := s.services.RegisterWebhook().Register(c.Request.Context(), registerWebhook.CMD{
+		URL:       req.URL,
+		Secret:    req.Secret,
+		TorrentID: req.TorrentID,
+		Events:    req.Events,
+	})
+	if err != nil {
+		s.handleError(c, err)
+		return
+	}
+
+	// The secret is only returned here, the receiver needs it to check the signatures
+	response := makeWebhook(webhook)
+	response.Secret = webhook.Secret()
+	c.JSON(http.StatusCreated, webhookResponse{Webhook: response})
+}
+
+func (s *Server) getWebhookController(c *gin.Context) {
+	webhook, err := s.services.GetWebhook().Get(c.Request.Context(), getWebhook.CMD{
+		WebhookID: c.Params.ByName("id"),
+	})
+	if err != nil {
+		s.handleError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, webhookResponse{Webhook: makeWebhook(webhook)})
+}
+
+func (s *Server) getWebhookDeliveriesController(c *gin.Context) {
+	deliveries, err := s.services.GetWebhook().Deliveries(c.Request.Context(), getWebhook.CMD{
+		WebhookID: c.Params.ByName("id"),
+	})
+	if err != nil {
+		s.handleError(c, err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, deliveriesResponse{Deliveries: makeDeliveries(deliveries)})
+}
+
+func (s *Server) unregisterWebhookController(c *gin.Context) {
+	if err := s.services.RegisterWebhook().Unregister(c.Request.Context(), c.Params.ByName("id")); err != nil {
+		s.handleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func makeWebhook(webhook *preview.Webhook) Webhook {
+	return Webhook{
+		ID:        webhook.ID(),
+		URL:       webhook.URL(),
+		TorrentID: webhook.TorrentID(),
+		Events:    webhook.Events(),
+		CreatedAt: webhook.CreatedAt(),
+	}
+}
+
+func makeDeliveries(deliveries []*preview.WebhookDelivery) []Delivery {
+	response := make([]Delivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		var nextAttemptAt, deliveredAt *time.Time
+		if d.Status() == preview.DeliveryPending {
+			at := d.NextAttemptAt()
+			nextAttemptAt = &at
+		}
+		if d.Status() == preview.DeliveryDelivered {
+			at := d.DeliveredAt()
+			deliveredAt = &at
+		}
+
+		response = append(response, Delivery{
+			ID:             d.ID(),
+			Event:          d.Event(),
+			TorrentID:      d.TorrentID(),
+			Status:         string(d.Status()),
+			Attempts:       d.Attempts(),
+			ResponseStatus: d.ResponseStatus(),
+			LastError:      d.LastError(),
+			NextAttemptAt:  nextAttemptAt,
+			CreatedAt:      d.CreatedAt(),
+			DeliveredAt:    deliveredAt,
+		})
+	}
+	return response
+}
@@ -2,9 +2,11 @@ package file
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
@@ -25,6 +27,31 @@ func (r *ImagePersister) PersistFile(ctx context.Context, id string, data []byte
 	return ioutil.WriteFile(path.Join(r.imageDir, id), data, 0644)
 }
 
+func (r *ImagePersister) DeleteFile(ctx context.Context, id string) error {
+	name := path.Join(r.imageDir, id)
+	// The names come from the torrents, never delete anything outside of the directory
+	if !strings.HasPrefix(name, path.Clean(r.imageDir)+"/") {
+		return fmt.Errorf("file %q is not in the image directory", id)
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// CheckWritable returns an error if the images cannot be written in the directory
+func (r *ImagePersister) CheckWritable(ctx context.Context) error {
+	if err := ensureDirectoryExists(r.imageDir); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(r.imageDir, ".prevtorrent.check.")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
 func ensureDirectoryExists(dir string) (err error) {
 	if _, err = os.Stat(dir); os.IsNotExist(err) {
 		if err := os.MkdirAll(dir, 0755); err != nil {
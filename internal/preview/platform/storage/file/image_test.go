@@ -66,3 +66,47 @@ func fakeLogger() *logrus.Logger {
 	l.Out = ioutil.Discard
 	return l
 }
+
+func TestImagePersister_DeleteFile(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "torrentpreviewtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	imagePersister := file.NewImagePersister(fakeLogger(), path.Join(dir, "images"))
+	require.NoError(t, imagePersister.PersistFile(context.Background(), "image.jpg", []byte("example")))
+
+	require.NoError(t, imagePersister.DeleteFile(context.Background(), "image.jpg"))
+	_, err = os.Stat(path.Join(dir, "images", "image.jpg"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Deleting twice is fine, nothing is left behind either way
+	require.NoError(t, imagePersister.DeleteFile(context.Background(), "image.jpg"))
+}
+
+func TestImagePersister_DeleteFile_ErrIfOutsideOfTheDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "torrentpreviewtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	outside := path.Join(dir, "secret.txt")
+	require.NoError(t, ioutil.WriteFile(outside, []byte("example"), 0644))
+
+	imagePersister := file.NewImagePersister(fakeLogger(), path.Join(dir, "images"))
+	require.Error(t, imagePersister.DeleteFile(context.Background(), "../secret.txt"))
+
+	_, err = os.Stat(outside)
+	assert.NoError(t, err)
+}
+
+func TestImagePersister_CheckWritable(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "torrentpreviewtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	imagePersister := file.NewImagePersister(fakeLogger(), path.Join(dir, "images"))
+	require.NoError(t, imagePersister.CheckWritable(context.Background()))
+
+	files, err := ioutil.ReadDir(path.Join(dir, "images"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"prevtorrent/internal/platform/metrics"
 	"prevtorrent/internal/preview"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -23,12 +27,15 @@ const (
 	qv      = "2"
 )
 
+// progressTime matches the time of the output that ffmpeg reports while encoding. Ex: time=00:00:09.97
+var progressTime = regexp.MustCompile(`time=(\d+):(\d+):(\d+(?:\.\d+)?)`)
+
 type InMemoryFfmpeg struct {
 	logger *logrus.Logger
 }
 
 func NewInMemoryFfmpeg(logger *logrus.Logger) (*InMemoryFfmpeg, error) {
-	if err := checkFFMPGExecutableIsInPath(); err != nil {
+	if err := CheckExecutable(); err != nil {
 		return nil, err
 	}
 	return &InMemoryFfmpeg{
@@ -36,7 +43,8 @@ func NewInMemoryFfmpeg(logger *logrus.Logger) (*InMemoryFfmpeg, error) {
 	}, nil
 }
 
-func checkFFMPGExecutableIsInPath() error {
+// CheckExecutable returns an error if ffmpeg is not in the PATH or is unable to run
+func CheckExecutable() error {
 	cmd := exec.Command(command, "-version")
 	if err := cmd.Start(); err != nil {
 		return err
@@ -47,8 +55,10 @@ func checkFFMPGExecutableIsInPath() error {
 	return nil
 }
 
-func (i *InMemoryFfmpeg) ExtractImage(ctx context.Context, data []byte, time int) ([]byte, error) {
-	frameExtractionTime := strconv.Itoa(time)
+func (i *InMemoryFfmpeg) ExtractImage(ctx context.Context, data io.Reader, second int) (img []byte, err error) {
+	start := time.Now()
+	defer func() { measure(ctx, "image", start, err) }()
+	frameExtractionTime := strconv.Itoa(second)
 
 	id, err := uuid.NewRandom()
 	if err != nil {
@@ -58,15 +68,15 @@ func (i *InMemoryFfmpeg) ExtractImage(ctx context.Context, data []byte, time int
 	outputFilename := path.Join(os.TempDir(), fmt.Sprintf("prevtorrent.ffmpgout.%v.jpg", id.String()))
 	defer rmFile(outputFilename)
 
-	// IMPROVEMENT: For some reason passing the file from STDIN (see below) crashes ffmpeg.
+	// IMPROVEMENT: For some reason passing the file from STDIN crashes ffmpeg.
 	//       Doing it with a file seems to work better but involves IO. Would be nice to get rid of it
 	//       in the future or use tmpfs instead
 	inputVideo := outputFilename + ".mp4"
-	err = ioutil.WriteFile(inputVideo, data, 0600)
+	err = writeFile(inputVideo, data)
+	defer rmFile(inputVideo)
 	if err != nil {
 		return nil, err
 	}
-	defer rmFile(inputVideo)
 
 	cmd := exec.Command(command,
 		"-ss", frameExtractionTime, // Always keep before the -i option for performance considerations! https://trac.ffmpeg.org/wiki/Seeking
@@ -76,7 +86,6 @@ func (i *InMemoryFfmpeg) ExtractImage(ctx context.Context, data []byte, time int
 		outputFilename,
 	)
 
-	cmd.Stdin = bytes.NewBuffer(data)
 	stdOut := new(bytes.Buffer)
 	cmd.Stdout = stdOut
 	stdErr := new(bytes.Buffer)
@@ -91,7 +100,7 @@ func (i *InMemoryFfmpeg) ExtractImage(ctx context.Context, data []byte, time int
 		return nil, i.logCommandFailed(err, stdOut, stdErr)
 	}
 
-	img, err := ioutil.ReadFile(outputFilename)
+	img, err = ioutil.ReadFile(outputFilename)
 	if err != nil {
 		return nil, i.logCommandFailed(err, stdOut, stdErr)
 	}
@@ -99,6 +108,108 @@ func (i *InMemoryFfmpeg) ExtractImage(ctx context.Context, data []byte, time int
 	return img, err
 }
 
+// ExtractClip transcodes the beginning of the video into a low bitrate H.264 MP4, playable in
+// any browser. The cost is bounded by the limits: duration, bitrate, height, threads and timeout.
+func (i *InMemoryFfmpeg) ExtractClip(ctx context.Context, data io.Reader, limits preview.ClipLimits) (_ []byte, _ time.Duration, err error) {
+	start := time.Now()
+	defer func() { measure(ctx, "clip", start, err) }() // ctx ends up with the timeout of the limits
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	outputFilename := path.Join(os.TempDir(), fmt.Sprintf("prevtorrent.ffmpgclip.%v.mp4", id.String()))
+	defer rmFile(outputFilename)
+
+	inputVideo := outputFilename + ".input"
+	err = writeFile(inputVideo, data)
+	defer rmFile(inputVideo)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	bitrate := fmt.Sprintf("%vk", limits.MaxBitrate)
+	cmd := exec.CommandContext(ctx, command,
+		"-i", inputVideo,
+		"-t", strconv.FormatFloat(limits.Duration.Seconds(), 'f', -1, 64),
+		"-vf", fmt.Sprintf("scale=-2:'min(%v,ih)'", limits.MaxHeight),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-profile:v", "baseline", // plays everywhere
+		"-pix_fmt", "yuv420p",
+		"-b:v", bitrate,
+		"-maxrate", bitrate,
+		"-bufsize", fmt.Sprintf("%vk", 2*limits.MaxBitrate),
+		"-c:a", "aac",
+		"-b:a", "64k",
+		"-threads", strconv.Itoa(limits.Threads),
+		"-movflags", "+faststart", // the browser can start playing before downloading the whole clip
+		"-y",
+		outputFilename,
+	)
+
+	stdOut := new(bytes.Buffer)
+	cmd.Stdout = stdOut
+	stdErr := new(bytes.Buffer)
+	cmd.Stderr = stdErr
+
+	if err := cmd.Run(); err != nil {
+		err = errors.Wrap(err, "error while transcoding the clip with ffmpeg")
+		return nil, 0, i.logCommandFailed(err, stdOut, stdErr)
+	}
+
+	clip, err := ioutil.ReadFile(outputFilename)
+	if err != nil {
+		return nil, 0, i.logCommandFailed(err, stdOut, stdErr)
+	}
+
+	return clip, encodedDuration(stdErr.String()), nil
+}
+
+// measure observes how long the operation took and, if it failed, why
+func measure(ctx context.Context, operation string, start time.Time, err error) {
+	metrics.FfmpegDuration.WithLabelValues(operation).Observe(metrics.Since(start))
+	if err != nil {
+		metrics.FfmpegFailures.WithLabelValues(operation, failureReason(ctx, err)).Inc()
+	}
+}
+
+// failureReason groups the errors of ffmpeg in a few reasons, to be used as label of the metrics
+func failureReason(ctx context.Context, err error) string {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, preview.ErrAtomNotFound):
+		return "atom_not_found"
+	case errors.Is(err, preview.ErrNotAbleToGenerateImage):
+		return "no_output"
+	default:
+		return "error"
+	}
+}
+
+// encodedDuration returns the last time reported by ffmpeg, which is the duration of the output
+func encodedDuration(stderr string) time.Duration {
+	matches := progressTime.FindAllStringSubmatch(stderr, -1)
+	if len(matches) == 0 {
+		return 0
+	}
+	last := matches[len(matches)-1]
+	hours, _ := strconv.Atoi(last[1])
+	minutes, _ := strconv.Atoi(last[2])
+	seconds, _ := strconv.ParseFloat(last[3], 64)
+
+	return time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second))
+}
+
 func (i *InMemoryFfmpeg) logCommandFailed(err error, stdOut, stdErr *bytes.Buffer) error {
 	i.logger.WithFields(logrus.Fields{
 		"stdout": stdOut.String(),
@@ -121,6 +232,19 @@ func (i *InMemoryFfmpeg) isAtomNotFound(stderr string) bool {
 	return strings.Contains(stderr, "moov atom not found")
 }
 
+// writeFile copies the data into the file, without holding it all in memory
+func writeFile(dst string, data io.Reader) error {
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func rmFile(src string) {
 	_ = os.Remove(src)
 }
@@ -0,0 +1,60 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"prevtorrent/internal/preview"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+type ClipRepository struct {
+	db *sql.DB
+}
+
+func NewClipRepository(db *sql.DB) *ClipRepository {
+	return &ClipRepository{db: db}
+}
+
+func (r *ClipRepository) ByTorrent(ctx context.Context, id string) ([]preview.Clip, error) {
+	sqlStructure := sqlbuilder.NewStruct(new(clip))
+	query := sqlStructure.SelectFrom(sqlClipTable)
+	query.Where(query.Equal("torrent_id", id))
+	query.OrderBy("file_id", "name").Asc()
+
+	sqlRaw, args := query.Build()
+	rows, err := r.db.QueryContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clips := make([]preview.Clip, 0)
+	for rows.Next() {
+		var c clip
+		if err := rows.Scan(sqlStructure.Addr(&c)...); err != nil {
+			return nil, err
+		}
+		duration := time.Duration(c.Duration) * time.Millisecond
+		clips = append(clips, preview.NewClip(c.TorrentID, c.FileID, c.Name, duration, c.Length))
+	}
+	return clips, rows.Err()
+}
+
+func (r *ClipRepository) Persist(ctx context.Context, c preview.Clip) error {
+	sqlStructure := sqlbuilder.NewStruct(new(clip))
+	query, args := sqlStructure.ReplaceInto(sqlClipTable, clip{
+		TorrentID: c.TorrentID(),
+		FileID:    c.FileID(),
+		Name:      c.Name(),
+		Duration:  int(c.Duration().Milliseconds()),
+		Length:    c.Length(),
+	}).Build()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error trying to persist a clip on database: %v", err)
+	}
+	return nil
+}
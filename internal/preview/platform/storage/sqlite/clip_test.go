@@ -0,0 +1,51 @@
+package sqlite_test
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClipRepository_Persist(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec(
+		"REPLACE INTO clips (torrent_id, file_id, name, duration, length) VALUES (?, ?, ?, ?, ?)").
+		WithArgs(torrentID, 1, "clip.mp4", 9500, 2048).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repository := sqlite.NewClipRepository(db)
+	err = repository.Persist(context.Background(), preview.NewClip(torrentID, 1, "clip.mp4", 9500*time.Millisecond, 2048))
+	require.NoError(t, err)
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestClipRepository_ByTorrent(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"torrent_id", "file_id", "name", "duration", "length"}).
+		AddRow(torrentID, 1, "clip.mp4", 9500, 2048)
+	sqlMock.ExpectQuery("SELECT clips.torrent_id, clips.file_id, clips.name, clips.duration, clips.length FROM clips WHERE torrent_id = ? ORDER BY file_id, name ASC").
+		WithArgs(torrentID).
+		WillReturnRows(rows)
+
+	repository := sqlite.NewClipRepository(db)
+	clips, err := repository.ByTorrent(context.Background(), torrentID)
+	require.NoError(t, err)
+
+	assert.Equal(t, []preview.Clip{preview.NewClip(torrentID, 1, "clip.mp4", 9500*time.Millisecond, 2048)}, clips)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
@@ -0,0 +1,129 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"prevtorrent/internal/preview"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// WebhookDeliveryRepository stores the deliveries of the webhooks, which are also their log
+type WebhookDeliveryRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookDeliveryRepository(db *sql.DB) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{db: db}
+}
+
+// Persist stores all the deliveries in the same transaction
+func (r *WebhookDeliveryRepository) Persist(ctx context.Context, deliveries ...*preview.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	rows := make([]interface{}, 0, len(deliveries))
+	for _, d := range deliveries {
+		rows = append(rows, webhookDelivery{
+			ID:             d.ID(),
+			WebhookID:      d.WebhookID(),
+			Event:          d.Event(),
+			TorrentID:      d.TorrentID(),
+			Payload:        d.Payload(),
+			Status:         string(d.Status()),
+			Attempts:       d.Attempts(),
+			NextAttemptAt:  d.NextAttemptAt(),
+			ResponseStatus: d.ResponseStatus(),
+			LastError:      d.LastError(),
+			CreatedAt:      d.CreatedAt(),
+			DeliveredAt:    d.DeliveredAt(),
+		})
+	}
+
+	sqlStructure := sqlbuilder.NewStruct(new(webhookDelivery))
+	query, args := sqlStructure.ReplaceInto(sqlDeliveryTable, rows...).Build()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error trying to persist the webhook deliveries on database: %v", err)
+	}
+	return nil
+}
+
+func (r *WebhookDeliveryRepository) Due(ctx context.Context, now time.Time, limit int) ([]*preview.WebhookDelivery, error) {
+	sqlStructure := sqlbuilder.NewStruct(new(webhookDelivery))
+	query := sqlStructure.SelectFrom(sqlDeliveryTable)
+	query.Where(
+		query.Equal("status", string(preview.DeliveryPending)),
+		query.LessEqualThan("next_attempt_at", now),
+	)
+	query.OrderBy("next_attempt_at").Asc()
+	query.Limit(limit)
+
+	return r.query(ctx, sqlStructure, query)
+}
+
+func (r *WebhookDeliveryRepository) Claim(ctx context.Context, id string, now time.Time, until time.Time) (bool, error) {
+	query := sqlbuilder.Update(sqlDeliveryTable)
+	query.Set(query.Assign("next_attempt_at", until))
+	query.Where(
+		query.Equal("id", id),
+		query.Equal("status", string(preview.DeliveryPending)),
+		query.LessEqualThan("next_attempt_at", now),
+	)
+
+	sqlRaw, args := query.Build()
+	result, err := r.db.ExecContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return false, fmt.Errorf("error trying to claim the webhook delivery on database: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *WebhookDeliveryRepository) ByWebhook(ctx context.Context, webhookID string) ([]*preview.WebhookDelivery, error) {
+	sqlStructure := sqlbuilder.NewStruct(new(webhookDelivery))
+	query := sqlStructure.SelectFrom(sqlDeliveryTable)
+	query.Where(query.Equal("webhook_id", webhookID))
+	query.OrderBy("created_at").Desc()
+
+	return r.query(ctx, sqlStructure, query)
+}
+
+func (r *WebhookDeliveryRepository) query(ctx context.Context, sqlStructure *sqlbuilder.Struct, query *sqlbuilder.SelectBuilder) ([]*preview.WebhookDelivery, error) {
+	sqlRaw, args := query.Build()
+	rows, err := r.db.QueryContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*preview.WebhookDelivery, 0)
+	for rows.Next() {
+		var d webhookDelivery
+		if err := rows.Scan(sqlStructure.Addr(&d)...); err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, preview.RestoreWebhookDelivery(
+			d.ID,
+			d.WebhookID,
+			d.Event,
+			d.TorrentID,
+			d.Payload,
+			preview.DeliveryStatus(d.Status),
+			d.Attempts,
+			d.NextAttemptAt,
+			d.ResponseStatus,
+			d.LastError,
+			d.CreatedAt,
+			d.DeliveredAt,
+		))
+	}
+	return deliveries, rows.Err()
+}
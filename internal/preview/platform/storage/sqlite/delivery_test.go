@@ -0,0 +1,99 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const deliveryColumns = "webhook_deliveries.id, webhook_deliveries.webhook_id, webhook_deliveries.event, " +
+	"webhook_deliveries.torrent_id, webhook_deliveries.payload, webhook_deliveries.status, " +
+	"webhook_deliveries.attempts, webhook_deliveries.next_attempt_at, webhook_deliveries.response_status, " +
+	"webhook_deliveries.last_error, webhook_deliveries.created_at, webhook_deliveries.delivered_at"
+
+func TestWebhookDeliveryRepository_Persist(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	policy := preview.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("REPLACE INTO webhook_deliveries (id, webhook_id, event, torrent_id, payload, status, attempts, next_attempt_at, response_status, last_error, created_at, delivered_at) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(
+			"d1", "e9c6", "torrent.created", torrentID, []byte("{}"), "pending", 1, now.Add(time.Minute), 500, "unexpected status 500", now, time.Time{},
+			"d2", "f00d", "torrent.created", torrentID, []byte("{}"), "pending", 0, now, 0, "", now, time.Time{},
+		).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	failed := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, torrentID, []byte("{}"), now)
+	failed.Failed(500, errors.New("unexpected status 500"), policy, now)
+	pending := preview.NewWebhookDelivery("d2", "f00d", preview.WebhookTorrentCreated, torrentID, []byte("{}"), now)
+
+	repository := sqlite.NewWebhookDeliveryRepository(db)
+	require.NoError(t, repository.Persist(context.Background(), failed, pending))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestWebhookDeliveryRepository_Due(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{
+		"id", "webhook_id", "event", "torrent_id", "payload", "status", "attempts",
+		"next_attempt_at", "response_status", "last_error", "created_at", "delivered_at",
+	}).AddRow("d1", "e9c6", "torrent.created", torrentID, []byte("{}"), "pending", 1, now, 500, "unexpected status 500", now, time.Time{})
+
+	sqlMock.ExpectQuery("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at ASC LIMIT 10").
+		WithArgs("pending", now).
+		WillReturnRows(rows)
+
+	repository := sqlite.NewWebhookDeliveryRepository(db)
+	deliveries, err := repository.Due(context.Background(), now, 10)
+	require.NoError(t, err)
+
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "d1", deliveries[0].ID())
+	assert.Equal(t, 1, deliveries[0].Attempts())
+	assert.Equal(t, []byte("{}"), deliveries[0].Payload())
+	assert.True(t, deliveries[0].IsDue(now))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestWebhookDeliveryRepository_Claim(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	until := now.Add(5 * time.Minute)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	query := "UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ? AND status = ? AND next_attempt_at <= ?"
+	sqlMock.ExpectExec(query).
+		WithArgs(until, "d1", "pending", now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Someone else claimed it first
+	sqlMock.ExpectExec(query).
+		WithArgs(until, "d1", "pending", now).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repository := sqlite.NewWebhookDeliveryRepository(db)
+	claimed, err := repository.Claim(context.Background(), "d1", now, until)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, err = repository.Claim(context.Background(), "d1", now, until)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"prevtorrent/internal/platform/bus/eventlog"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// EventLogRepository stores every event published. See eventlog.Publisher
+type EventLogRepository struct {
+	db *sql.DB
+}
+
+func NewEventLogRepository(db *sql.DB) *EventLogRepository {
+	return &EventLogRepository{db: db}
+}
+
+func (r *EventLogRepository) Append(ctx context.Context, records ...eventlog.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	query := sqlbuilder.InsertInto(sqlEventLogTable)
+	query.Cols("uuid", "name", "payload", "recorded_at")
+	for _, record := range records {
+		query.Values(record.UUID, record.Name, record.Payload, record.RecordedAt)
+	}
+	// The outbox relay publishes an event again if it failed to delete it once published
+	query.SQL("ON CONFLICT (uuid) DO NOTHING")
+
+	sqlRaw, args := query.Build()
+	if _, err := r.db.ExecContext(ctx, sqlRaw, args...); err != nil {
+		return fmt.Errorf("error trying to append the events to the log: %v", err)
+	}
+	return nil
+}
+
+func (r *EventLogRepository) Read(ctx context.Context, afterID int64, limit int) ([]eventlog.Record, error) {
+	sqlStructure := sqlbuilder.NewStruct(new(eventLogRecord))
+	query := sqlStructure.SelectFrom(sqlEventLogTable)
+	query.Where(query.GreaterThan("id", afterID))
+	query.OrderBy("id").Asc()
+	query.Limit(limit)
+
+	sqlRaw, args := query.Build()
+	rows, err := r.db.QueryContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]eventlog.Record, 0)
+	for rows.Next() {
+		var e eventLogRecord
+		if err := rows.Scan(sqlStructure.Addr(&e)...); err != nil {
+			return nil, err
+		}
+		records = append(records, eventlog.Record{
+			ID:         e.ID,
+			UUID:       e.UUID,
+			Name:       e.Name,
+			Payload:    e.Payload,
+			RecordedAt: e.RecordedAt,
+		})
+	}
+	return records, rows.Err()
+}
+
+func (r *EventLogRepository) Purge(ctx context.Context, name string, before time.Time) error {
+	query := sqlbuilder.DeleteFrom(sqlEventLogTable)
+	query.Where(
+		query.Equal("name", name),
+		query.LessThan("recorded_at", before),
+	)
+
+	sqlRaw, args := query.Build()
+	_, err := r.db.ExecContext(ctx, sqlRaw, args...)
+	return err
+}
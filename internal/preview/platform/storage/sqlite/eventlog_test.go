@@ -0,0 +1,74 @@
+package sqlite_test
+
+import (
+	"context"
+	"prevtorrent/internal/platform/bus/eventlog"
+	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLogRepository_Append(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("INSERT INTO event_log (uuid, name, payload, recorded_at) VALUES (?, ?, ?, ?), (?, ?, ?, ?) "+
+		"ON CONFLICT (uuid) DO NOTHING").
+		WithArgs(
+			"uuid-1", "preview.TorrentCreatedEvent", []byte(`{"TorrentID":"cb84"}`), now,
+			"uuid-2", "preview.ImageExtractedEvent", []byte(`{"TorrentID":"cb84"}`), now,
+		).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+
+	repository := sqlite.NewEventLogRepository(db)
+	err = repository.Append(context.Background(),
+		eventlog.Record{UUID: "uuid-1", Name: "preview.TorrentCreatedEvent", Payload: []byte(`{"TorrentID":"cb84"}`), RecordedAt: now},
+		eventlog.Record{UUID: "uuid-2", Name: "preview.ImageExtractedEvent", Payload: []byte(`{"TorrentID":"cb84"}`), RecordedAt: now},
+	)
+	require.NoError(t, err)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestEventLogRepository_Read(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"id", "uuid", "name", "payload", "recorded_at"}).
+		AddRow(8, "uuid-1", "preview.TorrentCreatedEvent", []byte(`{"TorrentID":"cb84"}`), now)
+	sqlMock.ExpectQuery("SELECT event_log.id, event_log.uuid, event_log.name, event_log.payload, event_log.recorded_at " +
+		"FROM event_log WHERE id > ? ORDER BY id ASC LIMIT 10").
+		WithArgs(int64(7)).
+		WillReturnRows(rows)
+
+	repository := sqlite.NewEventLogRepository(db)
+	records, err := repository.Read(context.Background(), 7, 10)
+	require.NoError(t, err)
+
+	assert.Equal(t, []eventlog.Record{
+		{ID: 8, UUID: "uuid-1", Name: "preview.TorrentCreatedEvent", Payload: []byte(`{"TorrentID":"cb84"}`), RecordedAt: now},
+	}, records)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestEventLogRepository_Purge(t *testing.T) {
+	before := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("DELETE FROM event_log WHERE name = ? AND recorded_at < ?").
+		WithArgs("preview.PieceCompletedEvent", before).
+		WillReturnResult(sqlmock.NewResult(0, 120))
+
+	repository := sqlite.NewEventLogRepository(db)
+	require.NoError(t, repository.Purge(context.Background(), "preview.PieceCompletedEvent", before))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
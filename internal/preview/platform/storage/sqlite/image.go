@@ -42,6 +42,24 @@ func (r *ImageRepository) ByTorrent(ctx context.Context, id string) (*preview.To
 
 }
 
+func (r *ImageRepository) DeleteByFiles(ctx context.Context, torrentID string, fileIDs []int) error {
+	query := sqlbuilder.DeleteFrom(sqlMediaTable)
+	query.Where(query.Equal("torrent_id", torrentID))
+	if len(fileIDs) > 0 {
+		ids := make([]interface{}, 0, len(fileIDs))
+		for _, id := range fileIDs {
+			ids = append(ids, id)
+		}
+		query.Where(query.In("file_id", ids...))
+	}
+
+	sqlRaw, args := query.Build()
+	if _, err := r.db.ExecContext(ctx, sqlRaw, args...); err != nil {
+		return fmt.Errorf("error trying to delete the media on database: %v", err)
+	}
+	return nil
+}
+
 func (r *ImageRepository) Persist(ctx context.Context, img preview.Image) error {
 	torrentSQLStruct := sqlbuilder.NewStruct(new(media))
 	query, args := torrentSQLStruct.InsertInto(sqlMediaTable, media{
@@ -49,7 +67,10 @@ func (r *ImageRepository) Persist(ctx context.Context, img preview.Image) error
 		FileID:    img.FileID(),
 		Name:      img.Name(),
 		Length:    img.Length(),
-	}).Build()
+	}).
+		// The same image is persisted again when a message is redelivered
+		SQL("ON CONFLICT (torrent_id, file_id, name) DO UPDATE SET length = excluded.length").
+		Build()
 
 	_, err := r.db.ExecContext(ctx, query, args...)
 	if err != nil {
@@ -22,7 +22,8 @@ func Test_ImageRepositoryPersists(t *testing.T) {
 	require.NoError(t, err)
 
 	sqlMock.ExpectExec(
-		"INSERT INTO media (torrent_id, file_id, name, length) VALUES (?, ?, ?, ?)").
+		"INSERT INTO media (torrent_id, file_id, name, length) VALUES (?, ?, ?, ?) "+
+			"ON CONFLICT (torrent_id, file_id, name) DO UPDATE SET length = excluded.length").
 		WithArgs(torrentID, fileID, name, length).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
@@ -42,7 +43,8 @@ func Test_ImageRepositoryErrorOnPersist(t *testing.T) {
 	require.NoError(t, err)
 
 	sqlMock.ExpectExec(
-		"INSERT INTO media (torrent_id, file_id, name, length) VALUES (?, ?, ?, ?)").
+		"INSERT INTO media (torrent_id, file_id, name, length) VALUES (?, ?, ?, ?) "+
+			"ON CONFLICT (torrent_id, file_id, name) DO UPDATE SET length = excluded.length").
 		WithArgs(torrentID, fileID, name, length).
 		WillReturnError(errors.New("fake UNIQUE CONSTRAINT FAIL"))
 
@@ -81,6 +83,23 @@ func Test_ImageRepositoryByTorrent(t *testing.T) {
 	assert.Equal(t, img2, images.Images()[1])
 }
 
+func Test_ImageRepositoryDeleteByFiles(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("DELETE FROM media WHERE torrent_id = ? AND file_id IN (?, ?)").
+		WithArgs("1234", 0, 2).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	sqlMock.ExpectExec("DELETE FROM media WHERE torrent_id = ?").
+		WithArgs("1234").
+		WillReturnResult(sqlmock.NewResult(0, 5))
+
+	imageRepository := sqlite.NewImageRepository(db)
+	require.NoError(t, imageRepository.DeleteByFiles(context.Background(), "1234", []int{0, 2}))
+	require.NoError(t, imageRepository.DeleteByFiles(context.Background(), "1234", nil))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
 func Test_ImageRepositoryByTorrent_QueryError(t *testing.T) {
 	torrentID := "1234"
 
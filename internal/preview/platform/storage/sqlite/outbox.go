@@ -0,0 +1,164 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"prevtorrent/internal/platform/bus/outbox"
+	"prevtorrent/internal/platform/tracing"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// OutboxRepository reads the events stored along with the changes that produced them. See outbox.Relay
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+func (r *OutboxRepository) Pending(ctx context.Context, limit int) ([]outbox.Message, error) {
+	sqlStructure := sqlbuilder.NewStruct(new(outboxMessage))
+	query := sqlStructure.SelectFrom(sqlOutboxTable)
+	query.OrderBy("id").Asc()
+	query.Limit(limit)
+
+	sqlRaw, args := query.Build()
+	rows, err := r.db.QueryContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]outbox.Message, 0)
+	for rows.Next() {
+		var m outboxMessage
+		if err := rows.Scan(sqlStructure.Addr(&m)...); err != nil {
+			return nil, err
+		}
+
+		var metadata map[string]string
+		if err := json.Unmarshal([]byte(m.Metadata), &metadata); err != nil {
+			return nil, fmt.Errorf("unable to decode the metadata of the message: %v", err)
+		}
+
+		messages = append(messages, outbox.Message{
+			ID:       m.ID,
+			UUID:     m.UUID,
+			Name:     m.Name,
+			Payload:  m.Payload,
+			Metadata: metadata,
+			Attempts: m.Attempts,
+		})
+	}
+	return messages, rows.Err()
+}
+
+func (r *OutboxRepository) Delete(ctx context.Context, id int64) error {
+	query := sqlbuilder.DeleteFrom(sqlOutboxTable)
+	query.Where(query.Equal("id", id))
+
+	sqlRaw, args := query.Build()
+	_, err := r.db.ExecContext(ctx, sqlRaw, args...)
+	return err
+}
+
+func (r *OutboxRepository) Failed(ctx context.Context, id int64, reason error) error {
+	query := sqlbuilder.Update(sqlOutboxTable)
+	query.Set(
+		query.Incr("attempts"),
+		query.Assign("last_error", reason.Error()),
+	)
+	query.Where(query.Equal("id", id))
+
+	sqlRaw, args := query.Build()
+	_, err := r.db.ExecContext(ctx, sqlRaw, args...)
+	return err
+}
+
+// DeadLetter moves the message to the dead letters, along with the last error
+func (r *OutboxRepository) DeadLetter(ctx context.Context, m outbox.Message, reason error) error {
+	metadata, err := json.Marshal(m.Metadata)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	insert := sqlbuilder.InsertInto(sqlDeadLetterTable)
+	insert.Cols("id", "uuid", "name", "payload", "metadata", "attempts", "last_error")
+	insert.Values(m.ID, m.UUID, m.Name, m.Payload, string(metadata), m.Attempts+1, reason.Error())
+	sqlRaw, args := insert.Build()
+	if _, err := tx.Exec(sqlRaw, args...); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error trying to store the dead letter: %v", err)
+	}
+
+	query := sqlbuilder.DeleteFrom(sqlOutboxTable)
+	query.Where(query.Equal("id", m.ID))
+	sqlRaw, args = query.Build()
+	if _, err := tx.Exec(sqlRaw, args...); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error trying to delete the message from the outbox: %v", err)
+	}
+	return tx.Commit()
+}
+
+// Publish stores an event that is not produced by any change, to be published by the outbox.Relay
+// like the rest. It implements bus.Event without depending on the broker
+func (r *OutboxRepository) Publish(ctx context.Context, event interface{}) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := storeEvents(ctx, tx, []interface{}{event}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// storeEvents adds the events to the outbox within the transaction given, along with the correlation
+// ID and the span of the context
+func storeEvents(ctx context.Context, tx *sql.Tx, events []interface{}) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	metadata := make(map[string]string)
+	tracing.Inject(ctx, metadata)
+	encodedMetadata, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		query := sqlbuilder.InsertInto(sqlOutboxTable)
+		query.Cols("uuid", "name", "payload", "metadata")
+		query.Values(uuid.New().String(), eventName(event), payload, string(encodedMetadata))
+
+		sqlRaw, args := query.Build()
+		if _, err := tx.Exec(sqlRaw, args...); err != nil {
+			return fmt.Errorf("error trying to store the event on the outbox: %v", err)
+		}
+	}
+	return nil
+}
+
+// eventName returns the same name given by the cqrs marshaler, so the handlers recognise the event
+func eventName(event interface{}) string {
+	return strings.TrimLeft(fmt.Sprintf("%T", event), "*")
+}
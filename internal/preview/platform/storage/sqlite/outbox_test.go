@@ -0,0 +1,115 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"prevtorrent/internal/platform/bus/outbox"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxRepository_Pending(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"id", "uuid", "name", "payload", "metadata", "attempts"}).
+		AddRow(1, "uuid-1", "preview.TorrentCreatedEvent", []byte(`{"TorrentID":"cb84"}`), `{"correlation_id":"c0ffee"}`, 0).
+		AddRow(2, "uuid-2", "preview.TorrentCreatedEvent", []byte(`{"TorrentID":"zocm"}`), `{}`, 3)
+	sqlMock.ExpectQuery("SELECT outbox.id, outbox.uuid, outbox.name, outbox.payload, outbox.metadata, outbox.attempts FROM outbox ORDER BY id ASC LIMIT 10").
+		WillReturnRows(rows)
+
+	repository := sqlite.NewOutboxRepository(db)
+	messages, err := repository.Pending(context.Background(), 10)
+	require.NoError(t, err)
+
+	assert.Equal(t, []outbox.Message{
+		{
+			ID:       1,
+			UUID:     "uuid-1",
+			Name:     "preview.TorrentCreatedEvent",
+			Payload:  []byte(`{"TorrentID":"cb84"}`),
+			Metadata: map[string]string{"correlation_id": "c0ffee"},
+		},
+		{
+			ID:       2,
+			UUID:     "uuid-2",
+			Name:     "preview.TorrentCreatedEvent",
+			Payload:  []byte(`{"TorrentID":"zocm"}`),
+			Metadata: map[string]string{},
+			Attempts: 3,
+		},
+	}, messages)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_Delete(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("DELETE FROM outbox WHERE id = ?").
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repository := sqlite.NewOutboxRepository(db)
+	require.NoError(t, repository.Delete(context.Background(), 1))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_Failed(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("UPDATE outbox SET attempts = attempts + 1, last_error = ? WHERE id = ?").
+		WithArgs("broker down", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repository := sqlite.NewOutboxRepository(db)
+	require.NoError(t, repository.Failed(context.Background(), 1, errors.New("broker down")))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_DeadLetter(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec("INSERT INTO outbox_dead_letters (id, uuid, name, payload, metadata, attempts, last_error) VALUES (?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(int64(1), "uuid-1", "preview.TorrentCreatedEvent", []byte(`{"TorrentID":"cb84"}`), `{"correlation_id":"c0ffee"}`, 5, "broker down").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	sqlMock.ExpectExec("DELETE FROM outbox WHERE id = ?").
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+
+	repository := sqlite.NewOutboxRepository(db)
+	err = repository.DeadLetter(context.Background(), outbox.Message{
+		ID:       1,
+		UUID:     "uuid-1",
+		Name:     "preview.TorrentCreatedEvent",
+		Payload:  []byte(`{"TorrentID":"cb84"}`),
+		Metadata: map[string]string{"correlation_id": "c0ffee"},
+		Attempts: 4,
+	}, errors.New("broker down"))
+	require.NoError(t, err)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_Publish(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec("INSERT INTO outbox (uuid, name, payload, metadata) VALUES (?, ?, ?, ?)").
+		WithArgs(sqlmock.AnyArg(), "preview.TorrentCreatedEvent", []byte(`{"TorrentID":"cb84"}`), `{}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	sqlMock.ExpectCommit()
+
+	repository := sqlite.NewOutboxRepository(db)
+	require.NoError(t, repository.Publish(context.Background(), preview.NewTorrentCreatedEvent("cb84")))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// ProcessedMessageRepository remembers the messages already handled. See dedup.Deduplicator
+type ProcessedMessageRepository struct {
+	db *sql.DB
+}
+
+func NewProcessedMessageRepository(db *sql.DB) *ProcessedMessageRepository {
+	return &ProcessedMessageRepository{db: db}
+}
+
+func (r *ProcessedMessageRepository) Processed(ctx context.Context, handler, key string) (bool, error) {
+	query := sqlbuilder.Select("COUNT(*)").From(sqlProcessedTable)
+	query.Where(
+		query.Equal("handler", handler),
+		query.Equal("message_key", key),
+		query.IsNotNull("processed_at"),
+	)
+
+	sqlRaw, args := query.Build()
+	var count int
+	if err := r.db.QueryRowContext(ctx, sqlRaw, args...).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Claim inserts the claim of the message if there is none. A claim whose lease expired, and whose
+// message was not processed, is taken over
+func (r *ProcessedMessageRepository) Claim(ctx context.Context, handler, key string, until time.Time) (bool, error) {
+	query := sqlbuilder.InsertInto(sqlProcessedTable).
+		Cols("handler", "message_key", "claimed_until").
+		Values(handler, key, until)
+	query.SQL(fmt.Sprintf(
+		"ON CONFLICT (handler, message_key) DO UPDATE SET claimed_until = excluded.claimed_until WHERE processed_at IS NULL AND claimed_until < %v",
+		query.Var(time.Now()),
+	))
+
+	sqlRaw, args := query.Build()
+	result, err := r.db.ExecContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return false, fmt.Errorf("error trying to claim the message on database: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// Renew extends the claim of a message not processed yet
+func (r *ProcessedMessageRepository) Renew(ctx context.Context, handler, key string, until time.Time) error {
+	query := sqlbuilder.Update(sqlProcessedTable)
+	query.Set(query.Assign("claimed_until", until))
+	query.Where(
+		query.Equal("handler", handler),
+		query.Equal("message_key", key),
+		query.IsNull("processed_at"),
+	)
+
+	sqlRaw, args := query.Build()
+	_, err := r.db.ExecContext(ctx, sqlRaw, args...)
+	return err
+}
+
+// Release removes the claim of a message not processed, so the next delivery handles it
+func (r *ProcessedMessageRepository) Release(ctx context.Context, handler, key string) error {
+	query := sqlbuilder.DeleteFrom(sqlProcessedTable)
+	query.Where(
+		query.Equal("handler", handler),
+		query.Equal("message_key", key),
+		query.IsNull("processed_at"),
+	)
+
+	sqlRaw, args := query.Build()
+	_, err := r.db.ExecContext(ctx, sqlRaw, args...)
+	return err
+}
+
+func (r *ProcessedMessageRepository) MarkProcessed(ctx context.Context, handler, key string) error {
+	now := time.Now()
+	sqlStructure := sqlbuilder.NewStruct(new(processedMessage))
+	query, args := sqlStructure.ReplaceInto(sqlProcessedTable, processedMessage{
+		Handler:      handler,
+		Key:          key,
+		ProcessedAt:  now,
+		ClaimedUntil: now,
+	}).Build()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error trying to persist the processed message on database: %v", err)
+	}
+	return nil
+}
+
+// Purge forgets the messages processed before the given time, and the claims expired by then
+func (r *ProcessedMessageRepository) Purge(ctx context.Context, before time.Time) error {
+	query := sqlbuilder.DeleteFrom(sqlProcessedTable)
+	query.Where(query.Or(
+		query.LessThan("processed_at", before),
+		query.And(query.IsNull("processed_at"), query.LessThan("claimed_until", before)),
+	))
+
+	sqlRaw, args := query.Build()
+	_, err := r.db.ExecContext(ctx, sqlRaw, args...)
+	return err
+}
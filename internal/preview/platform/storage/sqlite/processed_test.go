@@ -0,0 +1,114 @@
+package sqlite_test
+
+import (
+	"context"
+	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessedMessageRepository_Processed(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectQuery("SELECT COUNT(*) FROM processed_messages WHERE handler = ? AND message_key = ? AND processed_at IS NOT NULL").
+		WithArgs("downloadPartials.CommandHandler", "uuid-1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	repository := sqlite.NewProcessedMessageRepository(db)
+	processed, err := repository.Processed(context.Background(), "downloadPartials.CommandHandler", "uuid-1")
+	require.NoError(t, err)
+	assert.True(t, processed)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestProcessedMessageRepository_Claim(t *testing.T) {
+	until := time.Date(2021, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("INSERT INTO processed_messages (handler, message_key, claimed_until) VALUES (?, ?, ?) ON CONFLICT (handler, message_key) DO UPDATE SET claimed_until = excluded.claimed_until WHERE processed_at IS NULL AND claimed_until < ?").
+		WithArgs("downloadPartials.CommandHandler", "uuid-1", until, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repository := sqlite.NewProcessedMessageRepository(db)
+	claimed, err := repository.Claim(context.Background(), "downloadPartials.CommandHandler", "uuid-1", until)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestProcessedMessageRepository_Claim_AlreadyClaimed(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("INSERT INTO processed_messages (handler, message_key, claimed_until) VALUES (?, ?, ?) ON CONFLICT (handler, message_key) DO UPDATE SET claimed_until = excluded.claimed_until WHERE processed_at IS NULL AND claimed_until < ?").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repository := sqlite.NewProcessedMessageRepository(db)
+	claimed, err := repository.Claim(context.Background(), "downloadPartials.CommandHandler", "uuid-1", time.Now())
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestProcessedMessageRepository_Renew(t *testing.T) {
+	until := time.Date(2021, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("UPDATE processed_messages SET claimed_until = ? WHERE handler = ? AND message_key = ? AND processed_at IS NULL").
+		WithArgs(until, "downloadPartials.CommandHandler", "uuid-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repository := sqlite.NewProcessedMessageRepository(db)
+	require.NoError(t, repository.Renew(context.Background(), "downloadPartials.CommandHandler", "uuid-1", until))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestProcessedMessageRepository_Release(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("DELETE FROM processed_messages WHERE handler = ? AND message_key = ? AND processed_at IS NULL").
+		WithArgs("downloadPartials.CommandHandler", "uuid-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repository := sqlite.NewProcessedMessageRepository(db)
+	require.NoError(t, repository.Release(context.Background(), "downloadPartials.CommandHandler", "uuid-1"))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestProcessedMessageRepository_MarkProcessed(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("REPLACE INTO processed_messages (handler, message_key, processed_at, claimed_until) VALUES (?, ?, ?, ?)").
+		WithArgs("downloadPartials.CommandHandler", "uuid-1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repository := sqlite.NewProcessedMessageRepository(db)
+	require.NoError(t, repository.MarkProcessed(context.Background(), "downloadPartials.CommandHandler", "uuid-1"))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestProcessedMessageRepository_Purge(t *testing.T) {
+	before := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("DELETE FROM processed_messages WHERE (processed_at < ? OR (processed_at IS NULL AND claimed_until < ?))").
+		WithArgs(before, before).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	repository := sqlite.NewProcessedMessageRepository(db)
+	require.NoError(t, repository.Purge(context.Background(), before))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
@@ -0,0 +1,138 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"prevtorrent/internal/preview"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+type ProgressRepository struct {
+	db *sql.DB
+}
+
+func NewProgressRepository(db *sql.DB) *ProgressRepository {
+	return &ProgressRepository{db: db}
+}
+
+func (r *ProgressRepository) Get(ctx context.Context, torrentID string) (*preview.Progress, error) {
+	torrentID = strings.ToLower(torrentID)
+
+	sqlStructure := sqlbuilder.NewStruct(new(progress))
+	query := sqlStructure.SelectFrom(sqlProgressTable)
+	query.Where(query.Equal("torrent_id", torrentID))
+
+	sqlRaw, args := query.Build()
+	rows, err := r.db.QueryContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, preview.ErrNotFound
+	}
+
+	var p progress
+	if err := rows.Scan(sqlStructure.Addr(&p)...); err != nil {
+		return nil, err
+	}
+
+	var ranges []preview.PlannedRange
+	if err := json.Unmarshal([]byte(p.Ranges), &ranges); err != nil {
+		return nil, fmt.Errorf("unable to decode progress ranges: %v", err)
+	}
+
+	var pieces []int
+	if err := json.Unmarshal([]byte(p.Pieces), &pieces); err != nil {
+		return nil, fmt.Errorf("unable to decode progress pieces: %v", err)
+	}
+
+	var plans map[string]bool
+	if err := json.Unmarshal([]byte(p.Plans), &plans); err != nil {
+		return nil, fmt.Errorf("unable to decode progress plans: %v", err)
+	}
+
+	return preview.RestoreProgress(
+		p.TorrentID,
+		p.PieceLength,
+		ranges,
+		pieces,
+		plans,
+		preview.PeerStats{Active: p.ActivePeers, Seeders: p.Seeders},
+		p.StartedAt,
+		p.UpdatedAt,
+		p.Version,
+	), nil
+}
+
+// Persist inserts the progress the first time, and otherwise updates it only if nobody else did
+// since it was read. Returns preview.ErrConcurrentUpdate if someone did
+func (r *ProgressRepository) Persist(ctx context.Context, p *preview.Progress) error {
+	ranges, err := json.Marshal(p.Ranges())
+	if err != nil {
+		return err
+	}
+	pieces, err := json.Marshal(p.Pieces())
+	if err != nil {
+		return err
+	}
+	plans, err := json.Marshal(p.Plans())
+	if err != nil {
+		return err
+	}
+
+	row := progress{
+		TorrentID:   p.TorrentID(),
+		PieceLength: p.PieceLength(),
+		Ranges:      string(ranges),
+		Pieces:      string(pieces),
+		Plans:       string(plans),
+		ActivePeers: p.Peers().Active,
+		Seeders:     p.Peers().Seeders,
+		StartedAt:   p.StartedAt(),
+		UpdatedAt:   p.UpdatedAt(),
+		Version:     p.Version() + 1,
+	}
+
+	sqlStructure := sqlbuilder.NewStruct(new(progress))
+	var sqlRaw string
+	var args []interface{}
+	if p.Version() == 0 {
+		query := sqlStructure.InsertInto(sqlProgressTable, row)
+		query.SQL("ON CONFLICT (torrent_id) DO NOTHING")
+		sqlRaw, args = query.Build()
+	} else {
+		query := sqlStructure.Update(sqlProgressTable, row)
+		query.Where(
+			query.Equal("torrent_id", p.TorrentID()),
+			query.Equal("version", p.Version()),
+		)
+		sqlRaw, args = query.Build()
+	}
+
+	res, err := r.db.ExecContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return fmt.Errorf("error trying to persist the progress on database: %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return preview.ErrConcurrentUpdate
+	}
+	return nil
+}
+
+func (r *ProgressRepository) Reset(ctx context.Context) error {
+	sqlRaw, args := sqlbuilder.DeleteFrom(sqlProgressTable).Build()
+	if _, err := r.db.ExecContext(ctx, sqlRaw, args...); err != nil {
+		return fmt.Errorf("error trying to reset the progress on database: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressRepository_Persist(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec(
+		"INSERT INTO progress (torrent_id, piece_length, ranges, pieces, plans, active_peers, seeders, started_at, updated_at, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (torrent_id) DO NOTHING").
+		WithArgs(
+			torrentID,
+			10,
+			`[{"FileID":0,"PieceStart":0,"PieceEnd":1}]`,
+			`[1]`,
+			`{"plan-1":false}`,
+			3,
+			2,
+			startedAt,
+			startedAt.Add(time.Second),
+			1,
+		).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	progress := preview.NewProgress(torrentID)
+	progress.StartPlan("plan-1", 10, []preview.PlannedRange{{FileID: 0, PieceStart: 0, PieceEnd: 1}}, startedAt)
+	progress.CompletePiece(1, preview.PeerStats{Active: 3, Seeders: 2}, startedAt.Add(time.Second))
+
+	repository := sqlite.NewProgressRepository(db)
+	err = repository.Persist(context.Background(), progress)
+	require.NoError(t, err)
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestProgressRepository_Persist_UpdatedConcurrently(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec(
+		"UPDATE progress SET torrent_id = ?, piece_length = ?, ranges = ?, pieces = ?, plans = ?, active_peers = ?, seeders = ?, started_at = ?, updated_at = ?, version = ? WHERE torrent_id = ? AND version = ?").
+		WithArgs(torrentID, 10, `[]`, `[1]`, `{}`, 0, 0, startedAt, startedAt, 3, torrentID, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	progress := preview.RestoreProgress(torrentID, 10, nil, []int{1}, nil, preview.PeerStats{}, startedAt, startedAt, 2)
+
+	repository := sqlite.NewProgressRepository(db)
+	err = repository.Persist(context.Background(), progress)
+	require.True(t, errors.Is(err, preview.ErrConcurrentUpdate))
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestProgressRepository_Get(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"torrent_id", "piece_length", "ranges", "pieces", "plans", "active_peers", "seeders", "started_at", "updated_at", "version"}).
+		AddRow(torrentID, 10, `[{"FileID":0,"PieceStart":0,"PieceEnd":1}]`, `[1]`, `{"plan-1":false}`, 3, 2, startedAt, startedAt.Add(time.Second), 4)
+
+	sqlMock.ExpectQuery("SELECT progress.torrent_id, progress.piece_length, progress.ranges, progress.pieces, progress.plans, progress.active_peers, progress.seeders, progress.started_at, progress.updated_at, progress.version FROM progress WHERE torrent_id = ?").
+		WithArgs(torrentID).
+		WillReturnRows(rows)
+
+	repository := sqlite.NewProgressRepository(db)
+	progress, err := repository.Get(context.Background(), torrentID)
+	require.NoError(t, err)
+
+	assert.Equal(t, torrentID, progress.TorrentID())
+	assert.Equal(t, []preview.PlannedRange{{FileID: 0, PieceStart: 0, PieceEnd: 1}}, progress.Ranges())
+	assert.Equal(t, []int{1}, progress.Pieces())
+	assert.Equal(t, preview.PeerStats{Active: 3, Seeders: 2}, progress.Peers())
+	assert.Equal(t, 1, progress.PiecesLeft())
+	assert.Equal(t, 1, progress.ActivePlans())
+	assert.Equal(t, 4, progress.Version())
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestProgressRepository_Get_NotFound(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"torrent_id", "piece_length", "ranges", "pieces", "plans", "active_peers", "seeders", "started_at", "updated_at", "version"})
+
+	sqlMock.ExpectQuery("SELECT progress.torrent_id, progress.piece_length, progress.ranges, progress.pieces, progress.plans, progress.active_peers, progress.seeders, progress.started_at, progress.updated_at, progress.version FROM progress WHERE torrent_id = ?").
+		WithArgs(torrentID).
+		WillReturnRows(rows)
+
+	repository := sqlite.NewProgressRepository(db)
+	_, err = repository.Get(context.Background(), torrentID)
+	require.True(t, errors.Is(err, preview.ErrNotFound))
+}
+
+func TestProgressRepository_Reset(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("DELETE FROM progress").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	repository := sqlite.NewProgressRepository(db)
+	require.NoError(t, repository.Reset(context.Background()))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
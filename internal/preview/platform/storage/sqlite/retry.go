@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"prevtorrent/internal/preview"
+	"strings"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// noPendingRetries is how an empty list of pending downloads is stored
+const noPendingRetries = "[]"
+
+type RetryRepository struct {
+	db *sql.DB
+}
+
+func NewRetryRepository(db *sql.DB) *RetryRepository {
+	return &RetryRepository{db: db}
+}
+
+func (r *RetryRepository) Get(ctx context.Context, torrentID string) (*preview.DownloadRetry, error) {
+	torrentID = strings.ToLower(torrentID)
+
+	sqlStructure := sqlbuilder.NewStruct(new(retry))
+	query := sqlStructure.SelectFrom(sqlRetryTable)
+	query.Where(query.Equal("torrent_id", torrentID))
+
+	retries, err := r.query(ctx, sqlStructure, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(retries) == 0 {
+		return nil, preview.ErrNotFound
+	}
+	return retries[0], nil
+}
+
+func (r *RetryRepository) Due(ctx context.Context, now time.Time) ([]*preview.DownloadRetry, error) {
+	sqlStructure := sqlbuilder.NewStruct(new(retry))
+	query := sqlStructure.SelectFrom(sqlRetryTable)
+	query.Where(
+		query.LessEqualThan("next_attempt_at", now),
+		query.NotEqual("pending", noPendingRetries),
+	)
+	query.OrderBy("next_attempt_at").Asc()
+
+	return r.query(ctx, sqlStructure, query)
+}
+
+// Persist inserts the retry the first time, and otherwise updates it only if nobody else did
+// since it was read. Returns preview.ErrConcurrentUpdate if someone did
+func (r *RetryRepository) Persist(ctx context.Context, dr *preview.DownloadRetry) error {
+	pending, err := json.Marshal(dr.Pending())
+	if err != nil {
+		return err
+	}
+
+	row := retry{
+		TorrentID:     dr.TorrentID(),
+		Attempts:      dr.Attempts(),
+		NextAttemptAt: dr.NextAttemptAt(),
+		Pending:       string(pending),
+		LastError:     dr.LastError(),
+		Version:       dr.Version() + 1,
+	}
+
+	sqlStructure := sqlbuilder.NewStruct(new(retry))
+	var sqlRaw string
+	var args []interface{}
+	if dr.Version() == 0 {
+		query := sqlStructure.InsertInto(sqlRetryTable, row)
+		query.SQL("ON CONFLICT (torrent_id) DO NOTHING")
+		sqlRaw, args = query.Build()
+	} else {
+		query := sqlStructure.Update(sqlRetryTable, row)
+		query.Where(
+			query.Equal("torrent_id", dr.TorrentID()),
+			query.Equal("version", dr.Version()),
+		)
+		sqlRaw, args = query.Build()
+	}
+
+	res, err := r.db.ExecContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return fmt.Errorf("error trying to persist the retry on database: %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return preview.ErrConcurrentUpdate
+	}
+	return nil
+}
+
+func (r *RetryRepository) query(ctx context.Context, sqlStructure *sqlbuilder.Struct, query *sqlbuilder.SelectBuilder) ([]*preview.DownloadRetry, error) {
+	sqlRaw, args := query.Build()
+	rows, err := r.db.QueryContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	retries := make([]*preview.DownloadRetry, 0)
+	for rows.Next() {
+		var dr retry
+		if err := rows.Scan(sqlStructure.Addr(&dr)...); err != nil {
+			return nil, err
+		}
+
+		var pending []preview.PendingDownload
+		if err := json.Unmarshal([]byte(dr.Pending), &pending); err != nil {
+			return nil, fmt.Errorf("unable to decode pending retries: %v", err)
+		}
+
+		retries = append(retries, preview.RestoreDownloadRetry(
+			dr.TorrentID,
+			dr.Attempts,
+			dr.NextAttemptAt,
+			pending,
+			dr.LastError,
+			dr.Version,
+		))
+	}
+	return retries, rows.Err()
+}
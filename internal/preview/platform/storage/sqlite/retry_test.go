@@ -0,0 +1,121 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryRepository_Persist(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	policy := preview.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec(
+		"INSERT INTO retries (torrent_id, attempts, next_attempt_at, pending, last_error, version) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (torrent_id) DO NOTHING").
+		WithArgs(
+			torrentID,
+			1,
+			now.Add(time.Minute),
+			`[{"Segments":[{"FileID":0,"Start":0,"Length":10}],"Limits":{"MaxDownloadTime":60000000000,"SeederWaitTime":0,"Deadline":"2021-03-01T11:00:00Z"},"Force":true}]`,
+			"no seeders",
+			1,
+		).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	retry := preview.NewDownloadRetry(torrentID)
+	download := preview.PendingDownload{
+		Segments: []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}},
+		Limits:   preview.DownloadLimits{MaxDownloadTime: time.Minute, Deadline: now.Add(time.Hour)},
+		Force:    true,
+	}
+	err = retry.Schedule(download, errors.New("no seeders"), policy, now)
+	require.NoError(t, err)
+
+	repository := sqlite.NewRetryRepository(db)
+	err = repository.Persist(context.Background(), retry)
+	require.NoError(t, err)
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestRetryRepository_Persist_UpdatedConcurrently(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec(
+		"UPDATE retries SET torrent_id = ?, attempts = ?, next_attempt_at = ?, pending = ?, last_error = ?, version = ? WHERE torrent_id = ? AND version = ?").
+		WithArgs(torrentID, 1, now, "[]", "no seeders", 4, torrentID, 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	retry := preview.RestoreDownloadRetry(torrentID, 1, now, []preview.PendingDownload{{Segments: []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}}}}, "no seeders", 3)
+	retry.Release()
+
+	repository := sqlite.NewRetryRepository(db)
+	err = repository.Persist(context.Background(), retry)
+	require.True(t, errors.Is(err, preview.ErrConcurrentUpdate))
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestRetryRepository_Due(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"torrent_id", "attempts", "next_attempt_at", "pending", "last_error", "version"}).
+		AddRow(torrentID, 2, now, `[{"Segments":[{"FileID":0,"Start":0,"Length":10}],"Limits":{"MaxDownloadTime":0,"SeederWaitTime":0,"Deadline":"2021-03-01T11:00:00Z"},"Force":true}]`, "no seeders", 2)
+
+	sqlMock.ExpectQuery("SELECT retries.torrent_id, retries.attempts, retries.next_attempt_at, retries.pending, retries.last_error, retries.version FROM retries WHERE next_attempt_at <= ? AND pending <> ? ORDER BY next_attempt_at ASC").
+		WithArgs(now, "[]").
+		WillReturnRows(rows)
+
+	repository := sqlite.NewRetryRepository(db)
+	retries, err := repository.Due(context.Background(), now)
+	require.NoError(t, err)
+
+	require.Len(t, retries, 1)
+	assert.Equal(t, torrentID, retries[0].TorrentID())
+	assert.Equal(t, 2, retries[0].Attempts())
+	assert.Equal(t, []preview.PendingDownload{{
+		Segments: []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}},
+		Limits:   preview.DownloadLimits{Deadline: now.Add(time.Hour)},
+		Force:    true,
+	}}, retries[0].Pending())
+	assert.True(t, retries[0].IsDue(now))
+	assert.Equal(t, 2, retries[0].Version())
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestRetryRepository_Get_NotFound(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectQuery("SELECT retries.torrent_id, retries.attempts, retries.next_attempt_at, retries.pending, retries.last_error, retries.version FROM retries WHERE torrent_id = ?").
+		WithArgs(torrentID).
+		WillReturnRows(sqlmock.NewRows([]string{"torrent_id", "attempts", "next_attempt_at", "pending", "last_error", "version"}))
+
+	repository := sqlite.NewRetryRepository(db)
+	_, err = repository.Get(context.Background(), torrentID)
+	require.True(t, errors.Is(err, preview.ErrNotFound))
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"prevtorrent/internal/preview"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+type SagaRepository struct {
+	db *sql.DB
+}
+
+func NewSagaRepository(db *sql.DB) *SagaRepository {
+	return &SagaRepository{db: db}
+}
+
+func (r *SagaRepository) Get(ctx context.Context, torrentID string) (*preview.PreviewSaga, error) {
+	torrentID = strings.ToLower(torrentID)
+
+	sqlStructure := sqlbuilder.NewStruct(new(saga))
+	query := sqlStructure.SelectFrom(sqlSagaTable)
+	query.Where(query.Equal("torrent_id", torrentID))
+
+	sqlRaw, args := query.Build()
+	rows, err := r.db.QueryContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, preview.ErrNotFound
+	}
+
+	var s saga
+	if err := rows.Scan(sqlStructure.Addr(&s)...); err != nil {
+		return nil, err
+	}
+
+	return preview.RestorePreviewSaga(
+		s.TorrentID,
+		s.Parts,
+		s.Succeeded,
+		s.Failed,
+		s.LastError,
+		s.StartedAt,
+		s.FinishedAt,
+		s.Version,
+	), nil
+}
+
+// Persist inserts the saga of the torrent when a new one is started, and otherwise updates it
+// only if nobody else did since it was read
+func (r *SagaRepository) Persist(ctx context.Context, ps *preview.PreviewSaga, events ...interface{}) error {
+	row := saga{
+		TorrentID:  ps.TorrentID(),
+		Parts:      ps.Parts(),
+		Succeeded:  ps.Succeeded(),
+		Failed:     ps.Failed(),
+		LastError:  ps.LastError(),
+		StartedAt:  ps.StartedAt(),
+		FinishedAt: ps.FinishedAt(),
+		Version:    ps.Version() + 1,
+	}
+
+	sqlStructure := sqlbuilder.NewStruct(new(saga))
+	var sqlRaw string
+	var args []interface{}
+	if ps.Version() == 0 {
+		query := sqlStructure.InsertInto(sqlSagaTable, row)
+		query.SQL("ON CONFLICT (torrent_id) DO NOTHING")
+		sqlRaw, args = query.Build()
+	} else {
+		query := sqlStructure.Update(sqlSagaTable, row)
+		query.Where(
+			query.Equal("torrent_id", ps.TorrentID()),
+			query.Equal("version", ps.Version()),
+		)
+		sqlRaw, args = query.Build()
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(sqlRaw, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error trying to persist the saga on database: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		_ = tx.Rollback()
+		if err != nil {
+			return err
+		}
+		return preview.ErrConcurrentUpdate
+	}
+	if err := storeEvents(ctx, tx, events); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
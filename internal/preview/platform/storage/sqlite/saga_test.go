@@ -0,0 +1,92 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSagaRepository_Persist_Starts(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec("INSERT INTO sagas (torrent_id, parts, succeeded, failed, last_error, started_at, finished_at, version) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (torrent_id) DO NOTHING").
+		WithArgs(torrentID, 2, 0, 0, "", startedAt, time.Time{}, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+
+	repository := sqlite.NewSagaRepository(db)
+	err = repository.Persist(context.Background(), preview.StartPreviewSaga(torrentID, 2, startedAt))
+	require.NoError(t, err)
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestSagaRepository_Persist_StartedConcurrently(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec("INSERT INTO sagas (torrent_id, parts, succeeded, failed, last_error, started_at, finished_at, version) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (torrent_id) DO NOTHING").
+		WithArgs(torrentID, 2, 0, 0, "", startedAt, time.Time{}, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	sqlMock.ExpectRollback()
+
+	repository := sqlite.NewSagaRepository(db)
+	err = repository.Persist(context.Background(), preview.StartPreviewSaga(torrentID, 2, startedAt))
+	assert.True(t, errors.Is(err, preview.ErrConcurrentUpdate))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestSagaRepository_Persist_DetectsConcurrentUpdates(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	finishedAt := startedAt.Add(time.Minute)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec("UPDATE sagas SET torrent_id = ?, parts = ?, succeeded = ?, failed = ?, last_error = ?, "+
+		"started_at = ?, finished_at = ?, version = ? WHERE torrent_id = ? AND version = ?").
+		WithArgs(torrentID, 1, 1, 0, "", startedAt, finishedAt, 4, torrentID, 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	sqlMock.ExpectRollback()
+
+	saga := preview.RestorePreviewSaga(torrentID, 1, 0, 0, "", startedAt, time.Time{}, 3)
+	require.NoError(t, saga.PartSucceeded(finishedAt))
+
+	repository := sqlite.NewSagaRepository(db)
+	err = repository.Persist(context.Background(), saga, saga.Outcome(1))
+	assert.True(t, errors.Is(err, preview.ErrConcurrentUpdate))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestSagaRepository_Get_NotFound(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectQuery("SELECT sagas.torrent_id, sagas.parts, sagas.succeeded, sagas.failed, sagas.last_error, " +
+		"sagas.started_at, sagas.finished_at, sagas.version FROM sagas WHERE torrent_id = ?").
+		WithArgs("cb84").
+		WillReturnRows(sqlmock.NewRows([]string{"torrent_id"}))
+
+	repository := sqlite.NewSagaRepository(db)
+	_, err = repository.Get(context.Background(), "cb84")
+	assert.True(t, errors.Is(err, preview.ErrNotFound))
+}
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// schemaTables are the tables created by infrastructure/database/sqlite.schema.sql
+var schemaTables = []string{
+	sqlTorrentTable,
+	sqlFileTable,
+	sqlMediaTable,
+	sqlProgressTable,
+	sqlRetryTable,
+	sqlClipTable,
+	"queue_messages",
+	"queue_consumer_groups",
+	"queue_deliveries",
+	sqlOutboxTable,
+	sqlDeadLetterTable,
+	sqlProcessedTable,
+	sqlSagaTable,
+	sqlWebhookTable,
+	sqlDeliveryTable,
+	sqlEventLogTable,
+	sqlStatsTable,
+}
+
+// CheckSchema returns an error naming the tables of the schema missing in the database
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	query := sqlbuilder.Select("name").From("sqlite_master")
+	query.Where(query.Equal("type", "table"))
+
+	sqlRaw, args := query.Build()
+	rows, err := db.QueryContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	missing := make([]string, 0)
+	for _, table := range schemaTables {
+		if !existing[table] {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing tables: %v. Create them with infrastructure/database/sqlite.schema.sql", strings.Join(missing, ", "))
+	}
+	return nil
+}
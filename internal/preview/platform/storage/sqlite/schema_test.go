@@ -0,0 +1,44 @@
+package sqlite_test
+
+import (
+	"context"
+	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSchema(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"name"})
+	for _, table := range []string{
+		"torrents", "files", "media", "progress", "retries", "clips", "queue_messages", "queue_consumer_groups",
+		"queue_deliveries", "outbox", "outbox_dead_letters", "processed_messages", "sagas", "webhooks", "webhook_deliveries", "event_log",
+		"stats", "sqlite_sequence",
+	} {
+		rows.AddRow(table)
+	}
+	sqlMock.ExpectQuery("SELECT name FROM sqlite_master WHERE type = ?").
+		WithArgs("table").
+		WillReturnRows(rows)
+
+	require.NoError(t, sqlite.CheckSchema(context.Background(), db))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestCheckSchema_MissingTables(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectQuery("SELECT name FROM sqlite_master WHERE type = ?").
+		WithArgs("table").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("torrents"))
+
+	err = sqlite.CheckSchema(context.Background(), db)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "missing tables: files, media")
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
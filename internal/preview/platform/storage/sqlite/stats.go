@@ -0,0 +1,60 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"prevtorrent/internal/preview"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+type StatsRepository struct {
+	db *sql.DB
+}
+
+func NewStatsRepository(db *sql.DB) *StatsRepository {
+	return &StatsRepository{db: db}
+}
+
+func (r *StatsRepository) Get(ctx context.Context) (*preview.Stats, error) {
+	sqlStructure := sqlbuilder.NewStruct(new(statsCounter))
+	sqlRaw, args := sqlStructure.SelectFrom(sqlStatsTable).Build()
+
+	rows, err := r.db.QueryContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counters := make(map[preview.Counter]int)
+	for rows.Next() {
+		var c statsCounter
+		if err := rows.Scan(sqlStructure.Addr(&c)...); err != nil {
+			return nil, err
+		}
+		counters[preview.Counter(c.Counter)] = c.Value
+	}
+	return preview.RestoreStats(counters), rows.Err()
+}
+
+func (r *StatsRepository) Increment(ctx context.Context, counter preview.Counter) error {
+	query := sqlbuilder.InsertInto(sqlStatsTable)
+	query.Cols("counter", "value")
+	query.Values(string(counter), 1)
+	query.SQL("ON CONFLICT (counter) DO UPDATE SET value = value + 1")
+
+	sqlRaw, args := query.Build()
+	if _, err := r.db.ExecContext(ctx, sqlRaw, args...); err != nil {
+		return fmt.Errorf("error trying to increment the counter %v on database: %v", counter, err)
+	}
+	return nil
+}
+
+func (r *StatsRepository) Reset(ctx context.Context) error {
+	sqlRaw, args := sqlbuilder.DeleteFrom(sqlStatsTable).Build()
+	if _, err := r.db.ExecContext(ctx, sqlRaw, args...); err != nil {
+		return fmt.Errorf("error trying to reset the stats on database: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package sqlite_test
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsRepository_Get(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"counter", "value"}).
+		AddRow("torrents", 12).
+		AddRow("images", 30)
+	sqlMock.ExpectQuery("SELECT stats.counter, stats.value FROM stats").
+		WillReturnRows(rows)
+
+	repository := sqlite.NewStatsRepository(db)
+	stats, err := repository.Get(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 12, stats.Count(preview.CounterTorrents))
+	assert.Equal(t, 30, stats.Count(preview.CounterImages))
+	assert.Equal(t, 0, stats.Count(preview.CounterPreviewsFailed))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestStatsRepository_Increment(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("INSERT INTO stats (counter, value) VALUES (?, ?) ON CONFLICT (counter) DO UPDATE SET value = value + 1").
+		WithArgs("images", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repository := sqlite.NewStatsRepository(db)
+	require.NoError(t, repository.Increment(context.Background(), preview.CounterImages))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
@@ -1,9 +1,22 @@
 package sqlite
 
+import "time"
+
 const (
-	sqlTorrentTable = "torrents"
-	sqlFileTable    = "files"
-	sqlMediaTable   = "media"
+	sqlTorrentTable    = "torrents"
+	sqlFileTable       = "files"
+	sqlMediaTable      = "media"
+	sqlProgressTable   = "progress"
+	sqlRetryTable      = "retries"
+	sqlClipTable       = "clips"
+	sqlOutboxTable     = "outbox"
+	sqlDeadLetterTable = "outbox_dead_letters"
+	sqlProcessedTable  = "processed_messages"
+	sqlSagaTable       = "sagas"
+	sqlWebhookTable    = "webhooks"
+	sqlDeliveryTable   = "webhook_deliveries"
+	sqlEventLogTable   = "event_log"
+	sqlStatsTable      = "stats"
 )
 
 type torrent struct {
@@ -12,6 +25,8 @@ type torrent struct {
 	Length      int    `db:"length"`
 	PieceLength int    `db:"pieceLength"`
 	Raw         []byte `db:"raw"`
+	Status      string `db:"status"`
+	LastError   string `db:"last_error"`
 }
 
 type file struct {
@@ -27,3 +42,97 @@ type media struct {
 	Name      string `db:"name"`
 	Length    int    `db:"length"`
 }
+
+type clip struct {
+	TorrentID string `db:"torrent_id"`
+	FileID    int    `db:"file_id"`
+	Name      string `db:"name"`
+	Duration  int    `db:"duration"` // in milliseconds
+	Length    int    `db:"length"`
+}
+
+type progress struct {
+	TorrentID   string    `db:"torrent_id"`
+	PieceLength int       `db:"piece_length"`
+	Ranges      string    `db:"ranges"`
+	Pieces      string    `db:"pieces"`
+	Plans       string    `db:"plans"`
+	ActivePeers int       `db:"active_peers"`
+	Seeders     int       `db:"seeders"`
+	StartedAt   time.Time `db:"started_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+	Version     int       `db:"version"`
+}
+
+type retry struct {
+	TorrentID     string    `db:"torrent_id"`
+	Attempts      int       `db:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	Pending       string    `db:"pending"`
+	LastError     string    `db:"last_error"`
+	Version       int       `db:"version"`
+}
+
+type outboxMessage struct {
+	ID       int64  `db:"id"`
+	UUID     string `db:"uuid"`
+	Name     string `db:"name"`
+	Payload  []byte `db:"payload"`
+	Metadata string `db:"metadata"`
+	Attempts int    `db:"attempts"`
+}
+
+type processedMessage struct {
+	Handler      string    `db:"handler"`
+	Key          string    `db:"message_key"`
+	ProcessedAt  time.Time `db:"processed_at"`
+	ClaimedUntil time.Time `db:"claimed_until"`
+}
+
+type saga struct {
+	TorrentID  string    `db:"torrent_id"`
+	Parts      int       `db:"parts"`
+	Succeeded  int       `db:"succeeded"`
+	Failed     int       `db:"failed"`
+	LastError  string    `db:"last_error"`
+	StartedAt  time.Time `db:"started_at"`
+	FinishedAt time.Time `db:"finished_at"`
+	Version    int       `db:"version"`
+}
+
+type webhook struct {
+	ID        string    `db:"id"`
+	URL       string    `db:"url"`
+	Secret    string    `db:"secret"`
+	TorrentID string    `db:"torrent_id"`
+	Events    string    `db:"events"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type webhookDelivery struct {
+	ID             string    `db:"id"`
+	WebhookID      string    `db:"webhook_id"`
+	Event          string    `db:"event"`
+	TorrentID      string    `db:"torrent_id"`
+	Payload        []byte    `db:"payload"`
+	Status         string    `db:"status"`
+	Attempts       int       `db:"attempts"`
+	NextAttemptAt  time.Time `db:"next_attempt_at"`
+	ResponseStatus int       `db:"response_status"`
+	LastError      string    `db:"last_error"`
+	CreatedAt      time.Time `db:"created_at"`
+	DeliveredAt    time.Time `db:"delivered_at"`
+}
+
+type eventLogRecord struct {
+	ID         int64     `db:"id"`
+	UUID       string    `db:"uuid"`
+	Name       string    `db:"name"`
+	Payload    []byte    `db:"payload"`
+	RecordedAt time.Time `db:"recorded_at"`
+}
+
+type statsCounter struct {
+	Counter string `db:"counter"`
+	Value   int    `db:"value"`
+}
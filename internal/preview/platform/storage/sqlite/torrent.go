@@ -20,7 +20,7 @@ func NewTorrentRepository(db *sql.DB) *TorrentRepository {
 	return &TorrentRepository{db: db}
 }
 
-func (r *TorrentRepository) Persist(ctx context.Context, t preview.Torrent) error {
+func (r *TorrentRepository) Persist(ctx context.Context, t preview.Torrent, events ...interface{}) error {
 	torrentSQLStruct := sqlbuilder.NewStruct(new(torrent))
 	query, args := torrentSQLStruct.InsertInto(sqlTorrentTable, torrent{
 		ID:          t.ID(),
@@ -28,6 +28,8 @@ func (r *TorrentRepository) Persist(ctx context.Context, t preview.Torrent) erro
 		Length:      t.TotalLength(),
 		PieceLength: t.PieceLength(),
 		Raw:         t.Raw(),
+		Status:      t.Status().String(),
+		LastError:   t.LastError(),
 	}).Build()
 
 	tx, err := r.db.BeginTx(ctx, nil)
@@ -44,6 +46,10 @@ func (r *TorrentRepository) Persist(ctx context.Context, t preview.Torrent) erro
 		_ = tx.Rollback()
 		return err
 	}
+	if err := storeEvents(ctx, tx, events); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
 	return tx.Commit()
 }
 
@@ -93,7 +99,140 @@ func (r *TorrentRepository) Get(ctx context.Context, id string) (preview.Torrent
 		return preview.Torrent{}, err
 	}
 
-	return preview.NewInfo(id, t.Name, t.PieceLength, files, t.Raw)
+	info, err := preview.NewInfo(id, t.Name, t.PieceLength, files, t.Raw)
+	if err != nil {
+		return preview.Torrent{}, err
+	}
+
+	status, err := preview.NewStatus(t.Status)
+	if err != nil {
+		return preview.Torrent{}, err
+	}
+	info.RestoreStatus(status, t.LastError)
+
+	return info, nil
+}
+
+func (r *TorrentRepository) UpdateStatus(ctx context.Context, t preview.Torrent) error {
+	query := sqlbuilder.Update(sqlTorrentTable)
+	query.Set(
+		query.Assign("status", t.Status().String()),
+		query.Assign("last_error", t.LastError()),
+	)
+	query.Where(query.Equal("id", t.ID()))
+
+	sqlRaw, args := query.Build()
+	if _, err := r.db.ExecContext(ctx, sqlRaw, args...); err != nil {
+		return fmt.Errorf("error trying to update the torrent status on database: %v", err)
+	}
+	return nil
+}
+
+func (r *TorrentRepository) UpdateStatusFrom(ctx context.Context, t preview.Torrent, from preview.Status, events ...interface{}) error {
+	query := sqlbuilder.Update(sqlTorrentTable)
+	query.Set(
+		query.Assign("status", t.Status().String()),
+		query.Assign("last_error", t.LastError()),
+	)
+	query.Where(query.Equal("id", t.ID()), query.Equal("status", from.String()))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	sqlRaw, args := query.Build()
+	res, err := tx.Exec(sqlRaw, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error trying to update the torrent status on database: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		_ = tx.Rollback()
+		if err != nil {
+			return err
+		}
+		return preview.ErrConcurrentUpdate
+	}
+
+	if err := storeEvents(ctx, tx, events); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// torrentTables are the tables with rows of a torrent, in the order they are deleted. The torrent goes last
+var torrentTables = []string{
+	sqlMediaTable,
+	sqlClipTable,
+	sqlProgressTable,
+	sqlRetryTable,
+	sqlSagaTable,
+	sqlDeliveryTable,
+	sqlFileTable,
+}
+
+// torrentEventTables are the tables with the events of a torrent, which only have its ID in their JSON
+// payload. Their payloads are stored as blobs, which json_extract would read as JSONB
+var torrentEventTables = []string{
+	sqlOutboxTable,
+	sqlDeadLetterTable,
+	sqlEventLogTable,
+}
+
+func (r *TorrentRepository) Delete(ctx context.Context, id string, events ...interface{}) error {
+	id = strings.ToLower(id)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range torrentTables {
+		query := sqlbuilder.DeleteFrom(table)
+		query.Where(query.Equal("torrent_id", id))
+
+		sqlRaw, args := query.Build()
+		if _, err := tx.Exec(sqlRaw, args...); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error trying to delete the torrent from %s: %v", table, err)
+		}
+	}
+
+	// Nothing about the torrent is kept, nor published, except for the events given
+	for _, table := range torrentEventTables {
+		query := sqlbuilder.DeleteFrom(table)
+		query.Where(query.Equal("json_extract(CAST(payload AS TEXT), '$.TorrentID')", id))
+
+		sqlRaw, args := query.Build()
+		if _, err := tx.Exec(sqlRaw, args...); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error trying to delete the events of the torrent from %s: %v", table, err)
+		}
+	}
+
+	query := sqlbuilder.DeleteFrom(sqlTorrentTable)
+	query.Where(query.Equal("id", id))
+	sqlRaw, args := query.Build()
+	res, err := tx.Exec(sqlRaw, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error trying to delete the torrent: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		_ = tx.Rollback()
+		if err != nil {
+			return err
+		}
+		return preview.ErrNotFound
+	}
+
+	if err := storeEvents(ctx, tx, events); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
 func (r *TorrentRepository) readFiles(ctx context.Context, id string) ([]preview.File, error) {
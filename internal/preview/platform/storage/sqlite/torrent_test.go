@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql/driver"
 	"errors"
+	"prevtorrent/internal/platform/tracing"
 	"prevtorrent/internal/preview"
 	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,8 +35,8 @@ func TestNewTorrentRepository_StoreTorrentAndImages(t *testing.T) {
 
 	sqlMock.ExpectBegin()
 	sqlMock.ExpectExec(
-		"INSERT INTO torrents (id, name, length, pieceLength, raw) VALUES (?, ?, ?, ?, ?)").
-		WithArgs(torrentID, name, length, pieceLength, raw).
+		"INSERT INTO torrents (id, name, length, pieceLength, raw, status, last_error) VALUES (?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(torrentID, name, length, pieceLength, raw, "resolving", "").
 		WillReturnResult(driver.ResultNoRows)
 
 	sqlMock.ExpectExec(
@@ -77,8 +79,8 @@ func TestNewTorrentRepository_ErrorOnPersist(t *testing.T) {
 
 	sqlMock.ExpectBegin()
 	sqlMock.ExpectExec(
-		"INSERT INTO torrents (id, name, length, pieceLength, raw) VALUES (?, ?, ?, ?, ?)").
-		WithArgs(torrentID, name, length, pieceLength, raw).
+		"INSERT INTO torrents (id, name, length, pieceLength, raw, status, last_error) VALUES (?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(torrentID, name, length, pieceLength, raw, "resolving", "").
 		WillReturnError(errors.New("fake error at insert"))
 	sqlMock.ExpectRollback()
 
@@ -92,13 +94,46 @@ func TestNewTorrentRepository_ErrorOnPersist(t *testing.T) {
 	require.NoError(t, sqlMock.ExpectationsWereMet())
 }
 
+func TestTorrentRepository_Persist_StoresTheEventsInTheSameTransaction(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	raw := []byte("1234")
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(
+		"INSERT INTO torrents (id, name, length, pieceLength, raw, status, last_error) VALUES (?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(torrentID, "Torrent Example", 0, 10, raw, "resolving", "").
+		WillReturnResult(driver.ResultNoRows)
+	sqlMock.ExpectExec("INSERT INTO outbox (uuid, name, payload, metadata) VALUES (?, ?, ?, ?)").
+		WithArgs(
+			sqlmock.AnyArg(),
+			"preview.TorrentCreatedEvent",
+			[]byte(`{"TorrentID":"cb84ccc10f296df72d6c40ba7a07c178a4323a14"}`),
+			`{"correlation_id":"c0ffee"}`,
+		).
+		WillReturnError(errors.New("fake error at insert"))
+	sqlMock.ExpectRollback()
+
+	repository := sqlite.NewTorrentRepository(db)
+	torrent, err := preview.NewInfo(torrentID, "Torrent Example", 10, nil, raw)
+	require.NoError(t, err)
+
+	ctx := tracing.WithCorrelationID(context.Background(), "c0ffee")
+	err = repository.Persist(ctx, torrent, preview.NewTorrentCreatedEvent(torrentID))
+	require.Error(t, err)
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
 func TestTorrentRepository_Get_ErrorOnRead(t *testing.T) {
 	torrentID := "1234"
 
 	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	require.NoError(t, err)
 
-	sqlMock.ExpectQuery("SELECT torrents.id, torrents.name, torrents.length, torrents.pieceLength, torrents.raw FROM torrents WHERE id = ?").
+	sqlMock.ExpectQuery("SELECT torrents.id, torrents.name, torrents.length, torrents.pieceLength, torrents.raw, torrents.status, torrents.last_error FROM torrents WHERE id = ?").
 		WithArgs(torrentID).
 		WillReturnError(errors.New("fake error"))
 
@@ -119,10 +154,10 @@ func TestTorrentRepository_Get(t *testing.T) {
 	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	require.NoError(t, err)
 
-	rows := sqlmock.NewRows([]string{"id", "name", "length", "pieceLength", "raw"}).
-		AddRow(torrentID, torrentName, torrentLength, torrentPieceLength, torrentRaw)
+	rows := sqlmock.NewRows([]string{"id", "name", "length", "pieceLength", "raw", "status", "last_error"}).
+		AddRow(torrentID, torrentName, torrentLength, torrentPieceLength, torrentRaw, "no_seeders", "no seeders")
 
-	sqlMock.ExpectQuery("SELECT torrents.id, torrents.name, torrents.length, torrents.pieceLength, torrents.raw FROM torrents WHERE id = ?").
+	sqlMock.ExpectQuery("SELECT torrents.id, torrents.name, torrents.length, torrents.pieceLength, torrents.raw, torrents.status, torrents.last_error FROM torrents WHERE id = ?").
 		WithArgs(torrentID).
 		WillReturnRows(rows)
 
@@ -144,6 +179,8 @@ func TestTorrentRepository_Get(t *testing.T) {
 	assert.Equal(t, torrentLength, torrent.TotalLength())
 	assert.Equal(t, torrentPieceLength, torrent.PieceLength())
 	assert.Equal(t, torrentRaw, torrent.Raw())
+	assert.Equal(t, preview.StatusNoSeeders, torrent.Status())
+	assert.Equal(t, "no seeders", torrent.LastError())
 
 	require.Len(t, torrent.Files(), 2)
 
@@ -165,10 +202,10 @@ func TestTorrentRepository_Get_ErrorReadingFiles(t *testing.T) {
 	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	require.NoError(t, err)
 
-	rows := sqlmock.NewRows([]string{"id", "name", "length", "pieceLength", "raw"}).
-		AddRow(torrentID, torrentName, torrentLength, torrentPieceLength, torrentRaw)
+	rows := sqlmock.NewRows([]string{"id", "name", "length", "pieceLength", "raw", "status", "last_error"}).
+		AddRow(torrentID, torrentName, torrentLength, torrentPieceLength, torrentRaw, "no_seeders", "no seeders")
 
-	sqlMock.ExpectQuery("SELECT torrents.id, torrents.name, torrents.length, torrents.pieceLength, torrents.raw FROM torrents WHERE id = ?").
+	sqlMock.ExpectQuery("SELECT torrents.id, torrents.name, torrents.length, torrents.pieceLength, torrents.raw, torrents.status, torrents.last_error FROM torrents WHERE id = ?").
 		WithArgs(torrentID).
 		WillReturnRows(rows)
 
@@ -181,3 +218,141 @@ func TestTorrentRepository_Get_ErrorReadingFiles(t *testing.T) {
 	_, err = repository.Get(context.Background(), torrentID)
 	require.Error(t, err)
 }
+
+func TestTorrentRepository_UpdateStatus(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f1, err := preview.NewFileInfo(0, 100, "img.jpg")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "Torrent Example", 10, []preview.File{f1}, []byte("1234"))
+	require.NoError(t, err)
+	require.NoError(t, torrent.ChangeStatus(preview.StatusFailed, errors.New("fake error")))
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("UPDATE torrents SET status = ?, last_error = ? WHERE id = ?").
+		WithArgs("failed", "fake error", torrentID).
+		WillReturnResult(driver.RowsAffected(1))
+
+	repository := sqlite.NewTorrentRepository(db)
+	err = repository.UpdateStatus(context.Background(), torrent)
+	require.NoError(t, err)
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestTorrentRepository_UpdateStatusFrom(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f1, err := preview.NewFileInfo(0, 100, "img.jpg")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "Torrent Example", 10, []preview.File{f1}, []byte("1234"))
+	require.NoError(t, err)
+	torrent.RestoreStatus(preview.StatusCompleted, "")
+	require.NoError(t, torrent.Reprocess(false))
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec("UPDATE torrents SET status = ?, last_error = ? WHERE id = ? AND status = ?").
+		WithArgs("planned", "", torrentID, "completed").
+		WillReturnResult(driver.RowsAffected(1))
+	sqlMock.ExpectExec("INSERT INTO outbox (uuid, name, payload, metadata) VALUES (?, ?, ?, ?)").
+		WithArgs(sqlmock.AnyArg(), "preview.TorrentReprocessRequestedEvent", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	sqlMock.ExpectCommit()
+
+	repository := sqlite.NewTorrentRepository(db)
+	err = repository.UpdateStatusFrom(context.Background(), torrent, preview.StatusCompleted, &preview.TorrentReprocessRequestedEvent{TorrentID: torrentID})
+	require.NoError(t, err)
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestTorrentRepository_UpdateStatusFrom_StatusChanged(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f1, err := preview.NewFileInfo(0, 100, "img.jpg")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "Torrent Example", 10, []preview.File{f1}, []byte("1234"))
+	require.NoError(t, err)
+	torrent.RestoreStatus(preview.StatusPlanned, "")
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec("UPDATE torrents SET status = ?, last_error = ? WHERE id = ? AND status = ?").
+		WithArgs("planned", "", torrentID, "completed").
+		WillReturnResult(driver.RowsAffected(0))
+	sqlMock.ExpectRollback()
+
+	repository := sqlite.NewTorrentRepository(db)
+	err = repository.UpdateStatusFrom(context.Background(), torrent, preview.StatusCompleted, &preview.TorrentReprocessRequestedEvent{TorrentID: torrentID})
+	require.True(t, errors.Is(err, preview.ErrConcurrentUpdate))
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestTorrentRepository_Delete(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	for _, table := range []string{"media", "clips", "progress", "retries", "sagas", "webhook_deliveries", "files"} {
+		sqlMock.ExpectExec("DELETE FROM " + table + " WHERE torrent_id = ?").
+			WithArgs(torrentID).
+			WillReturnResult(driver.RowsAffected(2))
+	}
+	for _, table := range []string{"outbox", "outbox_dead_letters", "event_log"} {
+		sqlMock.ExpectExec("DELETE FROM " + table + " WHERE json_extract(CAST(payload AS TEXT), '$.TorrentID') = ?").
+			WithArgs(torrentID).
+			WillReturnResult(driver.RowsAffected(2))
+	}
+	sqlMock.ExpectExec("DELETE FROM torrents WHERE id = ?").
+		WithArgs(torrentID).
+		WillReturnResult(driver.RowsAffected(1))
+	sqlMock.ExpectExec("INSERT INTO outbox (uuid, name, payload, metadata) VALUES (?, ?, ?, ?)").
+		WithArgs(sqlmock.AnyArg(), "preview.TorrentDeletedEvent", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	sqlMock.ExpectCommit()
+
+	repository := sqlite.NewTorrentRepository(db)
+	err = repository.Delete(context.Background(), strings.ToUpper(torrentID), &preview.TorrentDeletedEvent{TorrentID: torrentID})
+	require.NoError(t, err)
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestTorrentRepository_Delete_NotFound(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	for _, table := range []string{"media", "clips", "progress", "retries", "sagas", "webhook_deliveries", "files"} {
+		sqlMock.ExpectExec("DELETE FROM " + table + " WHERE torrent_id = ?").
+			WithArgs(torrentID).
+			WillReturnResult(driver.RowsAffected(0))
+	}
+	for _, table := range []string{"outbox", "outbox_dead_letters", "event_log"} {
+		sqlMock.ExpectExec("DELETE FROM " + table + " WHERE json_extract(CAST(payload AS TEXT), '$.TorrentID') = ?").
+			WithArgs(torrentID).
+			WillReturnResult(driver.RowsAffected(0))
+	}
+	sqlMock.ExpectExec("DELETE FROM torrents WHERE id = ?").
+		WithArgs(torrentID).
+		WillReturnResult(driver.RowsAffected(0))
+	sqlMock.ExpectRollback()
+
+	repository := sqlite.NewTorrentRepository(db)
+	err = repository.Delete(context.Background(), torrentID, &preview.TorrentDeletedEvent{TorrentID: torrentID})
+	require.True(t, errors.Is(err, preview.ErrNotFound))
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
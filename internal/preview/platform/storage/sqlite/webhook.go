@@ -0,0 +1,147 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"prevtorrent/internal/preview"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+func (r *WebhookRepository) Get(ctx context.Context, id string) (*preview.Webhook, error) {
+	sqlStructure := sqlbuilder.NewStruct(new(webhook))
+	query := sqlStructure.SelectFrom(sqlWebhookTable)
+	query.Where(query.Equal("id", id))
+
+	webhooks, err := r.query(ctx, sqlStructure, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, preview.ErrNotFound
+	}
+	return webhooks[0], nil
+}
+
+func (r *WebhookRepository) Persist(ctx context.Context, w *preview.Webhook) error {
+	events, err := json.Marshal(w.Events())
+	if err != nil {
+		return err
+	}
+
+	sqlStructure := sqlbuilder.NewStruct(new(webhook))
+	query, args := sqlStructure.ReplaceInto(sqlWebhookTable, webhook{
+		ID:        w.ID(),
+		URL:       w.URL(),
+		Secret:    w.Secret(),
+		TorrentID: w.TorrentID(),
+		Events:    string(events),
+		CreatedAt: w.CreatedAt(),
+	}).Build()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("error trying to persist the webhook on database: %v", err)
+	}
+	return nil
+}
+
+// Delete removes the webhook and its deliveries in the same transaction. It returns ErrNotFound
+// if there was no such webhook
+func (r *WebhookRepository) Delete(ctx context.Context, id string) error {
+	deliveries := sqlbuilder.DeleteFrom(sqlDeliveryTable)
+	deliveries.Where(deliveries.Equal("webhook_id", id))
+	deliveriesRaw, deliveriesArgs := deliveries.Build()
+
+	hook := sqlbuilder.DeleteFrom(sqlWebhookTable)
+	hook.Where(hook.Equal("id", id))
+	hookRaw, hookArgs := hook.Build()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(deliveriesRaw, deliveriesArgs...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	res, err := tx.Exec(hookRaw, hookArgs...)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		_ = tx.Rollback()
+		if err != nil {
+			return err
+		}
+		return preview.ErrNotFound
+	}
+	return tx.Commit()
+}
+
+// Subscribed reads the webhooks of the torrent and the ones of every torrent. The events are
+// filtered once read, since they are stored as a list
+func (r *WebhookRepository) Subscribed(ctx context.Context, event string, torrentID string) ([]*preview.Webhook, error) {
+	torrentID = strings.ToLower(torrentID)
+
+	sqlStructure := sqlbuilder.NewStruct(new(webhook))
+	query := sqlStructure.SelectFrom(sqlWebhookTable)
+	query.Where(query.In("torrent_id", "", torrentID))
+	query.OrderBy("created_at").Asc()
+
+	webhooks, err := r.query(ctx, sqlStructure, query)
+	if err != nil {
+		return nil, err
+	}
+
+	subscribed := make([]*preview.Webhook, 0, len(webhooks))
+	for _, w := range webhooks {
+		if w.Receives(event, torrentID) {
+			subscribed = append(subscribed, w)
+		}
+	}
+	return subscribed, nil
+}
+
+func (r *WebhookRepository) query(ctx context.Context, sqlStructure *sqlbuilder.Struct, query *sqlbuilder.SelectBuilder) ([]*preview.Webhook, error) {
+	sqlRaw, args := query.Build()
+	rows, err := r.db.QueryContext(ctx, sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]*preview.Webhook, 0)
+	for rows.Next() {
+		var w webhook
+		if err := rows.Scan(sqlStructure.Addr(&w)...); err != nil {
+			return nil, err
+		}
+
+		var events []string
+		if err := json.Unmarshal([]byte(w.Events), &events); err != nil {
+			return nil, fmt.Errorf("unable to decode the events of the webhook: %v", err)
+		}
+
+		webhooks = append(webhooks, preview.RestoreWebhook(
+			w.ID,
+			w.URL,
+			w.Secret,
+			w.TorrentID,
+			events,
+			w.CreatedAt,
+		))
+	}
+	return webhooks, rows.Err()
+}
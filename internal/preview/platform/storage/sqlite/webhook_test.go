@@ -0,0 +1,117 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/sqlite"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const webhookColumns = "webhooks.id, webhooks.url, webhooks.secret, webhooks.torrent_id, webhooks.events, webhooks.created_at"
+
+func TestWebhookRepository_Persist(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectExec("REPLACE INTO webhooks (id, url, secret, torrent_id, events, created_at) VALUES (?, ?, ?, ?, ?, ?)").
+		WithArgs(
+			"e9c6",
+			"https://example.com/hooks",
+			"s3cr3t",
+			"cb84ccc10f296df72d6c40ba7a07c178a4323a14",
+			`["preview.completed"]`,
+			now,
+		).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	webhook, err := preview.NewWebhook("e9c6", "https://example.com/hooks", "s3cr3t",
+		"cb84ccc10f296df72d6c40ba7a07c178a4323a14", []string{preview.WebhookPreviewCompleted}, now)
+	require.NoError(t, err)
+
+	repository := sqlite.NewWebhookRepository(db)
+	require.NoError(t, repository.Persist(context.Background(), webhook))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_Subscribed(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"id", "url", "secret", "torrent_id", "events", "created_at"}).
+		AddRow("e9c6", "https://example.com/all", "s3cr3t", "", "[]", now).
+		AddRow("f00d", "https://example.com/images", "s3cr3t", torrentID, `["image.extracted"]`, now)
+
+	sqlMock.ExpectQuery("SELECT "+webhookColumns+" FROM webhooks WHERE torrent_id IN (?, ?) ORDER BY created_at ASC").
+		WithArgs("", torrentID).
+		WillReturnRows(rows)
+
+	repository := sqlite.NewWebhookRepository(db)
+	webhooks, err := repository.Subscribed(context.Background(), preview.WebhookPreviewCompleted, torrentID)
+	require.NoError(t, err)
+
+	require.Len(t, webhooks, 1)
+	assert.Equal(t, "e9c6", webhooks[0].ID())
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_Get_NotFound(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectQuery("SELECT " + webhookColumns + " FROM webhooks WHERE id = ?").
+		WithArgs("e9c6").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "secret", "torrent_id", "events", "created_at"}))
+
+	repository := sqlite.NewWebhookRepository(db)
+	_, err = repository.Get(context.Background(), "e9c6")
+	require.True(t, errors.Is(err, preview.ErrNotFound))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_Delete(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec("DELETE FROM webhook_deliveries WHERE webhook_id = ?").
+		WithArgs("e9c6").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	sqlMock.ExpectExec("DELETE FROM webhooks WHERE id = ?").
+		WithArgs("e9c6").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+
+	repository := sqlite.NewWebhookRepository(db)
+	require.NoError(t, repository.Delete(context.Background(), "e9c6"))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_Delete_NotFound(t *testing.T) {
+	db, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec("DELETE FROM webhook_deliveries WHERE webhook_id = ?").
+		WithArgs("e9c6").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	sqlMock.ExpectExec("DELETE FROM webhooks WHERE id = ?").
+		WithArgs("e9c6").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	sqlMock.ExpectRollback()
+
+	repository := sqlite.NewWebhookRepository(db)
+	err = repository.Delete(context.Background(), "e9c6")
+	require.True(t, errors.Is(err, preview.ErrNotFound))
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
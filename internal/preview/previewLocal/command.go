@@ -0,0 +1,8 @@
+package previewLocal
+
+type CMD struct {
+	Root string // path to the files of the torrent
+	// Optional. A torrent is created with the files at Root if not set
+	TorrentRaw  []byte
+	PieceLength int // used when creating the torrent. See preview.TorrentCreator
+}
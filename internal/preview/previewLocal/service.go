@@ -0,0 +1,116 @@
+package previewLocal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"prevtorrent/internal/platform/bus"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/completePreview"
+	"prevtorrent/internal/preview/downloadPartials"
+	"prevtorrent/internal/preview/makeDownloadPlan"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Service struct {
+	logger            *logrus.Logger
+	localDownloader   preview.LocalTorrentDownloader
+	torrentRepository preview.TorrentRepository
+	makeDownloadPlan  makeDownloadPlan.Service
+}
+
+// NewService returns a Service that generates the previews of the torrents with the files on disk.
+// downloadPartials must have been created with the same localDownloader
+func NewService(
+	logger *logrus.Logger,
+	localDownloader preview.LocalTorrentDownloader,
+	torrentRepository preview.TorrentRepository,
+	imageRepository preview.ImageRepository,
+	sagaRepository preview.SagaRepository,
+	downloadPartials downloadPartials.Service,
+) Service {
+	commandBus := syncCommandBus{downloadPartials: downloadPartials}
+	return Service{
+		logger:            logger,
+		localDownloader:   localDownloader,
+		torrentRepository: torrentRepository,
+		makeDownloadPlan:  makeDownloadPlan.NewService(logger, commandBus, torrentRepository, imageRepository, sagaRepository),
+	}
+}
+
+// Preview imports the torrent and generates its previews reading the files at cmd.Root. It returns
+// once all the previews have been generated
+func (s Service) Preview(ctx context.Context, cmd CMD) (preview.Torrent, error) {
+	raw := cmd.TorrentRaw
+	if len(raw) == 0 {
+		var err error
+		if raw, err = s.localDownloader.Create(cmd.Root, cmd.PieceLength); err != nil {
+			return preview.Torrent{}, err
+		}
+	}
+
+	torrent, err := s.localDownloader.Open(raw, cmd.Root)
+	if err != nil {
+		return preview.Torrent{}, err
+	}
+
+	if _, err := s.torrentRepository.Get(ctx, torrent.ID()); errors.Is(err, preview.ErrNotFound) {
+		if err := s.torrentRepository.Persist(ctx, torrent); err != nil {
+			return preview.Torrent{}, err
+		}
+	} else if err != nil {
+		return preview.Torrent{}, err
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"torrentID": torrent.ID(),
+		"name":      torrent.Name(),
+		"root":      cmd.Root,
+	}).Info("generating previews from local files")
+
+	if err := s.makeDownloadPlan.Download(ctx, makeDownloadPlan.CMD{TorrentID: torrent.ID()}); err != nil {
+		return preview.Torrent{}, err
+	}
+	return s.torrentRepository.Get(ctx, torrent.ID())
+}
+
+// syncCommandBus runs the downloadPartials commands right away instead of sending them to the
+// workers, which would ask the peers for the pieces
+type syncCommandBus struct {
+	downloadPartials downloadPartials.Service
+}
+
+func (b syncCommandBus) Send(ctx context.Context, cmd interface{}) error {
+	switch c := cmd.(type) {
+	case downloadPartials.CMD:
+		return b.downloadPartials.DownloadPartials(ctx, c)
+	case *downloadPartials.CMD:
+		return b.downloadPartials.DownloadPartials(ctx, *c)
+	default:
+		return fmt.Errorf("unexpected command %T", cmd)
+	}
+}
+
+// NewEventBus returns the event bus for the downloadPartials given to NewService. The events are
+// stored in the outbox given, and published once a worker relays them. The end of each download is
+// handled right away by completePreview instead, so the preview gets its outcome without any worker
+func NewEventBus(outbox bus.Event, completePreview completePreview.Service) bus.Event {
+	return syncEventBus{outbox: outbox, completePreview: completePreview}
+}
+
+type syncEventBus struct {
+	outbox          bus.Event
+	completePreview completePreview.Service
+}
+
+func (b syncEventBus) Publish(ctx context.Context, event interface{}) error {
+	switch e := event.(type) {
+	case preview.PartialDownloadFinishedEvent:
+		return b.completePreview.PartFinished(ctx, e)
+	case *preview.PartialDownloadFinishedEvent:
+		return b.completePreview.PartFinished(ctx, *e)
+	default:
+		return b.outbox.Publish(ctx, event)
+	}
+}
@@ -0,0 +1,134 @@
+package previewLocal_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/platform/bus/busmocks"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/completePreview"
+	"prevtorrent/internal/preview/downloadPartials"
+	"prevtorrent/internal/preview/platform/client/clientmocks"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"prevtorrent/internal/preview/previewLocal"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const torrentID = "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+func TestService_Preview(t *testing.T) {
+	raw := []byte("torrent-data")
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, raw)
+	require.NoError(t, err)
+
+	localDownloader := new(clientmocks.LocalTorrentDownloader)
+	localDownloader.On("Create", "/tmp/videos", 0).Return(raw, nil)
+	localDownloader.On("Open", raw, "/tmp/videos").Return(torrent, nil)
+	localDownloader.On("DownloadParts", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, plan preview.DownloadPlan) (*preview.PieceRegistry, error) {
+			registry, err := preview.NewPieceRegistry(ctx, fakeLogger(), &plan, preview.NewPieceInMemoryStorage(plan))
+			if err != nil {
+				return nil, err
+			}
+			for _, pieceRange := range plan.GetPlan() {
+				for idx := pieceRange.Start(); idx <= pieceRange.End(); idx++ {
+					if err := registry.RegisterPiece(preview.NewPiece(torrentID, idx, []byte("01234"))); err != nil {
+						return nil, err
+					}
+				}
+			}
+			registry.NoMorePieces()
+			return registry, nil
+		})
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(preview.Torrent{}, preview.ErrNotFound).Once()
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("Persist", mock.Anything, torrent).Return(nil)
+	torrentRepository.On("UpdateStatus", mock.Anything, mock.Anything).Return(nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages(nil), nil)
+	imageRepository.On("Persist", mock.Anything, mock.Anything).Return(nil)
+
+	imageExtractor := new(storagemocks.ImageExtractor)
+	imageExtractor.On("ExtractImage", mock.Anything, mock.Anything, mock.Anything).Return([]byte("image"), nil)
+
+	imagePersister := new(storagemocks.ImagePersister)
+	imagePersister.On("PersistFile", mock.Anything, mock.Anything, []byte("image")).Return(nil)
+
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
+	downloadPartialsService := downloadPartials.NewService(fakeLogger(), eventBus, torrentRepository, localDownloader,
+		imageExtractor, imagePersister, imageRepository, nil, nil, preview.ClipLimits{})
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, mock.Anything).Return(nil, preview.ErrNotFound)
+	sagaRepository.On("Persist", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	service := previewLocal.NewService(fakeLogger(), localDownloader, torrentRepository, imageRepository, sagaRepository,
+		downloadPartialsService)
+
+	_, err = service.Preview(context.Background(), previewLocal.CMD{Root: "/tmp/videos"})
+	require.NoError(t, err)
+
+	localDownloader.AssertExpectations(t)
+	torrentRepository.AssertCalled(t, "Persist", mock.Anything, torrent)
+	imageRepository.AssertCalled(t, "Persist", mock.Anything, mock.Anything)
+	torrentRepository.AssertCalled(t, "UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusCompleted
+	}), mock.Anything)
+}
+
+func TestService_Preview_UsesTheTorrentGiven(t *testing.T) {
+	raw := []byte("torrent-data")
+
+	localDownloader := new(clientmocks.LocalTorrentDownloader)
+	localDownloader.On("Open", raw, "/tmp/videos").Return(preview.Torrent{}, errors.New("files do not match"))
+
+	service := previewLocal.NewService(fakeLogger(), localDownloader, new(storagemocks.TorrentRepository),
+		new(storagemocks.ImageRepository), new(storagemocks.SagaRepository), downloadPartials.Service{})
+
+	_, err := service.Preview(context.Background(), previewLocal.CMD{Root: "/tmp/videos", TorrentRaw: raw})
+	assert.Error(t, err)
+	localDownloader.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestEventBus_HandlesTheEndOfTheDownloadsInProcess(t *testing.T) {
+	finishedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	saga := preview.StartPreviewSaga(torrentID, 1, finishedAt)
+
+	sagaRepository := new(storagemocks.SagaRepository)
+	sagaRepository.On("Get", mock.Anything, torrentID).Return(saga, nil)
+	sagaRepository.On("Persist", mock.Anything, mock.MatchedBy(func(s *preview.PreviewSaga) bool {
+		return s.IsFinished()
+	}), mock.AnythingOfType("*preview.TorrentPreviewCompletedEvent")).Return(nil)
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages(nil), nil)
+
+	outbox := new(busmocks.Event)
+	outbox.On("Publish", mock.Anything, mock.AnythingOfType("*preview.ImageExtractedEvent")).Return(nil)
+
+	eventBus := previewLocal.NewEventBus(outbox, completePreview.NewService(fakeLogger(), sagaRepository, imageRepository))
+	require.NoError(t, eventBus.Publish(context.Background(), &preview.ImageExtractedEvent{TorrentID: torrentID}))
+	require.NoError(t, eventBus.Publish(context.Background(), preview.NewPartialDownloadFinishedEvent(torrentID, nil, finishedAt)))
+
+	outbox.AssertExpectations(t)
+	outbox.AssertNumberOfCalls(t, "Publish", 1)
+	sagaRepository.AssertExpectations(t)
+}
+
+func fakeLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
@@ -0,0 +1,292 @@
+package preview
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+//go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=ProgressRepository
+type ProgressRepository interface {
+	Get(ctx context.Context, torrentID string) (*Progress, error)
+	Persist(ctx context.Context, progress *Progress) error
+	// Reset removes the progress of every torrent, so it can be rebuilt from the events
+	Reset(ctx context.Context) error
+}
+
+// Progress is the latest known state of the downloads of a Torrent. It's a projection
+// built from the download events (DownloadPlanStartedEvent, PieceCompletedEvent, ...) thus
+// it only knows about the pieces we have planned to download, not the whole torrent.
+type Progress struct {
+	torrentID   string
+	pieceLength int
+	ranges      []PlannedRange
+	pieces      map[int]struct{} // pieces downloaded, by ID
+	plans       map[string]bool  // DownloadPlan started, by ID. True once finished
+	peers       PeerStats
+	startedAt   time.Time
+	updatedAt   time.Time
+	version     int
+}
+
+// PeerStats is the peer information we had when the last piece was downloaded
+type PeerStats struct {
+	Active  int
+	Seeders int
+}
+
+// FileProgress is the progress of the planned ranges of a single file
+type FileProgress struct {
+	FileID           int
+	Pieces           int
+	PiecesDownloaded int
+}
+
+// Percentage returns the percentage downloaded of the planned pieces of the file [0, 100]
+func (fp FileProgress) Percentage() float64 {
+	if fp.Pieces == 0 {
+		return 0
+	}
+	return float64(fp.PiecesDownloaded) * 100 / float64(fp.Pieces)
+}
+
+// NewProgress returns an empty Progress for a torrent
+func NewProgress(torrentID string) *Progress {
+	return &Progress{
+		torrentID: torrentID,
+		ranges:    make([]PlannedRange, 0),
+		pieces:    make(map[int]struct{}),
+		plans:     make(map[string]bool),
+	}
+}
+
+// RestoreProgress returns a Progress with all its state. Meant to be used by the repositories.
+func RestoreProgress(
+	torrentID string,
+	pieceLength int,
+	ranges []PlannedRange,
+	pieces []int,
+	plans map[string]bool,
+	peers PeerStats,
+	startedAt time.Time,
+	updatedAt time.Time,
+	version int,
+) *Progress {
+	p := NewProgress(torrentID)
+	p.pieceLength = pieceLength
+	p.ranges = append(p.ranges, ranges...)
+	for _, id := range pieces {
+		p.pieces[id] = struct{}{}
+	}
+	for id, finished := range plans {
+		p.plans[id] = finished
+	}
+	p.peers = peers
+	p.startedAt = startedAt
+	p.updatedAt = updatedAt
+	p.version = version
+	return p
+}
+
+// TorrentID returns the obvious
+func (p *Progress) TorrentID() string {
+	return p.torrentID
+}
+
+// PieceLength returns the piece length of the torrent
+func (p *Progress) PieceLength() int {
+	return p.pieceLength
+}
+
+// Ranges returns all the ranges that have been planned to be downloaded
+func (p *Progress) Ranges() []PlannedRange {
+	return p.ranges
+}
+
+// Pieces returns the sorted list of pieces downloaded
+func (p *Progress) Pieces() []int {
+	pieces := make([]int, 0, len(p.pieces))
+	for id := range p.pieces {
+		pieces = append(pieces, id)
+	}
+	sort.Ints(pieces)
+	return pieces
+}
+
+// Plans returns the DownloadPlan started, by ID, telling if they have finished
+func (p *Progress) Plans() map[string]bool {
+	plans := make(map[string]bool, len(p.plans))
+	for id, finished := range p.plans {
+		plans[id] = finished
+	}
+	return plans
+}
+
+// ActivePlans returns the number of DownloadPlan that have started and not finished yet
+func (p *Progress) ActivePlans() int {
+	active := 0
+	for _, finished := range p.plans {
+		if !finished {
+			active++
+		}
+	}
+	return active
+}
+
+// IsDownloading returns true if any DownloadPlan of the torrent is being downloaded
+func (p *Progress) IsDownloading() bool {
+	return p.ActivePlans() > 0
+}
+
+// Peers returns the last known peers stats
+func (p *Progress) Peers() PeerStats {
+	return p.peers
+}
+
+// StartedAt returns when the first DownloadPlan started
+func (p *Progress) StartedAt() time.Time {
+	return p.startedAt
+}
+
+// UpdatedAt returns the time of the last change
+func (p *Progress) UpdatedAt() time.Time {
+	return p.updatedAt
+}
+
+// Version is incremented each time the progress is persisted, to detect concurrent updates
+func (p *Progress) Version() int {
+	return p.version
+}
+
+// StartPlan registers the ranges that are about to be downloaded. Starting the same plan twice, or
+// after it has finished, changes nothing
+func (p *Progress) StartPlan(planID string, pieceLength int, ranges []PlannedRange, at time.Time) {
+	p.pieceLength = pieceLength
+	for _, r := range ranges {
+		if !p.hasRange(r) {
+			p.ranges = append(p.ranges, r)
+		}
+	}
+	if _, found := p.plans[planID]; !found {
+		if !p.IsDownloading() {
+			p.startedAt = at
+		}
+		p.plans[planID] = false
+	}
+	p.touch(at)
+}
+
+// CompletePiece registers a downloaded piece
+func (p *Progress) CompletePiece(pieceID int, peers PeerStats, at time.Time) {
+	p.pieces[pieceID] = struct{}{}
+	p.peers = peers
+	p.touch(at)
+}
+
+// CompleteRange registers that all the pieces of a range are available. Useful when
+// the pieces were already in the storage, and we never got a PieceCompletedEvent for them
+func (p *Progress) CompleteRange(pieceStart, pieceEnd int, at time.Time) {
+	for i := pieceStart; i <= pieceEnd; i++ {
+		p.pieces[i] = struct{}{}
+	}
+	p.touch(at)
+}
+
+// FinishPlan registers that a DownloadPlan is not being downloaded anymore. It can be finished
+// before being started, when the events arrive out of order
+func (p *Progress) FinishPlan(planID string, at time.Time) {
+	p.plans[planID] = true
+	p.touch(at)
+}
+
+// Files returns the progress of each file with planned ranges, sorted by FileID
+func (p *Progress) Files() []FileProgress {
+	pieces := make(map[int]map[int]struct{})
+	for _, r := range p.ranges {
+		if _, found := pieces[r.FileID]; !found {
+			pieces[r.FileID] = make(map[int]struct{})
+		}
+		for i := r.PieceStart; i <= r.PieceEnd; i++ {
+			pieces[r.FileID][i] = struct{}{}
+		}
+	}
+
+	files := make([]FileProgress, 0, len(pieces))
+	for fileID, filePieces := range pieces {
+		fp := FileProgress{FileID: fileID, Pieces: len(filePieces)}
+		for id := range filePieces {
+			if _, found := p.pieces[id]; found {
+				fp.PiecesDownloaded++
+			}
+		}
+		files = append(files, fp)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].FileID < files[j].FileID
+	})
+	return files
+}
+
+// PiecesLeft returns the number of planned pieces not downloaded yet
+func (p *Progress) PiecesLeft() int {
+	return len(p.plannedPieces()) - p.plannedPiecesDownloaded()
+}
+
+// ETA estimates how long it's going to take to download the pieces left, based on the
+// download speed since the first plan started. Returns false if there is not enough
+// information to make an estimation.
+func (p *Progress) ETA() (time.Duration, bool) {
+	if len(p.ranges) == 0 {
+		return 0, false
+	}
+
+	piecesLeft := p.PiecesLeft()
+	if piecesLeft == 0 {
+		return 0, true
+	}
+
+	elapsed := p.updatedAt.Sub(p.startedAt)
+	downloaded := p.plannedPiecesDownloaded()
+	if !p.IsDownloading() || downloaded == 0 || elapsed <= 0 {
+		return 0, false
+	}
+
+	perPiece := elapsed / time.Duration(downloaded)
+	return perPiece * time.Duration(piecesLeft), true
+}
+
+func (p *Progress) plannedPieces() map[int]struct{} {
+	planned := make(map[int]struct{})
+	for _, r := range p.ranges {
+		for i := r.PieceStart; i <= r.PieceEnd; i++ {
+			planned[i] = struct{}{}
+		}
+	}
+	return planned
+}
+
+func (p *Progress) plannedPiecesDownloaded() int {
+	count := 0
+	for id := range p.plannedPieces() {
+		if _, found := p.pieces[id]; found {
+			count++
+		}
+	}
+	return count
+}
+
+func (p *Progress) hasRange(r PlannedRange) bool {
+	for _, current := range p.ranges {
+		if current == r {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Progress) touch(at time.Time) {
+	if at.After(p.updatedAt) {
+		p.updatedAt = at
+	}
+}
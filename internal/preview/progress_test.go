@@ -0,0 +1,122 @@
+package preview_test
+
+import (
+	"prevtorrent/internal/preview"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress_FilesPercentage(t *testing.T) {
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	progress := preview.NewProgress("cb84ccc10f296df72d6c40ba7a07c178a4323a14")
+
+	progress.StartPlan("plan-1", 10, []preview.PlannedRange{
+		{FileID: 0, PieceStart: 0, PieceEnd: 3},
+		{FileID: 1, PieceStart: 3, PieceEnd: 4},
+	}, startedAt)
+
+	progress.CompletePiece(0, preview.PeerStats{Active: 3, Seeders: 1}, startedAt.Add(time.Second))
+	progress.CompletePiece(3, preview.PeerStats{Active: 5, Seeders: 2}, startedAt.Add(time.Second*2))
+
+	files := progress.Files()
+	require.Len(t, files, 2)
+
+	assert.Equal(t, preview.FileProgress{FileID: 0, Pieces: 4, PiecesDownloaded: 2}, files[0])
+	assert.Equal(t, float64(50), files[0].Percentage())
+	assert.Equal(t, preview.FileProgress{FileID: 1, Pieces: 2, PiecesDownloaded: 1}, files[1])
+	assert.Equal(t, float64(50), files[1].Percentage())
+
+	assert.Equal(t, 3, progress.PiecesLeft())
+	assert.Equal(t, preview.PeerStats{Active: 5, Seeders: 2}, progress.Peers())
+	assert.True(t, progress.IsDownloading())
+}
+
+func TestProgress_ETA(t *testing.T) {
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	progress := preview.NewProgress("cb84ccc10f296df72d6c40ba7a07c178a4323a14")
+
+	_, ok := progress.ETA()
+	assert.False(t, ok, "nothing planned, nothing downloading")
+
+	progress.StartPlan("plan-1", 10, []preview.PlannedRange{{FileID: 0, PieceStart: 0, PieceEnd: 3}}, startedAt)
+	_, ok = progress.ETA()
+	assert.False(t, ok, "no pieces downloaded yet, no way to know the speed")
+
+	progress.CompletePiece(0, preview.PeerStats{}, startedAt.Add(time.Second*10))
+	eta, ok := progress.ETA()
+	assert.True(t, ok)
+	assert.Equal(t, time.Second*30, eta)
+
+	progress.CompleteRange(1, 3, startedAt.Add(time.Second*11))
+	eta, ok = progress.ETA()
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), eta)
+}
+
+func TestProgress_FinishPlan(t *testing.T) {
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	progress := preview.NewProgress("cb84ccc10f296df72d6c40ba7a07c178a4323a14")
+
+	progress.StartPlan("plan-1", 10, []preview.PlannedRange{{FileID: 0, PieceStart: 0, PieceEnd: 1}}, startedAt)
+	progress.StartPlan("plan-2", 10, []preview.PlannedRange{{FileID: 1, PieceStart: 2, PieceEnd: 3}}, startedAt.Add(time.Second))
+	assert.Equal(t, 2, progress.ActivePlans())
+	assert.Equal(t, startedAt, progress.StartedAt())
+
+	progress.FinishPlan("plan-1", startedAt.Add(time.Second*2))
+	assert.True(t, progress.IsDownloading())
+
+	progress.FinishPlan("plan-2", startedAt.Add(time.Second*3))
+	progress.FinishPlan("plan-2", startedAt.Add(time.Second*4))
+	assert.False(t, progress.IsDownloading())
+	assert.Equal(t, 0, progress.ActivePlans())
+	assert.Equal(t, startedAt.Add(time.Second*4), progress.UpdatedAt())
+}
+
+func TestProgress_FinishPlan_RedeliveredAndOutOfOrderEvents(t *testing.T) {
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	progress := preview.NewProgress("cb84ccc10f296df72d6c40ba7a07c178a4323a14")
+	ranges := []preview.PlannedRange{{FileID: 0, PieceStart: 0, PieceEnd: 1}}
+
+	progress.StartPlan("plan-1", 10, ranges, startedAt)
+	progress.StartPlan("plan-1", 10, ranges, startedAt)
+	assert.Equal(t, 1, progress.ActivePlans())
+
+	progress.FinishPlan("plan-2", startedAt.Add(time.Second))
+	progress.StartPlan("plan-2", 10, ranges, startedAt)
+	assert.Equal(t, 1, progress.ActivePlans(), "plan-2 finished before its start was handled")
+
+	progress.FinishPlan("plan-1", startedAt.Add(time.Second*2))
+	progress.StartPlan("plan-1", 10, ranges, startedAt)
+	assert.False(t, progress.IsDownloading())
+	assert.Equal(t, ranges, progress.Ranges())
+}
+
+func TestRestoreProgress(t *testing.T) {
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	ranges := []preview.PlannedRange{{FileID: 0, PieceStart: 0, PieceEnd: 3}}
+
+	progress := preview.RestoreProgress(
+		"cb84ccc10f296df72d6c40ba7a07c178a4323a14",
+		10,
+		ranges,
+		[]int{2, 0},
+		map[string]bool{"plan-1": false, "plan-2": true},
+		preview.PeerStats{Active: 4, Seeders: 1},
+		startedAt,
+		startedAt.Add(time.Minute),
+		3,
+	)
+
+	assert.Equal(t, "cb84ccc10f296df72d6c40ba7a07c178a4323a14", progress.TorrentID())
+	assert.Equal(t, 10, progress.PieceLength())
+	assert.Equal(t, ranges, progress.Ranges())
+	assert.Equal(t, []int{0, 2}, progress.Pieces())
+	assert.Equal(t, 1, progress.ActivePlans())
+	assert.Equal(t, preview.PeerStats{Active: 4, Seeders: 1}, progress.Peers())
+	assert.Equal(t, startedAt, progress.StartedAt())
+	assert.Equal(t, startedAt.Add(time.Minute), progress.UpdatedAt())
+	assert.Equal(t, 3, progress.Version())
+}
@@ -0,0 +1,11 @@
+package registerWebhook
+
+type CMD struct {
+	URL string
+	// Optional. Generated if empty
+	Secret string
+	// Optional. Every torrent if empty
+	TorrentID string
+	// Optional. Every event if empty
+	Events []string
+}
@@ -0,0 +1,77 @@
+package registerWebhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"prevtorrent/internal/preview"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// secretLength is the number of random bytes of the generated secrets
+const secretLength = 32
+
+type Service struct {
+	logger            *logrus.Logger
+	webhookRepository preview.WebhookRepository
+}
+
+func NewService(logger *logrus.Logger, webhookRepository preview.WebhookRepository) Service {
+	return Service{logger: logger, webhookRepository: webhookRepository}
+}
+
+// Register stores a new webhook. The returned webhook is the only place where a generated secret
+// can be read from
+func (s Service) Register(ctx context.Context, cmd CMD) (*preview.Webhook, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := cmd.Secret
+	if secret == "" {
+		if secret, err = newSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	webhook, err := preview.NewWebhook(id.String(), cmd.URL, secret, cmd.TorrentID, cmd.Events, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.webhookRepository.Persist(ctx, webhook); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"webhookID": webhook.ID(),
+		"torrentID": webhook.TorrentID(),
+		"events":    webhook.Events(),
+	}).Info("webhook registered")
+
+	return webhook, nil
+}
+
+// Unregister removes the webhook and its deliveries. Returns preview.ErrNotFound if there is no such webhook
+func (s Service) Unregister(ctx context.Context, webhookID string) error {
+	if err := s.webhookRepository.Delete(ctx, webhookID); err != nil {
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"webhookID": webhookID,
+	}).Info("webhook unregistered")
+	return nil
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, secretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
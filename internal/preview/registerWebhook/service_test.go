@@ -0,0 +1,74 @@
+package registerWebhook_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"prevtorrent/internal/preview/registerWebhook"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Register(t *testing.T) {
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Persist", mock.Anything, mock.MatchedBy(func(w *preview.Webhook) bool {
+		return w.URL() == "https://example.com/hooks" &&
+			w.TorrentID() == "cb84ccc10f296df72d6c40ba7a07c178a4323a14" &&
+			len(w.Secret()) == 64
+	})).Return(nil)
+
+	service := registerWebhook.NewService(fakeLogger(), webhookRepository)
+	webhook, err := service.Register(context.Background(), registerWebhook.CMD{
+		URL:       "https://example.com/hooks",
+		TorrentID: "CB84CCC10F296DF72D6C40BA7A07C178A4323A14",
+		Events:    []string{preview.WebhookPreviewCompleted},
+	})
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, webhook.ID())
+	assert.Equal(t, []string{preview.WebhookPreviewCompleted}, webhook.Events())
+	webhookRepository.AssertExpectations(t)
+}
+
+func TestService_Register_KeepsTheGivenSecret(t *testing.T) {
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Persist", mock.Anything, mock.Anything).Return(nil)
+
+	service := registerWebhook.NewService(fakeLogger(), webhookRepository)
+	webhook, err := service.Register(context.Background(), registerWebhook.CMD{
+		URL:    "https://example.com/hooks",
+		Secret: "s3cr3t",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", webhook.Secret())
+}
+
+func TestService_Register_Invalid(t *testing.T) {
+	webhookRepository := new(storagemocks.WebhookRepository)
+
+	service := registerWebhook.NewService(fakeLogger(), webhookRepository)
+	_, err := service.Register(context.Background(), registerWebhook.CMD{URL: "example.com/hooks"})
+	require.True(t, errors.Is(err, preview.ErrInvalidWebhook))
+	webhookRepository.AssertNotCalled(t, "Persist", mock.Anything, mock.Anything)
+}
+
+func TestService_Unregister_NotFound(t *testing.T) {
+	webhookRepository := new(storagemocks.WebhookRepository)
+	webhookRepository.On("Delete", mock.Anything, "e9c6").Return(preview.ErrNotFound)
+
+	service := registerWebhook.NewService(fakeLogger(), webhookRepository)
+	err := service.Unregister(context.Background(), "e9c6")
+	require.True(t, errors.Is(err, preview.ErrNotFound))
+}
+
+func fakeLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
@@ -1,28 +1,53 @@
 package preview
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha1"
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 var ErrPriceRegistryWithNothingToWaitFor = errors.New("the plan has 0 pieces to wait for, thus using the registry to retrieve responses is useless")
+var ErrNoSeeders = errors.New("the torrent has no seeders")
+var ErrRegistryClosed = errors.New("the registry does not accept more pieces")
+var ErrDownloadStalled = errors.New("no pieces have been received for too long")
+var ErrCorruptPiece = errors.New("corrupt piece")
+
+// CorruptPieceError is returned when the data of a piece does not match the hash of the torrent
+type CorruptPieceError struct {
+	TorrentID string
+	PieceIdx  int
+	Reason    string
+}
+
+func (e *CorruptPieceError) Error() string {
+	return fmt.Sprintf("%v %v of torrent %v: %v", ErrCorruptPiece, e.PieceIdx, e.TorrentID, e.Reason)
+}
 
+// Unwrap makes errors.Is(err, ErrCorruptPiece) work
+func (e *CorruptPieceError) Unwrap() error {
+	return ErrCorruptPiece
+}
+
+// PieceStorage keeps the pieces received by the registry. Get can be called any number of times
+// until the piece is released by all the ranges that need it
 type PieceStorage interface {
 	Set(p *Piece)
 	Get(id int) (*Piece, bool)
+	Release(id int)
 }
 
 // PieceInMemoryStorage is in charge of registering all the pieces/chunks received via a peer
-// and store it until is read.
+// and store it until the files that need it have been consumed.
 // Various pieces might create a file. Different files might share the same pieces. That's why
 // we inspect the DownloadPlan to know how many complete files depend on a given piece,
-// and when we read from the storage we subtract 1 from the pieceCount.
-// If the pieceCount gets to 0, we free the space. So this storage is mean to be read just once
-// per file. We do this to keep memory footprint low.
+// and when a file releases the piece we subtract 1 from the pieceCount.
+// If the pieceCount gets to 0, we free the space. We do this to keep memory footprint low.
 type PieceInMemoryStorage struct {
 	pieceCount map[int]int
 	storage    map[int]*Piece
@@ -51,73 +76,136 @@ func (m *PieceInMemoryStorage) Set(p *Piece) {
 	m.storage[p.pieceID] = p
 }
 
-// Get returns a piece from the storage. Each piece has an associates counter,
-// and each time we read a piece the counter gets down by one. If it gets to
-// 0, we delete the piece
+// Get returns a piece from the storage
 func (m *PieceInMemoryStorage) Get(id int) (*Piece, bool) {
 	m.storageMux.RLock()
+	defer m.storageMux.RUnlock()
 	p, found := m.storage[id]
-	m.storageMux.RUnlock()
-
-	if !found {
-		return nil, found
-
-	}
+	return p, found
+}
 
+// Release tells a file that needed the piece has been consumed. Each piece has an associated
+// counter, and each release gets it down by one. If it gets to 0, we delete the piece
+func (m *PieceInMemoryStorage) Release(id int) {
 	m.storageMux.Lock()
 	defer m.storageMux.Unlock()
+	if _, found := m.pieceCount[id]; !found {
+		return
+	}
 	m.pieceCount[id]--
 	if m.pieceCount[id] == 0 {
 		delete(m.pieceCount, id)
 		delete(m.storage, id)
 	}
-	return p, found
 }
 
 // PieceRegistry keeps track of all the pieces downloaded for a DownloadPlan
 // and knows when we have all the pieces to generate a file.
-// It operates reading from pieceIncomingCh channel and outputs to the
-// plansCompletedCh when a PieceRange has all its pieces. Then an outside actor
-// can read the pieces from the storage.
-// IMPROVEMENT: This struct has too many responsibilities, too many channel logic and probably
-//       a lot of hidden bugs.
+// The downloader sends the pieces with RegisterPiece, which stores them and queues the
+// PieceRange that got all their pieces. The consumer reads those with RunOnPieceReady and
+// then reads the pieces from the storage. The pieces of a range are released once its callback returns.
+// The registry does not run any goroutine. RegisterPiece blocks while there are too many
+// ranges waiting to be consumed (see WithMaxPendingRanges) and gets unblocked when the
+// consumer fails or the context is cancelled, so nothing is left waiting forever.
 type PieceRegistry struct {
-	logger              *logrus.Logger
-	downloadPlan        *DownloadPlan
-	storage             PieceStorage
-	matcher             map[int][]*pieceRangeCounter
-	pieceIncomingCh     chan *Piece
-	pieceIncomingChMux  sync.Once
-	plansCompletedCh    chan PieceRange
-	plansCompletedChMux sync.Once
-	notifiedPieces      int
+	ctx          context.Context
+	logger       *logrus.Logger
+	storage      PieceStorage
+	clock        Clock
+	stallTimeout time.Duration
+	torrent      Torrent
+	hashes       [][]byte // SHA-1 of each piece, from the info dictionary of the torrent
+
+	matcher      map[int][]*pieceRangeCounter
+	counters     []*pieceRangeCounter
+	lastActivity time.Time
+	countersMux  sync.Mutex
+
+	ready     chan PieceRange // ranges with all their pieces, waiting to be consumed
+	slots     chan struct{}   // one element per range sent to ready and not consumed yet
+	finished  chan struct{}   // closed when no more pieces are coming
+	closed    bool            // true once finished has been closed
+	closedMux sync.RWMutex    // readers are the ones sending pieces. The writer closes finished
+	stop      chan struct{}   // closed when the registry has failed and the senders must give up
+	stopOnce  sync.Once
+	err       error
+	errMux    sync.Mutex
+	processed int           // ranges consumed by RunOnPieceReady
+	consumed  chan struct{} // closed when RunOnPieceReady returns
+	doneOnce  sync.Once
+}
+
+// RegistryOption configures a PieceRegistry
+type RegistryOption func(pr *PieceRegistry)
+
+// WithClock sets the Clock used to detect stalled downloads
+func WithClock(clock Clock) RegistryOption {
+	return func(pr *PieceRegistry) {
+		pr.clock = clock
+	}
+}
+
+// WithStallTimeout makes RunOnPieceReady return ErrDownloadStalled when neither a piece has been
+// received nor a range has been consumed for the given duration. Disabled by default.
+func WithStallTimeout(d time.Duration) RegistryOption {
+	return func(pr *PieceRegistry) {
+		pr.stallTimeout = d
+	}
+}
+
+// WithMaxPendingRanges sets how many completed ranges can be waiting to be consumed before
+// RegisterPiece blocks. By default all the ranges of the plan can be waiting.
+func WithMaxPendingRanges(n int) RegistryOption {
+	return func(pr *PieceRegistry) {
+		if n > 0 && n < cap(pr.slots) {
+			pr.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithPieceHashes sets the SHA-1 hashes of the pieces of the torrent, indexed by piece.
+// When given, BundlePlan verifies each piece before using it.
+func WithPieceHashes(hashes [][]byte) RegistryOption {
+	return func(pr *PieceRegistry) {
+		pr.hashes = hashes
+	}
 }
 
 // NewPieceRegistry creates a PieceRegistry
-func NewPieceRegistry(ctx context.Context, logger *logrus.Logger, plan *DownloadPlan, storage PieceStorage) (*PieceRegistry, error) {
+func NewPieceRegistry(ctx context.Context, logger *logrus.Logger, plan *DownloadPlan, storage PieceStorage, opts ...RegistryOption) (*PieceRegistry, error) {
 	if plan.CountPieces() == 0 {
 		return nil, ErrPriceRegistryWithNothingToWaitFor
 	}
 
 	matcher := make(map[int][]*pieceRangeCounter)
+	counters := make([]*pieceRangeCounter, 0, len(plan.GetPlan()))
 
 	for _, priceRange := range plan.GetPlan() {
 		counter := newPieceRangeCounter(priceRange)
+		counters = append(counters, counter)
 		for i := priceRange.Start(); i <= priceRange.End(); i++ {
 			matcher[i] = append(matcher[i], counter)
 		}
 	}
 
 	pr := &PieceRegistry{
-		logger:           logger,
-		downloadPlan:     plan,
-		matcher:          matcher,
-		storage:          storage,
-		pieceIncomingCh:  make(chan *Piece, plan.CountPieces()),
-		plansCompletedCh: make(chan PieceRange, plan.CountPieces()),
+		ctx:      ctx,
+		logger:   logger,
+		storage:  storage,
+		clock:    SystemClock{},
+		torrent:  plan.GetTorrent(),
+		matcher:  matcher,
+		counters: counters,
+		ready:    make(chan PieceRange, len(counters)),
+		slots:    make(chan struct{}, len(counters)),
+		finished: make(chan struct{}),
+		stop:     make(chan struct{}),
+		consumed: make(chan struct{}),
 	}
-
-	pr.listenForPieces(ctx)
+	for _, opt := range opts {
+		opt(pr)
+	}
+	pr.lastActivity = pr.clock.Now()
 
 	return pr, nil
 }
@@ -127,107 +215,276 @@ func (pr *PieceRegistry) GetPiece(idx int) (*Piece, bool) {
 	return pr.storage.Get(idx)
 }
 
-// SubscribeAllPartsDownloaded returns the channel where all the PieceRange
-// are going to be published when completed.
-func (pr *PieceRegistry) SubscribeAllPartsDownloaded() chan PieceRange {
-	return pr.plansCompletedCh
+// ReadPiece implements PieceSource
+func (pr *PieceRegistry) ReadPiece(idx int) ([]byte, error) {
+	p, found := pr.storage.Get(idx)
+	if !found {
+		return nil, fmt.Errorf("piece %v not found in the registry", idx)
+	}
+	return p.data, nil
 }
 
-//  RegisterPiece sends a piece downloaded by the torrent without blocking
-func (pr *PieceRegistry) RegisterPiece(piece *Piece) {
-	pr.pieceIncomingCh <- piece
+// ReleasePiece implements PieceSource. Nothing to do, the storage releases the pieces of a range
+// once it has been consumed
+func (pr *PieceRegistry) ReleasePiece(int) {}
+
+// Consumed returns a channel closed once RunOnPieceReady has returned, thus nobody is going
+// to read the pieces anymore
+func (pr *PieceRegistry) Consumed() <-chan struct{} {
+	return pr.consumed
+}
+
+// RegisterPiece stores a piece downloaded by the torrent. It blocks while there are too many
+// ranges waiting to be consumed. Returns an error if the registry is not accepting pieces anymore,
+// either because NoMorePieces has been called, the consumer has failed, or the context is done.
+func (pr *PieceRegistry) RegisterPiece(piece *Piece) error {
+	pr.closedMux.RLock()
+	defer pr.closedMux.RUnlock()
+	if pr.closed {
+		return ErrRegistryClosed
+	}
+	select {
+	case <-pr.stop:
+		return fmt.Errorf("%w: %v", ErrRegistryClosed, pr.Err())
+	default:
+	}
+
+	completed, added := pr.addPiece(piece)
+	if !added {
+		return nil
+	}
+
+	pr.logger.WithContext(pr.ctx).WithFields(logrus.Fields{
+		"torrentID": piece.TorrentID(),
+		"piece":     piece.ID(),
+	}).Debug("part added to registry")
+
+	for _, pieceRange := range completed {
+		select {
+		case pr.slots <- struct{}{}:
+			pr.ready <- pieceRange // never blocks, ready has room for all the ranges
+		case <-pr.stop:
+			return fmt.Errorf("%w: %v", ErrRegistryClosed, pr.Err())
+		case <-pr.ctx.Done():
+			return fmt.Errorf("context cancelled: %v", pr.ctx.Err())
+		}
+	}
+	return nil
 }
 
-// NoMorePieces notifies that there is no more incoming data and we can stop
-// listening for more pices. It usually means that the torrent has downloaded
-// all what's in the DownloadPlan
+// NoMorePieces notifies that there is no more incoming data. Once the ranges already
+// completed are consumed, RunOnPieceReady returns. Must be called once all the calls to
+// RegisterPiece have returned.
 func (pr *PieceRegistry) NoMorePieces() {
-	pr.pieceIncomingChMux.Do(func() {
-		close(pr.pieceIncomingCh)
-	})
+	pr.closedMux.Lock()
+	defer pr.closedMux.Unlock()
+	if !pr.closed {
+		pr.closed = true
+		close(pr.finished)
+	}
+}
+
+// Fail records the reason why the downloader is not going to send all the pieces of the
+// DownloadPlan. Only the first error is kept. It's still required to call NoMorePieces.
+func (pr *PieceRegistry) Fail(err error) {
+	pr.errMux.Lock()
+	defer pr.errMux.Unlock()
+	if pr.err == nil {
+		pr.err = err
+	}
+}
+
+// Err returns the error given to Fail, if any
+func (pr *PieceRegistry) Err() error {
+	pr.errMux.Lock()
+	defer pr.errMux.Unlock()
+	return pr.err
+}
+
+// MissingRanges returns the PieceRange of the DownloadPlan that have not received all their
+// pieces. Meant to be called once RunOnPieceReady has returned, to know what's left to download
+func (pr *PieceRegistry) MissingRanges() []MissingRange {
+	pr.countersMux.Lock()
+	defer pr.countersMux.Unlock()
+
+	missing := make([]MissingRange, 0)
+	for _, counter := range pr.counters {
+		if !counter.areAllPiecesDownloaded() {
+			missing = append(missing, MissingRange{
+				PieceRange:    counter.pieceRange,
+				PiecesMissing: counter.piecesMissing(),
+			})
+		}
+	}
+	return missing
 }
 
 // RunOnPieceReady receives a callback and executes it every time a PieceRange
-// from the DownloadPlan has been completed
+// from the DownloadPlan has been completed. Returns once all the ranges have been
+// consumed or there are no more pieces coming. In the latter case, returns the error
+// the downloader has given to Fail, if any.
+// If the callback fails, the registry stops accepting pieces and the error is returned.
 func (pr *PieceRegistry) RunOnPieceReady(ctx context.Context, fnx func(part PieceRange) error) error {
-	for {
+	defer pr.doneOnce.Do(func() {
+		close(pr.consumed)
+	})
+
+	for pr.processed < len(pr.counters) {
 		select {
-		case part, isOpen := <-pr.SubscribeAllPartsDownloaded():
-			if !isOpen {
-				return nil
+		case part := <-pr.ready:
+			if err := pr.consume(part, fnx); err != nil {
+				return err
 			}
 
-			if err := fnx(part); err != nil {
-				return err
+		case <-pr.finished:
+			return pr.drain(fnx)
+
+		case <-pr.stop:
+			return pr.Err()
+
+		case <-pr.stalled():
+			if pr.isStalled() {
+				pr.abort(ErrDownloadStalled)
+				return ErrDownloadStalled
 			}
 
 		case <-ctx.Done():
+			pr.abort(ctx.Err())
 			return fmt.Errorf("context cancelled: %v", ctx.Err())
 		}
 	}
+	return nil
 }
 
-func (pr *PieceRegistry) listenForPieces(ctx context.Context) {
-	go pr.listen(ctx)
+// drain consumes the ranges that were completed before NoMorePieces was called
+func (pr *PieceRegistry) drain(fnx func(part PieceRange) error) error {
+	for {
+		select {
+		case part := <-pr.ready:
+			if err := pr.consume(part, fnx); err != nil {
+				return err
+			}
+		default:
+			return pr.Err()
+		}
+	}
 }
 
-func (pr *PieceRegistry) closeIncomingChanel() {
-	pr.plansCompletedChMux.Do(func() {
-		close(pr.plansCompletedCh)
-	})
+func (pr *PieceRegistry) consume(part PieceRange, fnx func(part PieceRange) error) error {
+	err := fnx(part)
+	for i := part.Start(); i <= part.End(); i++ {
+		pr.storage.Release(i)
+	}
+	<-pr.slots
+	pr.processed++
+	pr.touch()
+	if err != nil {
+		pr.abort(err)
+	}
+	return err
 }
 
-func (pr *PieceRegistry) addPiece(p *Piece) error {
-	if _, found := pr.matcher[p.pieceID]; !found {
-		return fmt.Errorf("part %v not previously registered in matcher", p.pieceID)
+// stalled returns a channel that fires when it's time to check if the download has stalled.
+// A nil channel, thus never fires, if the stall timeout is disabled
+func (pr *PieceRegistry) stalled() <-chan time.Time {
+	if pr.stallTimeout <= 0 {
+		return nil
 	}
+	return pr.clock.After(pr.stallTimeout)
+}
 
-	pr.registerPiece(p)
+func (pr *PieceRegistry) isStalled() bool {
+	pr.countersMux.Lock()
+	defer pr.countersMux.Unlock()
+	return pr.clock.Now().Sub(pr.lastActivity) >= pr.stallTimeout
+}
 
-	for _, counter := range pr.matcher[p.pieceID] {
-		counter.addOne()
-		if counter.areAllPiecesDownloaded() {
-			pr.notifyAllPartsDownloaded(counter.pieceRange)
-		}
+func (pr *PieceRegistry) touch() {
+	pr.countersMux.Lock()
+	defer pr.countersMux.Unlock()
+	pr.lastActivity = pr.clock.Now()
+}
+
+// verify checks the data of the piece against its hash. Pieces are not verified if the
+// registry has no hashes
+func (pr *PieceRegistry) verify(p *Piece) error {
+	if pr.hashes == nil {
+		return nil
+	}
+	corrupt := func(reason string, args ...interface{}) error {
+		return &CorruptPieceError{TorrentID: pr.torrent.ID(), PieceIdx: p.pieceID, Reason: fmt.Sprintf(reason, args...)}
+	}
+
+	if p.pieceID < 0 || p.pieceID >= len(pr.hashes) {
+		return corrupt("no hash for the piece")
+	}
+	// The last piece is usually shorter, but the downloader might give it padded
+	length := pr.torrent.pieceLength
+	if remaining := pr.torrent.totalLength - p.pieceID*pr.torrent.pieceLength; remaining < length {
+		length = remaining
+	}
+	if len(p.data) < length {
+		return corrupt("expected %v bytes, got %v", length, len(p.data))
+	}
+
+	sum := sha1.Sum(p.data[:length])
+	if !bytes.Equal(sum[:], pr.hashes[p.pieceID]) {
+		return corrupt("hash mismatch")
 	}
 	return nil
 }
 
-func (pr *PieceRegistry) registerPiece(p *Piece) {
-	pr.storage.Set(p)
+// reject marks a PieceRange as not downloaded, so it's returned by MissingRanges
+func (pr *PieceRegistry) reject(pieceRange PieceRange) {
+	pr.countersMux.Lock()
+	defer pr.countersMux.Unlock()
+	for _, counter := range pr.counters {
+		cr := counter.pieceRange
+		if cr.FileID() == pieceRange.FileID() && cr.Start() == pieceRange.Start() && cr.End() == pieceRange.End() {
+			counter.reset()
+		}
+	}
 }
 
-func (pr *PieceRegistry) notifyAllPartsDownloaded(pieceRange PieceRange) {
-	pr.plansCompletedCh <- pieceRange
-	pr.notifiedPieces++
-	if pr.notifiedPieces == len(pr.downloadPlan.GetPlan()) {
-		pr.closeIncomingChanel()
-	}
+// abort records the error and unblocks whoever is sending pieces
+func (pr *PieceRegistry) abort(err error) {
+	pr.Fail(err)
+	pr.stopOnce.Do(func() {
+		close(pr.stop)
+	})
 }
 
-func (pr *PieceRegistry) listen(ctx context.Context) {
-	for {
-		select {
-		case piece, isOpen := <-pr.pieceIncomingCh:
-			if !isOpen {
-				pr.logger.Debug("no more input. Seems that those were all the pieces")
-				pr.closeIncomingChanel()
-				return
-			}
+// addPiece stores the piece and returns the ranges that have been completed with it. Returns false
+// if the piece has been dropped, because the plan does not need it or it has already been received
+func (pr *PieceRegistry) addPiece(p *Piece) ([]PieceRange, bool) {
+	pr.countersMux.Lock()
+	defer pr.countersMux.Unlock()
 
-			log := pr.logger.WithFields(logrus.Fields{
-				"torrentID": piece.TorrentID(),
-				"piece":     piece.ID(),
-			})
+	counters, found := pr.matcher[p.pieceID]
+	if !found {
+		pr.logger.WithContext(pr.ctx).WithFields(logrus.Fields{
+			"torrentID": p.TorrentID(),
+			"piece":     p.ID(),
+		}).Warn("piece not in the plan, dropped")
+		return nil, false
+	}
 
-			if err := pr.addPiece(piece); err != nil {
-				log.Error(err)
-				return
-			}
-			log.Debug("part added to registry")
-		case <-ctx.Done():
-			pr.closeIncomingChanel()
-			return
+	added := false
+	completed := make([]PieceRange, 0)
+	for _, counter := range counters {
+		if !counter.addOne(p.pieceID) {
+			continue // the piece has been received twice
+		}
+		added = true
+		if counter.areAllPiecesDownloaded() {
+			completed = append(completed, counter.pieceRange)
 		}
 	}
+	if !added {
+		return nil, false
+	}
+
+	pr.storage.Set(p)
+	pr.lastActivity = pr.clock.Now()
+	return completed, true
 }
@@ -0,0 +1,307 @@
+package preview_test
+
+import (
+	"context"
+	"errors"
+	"prevtorrent/internal/preview"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPieceRegistry_MissingRanges(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f0, err := preview.NewFileInfo(0, 50, "movie.mp4")
+	require.NoError(t, err)
+	f1, err := preview.NewFileInfo(1, 50, "movie2.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test movie", 25, []preview.File{f0, f1}, []byte(""))
+	require.NoError(t, err)
+
+	plan := preview.NewDownloadPlan(torrent)
+	images := preview.NewTorrentImages(nil)
+	require.NoError(t, plan.Add(images, torrent.File(0), 0, 50))
+	require.NoError(t, plan.Add(images, torrent.File(1), 0, 50))
+
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	require.NoError(t, err)
+	registry.RegisterPiece(preview.NewPiece(torrentID, 0, make([]byte, 25)))
+	registry.RegisterPiece(preview.NewPiece(torrentID, 1, make([]byte, 25)))
+	registry.RegisterPiece(preview.NewPiece(torrentID, 2, make([]byte, 25)))
+	registry.NoMorePieces()
+
+	completed := make([]preview.PieceRange, 0)
+	err = registry.RunOnPieceReady(context.Background(), func(part preview.PieceRange) error {
+		completed = append(completed, part)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, completed, 1)
+	assert.Equal(t, 0, completed[0].FileID())
+
+	missing := registry.MissingRanges()
+	require.Len(t, missing, 1)
+	assert.Equal(t, 1, missing[0].PieceRange.FileID())
+	assert.Equal(t, 1, missing[0].PiecesMissing)
+}
+
+func TestPieceRegistry_RegisterPiece_UnknownPieceIsDropped(t *testing.T) {
+	torrentID, plan := twoRangesPlan(t)
+
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	require.NoError(t, err)
+
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 99, make([]byte, 50))))
+	_, found := registry.GetPiece(99)
+	assert.False(t, found)
+
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 0, make([]byte, 50))))
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 1, make([]byte, 50))))
+
+	completed := 0
+	err = registry.RunOnPieceReady(context.Background(), func(part preview.PieceRange) error {
+		completed++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, completed)
+}
+
+func TestPieceRegistry_RunOnPieceReady_ReleasesThePiecesOfTheRange(t *testing.T) {
+	torrentID, plan := twoRangesPlan(t)
+
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	require.NoError(t, err)
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 0, make([]byte, 50))))
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 1, make([]byte, 50))))
+
+	err = registry.RunOnPieceReady(context.Background(), func(part preview.PieceRange) error {
+		// The pieces can be read as many times as needed while the range is being consumed
+		_, err := preview.NewBundlePlan().Bundle(registry, part)
+		require.NoError(t, err)
+		_, found := registry.GetPiece(part.Start())
+		assert.True(t, found)
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, found := registry.GetPiece(0)
+	assert.False(t, found)
+	select {
+	case <-registry.Consumed():
+	default:
+		t.Fatal("the registry must be consumed")
+	}
+}
+
+func TestPieceRegistry_RegisterPiece_DuplicateIsCountedOnce(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f0, err := preview.NewFileInfo(0, 50, "movie.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "test movie", 25, []preview.File{f0}, []byte(""))
+	require.NoError(t, err)
+
+	plan := preview.NewDownloadPlan(torrent)
+	require.NoError(t, plan.Add(preview.NewTorrentImages(nil), torrent.File(0), 0, 50))
+
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	require.NoError(t, err)
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 0, make([]byte, 25))))
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 0, make([]byte, 25))))
+	registry.NoMorePieces()
+
+	err = registry.RunOnPieceReady(context.Background(), func(part preview.PieceRange) error {
+		t.Fatal("the range must not be completed by a duplicate piece")
+		return nil
+	})
+	require.NoError(t, err)
+
+	missing := registry.MissingRanges()
+	require.Len(t, missing, 1)
+	assert.Equal(t, 1, missing[0].PiecesMissing)
+}
+
+func TestPieceRegistry_RunOnPieceReady_CallbackErrorIsReturned(t *testing.T) {
+	torrentID, plan := twoRangesPlan(t)
+	callbackErr := errors.New("unable to extract image")
+
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan))
+	require.NoError(t, err)
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 0, make([]byte, 50))))
+
+	err = registry.RunOnPieceReady(context.Background(), func(part preview.PieceRange) error {
+		return callbackErr
+	})
+	assert.Equal(t, callbackErr, err)
+
+	err = registry.RegisterPiece(preview.NewPiece(torrentID, 1, make([]byte, 50)))
+	assert.True(t, errors.Is(err, preview.ErrRegistryClosed))
+}
+
+func TestPieceRegistry_RegisterPiece_Backpressure(t *testing.T) {
+	torrentID, plan := twoRangesPlan(t)
+
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan),
+		preview.WithMaxPendingRanges(1))
+	require.NoError(t, err)
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 0, make([]byte, 50))))
+
+	registered := make(chan error)
+	go func() {
+		registered <- registry.RegisterPiece(preview.NewPiece(torrentID, 1, make([]byte, 50)))
+	}()
+
+	select {
+	case <-registered:
+		t.Fatal("the second range must wait until the first one is consumed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	completed := make([]preview.PieceRange, 0)
+	err = registry.RunOnPieceReady(context.Background(), func(part preview.PieceRange) error {
+		completed = append(completed, part)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, <-registered)
+	assert.Len(t, completed, 2)
+}
+
+func TestPieceRegistry_Cancel_UnblocksTheSenders(t *testing.T) {
+	torrentID, plan := twoRangesPlan(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	registry, err := preview.NewPieceRegistry(ctx, fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan),
+		preview.WithMaxPendingRanges(1))
+	require.NoError(t, err)
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 0, make([]byte, 50))))
+
+	registered := make(chan error)
+	go func() {
+		registered <- registry.RegisterPiece(preview.NewPiece(torrentID, 1, make([]byte, 50)))
+	}()
+
+	cancel()
+	assert.Error(t, <-registered)
+
+	err = registry.RunOnPieceReady(ctx, func(part preview.PieceRange) error {
+		return nil
+	})
+	assert.Error(t, err)
+}
+
+func TestPieceRegistry_RunOnPieceReady_Stalled(t *testing.T) {
+	torrentID, plan := twoRangesPlan(t)
+	clock := newFakeClock(time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC))
+
+	registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), plan, preview.NewPieceInMemoryStorage(*plan),
+		preview.WithClock(clock), preview.WithStallTimeout(time.Minute))
+	require.NoError(t, err)
+
+	result := make(chan error)
+	go func() {
+		result <- registry.RunOnPieceReady(context.Background(), func(part preview.PieceRange) error {
+			return nil
+		})
+	}()
+
+	clock.BlockUntilWaiters(1)
+	clock.Advance(30 * time.Second)
+	require.NoError(t, registry.RegisterPiece(preview.NewPiece(torrentID, 0, make([]byte, 50))))
+
+	// Once the range is consumed, the registry waits again for a full minute
+	clock.BlockUntilWaiters(2)
+	clock.Advance(time.Minute)
+	assert.Equal(t, preview.ErrDownloadStalled, <-result)
+
+	err = registry.RegisterPiece(preview.NewPiece(torrentID, 1, make([]byte, 50)))
+	assert.True(t, errors.Is(err, preview.ErrRegistryClosed))
+}
+
+// twoRangesPlan returns a DownloadPlan with two ranges of a single piece each: 0 and 1
+func twoRangesPlan(t *testing.T) (string, *preview.DownloadPlan) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	f0, err := preview.NewFileInfo(0, 50, "movie.mp4")
+	require.NoError(t, err)
+	f1, err := preview.NewFileInfo(1, 50, "movie2.mp4")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test movie", 50, []preview.File{f0, f1}, []byte(""))
+	require.NoError(t, err)
+
+	plan := preview.NewDownloadPlan(torrent)
+	images := preview.NewTorrentImages(nil)
+	require.NoError(t, plan.Add(images, torrent.File(0), 0, 50))
+	require.NoError(t, plan.Add(images, torrent.File(1), 0, 50))
+	return torrentID, plan
+}
+
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// fakeClock only moves when Advance is called
+type fakeClock struct {
+	now     time.Time
+	waiters []fakeWaiter
+	afters  int // number of calls to After
+	mux     sync.Mutex
+	cond    *sync.Cond
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	c := &fakeClock{now: now}
+	c.cond = sync.NewCond(&c.mux)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	w := fakeWaiter{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	c.afters++
+	c.cond.Broadcast()
+	return w.c
+}
+
+// Advance moves the clock and fires the waiters that are due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.now = c.now.Add(d)
+
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = waiting
+}
+
+// BlockUntilWaiters blocks until After has been called n times
+func (c *fakeClock) BlockUntilWaiters(n int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for c.afters < n {
+		c.cond.Wait()
+	}
+}
@@ -0,0 +1,26 @@
+package reprocessTorrent
+
+import (
+	"prevtorrent/internal/preview"
+	"time"
+)
+
+type CMD struct {
+	TorrentID string
+	// Optional. All the supported files of the torrent if empty
+	FileIDs []int
+	// Optional. Generates again the images we already have instead of skipping them
+	Force bool
+	// Optional. The defaults of the configuration are used when not set
+	MaxDownloadTime time.Duration
+	SeederWaitTime  time.Duration
+	Deadline        time.Time
+}
+
+func (c CMD) limits() preview.DownloadLimits {
+	return preview.DownloadLimits{
+		MaxDownloadTime: c.MaxDownloadTime,
+		SeederWaitTime:  c.SeederWaitTime,
+		Deadline:        c.Deadline,
+	}
+}
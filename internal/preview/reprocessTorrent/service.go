@@ -0,0 +1,107 @@
+package reprocessTorrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"prevtorrent/internal/preview"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Service struct {
+	logger            *logrus.Logger
+	torrentRepository preview.TorrentRepository
+	imageRepository   preview.ImageRepository
+	imagePersister    preview.ImagePersister
+}
+
+func NewService(
+	logger *logrus.Logger,
+	torrentRepository preview.TorrentRepository,
+	imageRepository preview.ImageRepository,
+	imagePersister preview.ImagePersister,
+) Service {
+	return Service{
+		logger:            logger,
+		torrentRepository: torrentRepository,
+		imageRepository:   imageRepository,
+		imagePersister:    imagePersister,
+	}
+}
+
+// Reprocess asks for a new download plan of the torrent. The plan is made by the makeDownloadPlan
+// handlers, so this only checks that the torrent can be reprocessed: it exists, nothing is being
+// processed for it right now, unless forced, and the files, if any, can be previewed. The torrent is
+// planned and the request stored only if nobody changed its status meanwhile.
+// With Force the images of the files are deleted before, so none of the previous preview is served
+// if the new one fails. Without it they are kept, and only the ranges without an image are planned
+func (s Service) Reprocess(ctx context.Context, cmd CMD) error {
+	torrent, err := s.torrentRepository.Get(ctx, cmd.TorrentID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range cmd.FileIDs {
+		if _, err := torrent.SupportedFile(id); err != nil {
+			return err
+		}
+	}
+
+	previous := torrent.Status()
+	if err := torrent.Reprocess(cmd.Force); err != nil {
+		return err
+	}
+
+	deleted := 0
+	if cmd.Force {
+		if deleted, err = s.deleteImages(ctx, torrent.ID(), cmd.FileIDs); err != nil {
+			return err
+		}
+	}
+
+	event := preview.NewTorrentReprocessRequestedEvent(torrent.ID(), cmd.FileIDs, cmd.Force, previous, cmd.limits(), time.Now())
+	err = s.torrentRepository.UpdateStatusFrom(ctx, torrent, previous, event)
+	if errors.Is(err, preview.ErrConcurrentUpdate) {
+		return fmt.Errorf("%w: the torrent has changed meanwhile", preview.ErrPreviewInProgress)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"torrentID":      torrent.ID(),
+		"files":          cmd.FileIDs,
+		"force":          cmd.Force,
+		"previousStatus": previous,
+		"deletedImages":  deleted,
+	}).Info("reprocess of the torrent requested")
+	return nil
+}
+
+// deleteImages removes the images of the files, or of the whole torrent if none is given. The files are
+// deleted before the rows that point to them, so a failed deletion can be tried again
+func (s Service) deleteImages(ctx context.Context, torrentID string, fileIDs []int) (int, error) {
+	images, err := s.imageRepository.ByTorrent(ctx, torrentID)
+	if err != nil {
+		return 0, err
+	}
+
+	selected := make(map[int]bool, len(fileIDs))
+	for _, id := range fileIDs {
+		selected[id] = true
+	}
+	deleted := 0
+	for _, img := range images.Images() {
+		if len(selected) > 0 && !selected[img.FileID()] {
+			continue
+		}
+		if err := s.imagePersister.DeleteFile(ctx, img.Name()); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, s.imageRepository.DeleteByFiles(ctx, torrentID, fileIDs)
+}
@@ -0,0 +1,187 @@
+package reprocessTorrent_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"prevtorrent/internal/preview/reprocessTorrent"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const torrentID = "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+func TestService_Reprocess(t *testing.T) {
+	torrent := fakeTorrent(t, preview.StatusPartiallyCompleted)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusPlanned
+	}), preview.StatusPartiallyCompleted, mock.MatchedBy(func(e *preview.TorrentReprocessRequestedEvent) bool {
+		return e.TorrentID == torrentID &&
+			assert.ObjectsAreEqual([]int{1}, e.FileIDs) &&
+			e.Force &&
+			e.PreviousStatus == preview.StatusPartiallyCompleted &&
+			e.MaxDownloadTime == time.Minute &&
+			!e.RequestedAt.IsZero()
+	})).Return(nil)
+
+	// Only the images of the file reprocessed are deleted
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages([]preview.Image{
+		preview.NewImage(torrentID, 0, "0.00.jpg", 100),
+		preview.NewImage(torrentID, 1, "1.00.jpg", 100),
+		preview.NewImage(torrentID, 1, "1.01.jpg", 100),
+	}), nil)
+	imageRepository.On("DeleteByFiles", mock.Anything, torrentID, []int{1}).Return(nil)
+	imagePersister := new(storagemocks.ImagePersister)
+	imagePersister.On("DeleteFile", mock.Anything, "1.00.jpg").Return(nil)
+	imagePersister.On("DeleteFile", mock.Anything, "1.01.jpg").Return(nil)
+
+	service := reprocessTorrent.NewService(fakeLogger(), torrentRepository, imageRepository, imagePersister)
+
+	err := service.Reprocess(context.Background(), reprocessTorrent.CMD{
+		TorrentID:       torrentID,
+		FileIDs:         []int{1},
+		Force:           true,
+		MaxDownloadTime: time.Minute,
+	})
+	require.NoError(t, err)
+	torrentRepository.AssertExpectations(t)
+	imageRepository.AssertExpectations(t)
+	imagePersister.AssertExpectations(t)
+	imagePersister.AssertNotCalled(t, "DeleteFile", mock.Anything, "0.00.jpg")
+}
+
+func TestService_Reprocess_WithoutForceKeepsTheImages(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusPartiallyCompleted), nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, preview.StatusPartiallyCompleted, mock.Anything).Return(nil)
+	imageRepository := new(storagemocks.ImageRepository)
+
+	service := reprocessTorrent.NewService(fakeLogger(), torrentRepository, imageRepository, new(storagemocks.ImagePersister))
+
+	err := service.Reprocess(context.Background(), reprocessTorrent.CMD{TorrentID: torrentID})
+	require.NoError(t, err)
+	imageRepository.AssertNotCalled(t, "DeleteByFiles", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestService_Reprocess_ImagesNotDeleted(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusCompleted), nil)
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages([]preview.Image{
+		preview.NewImage(torrentID, 0, "0.00.jpg", 100),
+	}), nil)
+	imagePersister := new(storagemocks.ImagePersister)
+	imagePersister.On("DeleteFile", mock.Anything, "0.00.jpg").Return(errors.New("fake error"))
+
+	service := reprocessTorrent.NewService(fakeLogger(), torrentRepository, imageRepository, imagePersister)
+
+	err := service.Reprocess(context.Background(), reprocessTorrent.CMD{TorrentID: torrentID, Force: true})
+	require.Error(t, err)
+	// Nothing is planned, and the rows are kept so the request can be sent again
+	imageRepository.AssertNotCalled(t, "DeleteByFiles", mock.Anything, mock.Anything, mock.Anything)
+	torrentRepository.AssertNotCalled(t, "UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestService_Reprocess_NotFound(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(preview.Torrent{}, preview.ErrNotFound)
+
+	service := reprocessTorrent.NewService(fakeLogger(), torrentRepository, new(storagemocks.ImageRepository), new(storagemocks.ImagePersister))
+
+	err := service.Reprocess(context.Background(), reprocessTorrent.CMD{TorrentID: torrentID})
+	assert.True(t, errors.Is(err, preview.ErrNotFound))
+}
+
+func TestService_Reprocess_InProgress(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusDownloading), nil)
+
+	service := reprocessTorrent.NewService(fakeLogger(), torrentRepository, new(storagemocks.ImageRepository), new(storagemocks.ImagePersister))
+
+	err := service.Reprocess(context.Background(), reprocessTorrent.CMD{TorrentID: torrentID})
+	assert.True(t, errors.Is(err, preview.ErrPreviewInProgress))
+	torrentRepository.AssertNotCalled(t, "UpdateStatusFrom", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestService_Reprocess_ForceTakesOverThePlanInProgress(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusDownloading), nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusPlanned
+	}), preview.StatusDownloading, mock.AnythingOfType("*preview.TorrentReprocessRequestedEvent")).Return(nil)
+	imageRepository := new(storagemocks.ImageRepository)
+	imageRepository.On("ByTorrent", mock.Anything, torrentID).Return(preview.NewTorrentImages(nil), nil)
+	imageRepository.On("DeleteByFiles", mock.Anything, torrentID, []int(nil)).Return(nil)
+
+	service := reprocessTorrent.NewService(fakeLogger(), torrentRepository, imageRepository, new(storagemocks.ImagePersister))
+
+	err := service.Reprocess(context.Background(), reprocessTorrent.CMD{TorrentID: torrentID, Force: true})
+	require.NoError(t, err)
+	torrentRepository.AssertExpectations(t)
+}
+
+func TestService_Reprocess_ForceDoesNotTakeOverTheResolving(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusResolving), nil)
+
+	service := reprocessTorrent.NewService(fakeLogger(), torrentRepository, new(storagemocks.ImageRepository), new(storagemocks.ImagePersister))
+
+	err := service.Reprocess(context.Background(), reprocessTorrent.CMD{TorrentID: torrentID, Force: true})
+	assert.True(t, errors.Is(err, preview.ErrPreviewInProgress))
+}
+
+func TestService_Reprocess_ChangedConcurrently(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusCompleted), nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.Anything, preview.StatusCompleted, mock.Anything).
+		Return(preview.ErrConcurrentUpdate)
+
+	service := reprocessTorrent.NewService(fakeLogger(), torrentRepository, new(storagemocks.ImageRepository), new(storagemocks.ImagePersister))
+
+	err := service.Reprocess(context.Background(), reprocessTorrent.CMD{TorrentID: torrentID})
+	assert.True(t, errors.Is(err, preview.ErrPreviewInProgress))
+}
+
+func TestService_Reprocess_InvalidFile(t *testing.T) {
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(fakeTorrent(t, preview.StatusCompleted), nil)
+
+	service := reprocessTorrent.NewService(fakeLogger(), torrentRepository, new(storagemocks.ImageRepository), new(storagemocks.ImagePersister))
+
+	err := service.Reprocess(context.Background(), reprocessTorrent.CMD{TorrentID: torrentID, FileIDs: []int{2}})
+	assert.True(t, errors.Is(err, preview.ErrInvalidFile))
+
+	err = service.Reprocess(context.Background(), reprocessTorrent.CMD{TorrentID: torrentID, FileIDs: []int{9}})
+	assert.True(t, errors.Is(err, preview.ErrInvalidFile))
+}
+
+func fakeTorrent(t *testing.T, status preview.Status) preview.Torrent {
+	f1, err := preview.NewFileInfo(0, 1000, "movie.mp4")
+	require.NoError(t, err)
+	f2, err := preview.NewFileInfo(1, 1000, "movie2.mp4")
+	require.NoError(t, err)
+	f3, err := preview.NewFileInfo(2, 10, "subtitles.srt")
+	require.NoError(t, err)
+
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 100, []preview.File{f1, f2, f3}, []byte(""))
+	require.NoError(t, err)
+	torrent.RestoreStatus(status, "")
+	return torrent
+}
+
+func fakeLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	return l
+}
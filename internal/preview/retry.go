@@ -0,0 +1,154 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrTooManyRetries = errors.New("too many retries")
+
+//go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=RetryRepository
+type RetryRepository interface {
+	Get(ctx context.Context, torrentID string) (*DownloadRetry, error)
+	// Persist stores the retry. It returns ErrConcurrentUpdate if it has been persisted by someone
+	// else since it was read
+	Persist(ctx context.Context, retry *DownloadRetry) error
+	Due(ctx context.Context, now time.Time) ([]*DownloadRetry, error)
+}
+
+// FileSegment describes, with primitives, a segment of a file that has to be downloaded
+type FileSegment struct {
+	FileID int
+	Start  int
+	Length int
+}
+
+// PendingDownload is a download waiting to be retried, with the limits and the force flag of the
+// download that failed, so it is sent again as it was requested
+type PendingDownload struct {
+	Segments []FileSegment
+	Limits   DownloadLimits
+	Force    bool
+}
+
+// RetryPolicy describes how many times and how often we try to download a torrent again
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Backoff returns how long we have to wait before the given attempt (starting at 1). The
+// time doubles on each attempt, up to MaxBackoff
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
+
+// DownloadRetry keeps track of the downloads of a torrent that have to be tried again later.
+// The attempts are counted per torrent: all the downloads that fail while another retry is
+// waiting are sent together with it, and count as a single attempt.
+type DownloadRetry struct {
+	torrentID     string
+	attempts      int
+	nextAttemptAt time.Time
+	pending       []PendingDownload
+	lastError     string
+	version       int
+}
+
+// NewDownloadRetry returns a DownloadRetry without attempts
+func NewDownloadRetry(torrentID string) *DownloadRetry {
+	return &DownloadRetry{torrentID: torrentID, pending: make([]PendingDownload, 0)}
+}
+
+// RestoreDownloadRetry returns a DownloadRetry with all its state. Meant to be used by the repositories.
+func RestoreDownloadRetry(torrentID string, attempts int, nextAttemptAt time.Time, pending []PendingDownload, lastError string, version int) *DownloadRetry {
+	r := NewDownloadRetry(torrentID)
+	r.attempts = attempts
+	r.nextAttemptAt = nextAttemptAt
+	r.pending = append(r.pending, pending...)
+	r.lastError = lastError
+	r.version = version
+	return r
+}
+
+// TorrentID returns the obvious
+func (r *DownloadRetry) TorrentID() string {
+	return r.torrentID
+}
+
+// Attempts returns the number of retries scheduled so far
+func (r *DownloadRetry) Attempts() int {
+	return r.attempts
+}
+
+// NextAttemptAt returns when the pending downloads are going to be tried again
+func (r *DownloadRetry) NextAttemptAt() time.Time {
+	return r.nextAttemptAt
+}
+
+// Pending returns the downloads waiting to be retried
+func (r *DownloadRetry) Pending() []PendingDownload {
+	return r.pending
+}
+
+// LastError returns the reason of the last download failure
+func (r *DownloadRetry) LastError() string {
+	return r.lastError
+}
+
+// Version is incremented each time the retry is persisted, to detect concurrent updates
+func (r *DownloadRetry) Version() int {
+	return r.version
+}
+
+// IsWaiting returns true if there are downloads waiting to be retried
+func (r *DownloadRetry) IsWaiting() bool {
+	return len(r.pending) > 0
+}
+
+// IsDue returns true if the pending downloads have to be retried now
+func (r *DownloadRetry) IsDue(now time.Time) bool {
+	return r.IsWaiting() && !now.Before(r.nextAttemptAt)
+}
+
+// Schedule registers a download to be tried again. Returns ErrTooManyRetries if we have
+// already tried policy.MaxAttempts times
+func (r *DownloadRetry) Schedule(download PendingDownload, reason error, policy RetryPolicy, now time.Time) error {
+	r.lastError = reason.Error()
+	if r.IsWaiting() {
+		r.pending = append(r.pending, download)
+		return nil
+	}
+
+	if r.attempts >= policy.MaxAttempts {
+		return ErrTooManyRetries
+	}
+
+	r.attempts++
+	r.nextAttemptAt = now.Add(policy.Backoff(r.attempts))
+	r.pending = append(r.pending, download)
+	return nil
+}
+
+// Release returns the pending downloads and forgets about them. The attempts are kept
+func (r *DownloadRetry) Release() []PendingDownload {
+	pending := r.pending
+	r.pending = make([]PendingDownload, 0)
+	return pending
+}
+
+// Reset forgets the attempts made so far, once the torrent has been downloaded again or a new
+// preview has been requested. The downloads waiting are still retried when due
+func (r *DownloadRetry) Reset() {
+	r.attempts = 0
+	r.lastError = ""
+}
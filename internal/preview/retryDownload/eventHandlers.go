@@ -0,0 +1,86 @@
+package retryDownload
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+)
+
+type NoSeedersFoundEventHandler struct {
+	service Service
+}
+
+func NewNoSeedersFoundEventHandler(service Service) *NoSeedersFoundEventHandler {
+	return &NoSeedersFoundEventHandler{service: service}
+}
+
+func (h NoSeedersFoundEventHandler) HandlerName() string {
+	return "event.retry.noSeedersFound"
+}
+
+func (NoSeedersFoundEventHandler) NewEvent() interface{} {
+	return new(preview.NoSeedersFoundEvent)
+}
+
+func (h *NoSeedersFoundEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.Schedule(ctx, *e.(*preview.NoSeedersFoundEvent))
+}
+
+type DownloadIncompleteEventHandler struct {
+	service Service
+}
+
+func NewDownloadIncompleteEventHandler(service Service) *DownloadIncompleteEventHandler {
+	return &DownloadIncompleteEventHandler{service: service}
+}
+
+func (h DownloadIncompleteEventHandler) HandlerName() string {
+	return "event.retry.downloadIncomplete"
+}
+
+func (DownloadIncompleteEventHandler) NewEvent() interface{} {
+	return new(preview.DownloadIncompleteEvent)
+}
+
+func (h *DownloadIncompleteEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.ScheduleMissing(ctx, *e.(*preview.DownloadIncompleteEvent))
+}
+
+type PartialDownloadFinishedEventHandler struct {
+	service Service
+}
+
+func NewPartialDownloadFinishedEventHandler(service Service) *PartialDownloadFinishedEventHandler {
+	return &PartialDownloadFinishedEventHandler{service: service}
+}
+
+func (h PartialDownloadFinishedEventHandler) HandlerName() string {
+	return "event.retry.partialDownloadFinished"
+}
+
+func (PartialDownloadFinishedEventHandler) NewEvent() interface{} {
+	return new(preview.PartialDownloadFinishedEvent)
+}
+
+func (h *PartialDownloadFinishedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.DownloadFinished(ctx, *e.(*preview.PartialDownloadFinishedEvent))
+}
+
+type TorrentReprocessRequestedEventHandler struct {
+	service Service
+}
+
+func NewTorrentReprocessRequestedEventHandler(service Service) *TorrentReprocessRequestedEventHandler {
+	return &TorrentReprocessRequestedEventHandler{service: service}
+}
+
+func (h TorrentReprocessRequestedEventHandler) HandlerName() string {
+	return "event.retry.torrentReprocess"
+}
+
+func (TorrentReprocessRequestedEventHandler) NewEvent() interface{} {
+	return new(preview.TorrentReprocessRequestedEvent)
+}
+
+func (h *TorrentReprocessRequestedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.Reset(ctx, e.(*preview.TorrentReprocessRequestedEvent).TorrentID)
+}
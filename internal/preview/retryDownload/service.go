@@ -0,0 +1,228 @@
+package retryDownload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"prevtorrent/internal/platform/bus"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/downloadPartials"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxUpdateAttempts is how many times a change is applied when the retry is updated concurrently.
+// The event is handled again once they are exhausted
+const maxUpdateAttempts = 5
+
+// Service schedules the downloads that could not be done because the torrent had no seeders,
+// and sends them again once it's time to do so
+type Service struct {
+	logger            *logrus.Logger
+	commandBus        bus.Command
+	eventBus          bus.Event
+	torrentRepository preview.TorrentRepository
+	retryRepository   preview.RetryRepository
+	policy            preview.RetryPolicy
+}
+
+func NewService(
+	logger *logrus.Logger,
+	commandBus bus.Command,
+	eventBus bus.Event,
+	torrentRepository preview.TorrentRepository,
+	retryRepository preview.RetryRepository,
+	policy preview.RetryPolicy,
+) Service {
+	return Service{
+		logger:            logger,
+		commandBus:        commandBus,
+		eventBus:          eventBus,
+		torrentRepository: torrentRepository,
+		retryRepository:   retryRepository,
+		policy:            policy,
+	}
+}
+
+// Schedule registers the download of the event to be tried again later
+func (s Service) Schedule(ctx context.Context, event preview.NoSeedersFoundEvent) error {
+	download := preview.PendingDownload{Segments: event.Segments, Limits: event.Limits, Force: event.Force}
+	return s.schedule(ctx, event.TorrentID, download, errors.New(event.Reason), event.FoundAt)
+}
+
+// ScheduleMissing registers the segments that have not been downloaded to be tried again later
+func (s Service) ScheduleMissing(ctx context.Context, event preview.DownloadIncompleteEvent) error {
+	reason := fmt.Errorf("%v pieces missing in %v ranges", event.PiecesMissing(), len(event.Ranges))
+	download := preview.PendingDownload{Segments: event.Segments, Limits: event.Limits, Force: event.Force}
+	return s.schedule(ctx, event.TorrentID, download, reason, event.FinishedAt)
+}
+
+func (s Service) schedule(ctx context.Context, torrentID string, download preview.PendingDownload, reason error, at time.Time) error {
+	var exhausted *preview.DownloadRetry
+	err := s.update(ctx, torrentID, func(retry *preview.DownloadRetry) (bool, error) {
+		err := retry.Schedule(download, reason, s.policy, at)
+		if errors.Is(err, preview.ErrTooManyRetries) {
+			exhausted = retry
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"torrentID":     retry.TorrentID(),
+			"attempt":       retry.Attempts(),
+			"nextAttemptAt": retry.NextAttemptAt(),
+		}).Info("download scheduled to be retried")
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if exhausted != nil {
+		return s.giveUp(ctx, exhausted)
+	}
+	return nil
+}
+
+// DownloadFinished forgets the failed attempts of the torrent once one of its downloads succeeds
+func (s Service) DownloadFinished(ctx context.Context, event preview.PartialDownloadFinishedEvent) error {
+	if !event.Succeeded() {
+		return nil
+	}
+	return s.Reset(ctx, event.TorrentID)
+}
+
+// Reset forgets the failed attempts of the torrent, so the next failures are retried again
+func (s Service) Reset(ctx context.Context, torrentID string) error {
+	return s.update(ctx, torrentID, func(retry *preview.DownloadRetry) (bool, error) {
+		if retry.Attempts() == 0 {
+			return false, nil
+		}
+		retry.Reset()
+		return true, nil
+	})
+}
+
+// update applies the change to the latest retry of the torrent, and stores it if the change says so.
+// The change is applied again if someone else updated the retry in the meantime
+func (s Service) update(ctx context.Context, torrentID string, change func(retry *preview.DownloadRetry) (bool, error)) error {
+	err := preview.ErrConcurrentUpdate
+	for attempt := 1; attempt <= maxUpdateAttempts && errors.Is(err, preview.ErrConcurrentUpdate); attempt++ {
+		retry, getErr := s.retryRepository.Get(ctx, torrentID)
+		if errors.Is(getErr, preview.ErrNotFound) {
+			retry, getErr = preview.NewDownloadRetry(torrentID), nil
+		}
+		if getErr != nil {
+			return getErr
+		}
+
+		changed, changeErr := change(retry)
+		if changeErr != nil || !changed {
+			return changeErr
+		}
+
+		err = s.retryRepository.Persist(ctx, retry)
+	}
+	return err
+}
+
+// SendDue sends again all the downloads that are due
+func (s Service) SendDue(ctx context.Context, now time.Time) error {
+	retries, err := s.retryRepository.Due(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, retry := range retries {
+		for i, download := range retry.Release() {
+			cmd := downloadPartials.NewCMD(retry.TorrentID(), download.Segments)
+			cmd.MaxDownloadTime = download.Limits.MaxDownloadTime
+			cmd.SeederWaitTime = download.Limits.SeederWaitTime
+			cmd.Deadline = download.Limits.Deadline
+			cmd.Force = download.Force
+			// Sent again if the retry cannot be persisted, and it must not be downloaded twice
+			cmd.IdempotencyKey = retryKey(retry, i)
+			if err := s.commandBus.Send(ctx, cmd); err != nil {
+				return err
+			}
+		}
+
+		// If some download has been scheduled meanwhile, the retry is sent again on the next run. The
+		// downloads already sent have the same keys, and are skipped by the handlers
+		err := s.retryRepository.Persist(ctx, retry)
+		if errors.Is(err, preview.ErrConcurrentUpdate) {
+			s.logger.WithContext(ctx).WithFields(logrus.Fields{
+				"torrentID": retry.TorrentID(),
+			}).Warn("retry updated while being sent. Sending it again on the next run")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"torrentID": retry.TorrentID(),
+			"attempt":   retry.Attempts(),
+		}).Info("download retried")
+	}
+	return nil
+}
+
+// Run sends the due downloads every interval until the context is cancelled
+func (s Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.SendDue(ctx, time.Now()); err != nil {
+				s.logger.WithContext(ctx).WithFields(logrus.Fields{
+					"error": err,
+				}).Error("unable to send the downloads to retry")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// retryKey identifies each download of an attempt. The attempts start again from 1 after a Reset, so
+// the time of the attempt is part of the key too
+func retryKey(retry *preview.DownloadRetry, n int) string {
+	return fmt.Sprintf("retry/%v/%v/%v/%v", retry.TorrentID(), retry.Attempts(), retry.NextAttemptAt().Unix(), n)
+}
+
+func (s Service) giveUp(ctx context.Context, retry *preview.DownloadRetry) error {
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"torrentID": retry.TorrentID(),
+		"attempts":  retry.Attempts(),
+	}).Warn("giving up downloading the torrent")
+
+	if err := s.eventBus.Publish(ctx, preview.NewDownloadRetriesExhaustedEvent(retry, time.Now())); err != nil {
+		return err
+	}
+
+	torrent, err := s.torrentRepository.Get(ctx, retry.TorrentID())
+	if err != nil {
+		return err
+	}
+
+	// We only consider it a failure when we have nothing at all from the torrent
+	if torrent.Status() != preview.StatusNoSeeders {
+		return nil
+	}
+
+	reason := fmt.Errorf("%w: %v after %v attempts", preview.ErrTooManyRetries, retry.LastError(), retry.Attempts())
+	if err := torrent.ChangeStatus(preview.StatusFailed, reason); err != nil {
+		return err
+	}
+	// The status is only changed if no new download moved the torrent away from no seeders meanwhile
+	err = s.torrentRepository.UpdateStatusFrom(ctx, torrent, preview.StatusNoSeeders)
+	if errors.Is(err, preview.ErrConcurrentUpdate) {
+		return nil
+	}
+	return err
+}
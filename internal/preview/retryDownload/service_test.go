@@ -0,0 +1,261 @@
+package retryDownload_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/platform/bus/busmocks"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/downloadPartials"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"prevtorrent/internal/preview/retryDownload"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var policy = preview.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+
+func TestService_Schedule_FirstAttempt(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	foundAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	retryRepository := new(storagemocks.RetryRepository)
+	retryRepository.On("Get", mock.Anything, torrentID).
+		Return(nil, preview.ErrNotFound)
+	limits := preview.DownloadLimits{MaxDownloadTime: time.Minute, SeederWaitTime: time.Second, Deadline: foundAt.Add(time.Hour)}
+	retryRepository.On("Persist", mock.Anything, mock.MatchedBy(func(r *preview.DownloadRetry) bool {
+		return r.Attempts() == 1 &&
+			r.NextAttemptAt().Equal(foundAt.Add(time.Minute)) &&
+			len(r.Pending()) == 1 &&
+			r.Pending()[0].Limits == limits &&
+			r.Pending()[0].Force
+	})).Return(nil)
+
+	service := retryDownload.NewService(fakeLogger(), new(busmocks.Command), new(busmocks.Event), new(storagemocks.TorrentRepository), retryRepository, policy)
+	err := service.Schedule(context.Background(), preview.NoSeedersFoundEvent{
+		TorrentID: torrentID,
+		Segments:  []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}},
+		Limits:    limits,
+		Force:     true,
+		Reason:    "no seeders",
+		FoundAt:   foundAt,
+	})
+	require.NoError(t, err)
+	retryRepository.AssertExpectations(t)
+}
+
+func TestService_ScheduleMissing(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	finishedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	retryRepository := new(storagemocks.RetryRepository)
+	retryRepository.On("Get", mock.Anything, torrentID).
+		Return(nil, preview.ErrNotFound)
+	retryRepository.On("Persist", mock.Anything, mock.MatchedBy(func(r *preview.DownloadRetry) bool {
+		return r.Attempts() == 1 && r.LastError() == "3 pieces missing in 1 ranges"
+	})).Return(nil)
+
+	service := retryDownload.NewService(fakeLogger(), new(busmocks.Command), new(busmocks.Event), new(storagemocks.TorrentRepository), retryRepository, policy)
+	err := service.ScheduleMissing(context.Background(), preview.DownloadIncompleteEvent{
+		TorrentID:  torrentID,
+		Ranges:     []preview.IncompleteRange{{FileID: 0, PieceStart: 0, PieceEnd: 4, PiecesMissing: 3}},
+		Segments:   []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}},
+		FinishedAt: finishedAt,
+	})
+	require.NoError(t, err)
+	retryRepository.AssertExpectations(t)
+}
+
+func TestService_Schedule_GivesUp(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	foundAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	f, err := preview.NewFileInfo(0, 10, "video.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+	torrent.RestoreStatus(preview.StatusNoSeeders, "no seeders")
+
+	retryRepository := new(storagemocks.RetryRepository)
+	retryRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.RestoreDownloadRetry(torrentID, 2, foundAt, nil, "no seeders", 2), nil)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+	torrentRepository.On("UpdateStatusFrom", mock.Anything, mock.MatchedBy(func(t preview.Torrent) bool {
+		return t.Status() == preview.StatusFailed
+	}), preview.StatusNoSeeders).Return(nil)
+
+	eventBus := new(busmocks.Event)
+	eventBus.On("Publish", mock.Anything, mock.MatchedBy(func(e *preview.DownloadRetriesExhaustedEvent) bool {
+		return e.TorrentID == torrentID && e.Attempts == 2 && e.Reason == "no seeders"
+	})).Return(nil)
+
+	service := retryDownload.NewService(fakeLogger(), new(busmocks.Command), eventBus, torrentRepository, retryRepository, policy)
+	err = service.Schedule(context.Background(), preview.NoSeedersFoundEvent{
+		TorrentID: torrentID,
+		Segments:  []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}},
+		Reason:    "no seeders",
+		FoundAt:   foundAt,
+	})
+	require.NoError(t, err)
+	torrentRepository.AssertExpectations(t)
+	eventBus.AssertExpectations(t)
+	retryRepository.AssertNotCalled(t, "Persist", mock.Anything, mock.Anything)
+}
+
+func TestService_SendDue(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	segments := []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}}
+
+	limits := preview.DownloadLimits{MaxDownloadTime: time.Minute, SeederWaitTime: time.Second, Deadline: now.Add(time.Hour)}
+	retry := preview.RestoreDownloadRetry(torrentID, 1, now, []preview.PendingDownload{{Segments: segments, Limits: limits, Force: true}}, "no seeders", 1)
+
+	retryRepository := new(storagemocks.RetryRepository)
+	retryRepository.On("Due", mock.Anything, now).
+		Return([]*preview.DownloadRetry{retry}, nil)
+	retryRepository.On("Persist", mock.Anything, mock.MatchedBy(func(r *preview.DownloadRetry) bool {
+		return !r.IsWaiting() && r.Attempts() == 1
+	})).Return(nil)
+
+	cmd := downloadPartials.NewCMD(torrentID, segments)
+	cmd.MaxDownloadTime = time.Minute
+	cmd.SeederWaitTime = time.Second
+	cmd.Deadline = now.Add(time.Hour)
+	cmd.Force = true
+	cmd.IdempotencyKey = "retry/cb84ccc10f296df72d6c40ba7a07c178a4323a14/1/1614592800/0"
+	commandBus := new(busmocks.Command)
+	commandBus.On("Send", mock.Anything, cmd).
+		Return(nil)
+
+	service := retryDownload.NewService(fakeLogger(), commandBus, new(busmocks.Event), new(storagemocks.TorrentRepository), retryRepository, policy)
+	err := service.SendDue(context.Background(), now)
+	require.NoError(t, err)
+
+	commandBus.AssertExpectations(t)
+	retryRepository.AssertExpectations(t)
+}
+
+func TestService_SendDue_ErrorSendingCommand(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	segments := []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}}
+
+	retryRepository := new(storagemocks.RetryRepository)
+	retryRepository.On("Due", mock.Anything, now).
+		Return([]*preview.DownloadRetry{
+			preview.RestoreDownloadRetry(torrentID, 1, now, []preview.PendingDownload{{Segments: segments}}, "no seeders", 1),
+		}, nil)
+
+	commandBus := new(busmocks.Command)
+	commandBus.On("Send", mock.Anything, mock.Anything).
+		Return(errors.New("fake send error"))
+
+	service := retryDownload.NewService(fakeLogger(), commandBus, new(busmocks.Event), new(storagemocks.TorrentRepository), retryRepository, policy)
+	err := service.SendDue(context.Background(), now)
+	require.Error(t, err)
+	retryRepository.AssertNotCalled(t, "Persist", mock.Anything, mock.Anything)
+}
+
+func TestService_Schedule_UpdatedConcurrently(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	foundAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	sent := []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}}
+
+	// Someone else scheduled a download meanwhile
+	retryRepository := new(storagemocks.RetryRepository)
+	retryRepository.On("Get", mock.Anything, torrentID).
+		Return(nil, preview.ErrNotFound).Once()
+	retryRepository.On("Persist", mock.Anything, mock.MatchedBy(func(r *preview.DownloadRetry) bool {
+		return r.Version() == 0
+	})).Return(preview.ErrConcurrentUpdate).Once()
+	retryRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.RestoreDownloadRetry(torrentID, 1, foundAt, []preview.PendingDownload{{Segments: sent}}, "no seeders", 1), nil).Once()
+	retryRepository.On("Persist", mock.Anything, mock.MatchedBy(func(r *preview.DownloadRetry) bool {
+		return r.Version() == 1 && r.Attempts() == 1 && len(r.Pending()) == 2
+	})).Return(nil).Once()
+
+	service := retryDownload.NewService(fakeLogger(), new(busmocks.Command), new(busmocks.Event), new(storagemocks.TorrentRepository), retryRepository, policy)
+	err := service.Schedule(context.Background(), preview.NoSeedersFoundEvent{
+		TorrentID: torrentID,
+		Segments:  []preview.FileSegment{{FileID: 1, Start: 0, Length: 10}},
+		Reason:    "no seeders",
+		FoundAt:   foundAt,
+	})
+	require.NoError(t, err)
+	retryRepository.AssertExpectations(t)
+}
+
+func TestService_SendDue_UpdatedConcurrently(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	segments := []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}}
+
+	retryRepository := new(storagemocks.RetryRepository)
+	retryRepository.On("Due", mock.Anything, now).
+		Return([]*preview.DownloadRetry{
+			preview.RestoreDownloadRetry(torrentID, 1, now, []preview.PendingDownload{{Segments: segments}}, "no seeders", 1),
+		}, nil)
+	retryRepository.On("Persist", mock.Anything, mock.Anything).
+		Return(preview.ErrConcurrentUpdate)
+
+	commandBus := new(busmocks.Command)
+	commandBus.On("Send", mock.Anything, mock.Anything).
+		Return(nil)
+
+	service := retryDownload.NewService(fakeLogger(), commandBus, new(busmocks.Event), new(storagemocks.TorrentRepository), retryRepository, policy)
+	err := service.SendDue(context.Background(), now)
+	require.NoError(t, err, "the downloads are sent again on the next run")
+	commandBus.AssertNumberOfCalls(t, "Send", 1)
+}
+
+func TestService_DownloadFinished_ResetsTheAttempts(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	retryRepository := new(storagemocks.RetryRepository)
+	retryRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.RestoreDownloadRetry(torrentID, 2, now, nil, "no seeders", 3), nil)
+	retryRepository.On("Persist", mock.Anything, mock.MatchedBy(func(r *preview.DownloadRetry) bool {
+		return r.Attempts() == 0 && r.LastError() == "" && r.Version() == 3
+	})).Return(nil)
+
+	service := retryDownload.NewService(fakeLogger(), new(busmocks.Command), new(busmocks.Event), new(storagemocks.TorrentRepository), retryRepository, policy)
+	err := service.DownloadFinished(context.Background(), preview.PartialDownloadFinishedEvent{TorrentID: torrentID, FinishedAt: now})
+	require.NoError(t, err)
+	retryRepository.AssertExpectations(t)
+}
+
+func TestService_DownloadFinished_IgnoresFailures(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	retryRepository := new(storagemocks.RetryRepository)
+
+	service := retryDownload.NewService(fakeLogger(), new(busmocks.Command), new(busmocks.Event), new(storagemocks.TorrentRepository), retryRepository, policy)
+	err := service.DownloadFinished(context.Background(), preview.PartialDownloadFinishedEvent{TorrentID: torrentID, Reason: "no seeders"})
+	require.NoError(t, err)
+	retryRepository.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+}
+
+func TestService_Reset_NothingToReset(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	retryRepository := new(storagemocks.RetryRepository)
+	retryRepository.On("Get", mock.Anything, torrentID).
+		Return(nil, preview.ErrNotFound)
+
+	service := retryDownload.NewService(fakeLogger(), new(busmocks.Command), new(busmocks.Event), new(storagemocks.TorrentRepository), retryRepository, policy)
+	require.NoError(t, service.Reset(context.Background(), torrentID))
+	retryRepository.AssertNotCalled(t, "Persist", mock.Anything, mock.Anything)
+}
+
+func fakeLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	return l
+}
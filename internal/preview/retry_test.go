@@ -0,0 +1,66 @@
+package preview_test
+
+import (
+	"errors"
+	"prevtorrent/internal/preview"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := preview.RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Minute, MaxBackoff: 5 * time.Minute}
+
+	assert.Equal(t, time.Minute, policy.Backoff(1))
+	assert.Equal(t, 2*time.Minute, policy.Backoff(2))
+	assert.Equal(t, 4*time.Minute, policy.Backoff(3))
+	assert.Equal(t, 5*time.Minute, policy.Backoff(4))
+	assert.Equal(t, 5*time.Minute, policy.Backoff(10))
+}
+
+func TestDownloadRetry_Schedule(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	policy := preview.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+	download := preview.PendingDownload{Segments: []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}}}
+	reason := errors.New("no seeders")
+
+	retry := preview.NewDownloadRetry("cb84ccc10f296df72d6c40ba7a07c178a4323a14")
+	require.NoError(t, retry.Schedule(download, reason, policy, now))
+	assert.Equal(t, 1, retry.Attempts())
+	assert.False(t, retry.IsDue(now))
+	assert.True(t, retry.IsDue(now.Add(time.Minute)))
+
+	// A download failing while another one is waiting is sent with it
+	require.NoError(t, retry.Schedule(download, reason, policy, now))
+	assert.Equal(t, 1, retry.Attempts())
+	assert.Len(t, retry.Release(), 2)
+	assert.False(t, retry.IsWaiting())
+
+	require.NoError(t, retry.Schedule(download, reason, policy, now))
+	assert.Equal(t, 2, retry.Attempts())
+	assert.Equal(t, now.Add(2*time.Minute), retry.NextAttemptAt())
+	retry.Release()
+
+	err := retry.Schedule(download, reason, policy, now)
+	require.True(t, errors.Is(err, preview.ErrTooManyRetries))
+}
+
+func TestDownloadRetry_Reset(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	policy := preview.RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+	download := preview.PendingDownload{Segments: []preview.FileSegment{{FileID: 0, Start: 0, Length: 10}}}
+	reason := errors.New("no seeders")
+
+	retry := preview.NewDownloadRetry("cb84ccc10f296df72d6c40ba7a07c178a4323a14")
+	require.NoError(t, retry.Schedule(download, reason, policy, now))
+	retry.Release()
+	require.True(t, errors.Is(retry.Schedule(download, reason, policy, now), preview.ErrTooManyRetries))
+
+	retry.Reset()
+	assert.Equal(t, 0, retry.Attempts())
+	assert.Empty(t, retry.LastError())
+	require.NoError(t, retry.Schedule(download, reason, policy, now))
+	assert.Equal(t, 1, retry.Attempts())
+}
@@ -0,0 +1,174 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrConcurrentUpdate = errors.New("updated concurrently by someone else")
+	ErrSagaFinished     = errors.New("the preview has already finished")
+	ErrSagaRunning      = errors.New("the preview is still running")
+)
+
+//go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=SagaRepository
+type SagaRepository interface {
+	Get(ctx context.Context, torrentID string) (*PreviewSaga, error)
+	// Persist stores the saga along with the events given. It returns ErrConcurrentUpdate if the
+	// saga has changed since it was read, or if a new one is started while there is one stored
+	Persist(ctx context.Context, saga *PreviewSaga, events ...interface{}) error
+}
+
+// PreviewSaga follows the downloads of a DownloadPlan until all of them have finished, either
+// downloaded or failed. The downloads sent again by the retries count as the ones they replace.
+type PreviewSaga struct {
+	torrentID  string
+	parts      int
+	succeeded  int
+	failed     int
+	lastError  string
+	startedAt  time.Time
+	finishedAt time.Time
+	version    int
+}
+
+// StartPreviewSaga returns a saga waiting for the given number of downloads
+func StartPreviewSaga(torrentID string, parts int, now time.Time) *PreviewSaga {
+	s := &PreviewSaga{torrentID: torrentID, parts: parts, startedAt: now}
+	if parts == 0 {
+		s.finishedAt = now
+	}
+	return s
+}
+
+// Restart starts the saga again for a new plan with the given number of downloads. Returns
+// ErrSagaRunning if the downloads of the previous plan have not finished. The version is kept, so
+// the saga is replaced only if nobody else did since it was read
+func (s *PreviewSaga) Restart(parts int, now time.Time) error {
+	if !s.IsFinished() {
+		return ErrSagaRunning
+	}
+	s.Replace(parts, now)
+	return nil
+}
+
+// Replace works like Restart, even if the downloads of the previous plan have not finished. Meant
+// for the plans that got stuck: the downloads of the previous plan that finish afterwards count as
+// the ones of the new plan
+func (s *PreviewSaga) Replace(parts int, now time.Time) {
+	replaced := StartPreviewSaga(s.torrentID, parts, now)
+	replaced.version = s.version
+	*s = *replaced
+}
+
+// RestorePreviewSaga returns a PreviewSaga with all its state. Meant to be used by the repositories.
+func RestorePreviewSaga(
+	torrentID string,
+	parts, succeeded, failed int,
+	lastError string,
+	startedAt, finishedAt time.Time,
+	version int,
+) *PreviewSaga {
+	return &PreviewSaga{
+		torrentID:  torrentID,
+		parts:      parts,
+		succeeded:  succeeded,
+		failed:     failed,
+		lastError:  lastError,
+		startedAt:  startedAt,
+		finishedAt: finishedAt,
+		version:    version,
+	}
+}
+
+// TorrentID returns the obvious
+func (s *PreviewSaga) TorrentID() string {
+	return s.torrentID
+}
+
+// Parts returns the number of downloads of the plan
+func (s *PreviewSaga) Parts() int {
+	return s.parts
+}
+
+// Succeeded returns the number of downloads finished successfully, even if some pieces were missing
+func (s *PreviewSaga) Succeeded() int {
+	return s.succeeded
+}
+
+// Failed returns the number of downloads that have been given up
+func (s *PreviewSaga) Failed() int {
+	return s.failed
+}
+
+// Pending returns the number of downloads that have not finished yet
+func (s *PreviewSaga) Pending() int {
+	return s.parts - s.succeeded - s.failed
+}
+
+// LastError returns the reason of the last failed download
+func (s *PreviewSaga) LastError() string {
+	return s.lastError
+}
+
+// StartedAt returns when the plan was made
+func (s *PreviewSaga) StartedAt() time.Time {
+	return s.startedAt
+}
+
+// FinishedAt returns when the last download finished. Zero while there are downloads pending
+func (s *PreviewSaga) FinishedAt() time.Time {
+	return s.finishedAt
+}
+
+// Version is incremented each time the saga is persisted, to detect concurrent updates
+func (s *PreviewSaga) Version() int {
+	return s.version
+}
+
+// IsFinished returns true once all the downloads have finished
+func (s *PreviewSaga) IsFinished() bool {
+	return s.Pending() <= 0
+}
+
+// PartSucceeded registers a download as finished. Returns ErrSagaFinished if there was no
+// download pending
+func (s *PreviewSaga) PartSucceeded(now time.Time) error {
+	if s.IsFinished() {
+		return ErrSagaFinished
+	}
+	s.succeeded++
+	s.finish(now)
+	return nil
+}
+
+// PartFailed registers a download as given up. Returns ErrSagaFinished if there was no
+// download pending
+func (s *PreviewSaga) PartFailed(reason string, now time.Time) error {
+	if s.IsFinished() {
+		return ErrSagaFinished
+	}
+	s.failed++
+	s.lastError = reason
+	s.finish(now)
+	return nil
+}
+
+func (s *PreviewSaga) finish(now time.Time) {
+	if s.IsFinished() {
+		s.finishedAt = now
+	}
+}
+
+// Outcome returns the event telling how the preview ended: TorrentPreviewFailedEvent if all the
+// downloads have failed, TorrentPreviewCompletedEvent otherwise. Nil while the saga is not finished
+func (s *PreviewSaga) Outcome(images int) interface{} {
+	if !s.IsFinished() {
+		return nil
+	}
+	if s.parts > 0 && s.succeeded == 0 {
+		return NewTorrentPreviewFailedEvent(s, s.lastError)
+	}
+	return NewTorrentPreviewCompletedEvent(s, images)
+}
@@ -0,0 +1,78 @@
+package preview_test
+
+import (
+	"errors"
+	"prevtorrent/internal/preview"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewSaga_Completed(t *testing.T) {
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	saga := preview.StartPreviewSaga("cb84", 3, startedAt)
+
+	require.NoError(t, saga.PartSucceeded(startedAt.Add(time.Minute)))
+	require.NoError(t, saga.PartFailed("no seeders", startedAt.Add(2*time.Minute)))
+	assert.False(t, saga.IsFinished())
+	assert.Nil(t, saga.Outcome(0))
+
+	require.NoError(t, saga.PartSucceeded(startedAt.Add(3*time.Minute)))
+	assert.True(t, saga.IsFinished())
+	assert.Equal(t, &preview.TorrentPreviewCompletedEvent{
+		TorrentID:   "cb84",
+		Parts:       3,
+		FailedParts: 1,
+		Images:      5,
+		StartedAt:   startedAt,
+		FinishedAt:  startedAt.Add(3 * time.Minute),
+	}, saga.Outcome(5))
+
+	assert.True(t, errors.Is(saga.PartSucceeded(startedAt.Add(4*time.Minute)), preview.ErrSagaFinished))
+}
+
+func TestPreviewSaga_Failed(t *testing.T) {
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	saga := preview.StartPreviewSaga("cb84", 2, startedAt)
+
+	require.NoError(t, saga.PartFailed("no seeders", startedAt.Add(time.Minute)))
+	require.NoError(t, saga.PartFailed("deadline exceeded", startedAt.Add(2*time.Minute)))
+	assert.Equal(t, &preview.TorrentPreviewFailedEvent{
+		TorrentID:  "cb84",
+		Parts:      2,
+		Reason:     "deadline exceeded",
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(2 * time.Minute),
+	}, saga.Outcome(0))
+}
+
+func TestPreviewSaga_NothingToDownload(t *testing.T) {
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	saga := preview.StartPreviewSaga("cb84", 0, startedAt)
+
+	assert.True(t, saga.IsFinished())
+	assert.IsType(t, &preview.TorrentPreviewCompletedEvent{}, saga.Outcome(0))
+}
+
+func TestPreviewSaga_Restart(t *testing.T) {
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	saga := preview.RestorePreviewSaga("cb84", 2, 1, 0, "", startedAt, time.Time{}, 3)
+
+	restartedAt := startedAt.Add(time.Hour)
+	assert.True(t, errors.Is(saga.Restart(1, restartedAt), preview.ErrSagaRunning))
+
+	require.NoError(t, saga.PartFailed("no seeders", startedAt.Add(time.Minute)))
+	require.NoError(t, saga.Restart(1, restartedAt))
+	assert.Equal(t, preview.RestorePreviewSaga("cb84", 1, 0, 0, "", restartedAt, time.Time{}, 3), saga)
+}
+
+func TestPreviewSaga_Replace(t *testing.T) {
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	saga := preview.RestorePreviewSaga("cb84", 2, 1, 0, "", startedAt, time.Time{}, 3)
+
+	replacedAt := startedAt.Add(time.Hour)
+	saga.Replace(1, replacedAt)
+	assert.Equal(t, preview.RestorePreviewSaga("cb84", 1, 0, 0, "", replacedAt, time.Time{}, 3), saga)
+}
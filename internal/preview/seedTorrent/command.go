@@ -0,0 +1,6 @@
+package seedTorrent
+
+type CMD struct {
+	Root        string // file or directory to share
+	PieceLength int    // 0 to choose one depending on the size of the files
+}
@@ -0,0 +1,85 @@
+package seedTorrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/importTorrent"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// seedCheckInterval is how often a torrent being seeded is checked to still exist
+const seedCheckInterval = time.Minute
+
+type Service struct {
+	logger            *logrus.Logger
+	torrentSeeder     preview.TorrentSeeder
+	torrentRepository preview.TorrentRepository
+	importTorrent     importTorrent.Service
+}
+
+func NewService(
+	logger *logrus.Logger,
+	torrentSeeder preview.TorrentSeeder,
+	torrentRepository preview.TorrentRepository,
+	importTorrent importTorrent.Service,
+) Service {
+	return Service{
+		logger:            logger,
+		torrentSeeder:     torrentSeeder,
+		torrentRepository: torrentRepository,
+		importTorrent:     importTorrent,
+	}
+}
+
+// Seed creates a torrent from the local files, starts sharing them and imports the torrent so
+// its previews are generated like any other torrent
+func (s Service) Seed(ctx context.Context, cmd CMD) (preview.Torrent, error) {
+	raw, err := s.torrentSeeder.Create(cmd.Root, cmd.PieceLength)
+	if err != nil {
+		return preview.Torrent{}, err
+	}
+
+	// Seeding must start before the import, so the client reads the pieces from the local files
+	if err := s.torrentSeeder.Seed(ctx, raw, cmd.Root); err != nil {
+		return preview.Torrent{}, err
+	}
+
+	return s.importTorrent.Import(ctx, importTorrent.CMD{TorrentRaw: raw})
+}
+
+// KeepSeeding blocks while the torrent is seeded, until ctx is done. The process seeding the torrent
+// does not receive the preview.TorrentDeletedEvent, thus the torrent is checked to still exist every
+// seedCheckInterval. Once deleted, it is dropped and preview.ErrNotFound is returned
+func (s Service) KeepSeeding(ctx context.Context, torrentID string) error {
+	ticker := time.NewTicker(seedCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		torrent, err := s.torrentRepository.Get(ctx, torrentID)
+		if errors.Is(err, preview.ErrNotFound) || (err == nil && torrent.Status() == preview.StatusDeleting) {
+			s.logger.WithContext(ctx).WithFields(logrus.Fields{
+				"torrentID": torrentID,
+			}).Info("the torrent has been deleted, seeding stopped")
+			if err := s.torrentSeeder.Drop(ctx, torrentID); err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: the torrent %v has been deleted", preview.ErrNotFound, torrentID)
+		}
+		if err != nil && ctx.Err() == nil {
+			s.logger.WithContext(ctx).WithFields(logrus.Fields{
+				"torrentID": torrentID,
+				"error":     err,
+			}).Warn("unable to check that the torrent still exists")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
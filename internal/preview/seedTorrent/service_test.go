@@ -0,0 +1,104 @@
+package seedTorrent_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/importTorrent"
+	"prevtorrent/internal/preview/platform/client/clientmocks"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"prevtorrent/internal/preview/seedTorrent"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Seed(t *testing.T) {
+	raw := []byte("fake torrent")
+	fakeTorrent, err := preview.NewInfo("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "test torrent", 100, nil, raw)
+	require.NoError(t, err)
+
+	torrentSeeder := new(clientmocks.TorrentSeeder)
+	torrentSeeder.On("Create", "/tmp/videos", 0).Return(raw, nil)
+	torrentSeeder.On("Seed", mock.Anything, raw, "/tmp/videos").Return(nil)
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("Import", mock.Anything, raw).Return(fakeTorrent, nil)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, fakeTorrent.ID()).Return(preview.Torrent{}, preview.ErrNotFound)
+	torrentRepository.On("Persist", mock.Anything, fakeTorrent, mock.Anything, preview.NewTorrentCreatedEvent(fakeTorrent.ID())).
+		Return(nil)
+
+	importService := importTorrent.NewService(fakeLogger(), torrentDownloader, torrentRepository)
+	service := seedTorrent.NewService(fakeLogger(), torrentSeeder, torrentRepository, importService)
+
+	torrent, err := service.Seed(context.Background(), seedTorrent.CMD{Root: "/tmp/videos"})
+	require.NoError(t, err)
+	assert.Equal(t, fakeTorrent, torrent)
+	torrentSeeder.AssertExpectations(t)
+	torrentRepository.AssertExpectations(t)
+}
+
+func TestService_Seed_DoesNotImportIfSeedFails(t *testing.T) {
+	raw := []byte("fake torrent")
+
+	torrentSeeder := new(clientmocks.TorrentSeeder)
+	torrentSeeder.On("Create", "/tmp/videos", 1<<20).Return(raw, nil)
+	torrentSeeder.On("Seed", mock.Anything, raw, "/tmp/videos").Return(errors.New("bytes missing"))
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentRepository := new(storagemocks.TorrentRepository)
+	importService := importTorrent.NewService(fakeLogger(), torrentDownloader, torrentRepository)
+	service := seedTorrent.NewService(fakeLogger(), torrentSeeder, torrentRepository, importService)
+
+	_, err := service.Seed(context.Background(), seedTorrent.CMD{Root: "/tmp/videos", PieceLength: 1 << 20})
+	require.Error(t, err)
+	torrentDownloader.AssertNotCalled(t, "Import", mock.Anything, mock.Anything)
+}
+
+func TestService_KeepSeeding_DropsTheDeletedTorrent(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	torrentSeeder := new(clientmocks.TorrentSeeder)
+	torrentSeeder.On("Drop", mock.Anything, torrentID).Return(nil)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(preview.Torrent{}, preview.ErrNotFound)
+
+	service := seedTorrent.NewService(fakeLogger(), torrentSeeder, torrentRepository, importTorrent.Service{})
+
+	err := service.KeepSeeding(context.Background(), torrentID)
+	require.True(t, errors.Is(err, preview.ErrNotFound))
+	torrentSeeder.AssertExpectations(t)
+}
+
+func TestService_KeepSeeding_UntilCancelled(t *testing.T) {
+	raw := []byte("fake torrent")
+	torrent, err := preview.NewInfo("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "test torrent", 100, nil, raw)
+	require.NoError(t, err)
+	torrent.RestoreStatus(preview.StatusCompleted, "")
+
+	torrentSeeder := new(clientmocks.TorrentSeeder)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrent.ID()).Return(torrent, nil)
+
+	service := seedTorrent.NewService(fakeLogger(), torrentSeeder, torrentRepository, importTorrent.Service{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = service.KeepSeeding(ctx, torrent.ID())
+	require.True(t, errors.Is(err, context.Canceled))
+	torrentSeeder.AssertNotCalled(t, "Drop", mock.Anything, mock.Anything)
+}
+
+func fakeLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
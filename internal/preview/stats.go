@@ -0,0 +1,46 @@
+package preview
+
+import "context"
+
+//go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=StatsRepository
+type StatsRepository interface {
+	Get(ctx context.Context) (*Stats, error)
+	Increment(ctx context.Context, counter Counter) error
+	// Reset sets every counter to zero, so they can be rebuilt from the events
+	Reset(ctx context.Context) error
+}
+
+// Counter is the name of something counted by the Stats
+type Counter string
+
+const (
+	CounterTorrents          Counter = "torrents"           // Torrents created, from a magnet or from a file
+	CounterImages            Counter = "images"             // Images extracted
+	CounterImageFailures     Counter = "image_failures"     // Files from which no image could be extracted
+	CounterPreviewsCompleted Counter = "previews_completed" // Previews with at least one part handled successfully
+	CounterPreviewsFailed    Counter = "previews_failed"    // Previews with every part failed
+)
+
+// Stats are the totals of the service. It's a projection built from the events, like Progress
+type Stats struct {
+	counters map[Counter]int
+}
+
+// NewStats returns the stats with every counter set to zero
+func NewStats() *Stats {
+	return &Stats{counters: make(map[Counter]int)}
+}
+
+// RestoreStats returns the stats with the values given. Meant to be used by the repositories.
+func RestoreStats(counters map[Counter]int) *Stats {
+	s := NewStats()
+	for counter, value := range counters {
+		s.counters[counter] = value
+	}
+	return s
+}
+
+// Count returns the value of the counter, zero if nothing has been counted yet
+func (s *Stats) Count(counter Counter) int {
+	return s.counters[counter]
+}
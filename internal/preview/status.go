@@ -0,0 +1,85 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Status describes in which point of the processing a Torrent is
+type Status string
+
+const (
+	StatusResolving          Status = "resolving"           // We know the torrent, but we have not decided what to download yet
+	StatusPlanned            Status = "planned"             // The download plans have been sent to be downloaded
+	StatusDownloading        Status = "downloading"         // Waiting for pieces from the peers
+	StatusExtracting         Status = "extracting"          // Generating the images from the pieces downloaded
+	StatusCompleted          Status = "completed"           // All the planned images have been generated
+	StatusPartiallyCompleted Status = "partially_completed" // Some images have been generated, but not all of them
+	StatusNoSeeders          Status = "no_seeders"          // Nobody is sharing the torrent right now
+	StatusFailed             Status = "failed"              // Something went wrong. See the last error
+	StatusDeleting           Status = "deleting"            // The torrent is being deleted, nothing else is done with it
+)
+
+var ErrInvalidStatusTransition = errors.New("invalid status transition")
+var ErrPreviewInProgress = errors.New("the preview of the torrent is still being processed")
+
+// statusTransitions describes the statuses that can be reached from a given status. Notice that
+// a torrent might have multiple DownloadPlan, thus we go back to downloading once a plan is finished.
+// StatusFailed can be reached from any status but deleting. A torrent reprocessed with nothing to
+// download goes back from planned to the outcome it had.
+var statusTransitions = map[Status][]Status{
+	StatusResolving:          {StatusPlanned, StatusDownloading, StatusCompleted},
+	StatusPlanned:            {StatusPlanned, StatusDownloading, StatusCompleted, StatusPartiallyCompleted, StatusNoSeeders},
+	StatusDownloading:        {StatusDownloading, StatusExtracting, StatusCompleted, StatusPartiallyCompleted, StatusNoSeeders},
+	StatusExtracting:         {StatusDownloading, StatusExtracting, StatusCompleted, StatusPartiallyCompleted, StatusNoSeeders},
+	StatusCompleted:          {StatusPlanned, StatusDownloading, StatusCompleted},
+	StatusPartiallyCompleted: {StatusPlanned, StatusDownloading, StatusPartiallyCompleted},
+	StatusNoSeeders:          {StatusPlanned, StatusDownloading, StatusNoSeeders},
+	StatusFailed:             {StatusPlanned, StatusDownloading},
+	StatusDeleting:           {},
+}
+
+// NewStatus returns a Status from its string representation
+func NewStatus(value string) (Status, error) {
+	status := Status(value)
+	if _, found := statusTransitions[status]; !found {
+		return "", fmt.Errorf("unknown status %q", value)
+	}
+	return status, nil
+}
+
+// String returns the obvious
+func (s Status) String() string {
+	return string(s)
+}
+
+// CanTransitionTo returns true if we can go from the current status to the next one
+func (s Status) CanTransitionTo(next Status) bool {
+	if next == StatusFailed {
+		return s != StatusDeleting
+	}
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal returns true if there is nothing being processed for the torrent right now
+func (s Status) IsFinal() bool {
+	switch s {
+	case StatusCompleted, StatusPartiallyCompleted, StatusNoSeeders, StatusFailed:
+		return true
+	}
+	return false
+}
+
+// isPlanInProgress returns true while the downloads of a plan are being processed
+func (s Status) isPlanInProgress() bool {
+	switch s {
+	case StatusPlanned, StatusDownloading, StatusExtracting:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package preview_test
+
+import (
+	"errors"
+	"prevtorrent/internal/preview"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStatus(t *testing.T) {
+	status, err := preview.NewStatus("no_seeders")
+	require.NoError(t, err)
+	assert.Equal(t, preview.StatusNoSeeders, status)
+
+	_, err = preview.NewStatus("unknown")
+	require.Error(t, err)
+}
+
+func TestTorrent_ChangeStatus(t *testing.T) {
+	f, err := preview.NewFileInfo(0, 100, "video.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "test torrent", 10, []preview.File{f}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, preview.StatusResolving, torrent.Status())
+
+	require.NoError(t, torrent.ChangeStatus(preview.StatusPlanned, nil))
+	require.NoError(t, torrent.ChangeStatus(preview.StatusDownloading, nil))
+
+	err = torrent.ChangeStatus(preview.StatusResolving, nil)
+	require.True(t, errors.Is(err, preview.ErrInvalidStatusTransition))
+	assert.Equal(t, preview.StatusDownloading, torrent.Status())
+
+	require.NoError(t, torrent.ChangeStatus(preview.StatusFailed, errors.New("fake error")))
+	assert.Equal(t, preview.StatusFailed, torrent.Status())
+	assert.Equal(t, "fake error", torrent.LastError())
+	assert.True(t, torrent.Status().IsFinal())
+}
+
+func TestTorrent_Reprocess(t *testing.T) {
+	f, err := preview.NewFileInfo(0, 100, "video.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "test torrent", 10, []preview.File{f}, nil)
+	require.NoError(t, err)
+
+	err = torrent.Reprocess(true)
+	require.True(t, errors.Is(err, preview.ErrPreviewInProgress))
+	assert.Equal(t, preview.StatusResolving, torrent.Status())
+
+	torrent.RestoreStatus(preview.StatusDownloading, "")
+	err = torrent.Reprocess(false)
+	require.True(t, errors.Is(err, preview.ErrPreviewInProgress))
+	require.NoError(t, torrent.Reprocess(true))
+	assert.Equal(t, preview.StatusPlanned, torrent.Status())
+
+	torrent.RestoreStatus(preview.StatusNoSeeders, "")
+	require.NoError(t, torrent.Reprocess(false))
+	assert.Equal(t, preview.StatusPlanned, torrent.Status())
+	require.NoError(t, torrent.ChangeStatus(preview.StatusNoSeeders, nil))
+}
+
+func TestTorrent_MarkAsDeleting(t *testing.T) {
+	f, err := preview.NewFileInfo(0, 100, "video.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo("cb84ccc10f296df72d6c40ba7a07c178a4323a14", "test torrent", 10, []preview.File{f}, nil)
+	require.NoError(t, err)
+
+	torrent.RestoreStatus(preview.StatusDownloading, "")
+	err = torrent.MarkAsDeleting(false)
+	require.True(t, errors.Is(err, preview.ErrPreviewInProgress))
+	require.NoError(t, torrent.MarkAsDeleting(true))
+	assert.Equal(t, preview.StatusDeleting, torrent.Status())
+
+	torrent.RestoreStatus(preview.StatusResolving, "")
+	require.NoError(t, torrent.MarkAsDeleting(true))
+
+	torrent.RestoreStatus(preview.StatusCompleted, "")
+	require.NoError(t, torrent.MarkAsDeleting(false))
+	assert.Equal(t, preview.StatusDeleting, torrent.Status())
+	// A deletion that failed can be tried again
+	require.NoError(t, torrent.MarkAsDeleting(false))
+
+	err = torrent.ChangeStatus(preview.StatusFailed, errors.New("fake error"))
+	require.True(t, errors.Is(err, preview.ErrInvalidStatusTransition))
+	assert.True(t, errors.Is(torrent.Reprocess(true), preview.ErrPreviewInProgress))
+}
@@ -0,0 +1,6 @@
+package streamFile
+
+type CMD struct {
+	TorrentID string
+	FileID    int
+}
@@ -0,0 +1,146 @@
+package streamFile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"prevtorrent/internal/preview"
+
+	"github.com/sirupsen/logrus"
+)
+
+// windowSize is the maximum number of bytes downloaded with a single DownloadPlan. Bigger
+// requests are served window by window, so we keep in memory at most a window.
+const windowSize = preview.DownloadSize
+
+var ErrInvalidRange = errors.New("the range is out of the bounds of the file")
+var ErrIncompleteStream = errors.New("not all the pieces of the range have been downloaded")
+
+// Stream is a file of a torrent that can be streamed
+type Stream struct {
+	torrent preview.Torrent
+	file    preview.File
+}
+
+// Name returns the name of the file
+func (st Stream) Name() string {
+	return st.file.Name()
+}
+
+// Length returns the size of the file in bytes
+func (st Stream) Length() int {
+	return st.file.Length()
+}
+
+type Service struct {
+	logger            *logrus.Logger
+	torrentRepository preview.TorrentRepository
+	torrentDownloader preview.TorrentDownloader
+}
+
+func NewService(
+	logger *logrus.Logger,
+	torrentRepository preview.TorrentRepository,
+	torrentDownloader preview.TorrentDownloader,
+) Service {
+	return Service{
+		logger:            logger,
+		torrentRepository: torrentRepository,
+		torrentDownloader: torrentDownloader,
+	}
+}
+
+// Open returns the file to stream. Returns preview.ErrNotFound if either the torrent or the file does not exist
+func (s Service) Open(ctx context.Context, cmd CMD) (Stream, error) {
+	torrent, err := s.torrentRepository.Get(ctx, cmd.TorrentID)
+	if err != nil {
+		return Stream{}, err
+	}
+
+	file := torrent.File(cmd.FileID)
+	if file == nil {
+		return Stream{}, fmt.Errorf("%w: file %v of torrent %v", preview.ErrNotFound, cmd.FileID, torrent.ID())
+	}
+	return Stream{torrent: torrent, file: *file}, nil
+}
+
+// Copy downloads the bytes [start, start+length) of the file and writes them in order, as soon
+// as the pieces are downloaded and verified
+func (s Service) Copy(ctx context.Context, w io.Writer, stream Stream, start int, length int) error {
+	if start < 0 || length <= 0 || start+length > stream.Length() {
+		return fmt.Errorf("%w: start=%v, length=%v, file length=%v", ErrInvalidRange, start, length, stream.Length())
+	}
+
+	for offset := start; offset < start+length; offset += windowSize {
+		n := windowSize
+		if offset+n > start+length {
+			n = start + length - offset
+		}
+		if err := s.copyWindow(ctx, w, stream, offset, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s Service) copyWindow(ctx context.Context, w io.Writer, stream Stream, offset int, length int) error {
+	plan, err := preview.NewStreamPlan(stream.torrent, stream.file, offset, length)
+	if err != nil {
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"torrentID": stream.torrent.ID(),
+		"fileID":    stream.file.ID(),
+		"offset":    offset,
+		"length":    length,
+	}).Debug("streaming window")
+
+	registry, err := s.torrentDownloader.DownloadParts(ctx, *plan)
+	if err != nil {
+		return err
+	}
+
+	// The ranges are completed in any order, but must be written in order. Each range is a
+	// single piece, and there is one range per piece of the window
+	next := plan.GetPlan()[0].Start()
+	last := plan.GetPlan()[len(plan.GetPlan())-1].Start()
+	// The pieces are released once the range is consumed, thus the ones completed before their turn are copied
+	pending := make(map[int][]byte)
+	err = registry.RunOnPieceReady(ctx, func(part preview.PieceRange) error {
+		media, err := preview.NewBundlePlan().Bundle(registry, part)
+		if err != nil {
+			return err
+		}
+		if part.Start() != next {
+			data, err := media.Data()
+			if err != nil {
+				return err
+			}
+			pending[part.Start()] = data
+			return nil
+		}
+
+		if _, err := io.Copy(w, media.Reader()); err != nil {
+			return err
+		}
+		next++
+		for data, found := pending[next]; found; data, found = pending[next] {
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			delete(pending, next)
+			next++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if next <= last {
+		return fmt.Errorf("%w: piece %v is missing", ErrIncompleteStream, next)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package streamFile_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/client/clientmocks"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"prevtorrent/internal/preview/streamFile"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const torrentID = "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+func TestService_Copy(t *testing.T) {
+	torrent, file := fakeTorrent(t)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("DownloadParts", mock.Anything, mock.MatchedBy(func(plan preview.DownloadPlan) bool {
+		return plan.IsUrgent() && len(plan.GetPlan()) == 3
+	})).Return(func(_ context.Context, plan preview.DownloadPlan) *preview.PieceRegistry {
+		registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), &plan, preview.NewPieceInMemoryStorage(plan))
+		require.NoError(t, err)
+		// The pieces arrive in any order
+		registry.RegisterPiece(preview.NewPiece(torrentID, 2, []byte("22222")))
+		registry.RegisterPiece(preview.NewPiece(torrentID, 0, []byte("00000")))
+		registry.RegisterPiece(preview.NewPiece(torrentID, 1, []byte("11111")))
+		registry.NoMorePieces()
+		return registry
+	}, nil)
+
+	service := streamFile.NewService(fakeLogger(), torrentRepository, torrentDownloader)
+	stream, err := service.Open(context.Background(), streamFile.CMD{TorrentID: torrentID, FileID: 0})
+	require.NoError(t, err)
+	assert.Equal(t, file.Length(), stream.Length())
+
+	buf := new(bytes.Buffer)
+	err = service.Copy(context.Background(), buf, stream, 3, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "0011111222", buf.String())
+}
+
+func TestService_Copy_MissingPieces(t *testing.T) {
+	torrent, _ := fakeTorrent(t)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+
+	torrentDownloader := new(clientmocks.TorrentDownloader)
+	torrentDownloader.On("DownloadParts", mock.Anything, mock.Anything).
+		Return(func(_ context.Context, plan preview.DownloadPlan) *preview.PieceRegistry {
+			registry, err := preview.NewPieceRegistry(context.Background(), fakeLogger(), &plan, preview.NewPieceInMemoryStorage(plan))
+			require.NoError(t, err)
+			registry.RegisterPiece(preview.NewPiece(torrentID, 0, []byte("00000")))
+			registry.RegisterPiece(preview.NewPiece(torrentID, 2, []byte("22222")))
+			registry.NoMorePieces()
+			return registry
+		}, nil)
+
+	service := streamFile.NewService(fakeLogger(), torrentRepository, torrentDownloader)
+	stream, err := service.Open(context.Background(), streamFile.CMD{TorrentID: torrentID, FileID: 0})
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	err = service.Copy(context.Background(), buf, stream, 0, 15)
+	assert.True(t, errors.Is(err, streamFile.ErrIncompleteStream))
+	assert.Equal(t, "00000", buf.String())
+}
+
+func TestService_Copy_InvalidRange(t *testing.T) {
+	torrent, _ := fakeTorrent(t)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+
+	service := streamFile.NewService(fakeLogger(), torrentRepository, new(clientmocks.TorrentDownloader))
+	stream, err := service.Open(context.Background(), streamFile.CMD{TorrentID: torrentID, FileID: 0})
+	require.NoError(t, err)
+
+	err = service.Copy(context.Background(), new(bytes.Buffer), stream, 10, 10)
+	assert.True(t, errors.Is(err, streamFile.ErrInvalidRange))
+}
+
+func TestService_Open_FileNotFound(t *testing.T) {
+	torrent, _ := fakeTorrent(t)
+
+	torrentRepository := new(storagemocks.TorrentRepository)
+	torrentRepository.On("Get", mock.Anything, torrentID).Return(torrent, nil)
+
+	service := streamFile.NewService(fakeLogger(), torrentRepository, new(clientmocks.TorrentDownloader))
+	_, err := service.Open(context.Background(), streamFile.CMD{TorrentID: torrentID, FileID: 7})
+	assert.True(t, errors.Is(err, preview.ErrNotFound))
+}
+
+func fakeTorrent(t *testing.T) (preview.Torrent, preview.File) {
+	f, err := preview.NewFileInfo(0, 15, "video.mp4")
+	require.NoError(t, err)
+	torrent, err := preview.NewInfo(torrentID, "test torrent", 5, []preview.File{f}, []byte("torrent-data"))
+	require.NoError(t, err)
+	return torrent, f
+}
+
+func fakeLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	return l
+}
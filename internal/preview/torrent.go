@@ -18,8 +18,17 @@ var torrentIDValidation = regexp.MustCompile("^([a-zA-Z0-9]+)$")
 
 //go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=TorrentRepository
 type TorrentRepository interface {
-	Persist(ctx context.Context, torrent Torrent) error
+	// Persist stores a new torrent. The events are stored in the same transaction and published
+	// afterwards, thus they are published if, and only if, the torrent has been stored
+	Persist(ctx context.Context, torrent Torrent, events ...interface{}) error
 	Get(ctx context.Context, id string) (Torrent, error)
+	UpdateStatus(ctx context.Context, torrent Torrent) error
+	// UpdateStatusFrom stores the status of the torrent along with the events, like Persist, only if
+	// the status stored is still from. Returns ErrConcurrentUpdate otherwise
+	UpdateStatusFrom(ctx context.Context, torrent Torrent, from Status, events ...interface{}) error
+	// Delete removes the torrent and everything stored about it, its events and webhook deliveries
+	// included, along with the events given, like Persist. Returns ErrNotFound if there is no such torrent
+	Delete(ctx context.Context, id string, events ...interface{}) error
 }
 
 //go:generate mockery --case=snake --outpkg=clientmocks --output=platform/client/clientmocks --name=TorrentDownloader
@@ -28,6 +37,35 @@ type TorrentDownloader interface {
 	Import(ctx context.Context, raw []byte) (Torrent, error)
 }
 
+//go:generate mockery --case=snake --outpkg=clientmocks --output=platform/client/clientmocks --name=TorrentDropper
+
+// TorrentDropper stops downloading and seeding a torrent
+type TorrentDropper interface {
+	Drop(ctx context.Context, torrentID string) error
+}
+
+//go:generate mockery --case=snake --outpkg=clientmocks --output=platform/client/clientmocks --name=TorrentCreator
+type TorrentCreator interface {
+	Create(root string, pieceLength int) ([]byte, error)
+}
+
+//go:generate mockery --case=snake --outpkg=clientmocks --output=platform/client/clientmocks --name=TorrentSeeder
+type TorrentSeeder interface {
+	TorrentCreator
+	TorrentDropper
+	Seed(ctx context.Context, raw []byte, root string) error
+}
+
+//go:generate mockery --case=snake --outpkg=clientmocks --output=platform/client/clientmocks --name=LocalTorrentDownloader
+
+// LocalTorrentDownloader reads the pieces from files we already have instead of asking the peers
+type LocalTorrentDownloader interface {
+	TorrentDownloader
+	TorrentCreator
+	// Open checks that the files at root match the torrent and reads its pieces from there from now on
+	Open(raw []byte, root string) (Torrent, error)
+}
+
 var ErrNotFound = errors.New("record not found in storage")
 
 // Torrent represents the torrent meta info.
@@ -40,9 +78,12 @@ type Torrent struct {
 	files       []File // files is a list of all the files present in the torrent. should never be empty
 	filesByID   map[int]*File
 	raw         []byte // raw is the bencoded representation of a .torrent
+	status      Status // status is the point of the processing where the torrent is
+	lastError   string // lastError is the reason of the last failure, if any
 }
 
 var ErrInvalidTorrentID = errors.New("invalid torrent ID")
+var ErrInvalidFile = errors.New("invalid file")
 
 // NewInfo create a new torrent
 func NewInfo(
@@ -76,6 +117,7 @@ func NewInfo(
 		files:       files,
 		raw:         raw,
 		filesByID:   filesByID(files),
+		status:      StatusResolving,
 	}, nil
 }
 
@@ -89,6 +131,57 @@ func (i Torrent) Raw() []byte {
 	return i.raw
 }
 
+// Status returns the current status of the processing of the torrent
+func (i Torrent) Status() Status {
+	return i.status
+}
+
+// LastError returns the reason of the last failure. Empty if there was none
+func (i Torrent) LastError() string {
+	return i.lastError
+}
+
+// ChangeStatus moves the torrent to the next status, if it's a valid transition.
+// The error is stored as the last error of the torrent when given.
+func (i *Torrent) ChangeStatus(next Status, err error) error {
+	if !i.status.CanTransitionTo(next) {
+		return fmt.Errorf("%w: from %v to %v", ErrInvalidStatusTransition, i.status, next)
+	}
+	i.status = next
+	if err != nil {
+		i.lastError = err.Error()
+	}
+	return nil
+}
+
+// Reprocess moves the torrent back to planned, so a new plan can be made for it. Returns
+// ErrPreviewInProgress while it is being processed, unless force is set, which takes over a plan
+// in progress, e.g. one stuck downloading. A torrent being resolved is never taken over
+func (i *Torrent) Reprocess(force bool) error {
+	if !i.status.IsFinal() && !(force && i.status.isPlanInProgress()) {
+		return fmt.Errorf("%w: the torrent is %s", ErrPreviewInProgress, i.status)
+	}
+	i.status = StatusPlanned
+	return nil
+}
+
+// MarkAsDeleting moves the torrent to deleting, so nothing else is done with it while it is deleted.
+// Returns ErrPreviewInProgress while it is being processed, unless force is set, which takes it down
+// whatever it is doing, e.g. stuck downloading after a worker crashed
+func (i *Torrent) MarkAsDeleting(force bool) error {
+	if !force && !i.status.IsFinal() && i.status != StatusDeleting {
+		return fmt.Errorf("%w: the torrent is %s", ErrPreviewInProgress, i.status)
+	}
+	i.status = StatusDeleting
+	return nil
+}
+
+// RestoreStatus sets the status without validating the transition. Meant to be used by repositories.
+func (i *Torrent) RestoreStatus(status Status, lastError string) {
+	i.status = status
+	i.lastError = lastError
+}
+
 // Name returns the name of the torrent. Might be empty
 func (i Torrent) Name() string {
 	return i.name
@@ -113,6 +206,18 @@ func (i Torrent) File(idx int) *File {
 	return i.filesByID[idx]
 }
 
+// SupportedFile returns the file with the given ID, if it has an extension supported by ffmpeg
+func (i Torrent) SupportedFile(idx int) (File, error) {
+	f := i.File(idx)
+	if f == nil {
+		return File{}, fmt.Errorf("%w: the torrent has no file %v", ErrInvalidFile, idx)
+	}
+	if !f.IsSupportedExtension() {
+		return File{}, fmt.Errorf("%w: file %s has not a supported extension", ErrInvalidFile, f.Name())
+	}
+	return *f, nil
+}
+
 // SupportedFiles returns from all the files, the ones that have an extension supported by ffmpeg
 func (i Torrent) SupportedFiles() []File {
 	fi := make([]File, 0)
@@ -132,6 +237,7 @@ type File struct {
 	length int
 	name   string
 	images []Image
+	clips  []Clip
 }
 
 // NewFileInfo creates a File
@@ -196,3 +302,19 @@ func (fi *File) AddImage(image Image) error {
 func (fi File) Images() []Image {
 	return fi.images
 }
+
+func (fi *File) AddClip(clip Clip) error {
+	if clip.fileID != fi.ID() {
+		return fmt.Errorf("the clip with name '%v' and fileID '%v' does not match fileID %v ",
+			clip.Name(),
+			clip.fileID,
+			fi.ID(),
+		)
+	}
+	fi.clips = append(fi.clips, clip)
+	return nil
+}
+
+func (fi File) Clips() []Clip {
+	return fi.clips
+}
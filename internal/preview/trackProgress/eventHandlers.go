@@ -0,0 +1,86 @@
+package trackProgress
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+)
+
+type DownloadPlanStartedEventHandler struct {
+	service Service
+}
+
+func NewDownloadPlanStartedEventHandler(service Service) *DownloadPlanStartedEventHandler {
+	return &DownloadPlanStartedEventHandler{service: service}
+}
+
+func (h DownloadPlanStartedEventHandler) HandlerName() string {
+	return "event.progress.planStarted"
+}
+
+func (DownloadPlanStartedEventHandler) NewEvent() interface{} {
+	return new(preview.DownloadPlanStartedEvent)
+}
+
+func (h *DownloadPlanStartedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.PlanStarted(ctx, *e.(*preview.DownloadPlanStartedEvent))
+}
+
+type PieceCompletedEventHandler struct {
+	service Service
+}
+
+func NewPieceCompletedEventHandler(service Service) *PieceCompletedEventHandler {
+	return &PieceCompletedEventHandler{service: service}
+}
+
+func (h PieceCompletedEventHandler) HandlerName() string {
+	return "event.progress.pieceCompleted"
+}
+
+func (PieceCompletedEventHandler) NewEvent() interface{} {
+	return new(preview.PieceCompletedEvent)
+}
+
+func (h *PieceCompletedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.PieceCompleted(ctx, *e.(*preview.PieceCompletedEvent))
+}
+
+type PieceRangeCompletedEventHandler struct {
+	service Service
+}
+
+func NewPieceRangeCompletedEventHandler(service Service) *PieceRangeCompletedEventHandler {
+	return &PieceRangeCompletedEventHandler{service: service}
+}
+
+func (h PieceRangeCompletedEventHandler) HandlerName() string {
+	return "event.progress.rangeCompleted"
+}
+
+func (PieceRangeCompletedEventHandler) NewEvent() interface{} {
+	return new(preview.PieceRangeCompletedEvent)
+}
+
+func (h *PieceRangeCompletedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.RangeCompleted(ctx, *e.(*preview.PieceRangeCompletedEvent))
+}
+
+type DownloadPlanFinishedEventHandler struct {
+	service Service
+}
+
+func NewDownloadPlanFinishedEventHandler(service Service) *DownloadPlanFinishedEventHandler {
+	return &DownloadPlanFinishedEventHandler{service: service}
+}
+
+func (h DownloadPlanFinishedEventHandler) HandlerName() string {
+	return "event.progress.planFinished"
+}
+
+func (DownloadPlanFinishedEventHandler) NewEvent() interface{} {
+	return new(preview.DownloadPlanFinishedEvent)
+}
+
+func (h *DownloadPlanFinishedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.PlanFinished(ctx, *e.(*preview.DownloadPlanFinishedEvent))
+}
@@ -0,0 +1,82 @@
+package trackProgress
+
+import (
+	"context"
+	"errors"
+	"prevtorrent/internal/preview"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxUpdateAttempts is how many times a change is applied when the progress is updated concurrently
+// by the handlers of other events. The event is handled again once they are exhausted
+const maxUpdateAttempts = 5
+
+// Service keeps the Progress projection up to date with the download events
+type Service struct {
+	logger             *logrus.Logger
+	progressRepository preview.ProgressRepository
+}
+
+func NewService(logger *logrus.Logger, progressRepository preview.ProgressRepository) Service {
+	return Service{logger: logger, progressRepository: progressRepository}
+}
+
+func (s Service) PlanStarted(ctx context.Context, event preview.DownloadPlanStartedEvent) error {
+	return s.update(ctx, event.TorrentID, func(p *preview.Progress) {
+		p.StartPlan(event.PlanID, event.PieceLength, event.Ranges, event.StartedAt)
+	})
+}
+
+func (s Service) PieceCompleted(ctx context.Context, event preview.PieceCompletedEvent) error {
+	return s.update(ctx, event.TorrentID, func(p *preview.Progress) {
+		p.CompletePiece(event.PieceID, preview.PeerStats{
+			Active:  event.ActivePeers,
+			Seeders: event.ConnectedSeeders,
+		}, event.CompletedAt)
+	})
+}
+
+func (s Service) RangeCompleted(ctx context.Context, event preview.PieceRangeCompletedEvent) error {
+	return s.update(ctx, event.TorrentID, func(p *preview.Progress) {
+		p.CompleteRange(event.PieceStart, event.PieceEnd, event.CompletedAt)
+	})
+}
+
+func (s Service) PlanFinished(ctx context.Context, event preview.DownloadPlanFinishedEvent) error {
+	return s.update(ctx, event.TorrentID, func(p *preview.Progress) {
+		p.FinishPlan(event.PlanID, event.FinishedAt)
+	})
+}
+
+// update applies the change to the latest progress of the torrent. The events of a torrent are
+// handled concurrently, so the change is applied again if someone else updated it in the meantime
+func (s Service) update(ctx context.Context, torrentID string, fnx func(p *preview.Progress)) error {
+	var progress *preview.Progress
+	var err error
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		progress, err = s.progressRepository.Get(ctx, torrentID)
+		if errors.Is(err, preview.ErrNotFound) {
+			progress, err = preview.NewProgress(torrentID), nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fnx(progress)
+
+		err = s.progressRepository.Persist(ctx, progress)
+		if !errors.Is(err, preview.ErrConcurrentUpdate) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"torrentID":  torrentID,
+		"piecesLeft": progress.PiecesLeft(),
+	}).Debug("progress updated")
+	return nil
+}
@@ -0,0 +1,135 @@
+package trackProgress_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"prevtorrent/internal/preview/trackProgress"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_PlanStarted_CreatesProgressIfNotFound(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	ranges := []preview.PlannedRange{{FileID: 0, PieceStart: 0, PieceEnd: 3}}
+
+	progressRepository := new(storagemocks.ProgressRepository)
+	progressRepository.On("Get", mock.Anything, torrentID).
+		Return(nil, preview.ErrNotFound)
+	progressRepository.On("Persist", mock.Anything, mock.MatchedBy(func(p *preview.Progress) bool {
+		return p.TorrentID() == torrentID &&
+			assert.ObjectsAreEqual(ranges, p.Ranges()) &&
+			p.IsDownloading() &&
+			p.StartedAt().Equal(startedAt)
+	})).Return(nil)
+
+	service := trackProgress.NewService(fakeLogger(), progressRepository)
+	err := service.PlanStarted(context.Background(), preview.DownloadPlanStartedEvent{
+		TorrentID:   torrentID,
+		PlanID:      "plan-1",
+		PieceLength: 10,
+		Ranges:      ranges,
+		StartedAt:   startedAt,
+	})
+	require.NoError(t, err)
+	progressRepository.AssertExpectations(t)
+}
+
+func TestService_PieceCompleted_UpdatesExistingProgress(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	progress := preview.NewProgress(torrentID)
+	progress.StartPlan("plan-1", 10, []preview.PlannedRange{{FileID: 0, PieceStart: 0, PieceEnd: 3}}, startedAt)
+
+	progressRepository := new(storagemocks.ProgressRepository)
+	progressRepository.On("Get", mock.Anything, torrentID).
+		Return(progress, nil)
+	progressRepository.On("Persist", mock.Anything, mock.MatchedBy(func(p *preview.Progress) bool {
+		return assert.ObjectsAreEqual([]int{2}, p.Pieces()) &&
+			p.Peers() == preview.PeerStats{Active: 4, Seeders: 1}
+	})).Return(nil)
+
+	service := trackProgress.NewService(fakeLogger(), progressRepository)
+	err := service.PieceCompleted(context.Background(), preview.PieceCompletedEvent{
+		TorrentID:        torrentID,
+		PieceID:          2,
+		ActivePeers:      4,
+		ConnectedSeeders: 1,
+		CompletedAt:      startedAt.Add(time.Second),
+	})
+	require.NoError(t, err)
+	progressRepository.AssertExpectations(t)
+}
+
+func TestService_PieceCompleted_RetriesConcurrentUpdates(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+	startedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	stale := preview.NewProgress(torrentID)
+	latest := preview.RestoreProgress(torrentID, 10, nil, []int{1}, nil, preview.PeerStats{}, startedAt, startedAt, 2)
+
+	progressRepository := new(storagemocks.ProgressRepository)
+	progressRepository.On("Get", mock.Anything, torrentID).
+		Return(stale, nil).Once()
+	progressRepository.On("Persist", mock.Anything, stale).
+		Return(preview.ErrConcurrentUpdate).Once()
+	progressRepository.On("Get", mock.Anything, torrentID).
+		Return(latest, nil).Once()
+	progressRepository.On("Persist", mock.Anything, mock.MatchedBy(func(p *preview.Progress) bool {
+		return assert.ObjectsAreEqual([]int{1, 2}, p.Pieces()) && p.Version() == 2
+	})).Return(nil).Once()
+
+	service := trackProgress.NewService(fakeLogger(), progressRepository)
+	err := service.PieceCompleted(context.Background(), preview.PieceCompletedEvent{
+		TorrentID:   torrentID,
+		PieceID:     2,
+		CompletedAt: startedAt.Add(time.Second),
+	})
+	require.NoError(t, err)
+	progressRepository.AssertExpectations(t)
+}
+
+func TestService_PlanFinished_ErrorReadingProgress(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	progressRepository := new(storagemocks.ProgressRepository)
+	progressRepository.On("Get", mock.Anything, torrentID).
+		Return(nil, errors.New("fake error"))
+
+	service := trackProgress.NewService(fakeLogger(), progressRepository)
+	err := service.PlanFinished(context.Background(), preview.DownloadPlanFinishedEvent{TorrentID: torrentID})
+	require.Error(t, err)
+}
+
+func TestService_RangeCompleted_ErrorPersisting(t *testing.T) {
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	progressRepository := new(storagemocks.ProgressRepository)
+	progressRepository.On("Get", mock.Anything, torrentID).
+		Return(preview.NewProgress(torrentID), nil)
+	progressRepository.On("Persist", mock.Anything, mock.Anything).
+		Return(errors.New("fake error"))
+
+	service := trackProgress.NewService(fakeLogger(), progressRepository)
+	err := service.RangeCompleted(context.Background(), preview.PieceRangeCompletedEvent{
+		TorrentID:  torrentID,
+		PieceStart: 0,
+		PieceEnd:   1,
+	})
+	require.Error(t, err)
+}
+
+func fakeLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	return l
+}
@@ -0,0 +1,106 @@
+package trackStats
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+)
+
+type TorrentCreatedEventHandler struct {
+	service Service
+}
+
+func NewTorrentCreatedEventHandler(service Service) *TorrentCreatedEventHandler {
+	return &TorrentCreatedEventHandler{service: service}
+}
+
+func (h TorrentCreatedEventHandler) HandlerName() string {
+	return "event.stats.torrentCreated"
+}
+
+func (TorrentCreatedEventHandler) NewEvent() interface{} {
+	return new(preview.TorrentCreatedEvent)
+}
+
+func (h *TorrentCreatedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.TorrentCreated(ctx, *e.(*preview.TorrentCreatedEvent))
+}
+
+type ImageExtractedEventHandler struct {
+	service Service
+}
+
+func NewImageExtractedEventHandler(service Service) *ImageExtractedEventHandler {
+	return &ImageExtractedEventHandler{service: service}
+}
+
+func (h ImageExtractedEventHandler) HandlerName() string {
+	return "event.stats.imageExtracted"
+}
+
+func (ImageExtractedEventHandler) NewEvent() interface{} {
+	return new(preview.ImageExtractedEvent)
+}
+
+func (h *ImageExtractedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.ImageExtracted(ctx, *e.(*preview.ImageExtractedEvent))
+}
+
+type ImageExtractionFailedEventHandler struct {
+	service Service
+}
+
+func NewImageExtractionFailedEventHandler(service Service) *ImageExtractionFailedEventHandler {
+	return &ImageExtractionFailedEventHandler{service: service}
+}
+
+func (h ImageExtractionFailedEventHandler) HandlerName() string {
+	return "event.stats.imageExtractionFailed"
+}
+
+func (ImageExtractionFailedEventHandler) NewEvent() interface{} {
+	return new(preview.ImageExtractionFailedEvent)
+}
+
+func (h *ImageExtractionFailedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.ImageExtractionFailed(ctx, *e.(*preview.ImageExtractionFailedEvent))
+}
+
+type TorrentPreviewCompletedEventHandler struct {
+	service Service
+}
+
+func NewTorrentPreviewCompletedEventHandler(service Service) *TorrentPreviewCompletedEventHandler {
+	return &TorrentPreviewCompletedEventHandler{service: service}
+}
+
+func (h TorrentPreviewCompletedEventHandler) HandlerName() string {
+	return "event.stats.previewCompleted"
+}
+
+func (TorrentPreviewCompletedEventHandler) NewEvent() interface{} {
+	return new(preview.TorrentPreviewCompletedEvent)
+}
+
+func (h *TorrentPreviewCompletedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.PreviewCompleted(ctx, *e.(*preview.TorrentPreviewCompletedEvent))
+}
+
+type TorrentPreviewFailedEventHandler struct {
+	service Service
+}
+
+func NewTorrentPreviewFailedEventHandler(service Service) *TorrentPreviewFailedEventHandler {
+	return &TorrentPreviewFailedEventHandler{service: service}
+}
+
+func (h TorrentPreviewFailedEventHandler) HandlerName() string {
+	return "event.stats.previewFailed"
+}
+
+func (TorrentPreviewFailedEventHandler) NewEvent() interface{} {
+	return new(preview.TorrentPreviewFailedEvent)
+}
+
+func (h *TorrentPreviewFailedEventHandler) Handle(ctx context.Context, e interface{}) error {
+	return h.service.PreviewFailed(ctx, *e.(*preview.TorrentPreviewFailedEvent))
+}
@@ -0,0 +1,50 @@
+package trackStats
+
+import (
+	"context"
+	"prevtorrent/internal/preview"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Service keeps the Stats projection up to date with the events of the previews
+type Service struct {
+	logger          *logrus.Logger
+	statsRepository preview.StatsRepository
+}
+
+func NewService(logger *logrus.Logger, statsRepository preview.StatsRepository) Service {
+	return Service{logger: logger, statsRepository: statsRepository}
+}
+
+func (s Service) TorrentCreated(ctx context.Context, event preview.TorrentCreatedEvent) error {
+	return s.increment(ctx, event.TorrentID, preview.CounterTorrents)
+}
+
+func (s Service) ImageExtracted(ctx context.Context, event preview.ImageExtractedEvent) error {
+	return s.increment(ctx, event.TorrentID, preview.CounterImages)
+}
+
+func (s Service) ImageExtractionFailed(ctx context.Context, event preview.ImageExtractionFailedEvent) error {
+	return s.increment(ctx, event.TorrentID, preview.CounterImageFailures)
+}
+
+func (s Service) PreviewCompleted(ctx context.Context, event preview.TorrentPreviewCompletedEvent) error {
+	return s.increment(ctx, event.TorrentID, preview.CounterPreviewsCompleted)
+}
+
+func (s Service) PreviewFailed(ctx context.Context, event preview.TorrentPreviewFailedEvent) error {
+	return s.increment(ctx, event.TorrentID, preview.CounterPreviewsFailed)
+}
+
+func (s Service) increment(ctx context.Context, torrentID string, counter preview.Counter) error {
+	if err := s.statsRepository.Increment(ctx, counter); err != nil {
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"torrentID": torrentID,
+		"counter":   counter,
+	}).Debug("stats updated")
+	return nil
+}
@@ -0,0 +1,59 @@
+package trackStats_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"prevtorrent/internal/preview"
+	"prevtorrent/internal/preview/platform/storage/storagemocks"
+	"prevtorrent/internal/preview/trackStats"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ImageExtracted(t *testing.T) {
+	statsRepository := new(storagemocks.StatsRepository)
+	statsRepository.On("Increment", mock.Anything, preview.CounterImages).Return(nil)
+
+	service := trackStats.NewService(fakeLogger(), statsRepository)
+	err := service.ImageExtracted(context.Background(), preview.ImageExtractedEvent{
+		TorrentID: "cb84ccc10f296df72d6c40ba7a07c178a4323a14",
+		FileID:    0,
+	})
+	require.NoError(t, err)
+	statsRepository.AssertExpectations(t)
+}
+
+func TestService_PreviewFailed(t *testing.T) {
+	statsRepository := new(storagemocks.StatsRepository)
+	statsRepository.On("Increment", mock.Anything, preview.CounterPreviewsFailed).Return(nil)
+
+	service := trackStats.NewService(fakeLogger(), statsRepository)
+	err := service.PreviewFailed(context.Background(), preview.TorrentPreviewFailedEvent{
+		TorrentID: "cb84ccc10f296df72d6c40ba7a07c178a4323a14",
+		Parts:     2,
+	})
+	require.NoError(t, err)
+	statsRepository.AssertExpectations(t)
+}
+
+func TestService_TorrentCreated_ErrorIncrementing(t *testing.T) {
+	statsRepository := new(storagemocks.StatsRepository)
+	statsRepository.On("Increment", mock.Anything, preview.CounterTorrents).Return(errors.New("fake error"))
+
+	service := trackStats.NewService(fakeLogger(), statsRepository)
+	err := service.TorrentCreated(context.Background(), preview.TorrentCreatedEvent{
+		TorrentID: "cb84ccc10f296df72d6c40ba7a07c178a4323a14",
+	})
+	require.Error(t, err)
+	statsRepository.AssertExpectations(t)
+}
+
+func fakeLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	return l
+}
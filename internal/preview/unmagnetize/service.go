@@ -3,28 +3,25 @@ package unmagnetize
 import (
 	"context"
 	"errors"
-	"prevtorrent/internal/platform/bus"
 	"prevtorrent/internal/preview"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 type Service struct {
 	log               *logrus.Logger
-	eventBus          bus.Event
 	magnetResolver    preview.MagnetClient
 	torrentRepository preview.TorrentRepository
 }
 
 func NewService(
 	log *logrus.Logger,
-	eventBus bus.Event,
 	magnetResolver preview.MagnetClient,
 	torrentRepository preview.TorrentRepository,
 ) Service {
 	return Service{
 		log:               log,
-		eventBus:          eventBus,
 		magnetResolver:    magnetResolver,
 		torrentRepository: torrentRepository,
 	}
@@ -64,14 +61,14 @@ func (s Service) Handle(ctx context.Context, cmd CMD) (preview.Torrent, error) {
 		return preview.Torrent{}, err
 	}
 
-	err = s.torrentRepository.Persist(ctx, torrent)
+	// The events are published once the torrent is stored, even if the publisher is down at the moment
+	err = s.torrentRepository.Persist(ctx, torrent,
+		preview.NewMagnetResolvedEvent(m, torrent, time.Now()),
+		preview.NewTorrentCreatedEvent(torrent.ID()),
+	)
 	if err != nil {
 		return preview.Torrent{}, err
 	}
 
-	if err := s.eventBus.Publish(ctx, preview.NewTorrentCreatedEvent(torrent.ID())); err != nil {
-		return preview.Torrent{}, err
-	}
-
 	return torrent, nil
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"io/ioutil"
-	"prevtorrent/internal/platform/bus/busmocks"
 	"prevtorrent/internal/preview"
 	"prevtorrent/internal/preview/platform/client/clientmocks"
 	"prevtorrent/internal/preview/platform/storage/storagemocks"
@@ -36,18 +35,19 @@ func Test_MagnetService_Transform_DownloadByNetwork(t *testing.T) {
 	resolverRepo.On("Resolve", mock.Anything, mag).Return(torrent, nil)
 
 	torrentRepo := new(storagemocks.TorrentRepository)
-	torrentRepo.On("Persist", mock.Anything, torrent).Return(nil)
-	torrentRepo.On("Get", mock.Anything, "cb84ccc10f296df72d6c40ba7a07c178a4323a14").
-		Return(preview.Torrent{}, preview.ErrNotFound)
-
-	eventBus := new(busmocks.Event)
-	eventBus.On(
-		"Publish",
+	torrentRepo.On(
+		"Persist",
 		mock.Anything,
+		torrent,
+		mock.MatchedBy(func(e *preview.MagnetResolvedEvent) bool {
+			return e.TorrentID == "cb84ccc10f296df72d6c40ba7a07c178a4323a14" && e.Magnet == inputMagnet
+		}),
 		&preview.TorrentCreatedEvent{TorrentID: "cb84ccc10f296df72d6c40ba7a07c178a4323a14"},
 	).Return(nil)
+	torrentRepo.On("Get", mock.Anything, "cb84ccc10f296df72d6c40ba7a07c178a4323a14").
+		Return(preview.Torrent{}, preview.ErrNotFound)
 
-	s := unmagnetize.NewService(fakeLogger(), eventBus, resolverRepo, torrentRepo)
+	s := unmagnetize.NewService(fakeLogger(), resolverRepo, torrentRepo)
 	torrentReturned, err := s.Handle(context.Background(), unmagnetize.CMD{Magnet: inputMagnet})
 	require.NoError(t, err)
 	assert.Equal(t, torrent, torrentReturned)
@@ -72,9 +72,7 @@ func Test_MagnetService_Transform_AlreadyDownloaded(t *testing.T) {
 	torrentRepo.On("Persist", mock.Anything, torrentData).Return(nil)
 	torrentRepo.On("Get", mock.Anything, "cb84ccc10f296df72d6c40ba7a07c178a4323a14").Return(fakeTorrent, nil)
 
-	eventBus := new(busmocks.Event)
-
-	s := unmagnetize.NewService(fakeLogger(), eventBus, resolverRepo, torrentRepo)
+	s := unmagnetize.NewService(fakeLogger(), resolverRepo, torrentRepo)
 	torrentID, err := s.Handle(context.Background(), unmagnetize.CMD{Magnet: inputMagnet})
 	require.NoError(t, err)
 	assert.Equal(t, fakeTorrent, torrentID)
@@ -90,9 +88,7 @@ func Test_MagnetService_Transform_RepositoryErrorGetTorrent(t *testing.T) {
 	torrentRepo.On("Persist", mock.Anything, torrentData).Return(nil)
 	torrentRepo.On("Get", mock.Anything, "cb84ccc10f296df72d6c40ba7a07c178a4323a14").Return(preview.Torrent{}, errors.New("fake error"))
 
-	eventBus := new(busmocks.Event)
-
-	s := unmagnetize.NewService(fakeLogger(), eventBus, resolverRepo, torrentRepo)
+	s := unmagnetize.NewService(fakeLogger(), resolverRepo, torrentRepo)
 	_, err := s.Handle(context.Background(), unmagnetize.CMD{Magnet: inputMagnet})
 	require.Error(t, err)
 }
@@ -120,9 +116,7 @@ func Test_MagnetService_Inspect_RepositoryError(t *testing.T) {
 	torrentRepo.On("Get", mock.Anything, "cb84ccc10f296df72d6c40ba7a07c178a4323a14").
 		Return(preview.Torrent{}, preview.ErrNotFound)
 
-	eventBus := new(busmocks.Event)
-
-	s := unmagnetize.NewService(fakeLogger(), eventBus, resolverRepo, torrentRepo)
+	s := unmagnetize.NewService(fakeLogger(), resolverRepo, torrentRepo)
 	_, err = s.Handle(context.Background(), unmagnetize.CMD{Magnet: inputMagnet})
 	require.Error(t, err)
 }
@@ -133,9 +127,7 @@ func Test_MagnetService_Inspect_InvalidMagnetError(t *testing.T) {
 	resolverRepo := new(clientmocks.MagnetClient)
 	torrentRepo := new(storagemocks.TorrentRepository)
 
-	eventBus := new(busmocks.Event)
-
-	s := unmagnetize.NewService(fakeLogger(), eventBus, resolverRepo, torrentRepo)
+	s := unmagnetize.NewService(fakeLogger(), resolverRepo, torrentRepo)
 	_, err := s.Handle(context.Background(), unmagnetize.CMD{Magnet: inputMagnet})
 	require.Error(t, err)
 }
@@ -0,0 +1,345 @@
+package preview
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidWebhook   = errors.New("invalid webhook")
+	ErrNonPublicAddress = errors.New("the address is not public")
+)
+
+// nonPublicNetworks are the addresses the webhooks cannot post to, so they cannot be used to reach
+// the services next to ours: loopback, private, shared, link-local and unspecified ones
+var nonPublicNetworks = parseNetworks(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10",
+)
+
+// Events a webhook can subscribe to. They are part of the public API, so they do not change
+// when the domain events do
+const (
+	WebhookTorrentCreated   = "torrent.created"
+	WebhookImageExtracted   = "image.extracted"
+	WebhookPreviewCompleted = "preview.completed"
+	WebhookPreviewFailed    = "preview.failed"
+)
+
+var webhookEvents = map[string]bool{
+	WebhookTorrentCreated:   true,
+	WebhookImageExtracted:   true,
+	WebhookPreviewCompleted: true,
+	WebhookPreviewFailed:    true,
+}
+
+//go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=WebhookRepository
+type WebhookRepository interface {
+	Get(ctx context.Context, id string) (*Webhook, error)
+	Persist(ctx context.Context, webhook *Webhook) error
+	// Delete removes the webhook along with its deliveries
+	Delete(ctx context.Context, id string) error
+	// Subscribed returns the webhooks that receive the event of the given torrent
+	Subscribed(ctx context.Context, event string, torrentID string) ([]*Webhook, error)
+}
+
+//go:generate mockery --case=snake --outpkg=storagemocks --output=platform/storage/storagemocks --name=WebhookDeliveryRepository
+type WebhookDeliveryRepository interface {
+	Persist(ctx context.Context, deliveries ...*WebhookDelivery) error
+	// Due returns, oldest first, up to limit deliveries that have to be sent now
+	Due(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error)
+	// Claim reserves the delivery for whoever sends it, by delaying its next attempt until the given
+	// time. It returns false if the delivery is no longer due, because someone else claimed it
+	Claim(ctx context.Context, id string, now time.Time, until time.Time) (bool, error)
+	// ByWebhook returns the deliveries of the webhook, newest first
+	ByWebhook(ctx context.Context, webhookID string) ([]*WebhookDelivery, error)
+}
+
+//go:generate mockery --case=snake --outpkg=clientmocks --output=platform/client/clientmocks --name=WebhookSender
+type WebhookSender interface {
+	// Send posts the payload of the delivery to the url. It returns the status code of the response,
+	// if any, and an error unless the receiver accepted it
+	Send(ctx context.Context, url string, delivery *WebhookDelivery, signature string) (int, error)
+}
+
+// Webhook is an url where the events of the previews are posted. It might be restricted to a
+// torrent and to some events
+type Webhook struct {
+	id        string
+	url       string
+	secret    string
+	torrentID string
+	events    []string
+	createdAt time.Time
+}
+
+// NewWebhook returns a webhook for the given url. An empty torrentID or list of events means all of them
+func NewWebhook(id string, rawURL string, secret string, torrentID string, events []string, createdAt time.Time) (*Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: the url must be absolute, with http or https scheme", ErrInvalidWebhook)
+	}
+	// The names are checked once resolved, when the deliveries are sent
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, ErrNonPublicAddress)
+	}
+	if ip := net.ParseIP(host); ip != nil && !IsPublicAddress(ip) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, ErrNonPublicAddress)
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("%w: the secret cannot be empty", ErrInvalidWebhook)
+	}
+	for _, event := range events {
+		if !webhookEvents[event] {
+			return nil, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+	}
+
+	return RestoreWebhook(id, rawURL, secret, torrentID, events, createdAt), nil
+}
+
+// IsPublicAddress returns true if the webhooks may be posted to the ip
+func IsPublicAddress(ip net.IP) bool {
+	if ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// RestoreWebhook returns a Webhook with all its state. Meant to be used by the repositories.
+func RestoreWebhook(id string, url string, secret string, torrentID string, events []string, createdAt time.Time) *Webhook {
+	return &Webhook{
+		id:        id,
+		url:       url,
+		secret:    secret,
+		torrentID: strings.ToLower(torrentID),
+		events:    append(make([]string, 0, len(events)), events...),
+		createdAt: createdAt,
+	}
+}
+
+func (w *Webhook) ID() string {
+	return w.id
+}
+
+func (w *Webhook) URL() string {
+	return w.url
+}
+
+// Secret returns the key the payloads are signed with
+func (w *Webhook) Secret() string {
+	return w.secret
+}
+
+// TorrentID returns the torrent the webhook is restricted to, if any
+func (w *Webhook) TorrentID() string {
+	return w.torrentID
+}
+
+// Events returns the events the webhook is restricted to, if any
+func (w *Webhook) Events() []string {
+	return w.events
+}
+
+func (w *Webhook) CreatedAt() time.Time {
+	return w.createdAt
+}
+
+// Receives returns true if the event of the torrent has to be posted to the webhook
+func (w *Webhook) Receives(event string, torrentID string) bool {
+	if w.torrentID != "" && w.torrentID != strings.ToLower(torrentID) {
+		return false
+	}
+	if len(w.events) == 0 {
+		return true
+	}
+	for _, e := range w.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the HMAC-SHA256 of the payload with the secret of the webhook, as sent in the
+// requests: "sha256=" followed by the hexadecimal digest
+func (w *Webhook) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.secret))
+	_, _ = mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is an event to be posted to a webhook. The payload is decided when the delivery
+// is created, so every attempt sends the same body
+type WebhookDelivery struct {
+	id             string
+	webhookID      string
+	event          string
+	torrentID      string
+	payload        []byte
+	status         DeliveryStatus
+	attempts       int
+	nextAttemptAt  time.Time
+	responseStatus int
+	lastError      string
+	createdAt      time.Time
+	deliveredAt    time.Time
+}
+
+// NewWebhookDelivery returns a delivery to be sent right away
+func NewWebhookDelivery(id string, webhookID string, event string, torrentID string, payload []byte, now time.Time) *WebhookDelivery {
+	return &WebhookDelivery{
+		id:            id,
+		webhookID:     webhookID,
+		event:         event,
+		torrentID:     torrentID,
+		payload:       payload,
+		status:        DeliveryPending,
+		nextAttemptAt: now,
+		createdAt:     now,
+	}
+}
+
+// RestoreWebhookDelivery returns a WebhookDelivery with all its state. Meant to be used by the repositories.
+func RestoreWebhookDelivery(
+	id string,
+	webhookID string,
+	event string,
+	torrentID string,
+	payload []byte,
+	status DeliveryStatus,
+	attempts int,
+	nextAttemptAt time.Time,
+	responseStatus int,
+	lastError string,
+	createdAt time.Time,
+	deliveredAt time.Time,
+) *WebhookDelivery {
+	d := NewWebhookDelivery(id, webhookID, event, torrentID, payload, createdAt)
+	d.status = status
+	d.attempts = attempts
+	d.nextAttemptAt = nextAttemptAt
+	d.responseStatus = responseStatus
+	d.lastError = lastError
+	d.deliveredAt = deliveredAt
+	return d
+}
+
+func (d *WebhookDelivery) ID() string {
+	return d.id
+}
+
+func (d *WebhookDelivery) WebhookID() string {
+	return d.webhookID
+}
+
+func (d *WebhookDelivery) Event() string {
+	return d.event
+}
+
+func (d *WebhookDelivery) TorrentID() string {
+	return d.torrentID
+}
+
+func (d *WebhookDelivery) Payload() []byte {
+	return d.payload
+}
+
+func (d *WebhookDelivery) Status() DeliveryStatus {
+	return d.status
+}
+
+// Attempts returns how many times the delivery has been sent
+func (d *WebhookDelivery) Attempts() int {
+	return d.attempts
+}
+
+// NextAttemptAt returns when the delivery is going to be sent, if it is pending
+func (d *WebhookDelivery) NextAttemptAt() time.Time {
+	return d.nextAttemptAt
+}
+
+// ResponseStatus returns the status code of the last response, 0 if there was none
+func (d *WebhookDelivery) ResponseStatus() int {
+	return d.responseStatus
+}
+
+func (d *WebhookDelivery) LastError() string {
+	return d.lastError
+}
+
+func (d *WebhookDelivery) CreatedAt() time.Time {
+	return d.createdAt
+}
+
+// DeliveredAt returns when the receiver accepted the delivery, zero if it has not
+func (d *WebhookDelivery) DeliveredAt() time.Time {
+	return d.deliveredAt
+}
+
+// IsDue returns true if the delivery has to be sent now
+func (d *WebhookDelivery) IsDue(now time.Time) bool {
+	return d.status == DeliveryPending && !now.Before(d.nextAttemptAt)
+}
+
+// Delivered records that the receiver accepted the delivery
+func (d *WebhookDelivery) Delivered(responseStatus int, now time.Time) {
+	d.attempts++
+	d.status = DeliveryDelivered
+	d.responseStatus = responseStatus
+	d.lastError = ""
+	d.deliveredAt = now
+}
+
+// Failed records an unsuccessful attempt. The delivery is sent again after the backoff of the
+// policy, or given up once it has been sent policy.MaxAttempts times
+func (d *WebhookDelivery) Failed(responseStatus int, reason error, policy RetryPolicy, now time.Time) {
+	d.attempts++
+	d.responseStatus = responseStatus
+	d.lastError = reason.Error()
+	if d.attempts >= policy.MaxAttempts {
+		d.status = DeliveryFailed
+		return
+	}
+	d.nextAttemptAt = now.Add(policy.Backoff(d.attempts))
+}
+
+// Abandon gives up the delivery without sending it again
+func (d *WebhookDelivery) Abandon(reason error) {
+	d.status = DeliveryFailed
+	d.lastError = reason.Error()
+}
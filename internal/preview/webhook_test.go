@@ -0,0 +1,111 @@
+package preview_test
+
+import (
+	"errors"
+	"net"
+	"prevtorrent/internal/preview"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWebhook_Invalid(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		url    string
+		secret string
+		events []string
+	}{
+		"relative url":  {url: "/hooks", secret: "s3cr3t"},
+		"ftp url":       {url: "ftp://example.com/hooks", secret: "s3cr3t"},
+		"no secret":     {url: "https://example.com/hooks"},
+		"unknown event": {url: "https://example.com/hooks", secret: "s3cr3t", events: []string{"torrent.deleted"}},
+		"localhost":     {url: "http://localhost:8080/hooks", secret: "s3cr3t"},
+		"loopback":      {url: "http://127.0.0.1/hooks", secret: "s3cr3t"},
+		"private":       {url: "http://192.168.1.10/hooks", secret: "s3cr3t"},
+		"link-local":    {url: "http://169.254.169.254/latest/meta-data", secret: "s3cr3t"},
+		"ipv6 loopback": {url: "http://[::1]/hooks", secret: "s3cr3t"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := preview.NewWebhook("e9c6", tt.url, tt.secret, "", tt.events, now)
+			require.True(t, errors.Is(err, preview.ErrInvalidWebhook))
+		})
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	assert.True(t, preview.IsPublicAddress(net.ParseIP("93.184.216.34")))
+	assert.True(t, preview.IsPublicAddress(net.ParseIP("2606:2800:220:1::")))
+	assert.False(t, preview.IsPublicAddress(net.ParseIP("10.1.2.3")))
+	assert.False(t, preview.IsPublicAddress(net.ParseIP("172.20.0.1")))
+	assert.False(t, preview.IsPublicAddress(net.ParseIP("fe80::1")))
+	assert.False(t, preview.IsPublicAddress(net.ParseIP("fd00::1")))
+	assert.False(t, preview.IsPublicAddress(net.ParseIP("::ffff:127.0.0.1")))
+	assert.False(t, preview.IsPublicAddress(net.ParseIP("224.0.0.1")))
+}
+
+func TestWebhook_Receives(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	torrentID := "cb84ccc10f296df72d6c40ba7a07c178a4323a14"
+
+	all, err := preview.NewWebhook("e9c6", "https://example.com/hooks", "s3cr3t", "", nil, now)
+	require.NoError(t, err)
+	assert.True(t, all.Receives(preview.WebhookImageExtracted, torrentID))
+
+	filtered, err := preview.NewWebhook("e9c6", "https://example.com/hooks", "s3cr3t",
+		"CB84CCC10F296DF72D6C40BA7A07C178A4323A14", []string{preview.WebhookPreviewCompleted}, now)
+	require.NoError(t, err)
+	assert.True(t, filtered.Receives(preview.WebhookPreviewCompleted, torrentID))
+	assert.False(t, filtered.Receives(preview.WebhookImageExtracted, torrentID))
+	assert.False(t, filtered.Receives(preview.WebhookPreviewCompleted, "3f8f219568b8b229581dddd7bc5a5e889e906a9b"))
+}
+
+func TestWebhook_Sign(t *testing.T) {
+	webhook := preview.RestoreWebhook("e9c6", "https://example.com/hooks", "It's a Secret to Everybody", "", nil, time.Time{})
+
+	assert.Equal(t,
+		"sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+		webhook.Sign([]byte("Hello, World!")))
+}
+
+func TestWebhookDelivery_Failed(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	policy := preview.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+	reason := errors.New("unexpected status 500")
+
+	delivery := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, "cb84", []byte("{}"), now)
+	assert.True(t, delivery.IsDue(now))
+
+	delivery.Failed(500, reason, policy, now)
+	assert.Equal(t, preview.DeliveryPending, delivery.Status())
+	assert.Equal(t, 1, delivery.Attempts())
+	assert.Equal(t, 500, delivery.ResponseStatus())
+	assert.False(t, delivery.IsDue(now))
+	assert.True(t, delivery.IsDue(now.Add(time.Minute)))
+
+	delivery.Failed(0, reason, policy, now.Add(time.Minute))
+	assert.Equal(t, preview.DeliveryFailed, delivery.Status())
+	assert.Equal(t, "unexpected status 500", delivery.LastError())
+	assert.False(t, delivery.IsDue(now.Add(time.Hour)))
+}
+
+func TestWebhookDelivery_Delivered(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	policy := preview.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+
+	delivery := preview.NewWebhookDelivery("d1", "e9c6", preview.WebhookTorrentCreated, "cb84", []byte("{}"), now)
+	delivery.Failed(0, errors.New("connection refused"), policy, now)
+	delivery.Delivered(204, now.Add(time.Minute))
+
+	assert.Equal(t, preview.DeliveryDelivered, delivery.Status())
+	assert.Equal(t, 2, delivery.Attempts())
+	assert.Equal(t, 204, delivery.ResponseStatus())
+	assert.Empty(t, delivery.LastError())
+	assert.Equal(t, now.Add(time.Minute), delivery.DeliveredAt())
+	assert.False(t, delivery.IsDue(now.Add(time.Hour)))
+}